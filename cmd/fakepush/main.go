@@ -0,0 +1,36 @@
+// Command fakepush is a local stand-in for a Web Push service and the
+// browsers subscribed to it. It creates subscriptions, accepts VAPID-signed
+// messages for them, decrypts them and lists them as JSON.
+//
+// Run it, create a subscription and register it with the API, started with
+// ALLOW_LOCAL_ENDPOINTS=true so that it accepts plain HTTP local endpoints:
+//
+//	curl -X POST localhost:8026/subscriptions \
+//		-d '{"application_server_key": "<GET /api/v1/push/key>"}'
+//
+// then read the messages pushed to it at http://localhost:8026/messages.
+// DELETE /subscriptions?endpoint=... makes a subscription answer 410 Gone.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"todo/internal/webpush/fakepush"
+)
+
+func main() {
+	pushAddr := flag.String("push", ":8027", "listen address of the push service")
+	controlAddr := flag.String("http", ":8026", "HTTP listen address for subscriptions and messages")
+	flag.Parse()
+
+	server, err := fakepush.Start(*pushAddr)
+	if err != nil {
+		log.Fatal("Failed to start push service:", err)
+	}
+	log.Printf("Fake push service listening on %s", server.URL())
+
+	log.Printf("Subscriptions and messages served on %s", *controlAddr)
+	log.Fatal(http.ListenAndServe(*controlAddr, http.HandlerFunc(server.ServeControl)))
+}
@@ -0,0 +1,28 @@
+// Command fakes3 is a local stand-in for an S3-compatible service. It keeps
+// objects in memory, checks the AWS Signature Version 4 of every request and
+// supports the requests made by storage.S3Store: PUT, GET (with Range), HEAD
+// and DELETE on path-style object URLs.
+//
+// Run it and point the API at it with:
+//
+//	BLOB_STORE=s3 S3_ENDPOINT=http://localhost:9000 S3_BUCKET=attachments \
+//	S3_ACCESS_KEY_ID=test S3_SECRET_ACCESS_KEY=test
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"todo/internal/storage/fakes3"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	accessKey := flag.String("access-key", "test", "access key ID requests must be signed with")
+	secretKey := flag.String("secret-key", "test", "secret access key requests must be signed with")
+	flag.Parse()
+
+	log.Printf("Fake S3 listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, fakes3.New(*accessKey, *secretKey)))
+}
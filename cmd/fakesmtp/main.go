@@ -0,0 +1,48 @@
+// Command fakesmtp is a local stand-in for an SMTP server. It keeps the
+// messages it receives in memory and lists them as JSON over HTTP, so emails
+// can be checked without sending them anywhere.
+//
+// Run it and point the API at it with:
+//
+//	MAILER=smtp SMTP_HOST=localhost SMTP_PORT=2525 SMTP_SECURITY=none \
+//	SMTP_FROM="Todo <todo@example.com>"
+//
+// then read the messages at http://localhost:8025/messages, or clear them
+// with DELETE /messages.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+
+	"todo/internal/mailer/fakesmtp"
+)
+
+func main() {
+	smtpAddr := flag.String("smtp", ":2525", "SMTP listen address")
+	httpAddr := flag.String("http", ":8025", "HTTP listen address for reading messages")
+	flag.Parse()
+
+	server, err := fakesmtp.Start(*smtpAddr)
+	if err != nil {
+		log.Fatal("Failed to start SMTP server:", err)
+	}
+	log.Printf("Fake SMTP listening on %s", server.Addr())
+
+	http.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(server.Messages())
+		case http.MethodDelete:
+			server.Reset()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		}
+	})
+	log.Printf("Messages served on %s/messages", *httpAddr)
+	log.Fatal(http.ListenAndServe(*httpAddr, nil))
+}
@@ -3,13 +3,17 @@ package main
 import (
 	"log"
 	"net/http"
+	_ "time/tzdata" // timezones for reports, even without system tzdata
 
 	"todo/internal/auth"
 	"todo/internal/database"
 	"todo/internal/handlers"
+	"todo/internal/mailer"
 	"todo/internal/models"
 	"todo/internal/routes"
 	"todo/internal/services"
+	"todo/internal/storage"
+	"todo/internal/webpush"
 )
 
 func main() {
@@ -18,28 +22,194 @@ func main() {
 	}
 	defer database.Close()
 
-	// Create tables in correct order (users first, then todos, then expired_tokens)
+	// Create tables in correct order (users first, then organizations, lists, todos and expired_tokens)
 	if err := auth.CreateUsersTable(); err != nil {
 		log.Fatal("Failed to create users table:", err)
 	}
 
+	if err := models.CreateOrganizationsTables(); err != nil {
+		log.Fatal("Failed to create organizations tables:", err)
+	}
+
+	if err := models.CreateListsTable(); err != nil {
+		log.Fatal("Failed to create lists table:", err)
+	}
+
+	if err := models.CreateWorkflowTables(); err != nil {
+		log.Fatal("Failed to create workflow tables:", err)
+	}
+
+	if err := models.CreateSharingTables(); err != nil {
+		log.Fatal("Failed to create sharing tables:", err)
+	}
+
 	if err := models.CreateTodosTable(); err != nil {
 		log.Fatal("Failed to create todos table:", err)
 	}
 
+	if err := models.CreateTodoTagsTable(); err != nil {
+		log.Fatal("Failed to create todo tags table:", err)
+	}
+
+	if err := models.CreateAssignmentTables(); err != nil {
+		log.Fatal("Failed to create assignment tables:", err)
+	}
+
+	if err := models.CreateCommentTables(); err != nil {
+		log.Fatal("Failed to create comment tables:", err)
+	}
+
+	if err := models.CreateAttachmentsTable(); err != nil {
+		log.Fatal("Failed to create attachments table:", err)
+	}
+
+	if err := models.CreateTimeEntriesTable(); err != nil {
+		log.Fatal("Failed to create time entries table:", err)
+	}
+
+	if err := models.CreateSprintTables(); err != nil {
+		log.Fatal("Failed to create sprint tables:", err)
+	}
+
+	if err := models.CreateTemplateTables(); err != nil {
+		log.Fatal("Failed to create template tables:", err)
+	}
+
+	if err := models.CreateSmartListsTable(); err != nil {
+		log.Fatal("Failed to create smart lists table:", err)
+	}
+
+	if err := models.CreateRuleTables(); err != nil {
+		log.Fatal("Failed to create rule tables:", err)
+	}
+
+	if err := models.CreateArchivePoliciesTable(); err != nil {
+		log.Fatal("Failed to create archive policies table:", err)
+	}
+
+	if err := models.CreateTodoOperationsTable(); err != nil {
+		log.Fatal("Failed to create todo operations table:", err)
+	}
+
+	if err := models.CreateActivitiesTable(); err != nil {
+		log.Fatal("Failed to create activities table:", err)
+	}
+
+	if err := models.CreateNotificationTables(); err != nil {
+		log.Fatal("Failed to create notification tables:", err)
+	}
+
+	if err := models.CreateEmailTables(); err != nil {
+		log.Fatal("Failed to create email tables:", err)
+	}
+
+	if err := models.CreatePushTables(); err != nil {
+		log.Fatal("Failed to create push tables:", err)
+	}
+
+	if err := models.CreateWebhookTables(); err != nil {
+		log.Fatal("Failed to create webhook tables:", err)
+	}
+
+	if err := models.CreateOutboxTables(); err != nil {
+		log.Fatal("Failed to create outbox tables:", err)
+	}
+
 	if err := auth.CreateExpiredTokensTable(); err != nil {
 		log.Fatal("Failed to create expired_tokens table:", err)
 	}
 
+	blobStore, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatal("Failed to initialize blob store:", err)
+	}
+
+	emailMailer, err := mailer.NewFromEnv()
+	if err != nil {
+		log.Fatal("Failed to initialize mailer:", err)
+	}
+
+	pushClient, err := webpush.NewClientFromEnv()
+	if err != nil {
+		log.Fatal("Failed to initialize Web Push:", err)
+	}
+
+	outboxSinks, err := services.OutboxSinksFromEnv(services.NewEventBus())
+	if err != nil {
+		log.Fatal("Failed to initialize outbox sinks:", err)
+	}
+
 	// Initialize services
 	todoService := services.NewTodoService()
+	listService := services.NewListService()
+	sharingService := services.NewSharingService()
+	commentService := services.NewCommentService()
+	attachmentService := services.NewAttachmentService(blobStore)
+	timeService := services.NewTimeService()
+	sprintService := services.NewSprintService()
+	statsService := services.NewStatsService()
+	templateService := services.NewTemplateService()
+	duplicateService := services.NewDuplicateService()
+	smartListService := services.NewSmartListService()
+	ruleService := services.NewRuleService()
+	activityService := services.NewActivityService()
+	notificationService := services.NewNotificationService()
+	emailService := services.NewEmailService(emailMailer)
+	pushService := services.NewPushService(pushClient)
+	webhookService := services.NewWebhookService()
+	outboxRelay := services.NewOutboxRelay(outboxSinks...)
+	orgService := services.NewOrgService()
 	authService := services.NewAuthService()
 
 	// Initialize handlers
-	todoHandler := handlers.NewTodoHandler(todoService)
-	authHandler := handlers.NewHandler(authService)
+	h := &routes.Handlers{
+		Todo:         handlers.NewTodoHandler(todoService),
+		List:         handlers.NewListHandler(listService),
+		Sharing:      handlers.NewSharingHandler(sharingService),
+		Comment:      handlers.NewCommentHandler(commentService),
+		Attachment:   handlers.NewAttachmentHandler(attachmentService),
+		Time:         handlers.NewTimeHandler(timeService),
+		Sprint:       handlers.NewSprintHandler(sprintService),
+		Stats:        handlers.NewStatsHandler(statsService),
+		Template:     handlers.NewTemplateHandler(templateService),
+		Duplicate:    handlers.NewDuplicateHandler(duplicateService),
+		SmartList:    handlers.NewSmartListHandler(smartListService),
+		Rule:         handlers.NewRuleHandler(ruleService),
+		Activity:     handlers.NewActivityHandler(activityService),
+		Notification: handlers.NewNotificationHandler(notificationService),
+		Email:        handlers.NewEmailHandler(emailService),
+		Push:         handlers.NewPushHandler(pushService),
+		Webhook:      handlers.NewWebhookHandler(webhookService),
+		Org:          handlers.NewOrgHandler(orgService),
+		Auth:         handlers.NewHandler(authService),
+	}
+
+	router := routes.SetupRouter(h, authService, orgService)
+
+	// Remove blobs of deleted attachments and todos in the background
+	go attachmentService.RunGarbageCollector()
+
+	// Bring back snoozed todos when their snooze ends
+	go todoService.RunSnoozeSweeper()
+
+	// Archive todos completed longer ago than their owner's policy allows
+	go todoService.RunArchiver()
+
+	// Run the rules of todos that have been overdue long enough
+	go ruleService.RunOverdueSweeper()
+
+	// Queue reminders and digests and deliver queued emails
+	go emailService.RunMailer()
+
+	// Queue push reminders and deliver queued push messages
+	go pushService.RunPusher()
+
+	// Publish the todo events of the outbox to the activity feed,
+	// notifications and webhooks
+	go outboxRelay.RunRelay()
 
-	router := routes.SetupRouter(todoHandler, authHandler, authService)
+	// Deliver todo events to webhooks
+	go webhookService.RunDeliverer()
 
 	log.Println("Server starting on :8080")
 	log.Fatal(http.ListenAndServe(":8080", router))
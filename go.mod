@@ -6,12 +6,10 @@ toolchain go1.24.4
 
 require (
 	github.com/go-sql-driver/mysql v1.9.3
+	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/gorilla/mux v1.8.1
 	github.com/joho/godotenv v1.5.1
 	golang.org/x/crypto v0.39.0
 )
 
-require (
-	filippo.io/edwards25519 v1.1.0 // indirect
-	github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
-)
+require filippo.io/edwards25519 v1.1.0 // indirect
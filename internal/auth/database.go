@@ -2,6 +2,9 @@ package auth
 
 import "todo/internal/database"
 
+// CreateUsersTable creates the users table. A user can belong to several
+// organizations; default_org_id is the one clients open first. timezone is an
+// IANA name used for day boundaries in reports.
 func CreateUsersTable() error {
 	query := `
 	CREATE TABLE IF NOT EXISTS users (
@@ -9,12 +12,19 @@ func CreateUsersTable() error {
 		username VARCHAR(255) NOT NULL UNIQUE,
 		email VARCHAR(255) NOT NULL UNIQUE,
 		password VARCHAR(255) NOT NULL,
+		default_org_id INT NULL,
+		timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
 	)`
 
-	_, err := database.DB.Exec(query)
-	return err
+	if _, err := database.DB.Exec(query); err != nil {
+		return err
+	}
+	if err := database.AddColumnIfNotExists("users", "default_org_id", "INT NULL AFTER password"); err != nil {
+		return err
+	}
+	return database.AddColumnIfNotExists("users", "timezone", "VARCHAR(64) NOT NULL DEFAULT 'UTC' AFTER default_org_id")
 }
 
 func CreateExpiredTokensTable() error {
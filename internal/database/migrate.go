@@ -0,0 +1,101 @@
+package database
+
+import "fmt"
+
+// AddColumnIfNotExists adds a column to an existing table when it is missing.
+// CREATE TABLE IF NOT EXISTS leaves tables created by older versions untouched,
+// so new columns have to be added explicitly.
+func AddColumnIfNotExists(table, column, definition string) error {
+	var count int
+	err := DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`,
+		table, column).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("error checking column %s.%s: %v", table, column, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("error adding column %s.%s: %v", table, column, err)
+	}
+	return nil
+}
+
+// AddIndexIfNotExists adds an index to an existing table when it is missing.
+// definition is everything after the index name, e.g. "(user_id, due_date)".
+func AddIndexIfNotExists(table, index, definition string) error {
+	exists, err := indexExists(table, index)
+	if err != nil || exists {
+		return err
+	}
+
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD INDEX %s %s", table, index, definition)); err != nil {
+		return fmt.Errorf("error adding index %s.%s: %v", table, index, err)
+	}
+	return nil
+}
+
+func indexExists(table, index string) (bool, error) {
+	var count int
+	err := DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?`,
+		table, index).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("error checking index %s.%s: %v", table, index, err)
+	}
+	return count > 0, nil
+}
+
+// AddUniqueKeyIfNotExists adds a unique key to an existing table when it is missing
+func AddUniqueKeyIfNotExists(table, index, definition string) error {
+	exists, err := indexExists(table, index)
+	if err != nil || exists {
+		return err
+	}
+
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD UNIQUE KEY %s %s", table, index, definition)); err != nil {
+		return fmt.Errorf("error adding unique key %s.%s: %v", table, index, err)
+	}
+	return nil
+}
+
+// DropIndexIfExists drops an index that has been replaced by a newer one
+func DropIndexIfExists(table, index string) error {
+	exists, err := indexExists(table, index)
+	if err != nil || !exists {
+		return err
+	}
+
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s DROP INDEX %s", table, index)); err != nil {
+		return fmt.Errorf("error dropping index %s.%s: %v", table, index, err)
+	}
+	return nil
+}
+
+// MakeColumnNullable allows NULL in a column created as NOT NULL. definition
+// is the column type without NOT NULL, e.g. "INT NULL".
+func MakeColumnNullable(table, column, definition string) error {
+	var nullable string
+	err := DB.QueryRow(`
+		SELECT IS_NULLABLE
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`,
+		table, column).Scan(&nullable)
+	if err != nil {
+		return fmt.Errorf("error checking column %s.%s: %v", table, column, err)
+	}
+	if nullable == "YES" {
+		return nil
+	}
+
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("error changing column %s.%s: %v", table, column, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"todo/internal/middleware"
+	"todo/internal/services"
+	"todo/pkg/response"
+)
+
+type ActivityHandler struct {
+	service *services.ActivityService
+}
+
+func NewActivityHandler(service *services.ActivityService) *ActivityHandler {
+	return &ActivityHandler{
+		service: service,
+	}
+}
+
+// scoped returns the service limited to the organization of an org-scoped
+// route, or to the personal workspace otherwise
+func (h *ActivityHandler) scoped(r *http.Request) *services.ActivityService {
+	if org, ok := middleware.GetOrgFromContext(r.Context()); ok {
+		return h.service.ForOrg(org.OrgID)
+	}
+	return h.service
+}
+
+// GetActivity returns a page of the activity feed, optionally filtered by
+// list_id, todo_id and actor_id (a user ID or me)
+func (h *ActivityHandler) GetActivity(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var filter services.ActivityFilter
+	if listID := r.URL.Query().Get("list_id"); listID != "" {
+		id, err := strconv.Atoi(listID)
+		if err != nil || id <= 0 {
+			response.Error(w, "Invalid list_id: must be a list ID", http.StatusBadRequest)
+			return
+		}
+		filter.ListID = id
+	}
+	if todoID := r.URL.Query().Get("todo_id"); todoID != "" {
+		id, err := strconv.Atoi(todoID)
+		if err != nil || id <= 0 {
+			response.Error(w, "Invalid todo_id: must be a todo ID", http.StatusBadRequest)
+			return
+		}
+		filter.TodoID = id
+	}
+	switch actorID := r.URL.Query().Get("actor_id"); actorID {
+	case "":
+	case "me":
+		filter.ActorID = user.ID
+	default:
+		id, err := strconv.Atoi(actorID)
+		if err != nil || id <= 0 {
+			response.Error(w, "Invalid actor_id: must be me or a user ID", http.StatusBadRequest)
+			return
+		}
+		filter.ActorID = id
+	}
+	page, pageSize, ok := pageParams(w, r, services.DefaultActivityPageSize)
+	if !ok {
+		return
+	}
+
+	activity, err := h.scoped(r).GetActivity(user.ID, filter, page, pageSize)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Activity fetched successfully", activity, http.StatusOK)
+}
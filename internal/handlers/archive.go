@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"todo/internal/middleware"
+	"todo/internal/models"
+	"todo/internal/services"
+	"todo/pkg/response"
+
+	"github.com/gorilla/mux"
+)
+
+// GetArchive returns a page of archived todos, most recently archived first
+func (h *TodoHandler) GetArchive(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	page, pageSize, ok := pageParams(w, r, services.DefaultArchivePageSize)
+	if !ok {
+		return
+	}
+
+	archive, err := h.scoped(r).GetArchive(user.ID, page, pageSize)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Archived todos fetched successfully", archive, http.StatusOK)
+}
+
+// RestoreTodo brings an archived todo back at the end of the manual order
+func (h *TodoHandler) RestoreTodo(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	todo, err := h.scoped(r).Restore(id, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Todo restored successfully", todo, http.StatusOK)
+}
+
+func (h *TodoHandler) GetArchivePolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	policy, err := h.scoped(r).GetArchivePolicy(user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response.Success(w, "Archive policy fetched successfully", policy, http.StatusOK)
+}
+
+func (h *TodoHandler) UpdateArchivePolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var policy models.ArchivePolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	updatedPolicy, err := h.scoped(r).UpdateArchivePolicy(&policy, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response.Success(w, "Archive policy updated successfully", updatedPolicy, http.StatusOK)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"todo/internal/middleware"
+	"todo/internal/models"
+	"todo/pkg/response"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *TodoHandler) GetAssignees(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	assignees, err := h.scoped(r).GetAssignees(id, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Assignees fetched successfully", assignees, http.StatusOK)
+}
+
+// SetAssignees replaces the assignees of a todo; an empty list unassigns everyone
+func (h *TodoHandler) SetAssignees(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.AssignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	assignees, err := h.scoped(r).SetAssignees(id, req.UserIDs, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Assignees updated successfully", assignees, http.StatusOK)
+}
+
+func (h *TodoHandler) AddAssignees(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.AssignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	assignees, err := h.scoped(r).Assign(id, req.UserIDs, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Users assigned successfully", assignees, http.StatusOK)
+}
+
+func (h *TodoHandler) RemoveAssignee(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	assigneeID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		response.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.scoped(r).Unassign(id, assigneeID, user.ID); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "User unassigned successfully", nil, http.StatusOK)
+}
+
+func (h *TodoHandler) GetAssignmentHistory(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.scoped(r).GetAssignmentHistory(id, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Assignment history fetched successfully", events, http.StatusOK)
+}
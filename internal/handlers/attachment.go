@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"todo/internal/middleware"
+	"todo/internal/services"
+	"todo/pkg/response"
+
+	"github.com/gorilla/mux"
+)
+
+type AttachmentHandler struct {
+	service *services.AttachmentService
+}
+
+func NewAttachmentHandler(service *services.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{
+		service: service,
+	}
+}
+
+// scoped returns the service limited to the organization of an org-scoped
+// route, or to the personal workspace otherwise
+func (h *AttachmentHandler) scoped(r *http.Request) *services.AttachmentService {
+	if org, ok := middleware.GetOrgFromContext(r.Context()); ok {
+		return h.service.ForOrg(org.OrgID)
+	}
+	return h.service
+}
+
+func (h *AttachmentHandler) GetAttachments(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	attachments, err := h.scoped(r).GetAll(todoID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Attachments fetched successfully", attachments, http.StatusOK)
+}
+
+// UploadAttachment accepts a multipart/form-data request with the file in the
+// "file" field
+func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	// Leave room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, h.service.MaxSize()+1<<20)
+	if err := r.ParseMultipartForm(8 << 20); err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			response.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		} else {
+			response.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		response.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	attachment, err := h.scoped(r).Upload(todoID, header.Filename, file, header.Size, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Attachment uploaded successfully", attachment, http.StatusCreated)
+}
+
+// DownloadAttachment streams the file, honouring Range and conditional requests
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, attachmentID, ok := attachmentIDs(w, r)
+	if !ok {
+		return
+	}
+
+	attachment, blob, err := h.scoped(r).Open(todoID, attachmentID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, attachment.Filename, attachment.CreatedAt, blob)
+}
+
+func (h *AttachmentHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, attachmentID, ok := attachmentIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).Delete(todoID, attachmentID, user.ID); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Attachment deleted successfully", nil, http.StatusOK)
+}
+
+func (h *AttachmentHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	usage, err := h.service.GetUsage(user.ID)
+	if err != nil {
+		response.Error(w, "Failed to fetch storage usage", http.StatusInternalServerError)
+		return
+	}
+	response.Success(w, "Storage usage fetched successfully", usage, http.StatusOK)
+}
+
+func attachmentIDs(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	attachmentID, err := strconv.Atoi(mux.Vars(r)["attachmentId"])
+	if err != nil {
+		response.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return todoID, attachmentID, true
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"todo/internal/middleware"
+	"todo/internal/models"
+	"todo/internal/services"
+	"todo/pkg/response"
+
+	"github.com/gorilla/mux"
+)
+
+type CommentHandler struct {
+	service *services.CommentService
+}
+
+func NewCommentHandler(service *services.CommentService) *CommentHandler {
+	return &CommentHandler{
+		service: service,
+	}
+}
+
+// scoped returns the service limited to the organization of an org-scoped
+// route, or to the personal workspace otherwise
+func (h *CommentHandler) scoped(r *http.Request) *services.CommentService {
+	if org, ok := middleware.GetOrgFromContext(r.Context()); ok {
+		return h.service.ForOrg(org.OrgID)
+	}
+	return h.service
+}
+
+func (h *CommentHandler) GetComments(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	page, pageSize, ok := pageParams(w, r, services.DefaultCommentPageSize)
+	if !ok {
+		return
+	}
+
+	comments, err := h.scoped(r).GetComments(todoID, user.ID, page, pageSize)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Comments fetched successfully", comments, http.StatusOK)
+}
+
+func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := h.scoped(r).Create(todoID, &req, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Comment created successfully", comment, http.StatusCreated)
+}
+
+func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, commentID, ok := commentIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := h.scoped(r).Update(todoID, commentID, &req, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Comment updated successfully", comment, http.StatusOK)
+}
+
+func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, commentID, ok := commentIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).Delete(todoID, commentID, user.ID); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Comment deleted successfully", nil, http.StatusOK)
+}
+
+func (h *CommentHandler) GetCommentHistory(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, commentID, ok := commentIDs(w, r)
+	if !ok {
+		return
+	}
+
+	edits, err := h.scoped(r).GetHistory(todoID, commentID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Comment history fetched successfully", edits, http.StatusOK)
+}
+
+func commentIDs(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	commentID, err := strconv.Atoi(mux.Vars(r)["commentId"])
+	if err != nil {
+		response.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return todoID, commentID, true
+}
+
+// pageParams reads the page and page_size query parameters, defaulting to the
+// first page of defaultSize items
+func pageParams(w http.ResponseWriter, r *http.Request, defaultSize int) (int, int, bool) {
+	page, pageSize := 1, defaultSize
+	var err error
+	if v := r.URL.Query().Get("page"); v != "" {
+		if page, err = strconv.Atoi(v); err != nil {
+			response.Error(w, "Invalid page", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	if v := r.URL.Query().Get("page_size"); v != "" {
+		if pageSize, err = strconv.Atoi(v); err != nil {
+			response.Error(w, "Invalid page_size", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	return page, pageSize, true
+}
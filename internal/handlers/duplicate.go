@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"todo/internal/middleware"
+	"todo/internal/models"
+	"todo/internal/services"
+	"todo/pkg/response"
+
+	"github.com/gorilla/mux"
+)
+
+type DuplicateHandler struct {
+	service *services.DuplicateService
+}
+
+func NewDuplicateHandler(service *services.DuplicateService) *DuplicateHandler {
+	return &DuplicateHandler{
+		service: service,
+	}
+}
+
+// scoped returns the service limited to the organization of an org-scoped
+// route, or to the personal workspace otherwise
+func (h *DuplicateHandler) scoped(r *http.Request) *services.DuplicateService {
+	if org, ok := middleware.GetOrgFromContext(r.Context()); ok {
+		return h.service.ForOrg(org.OrgID)
+	}
+	return h.service
+}
+
+// DuplicateTodo copies a todo. The body is optional.
+func (h *DuplicateHandler) DuplicateTodo(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.DuplicateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	todo, err := h.scoped(r).DuplicateTodo(id, &req, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Todo duplicated successfully", todo, http.StatusCreated)
+}
+
+// DuplicateList copies a list, optionally with its todos. The body is
+// optional.
+func (h *DuplicateHandler) DuplicateList(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.DuplicateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.scoped(r).DuplicateList(id, &req, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "List duplicated successfully", result, http.StatusCreated)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"todo/internal/middleware"
+	"todo/internal/models"
+	"todo/internal/services"
+	"todo/pkg/response"
+)
+
+type EmailHandler struct {
+	service *services.EmailService
+}
+
+func NewEmailHandler(service *services.EmailService) *EmailHandler {
+	return &EmailHandler{
+		service: service,
+	}
+}
+
+func (h *EmailHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	prefs, err := h.service.GetPreferences(user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Email preferences fetched successfully", prefs, http.StatusOK)
+}
+
+func (h *EmailHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.EmailPreferences
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := h.service.UpdatePreferences(user.ID, &req)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Email preferences updated successfully", prefs, http.StatusOK)
+}
+
+// unsubscribePage is shown by the unsubscribe link of emails. Its form posts
+// to the same URL, token included, like the one-click POST of mail clients.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body style="font-family: sans-serif; max-width: 480px; margin: 48px auto;">
+{{if .Error}}
+  <p>{{.Error}}</p>
+{{else if .Done}}
+  <p>You are unsubscribed from all emails. You can turn them back on in your email settings.</p>
+{{else}}
+  <p>Stop all reminder and digest emails?</p>
+  <form method="post">
+    <input type="hidden" name="List-Unsubscribe" value="One-Click">
+    <button type="submit">Unsubscribe</button>
+  </form>
+{{end}}
+</body>
+</html>
+`))
+
+type unsubscribePageData struct {
+	Error string
+	Done  bool
+}
+
+// ConfirmUnsubscribe serves the unsubscribe link of emails: a page asking to
+// confirm. Links are opened by mail scanners and previews too, so following
+// one must not unsubscribe. It is not authenticated: the token identifies the
+// user.
+func (h *EmailHandler) ConfirmUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	status, data := http.StatusOK, unsubscribePageData{}
+	if err := h.service.CheckUnsubscribeToken(r.URL.Query().Get("token")); err != nil {
+		status, data.Error = errorStatus(err, http.StatusBadRequest), err.Error()
+	}
+	renderUnsubscribePage(w, status, data)
+}
+
+// Unsubscribe serves the confirmation of the unsubscribe page, and the
+// one-click POST of mail clients (RFC 8058). It is not authenticated: the
+// token identifies the user.
+func (h *EmailHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	page := strings.Contains(r.Header.Get("Accept"), "text/html")
+	if err := h.service.Unsubscribe(r.URL.Query().Get("token")); err != nil {
+		if page {
+			renderUnsubscribePage(w, errorStatus(err, http.StatusBadRequest), unsubscribePageData{Error: err.Error()})
+			return
+		}
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	if page {
+		renderUnsubscribePage(w, http.StatusOK, unsubscribePageData{Done: true})
+		return
+	}
+	response.Success(w, "Unsubscribed from all emails", nil, http.StatusOK)
+}
+
+func renderUnsubscribePage(w http.ResponseWriter, status int, data unsubscribePageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	unsubscribePage.Execute(w, data)
+}
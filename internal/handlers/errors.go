@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// errorStatus maps the errors shared by several services to an HTTP status
+// code, falling back to the given status for anything else
+func errorStatus(err error, fallback int) int {
+	msg := err.Error()
+	switch {
+	case strings.HasSuffix(msg, "not found"):
+		return http.StatusNotFound
+	case msg == "access denied":
+		return http.StatusForbidden
+	case strings.HasPrefix(msg, "wip limit reached"),
+		strings.Contains(msg, "still has todos"),
+		strings.Contains(msg, "already"),
+		strings.HasSuffix(msg, "archived"),
+		strings.HasPrefix(msg, "conflict:"),
+		strings.HasPrefix(msg, "nothing to"):
+		return http.StatusConflict
+	case strings.HasPrefix(msg, "file too large"),
+		strings.HasPrefix(msg, "storage quota exceeded"),
+		strings.HasPrefix(msg, "list has too many todos"):
+		return http.StatusRequestEntityTooLarge
+	}
+	return fallback
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"todo/internal/middleware"
 	"todo/internal/models"
 	"todo/internal/services"
 	"todo/pkg/response"
@@ -135,3 +136,70 @@ func (h *Handler) ExtractTokenFromRequest(r *http.Request) (string, error) {
 
 	return token, nil
 }
+
+// Me returns the authenticated user and the organizations they belong to
+func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	me, err := h.service.GetMe(user.ID)
+	if err != nil {
+		response.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+	response.Success(w, "User fetched successfully", me, http.StatusOK)
+}
+
+// SetDefaultOrg chooses the organization clients open first; null selects
+// the personal workspace
+func (h *Handler) SetDefaultOrg(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		OrgID *int `json:"org_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	updatedUser, err := h.service.SetDefaultOrg(user.ID, req.OrgID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Default organization updated successfully", updatedUser, http.StatusOK)
+}
+
+// SetTimezone sets the timezone used for the user's reports
+func (h *Handler) SetTimezone(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Timezone string `json:"timezone"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	updatedUser, err := h.service.SetTimezone(user.ID, req.Timezone)
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response.Success(w, "Timezone updated successfully", updatedUser, http.StatusOK)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	"todo/internal/middleware"
+	"todo/pkg/response"
+)
+
+// Undo reverts the user's latest todo operation. Conflicting later changes
+// are reported with 409 Conflict.
+func (h *TodoHandler) Undo(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	operation, err := h.scoped(r).Undo(user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Operation undone successfully", operation, http.StatusOK)
+}
+
+// Redo applies again the operation undone last
+func (h *TodoHandler) Redo(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	operation, err := h.scoped(r).Redo(user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Operation redone successfully", operation, http.StatusOK)
+}
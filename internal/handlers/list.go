@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"todo/internal/middleware"
+	"todo/internal/models"
+	"todo/internal/services"
+	"todo/pkg/response"
+
+	"github.com/gorilla/mux"
+)
+
+type ListHandler struct {
+	service *services.ListService
+}
+
+func NewListHandler(service *services.ListService) *ListHandler {
+	return &ListHandler{
+		service: service,
+	}
+}
+
+// scoped returns the service limited to the organization of an org-scoped
+// route, or to the personal workspace otherwise
+func (h *ListHandler) scoped(r *http.Request) *services.ListService {
+	if org, ok := middleware.GetOrgFromContext(r.Context()); ok {
+		return h.service.ForOrg(org.OrgID)
+	}
+	return h.service
+}
+
+func (h *ListHandler) GetLists(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	lists, err := h.scoped(r).GetAll(user.ID)
+	if err != nil {
+		response.Error(w, "Failed to fetch lists", http.StatusInternalServerError)
+		return
+	}
+	response.Success(w, "Lists fetched successfully", lists, http.StatusOK)
+}
+
+func (h *ListHandler) GetList(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.scoped(r).GetByID(id, user.ID)
+	if err != nil {
+		if err.Error() == "list not found" {
+			response.Error(w, "List not found", http.StatusNotFound)
+		} else {
+			response.Error(w, "Failed to fetch list", http.StatusInternalServerError)
+		}
+		return
+	}
+	response.Success(w, "List fetched successfully", list, http.StatusOK)
+}
+
+func (h *ListHandler) CreateList(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var list models.List
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	createdList, err := h.scoped(r).Create(&list, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response.Success(w, "List created successfully", createdList, http.StatusCreated)
+}
+
+func (h *ListHandler) UpdateList(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	var list models.List
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	updatedList, err := h.scoped(r).Update(id, &list, user.ID)
+	if err != nil {
+		if err.Error() == "list not found" {
+			response.Error(w, "List not found", http.StatusNotFound)
+		} else {
+			response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		}
+		return
+	}
+	response.Success(w, "List updated successfully", updatedList, http.StatusOK)
+}
+
+func (h *ListHandler) DeleteList(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.scoped(r).Delete(id, user.ID); err != nil {
+		if err.Error() == "list not found" {
+			response.Error(w, "List not found", http.StatusNotFound)
+		} else if err.Error() == "access denied" {
+			response.Error(w, "Access denied", http.StatusForbidden)
+		} else {
+			response.Error(w, "Failed to delete list", http.StatusInternalServerError)
+		}
+		return
+	}
+	response.Success(w, "List deleted successfully", nil, http.StatusOK)
+}
+
+func (h *ListHandler) GetWorkflow(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	workflow, err := h.scoped(r).GetWorkflow(id, user.ID)
+	if err != nil {
+		if err.Error() == "list not found" {
+			response.Error(w, "List not found", http.StatusNotFound)
+		} else {
+			response.Error(w, "Failed to fetch workflow", http.StatusInternalServerError)
+		}
+		return
+	}
+	response.Success(w, "Workflow fetched successfully", workflow, http.StatusOK)
+}
+
+func (h *ListHandler) UpdateWorkflow(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	var workflow models.Workflow
+	if err := json.NewDecoder(r.Body).Decode(&workflow); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	updatedWorkflow, err := h.scoped(r).SetWorkflow(id, &workflow, user.ID)
+	if err != nil {
+		if err.Error() == "list not found" {
+			response.Error(w, "List not found", http.StatusNotFound)
+		} else {
+			response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		}
+		return
+	}
+	response.Success(w, "Workflow updated successfully", updatedWorkflow, http.StatusOK)
+}
+
+func (h *ListHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	board, err := h.scoped(r).GetBoard(id, user.ID)
+	if err != nil {
+		if err.Error() == "list not found" {
+			response.Error(w, "List not found", http.StatusNotFound)
+		} else {
+			response.Error(w, "Failed to fetch board", http.StatusInternalServerError)
+		}
+		return
+	}
+	response.Success(w, "Board fetched successfully", board, http.StatusOK)
+}
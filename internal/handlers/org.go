@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"todo/internal/middleware"
+	"todo/internal/models"
+	"todo/internal/services"
+	"todo/pkg/response"
+
+	"github.com/gorilla/mux"
+)
+
+type OrgHandler struct {
+	service *services.OrgService
+}
+
+func NewOrgHandler(service *services.OrgService) *OrgHandler {
+	return &OrgHandler{
+		service: service,
+	}
+}
+
+func (h *OrgHandler) GetOrgs(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	orgs, err := h.service.GetAll(user.ID)
+	if err != nil {
+		response.Error(w, "Failed to fetch organizations", http.StatusInternalServerError)
+		return
+	}
+	response.Success(w, "Organizations fetched successfully", orgs, http.StatusOK)
+}
+
+func (h *OrgHandler) CreateOrg(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var org models.Organization
+	if err := json.NewDecoder(r.Body).Decode(&org); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	createdOrg, err := h.service.Create(&org, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Organization created successfully", createdOrg, http.StatusCreated)
+}
+
+// The handlers below serve org-scoped routes, where OrgMiddleware has already
+// resolved the organization and checked membership.
+
+func (h *OrgHandler) GetOrg(w http.ResponseWriter, r *http.Request) {
+	user, org, ok := userAndOrg(w, r)
+	if !ok {
+		return
+	}
+
+	organization, err := h.service.GetByID(org.OrgID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Organization fetched successfully", organization, http.StatusOK)
+}
+
+func (h *OrgHandler) UpdateOrg(w http.ResponseWriter, r *http.Request) {
+	user, org, ok := userAndOrg(w, r)
+	if !ok {
+		return
+	}
+
+	var organization models.Organization
+	if err := json.NewDecoder(r.Body).Decode(&organization); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	updatedOrg, err := h.service.Update(org.OrgID, &organization, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Organization updated successfully", updatedOrg, http.StatusOK)
+}
+
+func (h *OrgHandler) DeleteOrg(w http.ResponseWriter, r *http.Request) {
+	user, org, ok := userAndOrg(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(org.OrgID, user.ID); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Organization deleted successfully", nil, http.StatusOK)
+}
+
+func (h *OrgHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	user, org, ok := userAndOrg(w, r)
+	if !ok {
+		return
+	}
+
+	settings, err := h.service.GetSettings(org.OrgID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Settings fetched successfully", settings, http.StatusOK)
+}
+
+func (h *OrgHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	user, org, ok := userAndOrg(w, r)
+	if !ok {
+		return
+	}
+
+	var settings models.OrgSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	updatedSettings, err := h.service.UpdateSettings(org.OrgID, &settings, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Settings updated successfully", updatedSettings, http.StatusOK)
+}
+
+func (h *OrgHandler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	user, org, ok := userAndOrg(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := h.service.GetMembers(org.OrgID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Members fetched successfully", members, http.StatusOK)
+}
+
+func (h *OrgHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	user, org, ok := userAndOrg(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.AddOrgMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.service.AddMember(org.OrgID, &req, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Member added successfully", member, http.StatusCreated)
+}
+
+func (h *OrgHandler) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	user, org, ok := userAndOrg(w, r)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		response.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var roleRequest struct {
+		Role string `json:"role"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&roleRequest); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.UpdateMemberRole(org.OrgID, memberID, roleRequest.Role, user.ID); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Member updated successfully", nil, http.StatusOK)
+}
+
+func (h *OrgHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	user, org, ok := userAndOrg(w, r)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		response.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RemoveMember(org.OrgID, memberID, user.ID); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Member removed successfully", nil, http.StatusOK)
+}
+
+// userAndOrg reads the user and organization attached by the auth and org
+// middlewares, writing an error response when either is missing
+func userAndOrg(w http.ResponseWriter, r *http.Request) (*models.UserInfo, *models.OrgMembership, bool) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	org, ok := middleware.GetOrgFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Organization not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	return user, org, true
+}
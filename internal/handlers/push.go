@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"todo/internal/middleware"
+	"todo/internal/models"
+	"todo/internal/services"
+	"todo/pkg/response"
+
+	"github.com/gorilla/mux"
+)
+
+type PushHandler struct {
+	service *services.PushService
+}
+
+func NewPushHandler(service *services.PushService) *PushHandler {
+	return &PushHandler{
+		service: service,
+	}
+}
+
+// GetKey returns the VAPID public key, the applicationServerKey browsers pass
+// to pushManager.subscribe()
+func (h *PushHandler) GetKey(w http.ResponseWriter, r *http.Request) {
+	response.Success(w, "Push key fetched successfully", h.service.GetKey(), http.StatusOK)
+}
+
+func (h *PushHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	subscriptions, err := h.service.GetSubscriptions(user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Push subscriptions fetched successfully", subscriptions, http.StatusOK)
+}
+
+// Subscribe registers the PushSubscription of a device
+func (h *PushHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.PushSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	subscription, err := h.service.Subscribe(user.ID, &req)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Push subscription saved successfully", subscription, http.StatusCreated)
+}
+
+func (h *PushHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Unsubscribe(id, user.ID); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Push subscription deleted successfully", nil, http.StatusOK)
+}
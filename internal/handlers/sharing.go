@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"todo/internal/middleware"
+	"todo/internal/models"
+	"todo/internal/services"
+	"todo/pkg/response"
+
+	"github.com/gorilla/mux"
+)
+
+type SharingHandler struct {
+	service *services.SharingService
+}
+
+func NewSharingHandler(service *services.SharingService) *SharingHandler {
+	return &SharingHandler{
+		service: service,
+	}
+}
+
+// scoped returns the service limited to the organization of an org-scoped
+// route, or to the personal workspace otherwise
+func (h *SharingHandler) scoped(r *http.Request) *services.SharingService {
+	if org, ok := middleware.GetOrgFromContext(r.Context()); ok {
+		return h.service.ForOrg(org.OrgID)
+	}
+	return h.service
+}
+
+func (h *SharingHandler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	members, err := h.scoped(r).GetMembers(listID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Members fetched successfully", members, http.StatusOK)
+}
+
+func (h *SharingHandler) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	memberID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		response.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var roleRequest struct {
+		Role string `json:"role"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&roleRequest); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.scoped(r).UpdateMemberRole(listID, memberID, roleRequest.Role, user.ID); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Member updated successfully", nil, http.StatusOK)
+}
+
+func (h *SharingHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	memberID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		response.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.scoped(r).RemoveMember(listID, memberID, user.ID); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Member removed successfully", nil, http.StatusOK)
+}
+
+func (h *SharingHandler) Invite(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.InviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := h.scoped(r).Invite(listID, &req, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Invitation sent successfully", invitation, http.StatusCreated)
+}
+
+func (h *SharingHandler) GetListInvitations(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	invitations, err := h.scoped(r).GetListInvitations(listID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Invitations fetched successfully", invitations, http.StatusOK)
+}
+
+func (h *SharingHandler) CancelInvitation(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	invitationID, err := strconv.Atoi(mux.Vars(r)["invitationId"])
+	if err != nil {
+		response.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.scoped(r).CancelInvitation(listID, invitationID, user.ID); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Invitation cancelled successfully", nil, http.StatusOK)
+}
+
+func (h *SharingHandler) GetMyInvitations(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	invitations, err := h.scoped(r).GetMyInvitations(user.ID)
+	if err != nil {
+		response.Error(w, "Failed to fetch invitations", http.StatusInternalServerError)
+		return
+	}
+	response.Success(w, "Invitations fetched successfully", invitations, http.StatusOK)
+}
+
+func (h *SharingHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	invitationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := h.scoped(r).AcceptInvitation(invitationID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Invitation accepted successfully", invitation, http.StatusOK)
+}
+
+func (h *SharingHandler) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	invitationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := h.scoped(r).DeclineInvitation(invitationID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Invitation declined successfully", invitation, http.StatusOK)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+
+	"todo/internal/middleware"
+	"todo/internal/services"
+	"todo/pkg/response"
+)
+
+type StatsHandler struct {
+	service *services.StatsService
+}
+
+func NewStatsHandler(service *services.StatsService) *StatsHandler {
+	return &StatsHandler{
+		service: service,
+	}
+}
+
+// scoped returns the service limited to the organization of an org-scoped
+// route, or to the personal workspace otherwise
+func (h *StatsHandler) scoped(r *http.Request) *services.StatsService {
+	if org, ok := middleware.GetOrgFromContext(r.Context()); ok {
+		return h.service.ForOrg(org.OrgID)
+	}
+	return h.service
+}
+
+// GetStats returns productivity statistics between the from and to dates,
+// grouped by day or week and broken down by list or tag
+// GET /stats?from=2024-01-01&to=2024-01-31&group_by=week&breakdown=tag
+func (h *StatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	stats, err := h.scoped(r).GetStats(user.ID, query.Get("from"), query.Get("to"), query.Get("group_by"), query.Get("breakdown"))
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Stats fetched successfully", stats, http.StatusOK)
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"todo/internal/middleware"
+	"todo/internal/models"
+	"todo/internal/services"
+	"todo/pkg/response"
+
+	"github.com/gorilla/mux"
+)
+
+type TimeHandler struct {
+	service *services.TimeService
+}
+
+func NewTimeHandler(service *services.TimeService) *TimeHandler {
+	return &TimeHandler{
+		service: service,
+	}
+}
+
+// scoped returns the service limited to the organization of an org-scoped
+// route, or to the personal workspace otherwise
+func (h *TimeHandler) scoped(r *http.Request) *services.TimeService {
+	if org, ok := middleware.GetOrgFromContext(r.Context()); ok {
+		return h.service.ForOrg(org.OrgID)
+	}
+	return h.service
+}
+
+func (h *TimeHandler) StartTimer(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.scoped(r).StartTimer(todoID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Timer started successfully", entry, http.StatusCreated)
+}
+
+func (h *TimeHandler) StopTimer(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.scoped(r).StopTimer(todoID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Timer stopped successfully", entry, http.StatusOK)
+}
+
+// GetRunningTimer returns the user's running timer, or null
+func (h *TimeHandler) GetRunningTimer(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	entry, err := h.service.GetRunningTimer(user.ID)
+	if err != nil {
+		response.Error(w, "Failed to fetch timer", http.StatusInternalServerError)
+		return
+	}
+	response.Success(w, "Timer fetched successfully", entry, http.StatusOK)
+}
+
+func (h *TimeHandler) GetEntries(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.scoped(r).GetEntries(todoID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Time entries fetched successfully", entries, http.StatusOK)
+}
+
+func (h *TimeHandler) CreateEntry(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.TimeEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.scoped(r).CreateEntry(todoID, &req, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Time entry created successfully", entry, http.StatusCreated)
+}
+
+func (h *TimeHandler) UpdateEntry(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, entryID, ok := timeEntryIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TimeEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.scoped(r).UpdateEntry(todoID, entryID, &req, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Time entry updated successfully", entry, http.StatusOK)
+}
+
+func (h *TimeHandler) DeleteEntry(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, entryID, ok := timeEntryIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).DeleteEntry(todoID, entryID, user.ID); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Time entry deleted successfully", nil, http.StatusOK)
+}
+
+func (h *TimeHandler) GetTodoTime(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	total, err := h.scoped(r).GetTodoTime(todoID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Time fetched successfully", total, http.StatusOK)
+}
+
+func (h *TimeHandler) GetListTime(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	total, err := h.scoped(r).GetListTime(listID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Time fetched successfully", total, http.StatusOK)
+}
+
+// GetReport aggregates the user's time by day or week:
+// GET /time/report?from=2024-01-01&to=2024-01-31&group_by=week
+func (h *TimeHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	report, err := h.scoped(r).GetReport(user.ID, query.Get("from"), query.Get("to"), query.Get("group_by"))
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Report fetched successfully", report, http.StatusOK)
+}
+
+// ExportCSV downloads the user's time entries between from and to as CSV
+func (h *TimeHandler) ExportCSV(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	// Buffer the export so errors can still be reported as JSON
+	var buf bytes.Buffer
+	query := r.URL.Query()
+	if err := h.scoped(r).ExportCSV(user.ID, query.Get("from"), query.Get("to"), &buf); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="time-entries.csv"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func timeEntryIDs(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	entryID, err := strconv.Atoi(mux.Vars(r)["entryId"])
+	if err != nil {
+		response.Error(w, "Invalid time entry ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return todoID, entryID, true
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"todo/internal/middleware"
 	"todo/internal/models"
@@ -23,6 +24,15 @@ func NewTodoHandler(service *services.TodoService) *TodoHandler {
 	}
 }
 
+// scoped returns the service limited to the organization of an org-scoped
+// route, or to the personal workspace otherwise
+func (h *TodoHandler) scoped(r *http.Request) *services.TodoService {
+	if org, ok := middleware.GetOrgFromContext(r.Context()); ok {
+		return h.service.ForOrg(org.OrgID)
+	}
+	return h.service
+}
+
 func (h *TodoHandler) GetTodos(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
@@ -30,14 +40,79 @@ func (h *TodoHandler) GetTodos(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	todos, err := h.service.GetAll(user.ID)
+	var filter services.TodoFilter
+	switch assignedTo := r.URL.Query().Get("assigned_to"); assignedTo {
+	case "":
+	case "me":
+		filter.AssignedTo = user.ID
+	default:
+		id, err := strconv.Atoi(assignedTo)
+		if err != nil || id <= 0 {
+			response.Error(w, "Invalid assigned_to: must be me or a user ID", http.StatusBadRequest)
+			return
+		}
+		filter.AssignedTo = id
+	}
+	if sprintID := r.URL.Query().Get("sprint_id"); sprintID != "" {
+		id, err := strconv.Atoi(sprintID)
+		if err != nil || id <= 0 {
+			response.Error(w, "Invalid sprint_id: must be a sprint ID", http.StatusBadRequest)
+			return
+		}
+		filter.SprintID = id
+	}
+	filter.Tag = r.URL.Query().Get("tag")
+	filter.View = r.URL.Query().Get("view")
+
+	todos, err := h.scoped(r).GetAllSorted(user.ID, r.URL.Query().Get("sort"), filter)
 	if err != nil {
-		response.Error(w, "Failed to fetch todos", http.StatusInternalServerError)
+		if strings.HasPrefix(err.Error(), "invalid sort") || strings.HasPrefix(err.Error(), "invalid view") {
+			response.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			response.Error(w, "Failed to fetch todos", http.StatusInternalServerError)
+		}
 		return
 	}
 	response.Success(w, "Todos fetched successfully", todos, http.StatusOK)
 }
 
+// GetDueViewCounts returns the number of todos in the today, upcoming and
+// overdue views
+func (h *TodoHandler) GetDueViewCounts(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	counts, err := h.scoped(r).GetDueViewCounts(user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response.Success(w, "View counts fetched successfully", counts, http.StatusOK)
+}
+
+// GetDueView returns the todos of the today, upcoming or overdue view
+func (h *TodoHandler) GetDueView(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	view, err := h.scoped(r).GetDueView(mux.Vars(r)["view"], user.ID)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid view") {
+			response.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			response.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	response.Success(w, "View fetched successfully", view, http.StatusOK)
+}
+
 func (h *TodoHandler) GetTodo(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
@@ -53,7 +128,7 @@ func (h *TodoHandler) GetTodo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call service layer to get todo by ID for specific user
-	todo, err := h.service.GetByID(id, user.ID)
+	todo, err := h.scoped(r).GetByID(id, user.ID)
 	if err != nil {
 		if err.Error() == "todo not found" {
 			response.Error(w, "Todo not found", http.StatusNotFound)
@@ -80,9 +155,9 @@ func (h *TodoHandler) CreateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	createdTodo, err := h.service.Create(&todo, user.ID)
+	createdTodo, err := h.scoped(r).Create(&todo, user.ID)
 	if err != nil {
-		response.Error(w, err.Error(), http.StatusBadRequest)
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
 		return
 	}
 	response.Success(w, "Todo created successfully", createdTodo, http.StatusCreated)
@@ -107,12 +182,12 @@ func (h *TodoHandler) UpdateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updatedTodo, err := h.service.Update(id, &todo, user.ID)
+	updatedTodo, err := h.scoped(r).Update(id, &todo, user.ID)
 	if err != nil {
 		if err.Error() == "todo not found" {
 			response.Error(w, "Todo not found", http.StatusNotFound)
 		} else {
-			response.Error(w, err.Error(), http.StatusBadRequest)
+			response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
 		}
 		return
 	}
@@ -132,9 +207,11 @@ func (h *TodoHandler) DeleteTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.Delete(id, user.ID); err != nil {
+	if err := h.scoped(r).Delete(id, user.ID); err != nil {
 		if err.Error() == "todo not found" {
 			response.Error(w, "Todo not found", http.StatusNotFound)
+		} else if err.Error() == "access denied" {
+			response.Error(w, "Access denied", http.StatusForbidden)
 		} else {
 			response.Error(w, "Failed to delete todo", http.StatusInternalServerError)
 		}
@@ -166,14 +243,143 @@ func (h *TodoHandler) ReorderTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.ReorderTodos(user.ID, id, reorderRequest.NewOrderNo); err != nil {
+	if err := h.scoped(r).ReorderTodos(user.ID, id, reorderRequest.NewOrderNo); err != nil {
 		if err.Error() == "todo not found" {
 			response.Error(w, "Todo not found", http.StatusNotFound)
 		} else {
-			response.Error(w, err.Error(), http.StatusBadRequest)
+			response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
 		}
 		return
 	}
 
 	response.Success(w, "Todo reordered successfully", nil, http.StatusOK)
 }
+
+// SnoozeTodo hides a todo until the requested time
+func (h *TodoHandler) SnoozeTodo(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.SnoozeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	todo, err := h.scoped(r).Snooze(id, &req, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Todo snoozed successfully", todo, http.StatusOK)
+}
+
+// UnsnoozeTodo brings a snoozed todo back right away
+func (h *TodoHandler) UnsnoozeTodo(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	todo, err := h.scoped(r).Unsnooze(id, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Todo unsnoozed successfully", todo, http.StatusOK)
+}
+
+// TransitionTodo moves a todo to another workflow state or position on its list's board
+func (h *TodoHandler) TransitionTodo(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid todo ID", http.StatusBadRequest)
+		return
+	}
+
+	var transitionRequest struct {
+		State    string `json:"state"`
+		Position int    `json:"position"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&transitionRequest); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	todo, err := h.scoped(r).TransitionTodo(id, user.ID, transitionRequest.State, transitionRequest.Position)
+	if err != nil {
+		if err.Error() == "todo not found" {
+			response.Error(w, "Todo not found", http.StatusNotFound)
+		} else {
+			response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		}
+		return
+	}
+
+	response.Success(w, "Todo moved successfully", todo, http.StatusOK)
+}
+
+// QuickAdd creates a todo from free text, or only parses it when previewing
+func (h *TodoHandler) QuickAdd(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.QuickAddRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.scoped(r).QuickAdd(&req, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	if req.Preview {
+		response.Success(w, "Todo parsed successfully", result, http.StatusOK)
+		return
+	}
+	response.Success(w, "Todo created successfully", result, http.StatusCreated)
+}
+
+// GetTags returns the tags in use with their number of todos
+func (h *TodoHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	tags, err := h.scoped(r).GetTags(user.ID)
+	if err != nil {
+		response.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+	response.Success(w, "Tags fetched successfully", tags, http.StatusOK)
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"todo/internal/middleware"
+	"todo/internal/models"
+	"todo/internal/services"
+	"todo/pkg/response"
+
+	"github.com/gorilla/mux"
+)
+
+type WebhookHandler struct {
+	service *services.WebhookService
+}
+
+func NewWebhookHandler(service *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		service: service,
+	}
+}
+
+// scoped returns the service limited to the organization of an org-scoped
+// route, or to the personal workspace otherwise
+func (h *WebhookHandler) scoped(r *http.Request) *services.WebhookService {
+	if org, ok := middleware.GetOrgFromContext(r.Context()); ok {
+		return h.service.ForOrg(org.OrgID)
+	}
+	return h.service
+}
+
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	webhooks, err := h.scoped(r).GetWebhooks(user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Webhooks fetched successfully", webhooks, http.StatusOK)
+}
+
+// CreateWebhook adds a webhook. The response is the only one holding the
+// signing secret, until it is rotated.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := h.scoped(r).CreateWebhook(&req, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Webhook created successfully", webhook, http.StatusCreated)
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := h.scoped(r).GetWebhook(id, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Webhook fetched successfully", webhook, http.StatusOK)
+}
+
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := h.scoped(r).UpdateWebhook(id, &req, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Webhook updated successfully", webhook, http.StatusOK)
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.scoped(r).DeleteWebhook(id, user.ID); err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Webhook deleted successfully", nil, http.StatusOK)
+}
+
+// RotateSecret replaces a webhook's signing secret and returns the new one
+func (h *WebhookHandler) RotateSecret(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := h.scoped(r).RotateSecret(id, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Webhook secret rotated successfully", webhook, http.StatusOK)
+}
+
+// GetDeliveries returns a page of a webhook's delivery log, newest first,
+// optionally filtered with ?status=pending, sent or failed
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	page, pageSize, ok := pageParams(w, r, services.DefaultWebhookDeliveryPageSize)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.scoped(r).GetDeliveries(id, user.ID, r.URL.Query().Get("status"), page, pageSize)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Webhook deliveries fetched successfully", deliveries, http.StatusOK)
+}
+
+func (h *WebhookHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, deliveryID, ok := deliveryIDs(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.scoped(r).GetDelivery(id, deliveryID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response.Success(w, "Webhook delivery fetched successfully", delivery, http.StatusOK)
+}
+
+// Redeliver queues the event of a delivery again and returns the new delivery
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		response.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, deliveryID, ok := deliveryIDs(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.scoped(r).Redeliver(id, deliveryID, user.ID)
+	if err != nil {
+		response.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+		return
+	}
+	response.Success(w, "Webhook delivery queued successfully", delivery, http.StatusAccepted)
+}
+
+func deliveryIDs(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	webhookID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	deliveryID, err := strconv.Atoi(mux.Vars(r)["deliveryId"])
+	if err != nil {
+		response.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return webhookID, deliveryID, true
+}
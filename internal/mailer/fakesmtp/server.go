@@ -0,0 +1,173 @@
+// Package fakesmtp is an in-process SMTP server for local testing. It accepts
+// every message and keeps it in memory instead of relaying it. It speaks
+// enough SMTP for mailer.SMTPMailer with SMTP_SECURITY=none: EHLO, HELO,
+// AUTH PLAIN, MAIL, RCPT, DATA, RSET, NOOP and QUIT.
+package fakesmtp
+
+import (
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a message received by the server
+type Message struct {
+	From     string    `json:"from"`
+	To       []string  `json:"to"`
+	Data     string    `json:"data"`
+	Received time.Time `json:"received"`
+}
+
+type Server struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []Message
+	failures []int // reply codes for the next messages, see FailNext
+}
+
+// Start listens on addr, such as "127.0.0.1:0" for a random port, and serves
+// connections until Close
+func Start(addr string) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{listener: listener}
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Messages returns the messages received so far, oldest first
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset forgets the messages received and the failures queued
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+	s.failures = nil
+}
+
+// FailNext rejects the next message with an SMTP reply code: a 4xx code for a
+// transient failure the sender should retry, a 5xx code for a permanent one
+func (s *Server) FailNext(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, code)
+}
+
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle runs an SMTP session. Commands are answered in order; pipelining is
+// not supported.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(code int, message string) {
+		text.PrintfLine("%d %s", code, message)
+	}
+
+	reply(220, "fakesmtp ready")
+	var from string
+	var to []string
+	for {
+		conn.SetDeadline(time.Now().Add(5 * time.Minute))
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			text.PrintfLine("250-fakesmtp")
+			text.PrintfLine("250-AUTH PLAIN")
+			reply(250, "8BITMIME")
+		case "HELO":
+			reply(250, "fakesmtp")
+		case "AUTH":
+			reply(235, "Authentication successful")
+		case "MAIL":
+			from, to = pathArg(arg), nil
+			reply(250, "OK")
+		case "RCPT":
+			if from == "" {
+				reply(503, "MAIL first")
+				continue
+			}
+			to = append(to, pathArg(arg))
+			reply(250, "OK")
+		case "DATA":
+			if len(to) == 0 {
+				reply(503, "RCPT first")
+				continue
+			}
+			reply(354, "End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			if code := s.nextFailure(); code != 0 {
+				reply(code, "Rejected by fakesmtp")
+			} else {
+				s.mu.Lock()
+				s.messages = append(s.messages, Message{From: from, To: to, Data: string(data), Received: time.Now()})
+				s.mu.Unlock()
+				reply(250, "OK: queued")
+			}
+			from, to = "", nil
+		case "RSET":
+			from, to = "", nil
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, fmt.Sprintf("%s not implemented", verb))
+		}
+	}
+}
+
+func (s *Server) nextFailure() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.failures) == 0 {
+		return 0
+	}
+	code := s.failures[0]
+	s.failures = s.failures[1:]
+	return code
+}
+
+// pathArg returns the address of "FROM:<user@example.com> SIZE=123"
+func pathArg(arg string) string {
+	_, path, _ := strings.Cut(arg, ":")
+	path, _, _ = strings.Cut(strings.TrimSpace(path), " ")
+	return strings.Trim(path, "<>")
+}
@@ -0,0 +1,294 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain-text and an HTML version of its body
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string // extra headers, such as List-Unsubscribe
+}
+
+// Mailer delivers email
+type Mailer interface {
+	// Send delivers a message. Errors for which IsPermanent is true will not
+	// go away by sending the message again.
+	Send(ctx context.Context, msg *Message) error
+}
+
+// permanentError is a rejection of a message by the server, such as an
+// unknown recipient
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// IsPermanent tells whether retrying a failed Send is pointless
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// NewFromEnv returns the mailer selected by MAILER: "log" (the default) only
+// logs messages, "smtp" sends them through the server configured by the SMTP_*
+// variables.
+func NewFromEnv() (Mailer, error) {
+	switch os.Getenv("MAILER") {
+	case "", "log":
+		return LogMailer{}, nil
+	case "smtp":
+		return NewSMTPMailerFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q: must be log or smtp", os.Getenv("MAILER"))
+	}
+}
+
+// LogMailer logs messages instead of sending them, for development
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg *Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
+
+// Security modes of an SMTP connection
+const (
+	SMTPStartTLS = "starttls" // upgrade with STARTTLS when the server offers it
+	SMTPTLS      = "tls"      // implicit TLS, usually on port 465
+	SMTPNone     = "none"     // plain text, for local servers such as cmd/fakesmtp
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string // the sender address, e.g. Todo <todo@example.com>
+	Security string
+	Timeout  time.Duration
+}
+
+// SMTPMailer sends each message over a new connection to an SMTP server
+type SMTPMailer struct {
+	config SMTPConfig
+	from   string // the address part of config.From, for MAIL FROM
+}
+
+func NewSMTPMailer(config SMTPConfig) (*SMTPMailer, error) {
+	if config.Host == "" || config.From == "" {
+		return nil, fmt.Errorf("SMTP host and sender are required")
+	}
+	from, err := address(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP sender %q: %v", config.From, err)
+	}
+	switch config.Security {
+	case "":
+		config.Security = SMTPStartTLS
+	case SMTPStartTLS, SMTPTLS, SMTPNone:
+	default:
+		return nil, fmt.Errorf("invalid SMTP security %q: must be starttls, tls or none", config.Security)
+	}
+	if config.Port == "" {
+		config.Port = "587"
+		if config.Security == SMTPTLS {
+			config.Port = "465"
+		}
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &SMTPMailer{config: config, from: from}, nil
+}
+
+// NewSMTPMailerFromEnv configures the mailer from SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM and SMTP_SECURITY
+func NewSMTPMailerFromEnv() (*SMTPMailer, error) {
+	return NewSMTPMailer(SMTPConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		Security: os.Getenv("SMTP_SECURITY"),
+	})
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	to, err := address(msg.To)
+	if err != nil {
+		return &permanentError{fmt.Errorf("invalid recipient %q: %v", msg.To, err)}
+	}
+	data, err := buildMessage(m.config.From, msg)
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	addr := net.JoinHostPort(m.config.Host, m.config.Port)
+	dialer := &net.Dialer{Timeout: m.config.Timeout}
+	var conn net.Conn
+	if m.config.Security == SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: m.config.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP server: %v", err)
+	}
+	deadline := time.Now().Add(m.config.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error connecting to SMTP server: %v", err)
+	}
+	defer client.Close()
+
+	if m.config.Security == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+				return fmt.Errorf("error starting TLS: %v", err)
+			}
+		}
+	}
+	if m.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)); err != nil {
+			return classify("error authenticating", err)
+		}
+	}
+	if err := client.Mail(m.from); err != nil {
+		return classify("error sending MAIL FROM", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return classify("error sending RCPT TO", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return classify("error sending DATA", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("error writing message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return classify("error sending message", err)
+	}
+	return client.Quit()
+}
+
+// classify marks 5xx replies of the server as permanent errors
+func classify(context string, err error) error {
+	wrapped := fmt.Errorf("%s: %w", context, err)
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return &permanentError{wrapped}
+	}
+	return wrapped
+}
+
+// buildMessage encodes a message as multipart/alternative MIME, the plain-text
+// part first so that clients prefer the HTML one
+func buildMessage(from string, msg *Message) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"From":         from,
+		"To":           msg.To,
+		"Subject":      mime.QEncoding.Encode("UTF-8", msg.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"Message-ID":   messageID(from),
+		"MIME-Version": "1.0",
+		"Content-Type": "multipart/alternative; boundary=" + parts.Boundary(),
+	}
+	for name, value := range msg.Headers {
+		headers[textproto.CanonicalMIMEHeaderKey(name)] = value
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if strings.ContainsAny(headers[name], "\r\n") {
+			return nil, fmt.Errorf("invalid %s header: contains a line break", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var data bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&data, "%s: %s\r\n", name, headers[name])
+	}
+	data.WriteString("\r\n")
+	data.Write(body.Bytes())
+	return data.Bytes(), nil
+}
+
+// messageID returns a unique Message-ID in the sender's domain
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := address(from); err == nil {
+		if at := strings.LastIndex(addr, "@"); at >= 0 {
+			domain = addr[at+1:]
+		}
+	}
+	random := make([]byte, 16)
+	rand.Read(random)
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">"
+}
+
+// address returns the bare address of "Name <user@example.com>"
+func address(s string) (string, error) {
+	parsed, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Address, nil
+}
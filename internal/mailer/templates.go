@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Every email has a NAME.txt and a NAME.html template; footer.txt and
+// footer.html hold the unsubscribe link shared by all of them
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+// ReminderData fills the reminder templates
+type ReminderData struct {
+	Username       string
+	Title          string
+	Workspace      string
+	Due            string // in the user's timezone
+	DueIn          string // e.g. "in 1 hour"
+	UnsubscribeURL string
+}
+
+// DigestData fills the daily digest templates
+type DigestData struct {
+	Username       string
+	Date           string
+	Overdue        []DigestItem
+	Today          []DigestItem
+	UnsubscribeURL string
+}
+
+// DigestItem is a todo listed in a digest
+type DigestItem struct {
+	Title     string
+	Workspace string
+	Due       string // in the user's timezone
+}
+
+// Render executes the plain-text and HTML templates of an email, such as
+// reminder.txt and reminder.html for "reminder"
+func Render(name string, data interface{}) (text, html string, err error) {
+	var textBody, htmlBody bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&textBody, name+".txt", data); err != nil {
+		return "", "", err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&htmlBody, name+".html", data); err != nil {
+		return "", "", err
+	}
+	return textBody.String(), htmlBody.String(), nil
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"todo/internal/models"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+const orgContextKey contextKey = "orgMembership"
+
+// OrgMiddleware resolves the {org} route variable (ID or slug) and checks that
+// the authenticated user is a member. It must run after AuthMiddleware.
+func OrgMiddleware(orgService *services.OrgService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := GetUserFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized: user not found in context", http.StatusUnauthorized)
+				return
+			}
+
+			membership, err := orgService.GetMembership(mux.Vars(r)["org"], user.ID)
+			if err != nil {
+				if err.Error() == "organization not found" {
+					http.Error(w, "Organization not found", http.StatusNotFound)
+				} else {
+					http.Error(w, "Failed to check organization membership", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			// Attach membership to context
+			ctx := context.WithValue(r.Context(), orgContextKey, membership)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Helper to get the organization of an org-scoped route from context
+func GetOrgFromContext(ctx context.Context) (*models.OrgMembership, bool) {
+	org, ok := ctx.Value(orgContextKey).(*models.OrgMembership)
+	return org, ok
+}
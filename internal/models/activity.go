@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// Account activity verbs; todo activity uses the todo event types, such as
+// todo.completed
+const (
+	ActivityUserRegistered        = "user.registered"
+	ActivityUserLoggedIn          = "user.logged_in"
+	ActivityUserLoggedOut         = "user.logged_out"
+	ActivityUserTimezoneChanged   = "user.timezone_changed"
+	ActivityUserDefaultOrgChanged = "user.default_org_changed"
+)
+
+// Activity is an entry of the activity feed. Rapid repeated edits of a todo
+// by the same user are merged into one entry: Count is the number of edits
+// and UpdatedAt the time of the last one. ActorID is nil for changes made
+// by the system, such as a snooze ending.
+type Activity struct {
+	ID        int             `json:"id"`
+	OrgID     int             `json:"org_id,omitempty"`
+	Verb      string          `json:"verb"`
+	ActorID   *int            `json:"actor_id,omitempty"`
+	ActorName string          `json:"actor_name,omitempty"`
+	TodoID    *int            `json:"todo_id,omitempty"`
+	ListID    *int            `json:"list_id,omitempty"`
+	TodoTitle string          `json:"todo_title,omitempty"`
+	Details   ActivityDetails `json:"details"`
+	Count     int             `json:"count"`
+	Summary   string          `json:"summary"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// ActivityDetails holds what changed, depending on the verb
+type ActivityDetails struct {
+	Fields   []string `json:"fields,omitempty"`   // todo.updated
+	Position int      `json:"position,omitempty"` // todo.reordered
+	State    string   `json:"state,omitempty"`    // todo.state_changed
+	Users    []string `json:"users,omitempty"`    // todo.assigned and todo.unassigned
+	Tags     []string `json:"tags,omitempty"`     // todo.tagged
+	Timezone string   `json:"timezone,omitempty"` // user.timezone_changed
+	Excerpt  string   `json:"excerpt,omitempty"`  // comment notifications
+}
+
+// ActivityPage is one page of the activity feed, most recent first
+type ActivityPage struct {
+	Activities []Activity `json:"activities"`
+	Page       int        `json:"page"`
+	PageSize   int        `json:"page_size"`
+	Total      int        `json:"total"`
+}
+
+func CreateActivitiesTable() error {
+	// Activity outlives the todos and lists it is about, so there are no
+	// foreign keys on them. owner_id is the todo's owner, who can see the
+	// activity of todos outside lists; account activity has no todo and is
+	// only shown to its actor.
+	query := `
+	CREATE TABLE IF NOT EXISTS activities (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		org_id INT NOT NULL DEFAULT 0,
+		verb VARCHAR(32) NOT NULL,
+		actor_id INT NULL,
+		owner_id INT NULL,
+		todo_id INT NULL,
+		list_id INT NULL,
+		todo_title VARCHAR(255) NOT NULL DEFAULT '',
+		details TEXT NOT NULL,
+		count INT NOT NULL DEFAULT 1,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		INDEX idx_org_updated (org_id, updated_at),
+		INDEX idx_todo_id (todo_id, id),
+		INDEX idx_list_id (list_id),
+		INDEX idx_actor_id (actor_id)
+	)`
+
+	_, err := database.DB.Exec(query)
+	return err
+}
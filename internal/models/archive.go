@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// MaxArchiveAfterDays caps the archive policy of a user
+const MaxArchiveAfterDays = 3650
+
+// ArchivePolicy archives the todos a user owns in a tenant once they have been
+// completed for AfterDays days. 0 never archives them. Default is set when the
+// user has no policy of their own and the server default applies.
+type ArchivePolicy struct {
+	AfterDays int       `json:"after_days"`
+	Default   bool      `json:"default,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// ArchivePage is one page of archived todos, most recently archived first
+type ArchivePage struct {
+	Todos    []Todo `json:"todos"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+	Total    int    `json:"total"`
+}
+
+func CreateArchivePoliciesTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS archive_policies (
+		user_id INT NOT NULL,
+		org_id INT NOT NULL DEFAULT 0,
+		after_days INT NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, org_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`
+
+	_, err := database.DB.Exec(query)
+	return err
+}
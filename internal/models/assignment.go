@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// Assignment actions recorded in the assignment history
+const (
+	AssignmentAssigned   = "assigned"
+	AssignmentUnassigned = "unassigned"
+)
+
+// AssignmentReasonAccessLost marks assignees removed automatically because
+// they can no longer see the todo
+const AssignmentReasonAccessLost = "access_lost"
+
+type Assignee struct {
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	AssignedBy int       `json:"assigned_by"`
+	AssignedAt time.Time `json:"assigned_at"`
+}
+
+// AssignmentEvent is one entry of a todo's assignment history. ActorID is nil
+// for changes made by the system, such as unassigning a user who lost access.
+type AssignmentEvent struct {
+	ID        int       `json:"id"`
+	TodoID    int       `json:"todo_id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Action    string    `json:"action"`
+	ActorID   *int      `json:"actor_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AssignRequest replaces or extends the assignees of a todo
+type AssignRequest struct {
+	UserIDs []int `json:"user_ids"`
+}
+
+func CreateAssignmentTables() error {
+	assigneesQuery := `
+	CREATE TABLE IF NOT EXISTS todo_assignees (
+		todo_id INT NOT NULL,
+		user_id INT NOT NULL,
+		assigned_by INT NOT NULL,
+		assigned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (todo_id, user_id),
+		FOREIGN KEY (todo_id) REFERENCES todos(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_user_id (user_id)
+	)`
+
+	if _, err := database.DB.Exec(assigneesQuery); err != nil {
+		return err
+	}
+
+	eventsQuery := `
+	CREATE TABLE IF NOT EXISTS todo_assignment_events (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		todo_id INT NOT NULL,
+		user_id INT NOT NULL,
+		action VARCHAR(16) NOT NULL,
+		actor_id INT NULL,
+		reason VARCHAR(32) NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (todo_id) REFERENCES todos(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_todo_created (todo_id, created_at)
+	)`
+
+	_, err := database.DB.Exec(eventsQuery)
+	return err
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+type Attachment struct {
+	ID          int       `json:"id"`
+	TodoID      int       `json:"todo_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	UploadedBy  int       `json:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	StorageKey  string    `json:"-"`
+}
+
+// StorageUsage is a user's attachment storage use against their quota
+type StorageUsage struct {
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+}
+
+// CreateAttachmentsTable creates the attachment metadata table. todo_id has no
+// foreign key: rows of deleted todos are kept until the garbage collector has
+// removed their blobs. Duplicated todos share blobs, so several rows may have
+// the same storage key.
+func CreateAttachmentsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS todo_attachments (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		todo_id INT NOT NULL,
+		uploaded_by INT NOT NULL,
+		filename VARCHAR(255) NOT NULL,
+		content_type VARCHAR(127) NOT NULL,
+		size BIGINT NOT NULL,
+		storage_key VARCHAR(255) NOT NULL,
+		deleted_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_storage_key (storage_key),
+		INDEX idx_todo_id (todo_id),
+		INDEX idx_uploaded_by (uploaded_by)
+	)`
+
+	if _, err := database.DB.Exec(query); err != nil {
+		return err
+	}
+
+	if err := database.DropIndexIfExists("todo_attachments", "unique_storage_key"); err != nil {
+		return err
+	}
+	return database.AddIndexIfNotExists("todo_attachments", "idx_storage_key", "(storage_key)")
+}
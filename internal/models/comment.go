@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// MaxCommentLength is the maximum length of a comment body, in bytes
+const MaxCommentLength = 10000
+
+// Comment is a Markdown comment on a todo. Top-level comments carry their
+// replies; replies cannot be replied to.
+type Comment struct {
+	ID        int       `json:"id"`
+	TodoID    int       `json:"todo_id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	ParentID  *int      `json:"parent_id,omitempty"`
+	Body      string    `json:"body"`
+	Mentions  []Mention `json:"mentions"`
+	Edited    bool      `json:"edited"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Replies   []Comment `json:"replies,omitempty"`
+}
+
+// Mention is an @username in a comment body that resolved to a user
+type Mention struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// CommentEdit is a previous version of a comment body
+type CommentEdit struct {
+	ID        int       `json:"id"`
+	CommentID int       `json:"comment_id"`
+	Body      string    `json:"body"`
+	EditedAt  time.Time `json:"edited_at"`
+}
+
+type CommentRequest struct {
+	Body     string `json:"body"`
+	ParentID *int   `json:"parent_id,omitempty"`
+}
+
+// CommentPage is one page of a todo's top-level comments
+type CommentPage struct {
+	Comments []Comment `json:"comments"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+	Total    int       `json:"total"`
+}
+
+func CreateCommentTables() error {
+	commentsQuery := `
+	CREATE TABLE IF NOT EXISTS todo_comments (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		todo_id INT NOT NULL,
+		user_id INT NOT NULL,
+		parent_id INT NULL,
+		body TEXT NOT NULL,
+		edited BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (todo_id) REFERENCES todos(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (parent_id) REFERENCES todo_comments(id) ON DELETE CASCADE,
+		INDEX idx_todo_parent (todo_id, parent_id, created_at)
+	)`
+
+	if _, err := database.DB.Exec(commentsQuery); err != nil {
+		return err
+	}
+
+	editsQuery := `
+	CREATE TABLE IF NOT EXISTS comment_edits (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		comment_id INT NOT NULL,
+		body TEXT NOT NULL,
+		edited_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (comment_id) REFERENCES todo_comments(id) ON DELETE CASCADE,
+		INDEX idx_comment_id (comment_id)
+	)`
+
+	if _, err := database.DB.Exec(editsQuery); err != nil {
+		return err
+	}
+
+	mentionsQuery := `
+	CREATE TABLE IF NOT EXISTS comment_mentions (
+		comment_id INT NOT NULL,
+		user_id INT NOT NULL,
+		PRIMARY KEY (comment_id, user_id),
+		FOREIGN KEY (comment_id) REFERENCES todo_comments(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_user_id (user_id)
+	)`
+
+	_, err := database.DB.Exec(mentionsQuery)
+	return err
+}
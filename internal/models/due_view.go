@@ -0,0 +1,27 @@
+package models
+
+// DueViewCounts is the number of open todos in each due-date view, for the
+// current day in the user's timezone
+type DueViewCounts struct {
+	Date     string `json:"date"`
+	Timezone string `json:"timezone"`
+	Today    int    `json:"today"`
+	Upcoming int    `json:"upcoming"`
+	Overdue  int    `json:"overdue"`
+}
+
+// DueView lists the open todos of a due-date view, grouped by due day in the
+// user's timezone. Todos keep their manual order within a day.
+type DueView struct {
+	View     string         `json:"view"`
+	Date     string         `json:"date"`
+	Timezone string         `json:"timezone"`
+	Count    int            `json:"count"`
+	Groups   []DueViewGroup `json:"groups"`
+}
+
+type DueViewGroup struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+	Todos []Todo `json:"todos"`
+}
@@ -0,0 +1,23 @@
+package models
+
+// MaxDuplicateTodos caps the number of todos copied by duplicating a list
+const MaxDuplicateTodos = 500
+
+// DuplicateRequest selects what a duplicate copies besides the attributes of
+// the todo or list. Children are the todos of a list; todos have none.
+// Attachments are copied by reference, so the files are not stored twice.
+// Position is where the copy goes in the owner's manual order; by default it
+// goes right after the original.
+type DuplicateRequest struct {
+	Name               string `json:"name,omitempty"` // lists only; defaults to "<name> (copy)"
+	Position           *int   `json:"position,omitempty"`
+	IncludeChildren    bool   `json:"include_children"`
+	IncludeTags        bool   `json:"include_tags"`
+	IncludeAttachments bool   `json:"include_attachments"`
+}
+
+// DuplicateListResult is the copy of a list and the number of todos copied
+type DuplicateListResult struct {
+	List  *List `json:"list"`
+	Todos int   `json:"todos"`
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// Limits of email preferences
+const (
+	MaxReminderOffsets      = 5
+	MaxReminderOffsetMinute = 7 * 24 * 60
+)
+
+// Delivery states of queued emails and push messages
+const (
+	DeliveryPending   = "pending"
+	DeliverySent      = "sent"
+	DeliveryFailed    = "failed"
+	DeliveryCancelled = "cancelled" // no longer wanted, such as after unsubscribing
+)
+
+// Kinds of email
+const (
+	EmailReminder = "reminder"
+	EmailDigest   = "digest"
+)
+
+// EmailPreferences controls the emails a user receives. ReminderOffsets are
+// minutes before a due date; a reminder is sent at each of them, by email and
+// push, for the todos the user owns or is assigned. The digest is sent at
+// DigestHour in the user's timezone. No email or push is sent during quiet
+// hours, given as "22:00" and "07:00"; those due then wait for the end of the
+// quiet hours. Unsubscribed stops all email, but not push. Default is set
+// when the user has no preferences of their own.
+type EmailPreferences struct {
+	Reminders       bool      `json:"reminders"`
+	ReminderOffsets []int     `json:"reminder_offsets"`
+	Digest          bool      `json:"digest"`
+	DigestHour      int       `json:"digest_hour"`
+	QuietHoursStart string    `json:"quiet_hours_start,omitempty"`
+	QuietHoursEnd   string    `json:"quiet_hours_end,omitempty"`
+	Unsubscribed    bool      `json:"unsubscribed"`
+	Default         bool      `json:"default,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at,omitempty"`
+}
+
+func CreateEmailTables() error {
+	// unsubscribe_token authenticates the unsubscribe link of emails. Quiet
+	// hours are minutes after midnight. last_digest_on is the local date of
+	// the last digest, sent or found empty.
+	preferencesQuery := `
+	CREATE TABLE IF NOT EXISTS email_preferences (
+		user_id INT PRIMARY KEY,
+		reminders BOOLEAN NOT NULL DEFAULT TRUE,
+		reminder_offsets VARCHAR(255) NOT NULL,
+		digest BOOLEAN NOT NULL DEFAULT TRUE,
+		digest_hour TINYINT NOT NULL DEFAULT 8,
+		quiet_start SMALLINT NULL,
+		quiet_end SMALLINT NULL,
+		unsubscribed_at DATETIME NULL,
+		unsubscribe_token VARCHAR(64) NOT NULL UNIQUE,
+		last_digest_on DATE NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`
+
+	if _, err := database.DB.Exec(preferencesQuery); err != nil {
+		return err
+	}
+
+	// dedupe_key makes queueing the same reminder or digest twice a no-op
+	queueQuery := `
+	CREATE TABLE IF NOT EXISTS email_queue (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		kind VARCHAR(16) NOT NULL,
+		dedupe_key VARCHAR(128) NOT NULL UNIQUE,
+		recipient VARCHAR(255) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		text_body MEDIUMTEXT NOT NULL,
+		html_body MEDIUMTEXT NOT NULL,
+		status VARCHAR(16) NOT NULL DEFAULT 'pending',
+		attempts INT NOT NULL DEFAULT 0,
+		last_error TEXT NULL,
+		next_attempt_at DATETIME NOT NULL,
+		sent_at DATETIME NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_status_next (status, next_attempt_at)
+	)`
+
+	_, err := database.DB.Exec(queueQuery)
+	return err
+}
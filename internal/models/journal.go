@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// MaxJournalOperations is how many operations a user can undo in a tenant
+const MaxJournalOperations = 50
+
+// Journaled todo operations
+const (
+	OperationCreate     = "create"
+	OperationUpdate     = "update"
+	OperationDelete     = "delete"
+	OperationReorder    = "reorder"
+	OperationTransition = "transition"
+	OperationSnooze     = "snooze"
+	OperationUnsnooze   = "unsnooze"
+	OperationAssign     = "assign"
+	OperationUnassign   = "unassign"
+	OperationRestore    = "restore"
+)
+
+// Operation is an entry of a user's undo journal. Todo is only set in the
+// responses of undo and redo: the todo as it is afterwards, or nil when the
+// todo no longer exists.
+type Operation struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"`
+	TodoID    int       `json:"todo_id"`
+	Undone    bool      `json:"undone"`
+	Todo      *Todo     `json:"todo,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func CreateTodoOperationsTable() error {
+	// before_state and after_state hold the todo as JSON around the
+	// operation; one of them is NULL for creations and deletions. todo_id
+	// has no foreign key so that deletions can be undone. next_state holds
+	// the next occurrence an operation completing a recurring todo spawned,
+	// which undoing it deletes.
+	query := `
+	CREATE TABLE IF NOT EXISTS todo_operations (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		org_id INT NOT NULL DEFAULT 0,
+		kind VARCHAR(16) NOT NULL,
+		todo_id INT NOT NULL,
+		before_state MEDIUMTEXT NULL,
+		after_state MEDIUMTEXT NULL,
+		next_state MEDIUMTEXT NULL,
+		undone BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_user_org (user_id, org_id, id)
+	)`
+
+	if _, err := database.DB.Exec(query); err != nil {
+		return err
+	}
+	return database.AddColumnIfNotExists("todo_operations", "next_state", "MEDIUMTEXT NULL AFTER after_state")
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+type List struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	OrgID     int       `json:"org_id,omitempty"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role,omitempty"` // the caller's role on the list
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WorkflowState is a column on a list's board. Todos in a terminal state
+// are reported as completed.
+type WorkflowState struct {
+	Name       string `json:"name"`
+	Position   int    `json:"position"`
+	WIPLimit   *int   `json:"wip_limit,omitempty"`
+	IsTerminal bool   `json:"is_terminal"`
+}
+
+// StateTransition allows moving a todo from one state to another. A list
+// without any transitions allows every move.
+type StateTransition struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Workflow struct {
+	States      []WorkflowState   `json:"states"`
+	Transitions []StateTransition `json:"transitions"`
+}
+
+type BoardColumn struct {
+	State WorkflowState `json:"state"`
+	Count int           `json:"count"`
+	Todos []Todo        `json:"todos"`
+}
+
+type Board struct {
+	List    List          `json:"list"`
+	Columns []BoardColumn `json:"columns"`
+}
+
+// DefaultWorkflow is given to every new list
+var DefaultWorkflow = Workflow{
+	States: []WorkflowState{
+		{Name: "backlog", Position: 1},
+		{Name: "in_progress", Position: 2},
+		{Name: "review", Position: 3},
+		{Name: "done", Position: 4, IsTerminal: true},
+	},
+}
+
+func CreateListsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS lists (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		org_id INT NOT NULL DEFAULT 0,
+		name VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_user_id (user_id),
+		INDEX idx_org_id (org_id)
+	)`
+
+	if _, err := database.DB.Exec(query); err != nil {
+		return err
+	}
+
+	if err := database.AddColumnIfNotExists("lists", "org_id", "INT NOT NULL DEFAULT 0 AFTER user_id"); err != nil {
+		return err
+	}
+	return database.AddIndexIfNotExists("lists", "idx_org_id", "(org_id)")
+}
+
+func CreateWorkflowTables() error {
+	statesQuery := `
+	CREATE TABLE IF NOT EXISTS list_states (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		list_id INT NOT NULL,
+		name VARCHAR(32) NOT NULL,
+		position INT NOT NULL,
+		wip_limit INT NULL,
+		is_terminal BOOLEAN NOT NULL DEFAULT FALSE,
+		FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE,
+		UNIQUE KEY unique_list_state (list_id, name)
+	)`
+
+	if _, err := database.DB.Exec(statesQuery); err != nil {
+		return err
+	}
+
+	transitionsQuery := `
+	CREATE TABLE IF NOT EXISTS list_state_transitions (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		list_id INT NOT NULL,
+		from_state VARCHAR(32) NOT NULL,
+		to_state VARCHAR(32) NOT NULL,
+		FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE,
+		UNIQUE KEY unique_list_transition (list_id, from_state, to_state)
+	)`
+
+	_, err := database.DB.Exec(transitionsQuery)
+	return err
+}
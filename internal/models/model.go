@@ -15,16 +15,25 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-	Token string   `json:"token"`
-	User  UserInfo `json:"user"`
+	Token         string          `json:"token"`
+	User          UserInfo        `json:"user"`
+	Organizations []OrgMembership `json:"organizations"`
 }
 
 type UserInfo struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	Email        string    `json:"email"`
+	DefaultOrgID *int      `json:"default_org_id,omitempty"`
+	Timezone     string    `json:"timezone"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// MeResponse describes the authenticated user and the organizations they belong to
+type MeResponse struct {
+	User          UserInfo        `json:"user"`
+	Organizations []OrgMembership `json:"organizations"`
 }
 
 // Database models
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// Comment notification kinds; the other kinds are the todo event types, such
+// as todo.completed
+const (
+	NotificationCommented = "comment.created"
+	NotificationMentioned = "comment.mentioned"
+)
+
+// Watcher is a user following a todo
+type Watcher struct {
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Notification is an entry of a user's inbox. Repeated unread edits of a todo
+// by the same user are merged into one notification: Count is the number of
+// edits and UpdatedAt the time of the last one. ActorID is nil for changes
+// made by the system.
+type Notification struct {
+	ID        int             `json:"id"`
+	OrgID     int             `json:"org_id,omitempty"`
+	Kind      string          `json:"kind"`
+	ActorID   *int            `json:"actor_id,omitempty"`
+	ActorName string          `json:"actor_name,omitempty"`
+	TodoID    int             `json:"todo_id"`
+	TodoTitle string          `json:"todo_title"`
+	CommentID *int            `json:"comment_id,omitempty"`
+	Details   ActivityDetails `json:"details"`
+	Count     int             `json:"count"`
+	Summary   string          `json:"summary"`
+	Read      bool            `json:"read"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// NotificationPage is one page of an inbox, most recent first. Unread counts
+// the unread notifications of the whole inbox.
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	Page          int            `json:"page"`
+	PageSize      int            `json:"page_size"`
+	Total         int            `json:"total"`
+	Unread        int            `json:"unread"`
+}
+
+// NotificationPreferences tells, for each notification kind, whether the
+// user is notified of it. Kinds missing from an update are left unchanged.
+type NotificationPreferences struct {
+	Kinds map[string]bool `json:"kinds"`
+}
+
+// ReadRequest marks a notification read or unread
+type ReadRequest struct {
+	Read bool `json:"read"`
+}
+
+func CreateNotificationTables() error {
+	// Watchers have no foreign key on the todo: the watchers of a deleted
+	// todo are notified of the deletion, then removed.
+	watchersQuery := `
+	CREATE TABLE IF NOT EXISTS todo_watchers (
+		todo_id INT NOT NULL,
+		user_id INT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (todo_id, user_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_user_id (user_id)
+	)`
+
+	if _, err := database.DB.Exec(watchersQuery); err != nil {
+		return err
+	}
+
+	// Notifications outlive the todos they are about, like activity
+	notificationsQuery := `
+	CREATE TABLE IF NOT EXISTS notifications (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		org_id INT NOT NULL DEFAULT 0,
+		kind VARCHAR(32) NOT NULL,
+		actor_id INT NULL,
+		todo_id INT NOT NULL,
+		todo_title VARCHAR(255) NOT NULL DEFAULT '',
+		comment_id INT NULL,
+		details TEXT NOT NULL,
+		count INT NOT NULL DEFAULT 1,
+		read_at DATETIME NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_user_org_updated (user_id, org_id, updated_at),
+		INDEX idx_user_org_read (user_id, org_id, read_at)
+	)`
+
+	if _, err := database.DB.Exec(notificationsQuery); err != nil {
+		return err
+	}
+
+	preferencesQuery := `
+	CREATE TABLE IF NOT EXISTS notification_preferences (
+		user_id INT NOT NULL,
+		kind VARCHAR(32) NOT NULL,
+		enabled BOOLEAN NOT NULL,
+		PRIMARY KEY (user_id, kind),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`
+
+	_, err := database.DB.Exec(preferencesQuery)
+	return err
+}
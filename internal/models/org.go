@@ -0,0 +1,114 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// Organization roles. Lists and todos outside any organization belong to the
+// personal workspace, stored as org_id 0.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+var orgRoleRanks = map[string]int{
+	OrgRoleMember: 1,
+	OrgRoleAdmin:  2,
+	OrgRoleOwner:  3,
+}
+
+// IsValidOrgRole reports whether role is a known organization role
+func IsValidOrgRole(role string) bool {
+	_, ok := orgRoleRanks[role]
+	return ok
+}
+
+// HasOrgRole reports whether role grants at least the required organization role
+func HasOrgRole(role, required string) bool {
+	return role != "" && orgRoleRanks[role] >= orgRoleRanks[required]
+}
+
+// OrgSettings are per-organization preferences stored as JSON
+type OrgSettings struct {
+	Timezone              string `json:"timezone"`
+	DefaultListRole       string `json:"default_list_role"` // role members get on org lists; "" for none
+	MembersCanCreateLists bool   `json:"members_can_create_lists"`
+}
+
+// DefaultOrgSettings are given to every new organization
+var DefaultOrgSettings = OrgSettings{
+	Timezone:              "UTC",
+	DefaultListRole:       RoleEditor,
+	MembersCanCreateLists: true,
+}
+
+type Organization struct {
+	ID        int         `json:"id"`
+	Name      string      `json:"name"`
+	Slug      string      `json:"slug"`
+	Settings  OrgSettings `json:"settings"`
+	CreatedBy int         `json:"created_by"`
+	Role      string      `json:"role,omitempty"` // the caller's role in the organization
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// OrgMembership is one organization a user belongs to
+type OrgMembership struct {
+	OrgID    int       `json:"org_id"`
+	Name     string    `json:"name"`
+	Slug     string    `json:"slug"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type OrgMember struct {
+	OrgID    int       `json:"org_id"`
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// AddOrgMemberRequest identifies the user to add by username or email
+type AddOrgMemberRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+func CreateOrganizationsTables() error {
+	orgsQuery := `
+	CREATE TABLE IF NOT EXISTS organizations (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		slug VARCHAR(64) NOT NULL UNIQUE,
+		settings TEXT,
+		created_by INT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	)`
+
+	if _, err := database.DB.Exec(orgsQuery); err != nil {
+		return err
+	}
+
+	membersQuery := `
+	CREATE TABLE IF NOT EXISTS org_members (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		org_id INT NOT NULL,
+		user_id INT NOT NULL,
+		role VARCHAR(10) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		UNIQUE KEY unique_org_member (org_id, user_id),
+		INDEX idx_user_id (user_id)
+	)`
+
+	_, err := database.DB.Exec(membersQuery)
+	return err
+}
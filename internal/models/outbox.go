@@ -0,0 +1,61 @@
+package models
+
+import "todo/internal/database"
+
+func CreateOutboxTables() error {
+	// Events are written in the transaction of the mutation raising them.
+	// sequence orders the events of an aggregate, such as a todo, however
+	// the IDs are allocated; event_id is the idempotency key sinks receive.
+	eventsQuery := `
+	CREATE TABLE IF NOT EXISTS outbox_events (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		event_id CHAR(32) NOT NULL UNIQUE,
+		org_id INT NOT NULL DEFAULT 0,
+		aggregate_type VARCHAR(32) NOT NULL,
+		aggregate_id INT NOT NULL,
+		sequence INT NOT NULL,
+		event VARCHAR(32) NOT NULL,
+		payload MEDIUMTEXT NOT NULL,
+		status VARCHAR(16) NOT NULL DEFAULT 'pending',
+		attempts INT NOT NULL DEFAULT 0,
+		last_error TEXT NULL,
+		next_attempt_at DATETIME NOT NULL,
+		published_at DATETIME NULL,
+		created_at DATETIME NOT NULL,
+		UNIQUE KEY uk_aggregate_sequence (aggregate_type, aggregate_id, sequence),
+		INDEX idx_status_next (status, next_attempt_at)
+	)`
+
+	if _, err := database.DB.Exec(eventsQuery); err != nil {
+		return err
+	}
+
+	// The last sequence number of each aggregate; updating it locks the
+	// row, so concurrent mutations of an aggregate number their events in
+	// commit order
+	sequencesQuery := `
+	CREATE TABLE IF NOT EXISTS outbox_sequences (
+		aggregate_type VARCHAR(32) NOT NULL,
+		aggregate_id INT NOT NULL,
+		last_sequence INT NOT NULL,
+		PRIMARY KEY (aggregate_type, aggregate_id)
+	)`
+
+	if _, err := database.DB.Exec(sequencesQuery); err != nil {
+		return err
+	}
+
+	// The events each subscriber of the in-process bus has handled, so that
+	// events published again are not handled twice
+	consumedQuery := `
+	CREATE TABLE IF NOT EXISTS outbox_consumed (
+		consumer VARCHAR(64) NOT NULL,
+		event_id CHAR(32) NOT NULL,
+		consumed_at DATETIME NOT NULL,
+		PRIMARY KEY (consumer, event_id),
+		INDEX idx_consumed_at (consumed_at)
+	)`
+
+	_, err := database.DB.Exec(consumedQuery)
+	return err
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// MaxPushSubscriptions caps the devices a user can receive push messages on
+const MaxPushSubscriptions = 20
+
+// Kinds of push messages
+const (
+	PushReminder = "reminder"
+	PushAssigned = "todo.assigned"
+)
+
+// PushSubscription is a browser or device receiving push messages
+type PushSubscription struct {
+	ID            int        `json:"id"`
+	Endpoint      string     `json:"endpoint"`
+	DeviceName    string     `json:"device_name,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+}
+
+// PushSubscriptionRequest registers a device. Endpoint and Keys are the
+// fields of the browser's PushSubscription.toJSON().
+type PushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+	DeviceName string `json:"device_name"`
+}
+
+// PushPayload is the JSON payload of a push message, for the service worker
+// to show as a notification
+type PushPayload struct {
+	Kind   string `json:"kind"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	TodoID int    `json:"todo_id"`
+	OrgID  int    `json:"org_id,omitempty"`
+}
+
+// PushKey is the VAPID public key browsers subscribe with
+type PushKey struct {
+	PublicKey string `json:"public_key"`
+}
+
+func CreatePushTables() error {
+	// Endpoints are too long to index, so they are unique by their SHA-256
+	subscriptionsQuery := `
+	CREATE TABLE IF NOT EXISTS push_subscriptions (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		endpoint VARCHAR(2048) NOT NULL,
+		endpoint_hash CHAR(64) NOT NULL UNIQUE,
+		p256dh VARCHAR(255) NOT NULL,
+		auth VARCHAR(255) NOT NULL,
+		device_name VARCHAR(255) NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_success_at DATETIME NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_user_id (user_id)
+	)`
+
+	if _, err := database.DB.Exec(subscriptionsQuery); err != nil {
+		return err
+	}
+
+	// A message is queued once per subscription; dedupe_key makes queueing
+	// the same reminder twice a no-op
+	queueQuery := `
+	CREATE TABLE IF NOT EXISTS push_queue (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		subscription_id INT NOT NULL,
+		dedupe_key VARCHAR(128) NULL UNIQUE,
+		payload TEXT NOT NULL,
+		urgency VARCHAR(16) NOT NULL,
+		topic VARCHAR(32) NOT NULL DEFAULT '',
+		status VARCHAR(16) NOT NULL DEFAULT 'pending',
+		attempts INT NOT NULL DEFAULT 0,
+		last_error TEXT NULL,
+		next_attempt_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		sent_at DATETIME NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (subscription_id) REFERENCES push_subscriptions(id) ON DELETE CASCADE,
+		INDEX idx_status_next (status, next_attempt_at)
+	)`
+
+	_, err := database.DB.Exec(queueQuery)
+	return err
+}
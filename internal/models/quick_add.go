@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// QuickAddRequest is free text such as "Pay rent tomorrow 9am #home !high
+// every month". With Preview set, the text is only parsed.
+type QuickAddRequest struct {
+	Text    string `json:"text"`
+	Preview bool   `json:"preview"`
+}
+
+// ParsedTodo is what the quick-add parser understood. DueDate is in UTC;
+// AllDay is set when only a date was given, in which case DueDate is the
+// start of that day in the user's timezone.
+type ParsedTodo struct {
+	Title      string     `json:"title"`
+	DueDate    *time.Time `json:"due_date,omitempty"`
+	AllDay     bool       `json:"all_day"`
+	Tags       []string   `json:"tags"`
+	Priority   string     `json:"priority,omitempty"`
+	Recurrence string     `json:"recurrence,omitempty"`
+	ListName   string     `json:"list_name,omitempty"`
+	ListID     *int       `json:"list_id,omitempty"`
+}
+
+// QuickAddResult holds the parsed text and, unless previewing, the new todo
+type QuickAddResult struct {
+	Parsed ParsedTodo `json:"parsed"`
+	Todo   *Todo      `json:"todo,omitempty"`
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// Rule limits
+const (
+	MaxRules       = 50 // per user and tenant
+	MaxRuleActions = 10
+)
+
+// Rule actions
+const (
+	ActionCreateTodo  = "create_todo"
+	ActionMoveToTop   = "move_to_top"
+	ActionAssign      = "assign"
+	ActionSetPriority = "set_priority"
+	ActionAddTag      = "add_tag"
+	ActionSetState    = "set_state"
+	ActionComplete    = "complete"
+)
+
+// Rule execution outcomes
+const (
+	ExecutionSucceeded = "succeeded"
+	ExecutionFailed    = "failed"
+	ExecutionSkipped   = "skipped"
+)
+
+// Rule is a user-defined automation: when its trigger fires on a todo the
+// owner can see, and the todo meets the conditions, the actions run in
+// order with the owner's permissions. A rule with a list only applies to
+// the todos of that list.
+type Rule struct {
+	ID         int            `json:"id"`
+	UserID     int            `json:"user_id"`
+	OrgID      int            `json:"org_id,omitempty"`
+	Name       string         `json:"name"`
+	Enabled    bool           `json:"enabled"`
+	ListID     *int           `json:"list_id,omitempty"`
+	Trigger    RuleTrigger    `json:"trigger"`
+	Conditions RuleConditions `json:"conditions"`
+	Actions    []RuleAction   `json:"actions"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// RuleTrigger is the todo event starting a rule, such as todo.completed.
+// Tag narrows todo.tagged to one tag; Days is how long a todo must be
+// overdue for todo.overdue.
+type RuleTrigger struct {
+	Event string `json:"event"`
+	Tag   string `json:"tag,omitempty"`
+	Days  int    `json:"days,omitempty"`
+}
+
+// RuleConditions must all hold for the rule to run. Empty fields always hold.
+type RuleConditions struct {
+	Tags          []string `json:"tags,omitempty"`       // every one of these tags
+	Priorities    []string `json:"priorities,omitempty"` // any of these priorities
+	States        []string `json:"states,omitempty"`     // any of these workflow states
+	Completed     *bool    `json:"completed,omitempty"`
+	TitleContains string   `json:"title_contains,omitempty"`
+}
+
+// RuleAction is one step of a rule. Title and Description of create_todo
+// may contain {{title}}, the title of the todo that triggered the rule; its
+// todo goes in ListID, or else in the same list.
+type RuleAction struct {
+	Type        string   `json:"type"`
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	ListID      *int     `json:"list_id,omitempty"`
+	DueInDays   *int     `json:"due_in_days,omitempty"`
+	Priority    string   `json:"priority,omitempty"`
+	Tag         string   `json:"tag,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	State       string   `json:"state,omitempty"`
+	UserID      int      `json:"user_id,omitempty"`
+}
+
+type RuleRequest struct {
+	Name       string         `json:"name"`
+	Enabled    *bool          `json:"enabled,omitempty"` // defaults to true
+	ListID     *int           `json:"list_id,omitempty"`
+	Trigger    RuleTrigger    `json:"trigger"`
+	Conditions RuleConditions `json:"conditions"`
+	Actions    []RuleAction   `json:"actions"`
+}
+
+// RuleExecution is an entry of a rule's execution log
+type RuleExecution struct {
+	ID        int       `json:"id"`
+	RuleID    int       `json:"rule_id"`
+	TodoID    *int      `json:"todo_id,omitempty"`
+	Event     string    `json:"event"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message"`
+	Depth     int       `json:"depth"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RuleExecutionPage is one page of a rule's execution log, newest first
+type RuleExecutionPage struct {
+	Executions []RuleExecution `json:"executions"`
+	Page       int             `json:"page"`
+	PageSize   int             `json:"page_size"`
+	Total      int             `json:"total"`
+}
+
+func CreateRuleTables() error {
+	// The trigger event is a column so that mutations only load the rules
+	// they can fire; the rest of the rule is stored as JSON
+	rulesQuery := `
+	CREATE TABLE IF NOT EXISTS todo_rules (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		org_id INT NOT NULL DEFAULT 0,
+		name VARCHAR(255) NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		list_id INT NULL,
+		trigger_event VARCHAR(32) NOT NULL,
+		definition TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE,
+		INDEX idx_user_org (user_id, org_id),
+		INDEX idx_org_trigger (org_id, trigger_event)
+	)`
+
+	if _, err := database.DB.Exec(rulesQuery); err != nil {
+		return err
+	}
+
+	// due_date records the due date an overdue rule fired for, so that it
+	// fires once per todo until the due date changes
+	executionsQuery := `
+	CREATE TABLE IF NOT EXISTS rule_executions (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		rule_id INT NOT NULL,
+		todo_id INT NULL,
+		event VARCHAR(32) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		message VARCHAR(1000) NOT NULL DEFAULT '',
+		depth INT NOT NULL DEFAULT 0,
+		due_date DATETIME NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (rule_id) REFERENCES todo_rules(id) ON DELETE CASCADE,
+		INDEX idx_rule_id (rule_id, id),
+		INDEX idx_rule_todo (rule_id, todo_id)
+	)`
+
+	_, err := database.DB.Exec(executionsQuery)
+	return err
+}
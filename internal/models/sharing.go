@@ -0,0 +1,104 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// List roles, from least to most privileged. The owner is the user who
+// created the list and is never stored in list_members.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+	RoleOwner  = "owner"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+// IsValidMemberRole reports whether role can be granted to a list member
+func IsValidMemberRole(role string) bool {
+	return role == RoleViewer || role == RoleEditor || role == RoleAdmin
+}
+
+// HasRole reports whether role grants at least the required role
+func HasRole(role, required string) bool {
+	return role != "" && roleRanks[role] >= roleRanks[required]
+}
+
+// Invitation statuses
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+)
+
+type ListMember struct {
+	ListID    int       `json:"list_id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ListInvitation struct {
+	ID          int        `json:"id"`
+	ListID      int        `json:"list_id"`
+	ListName    string     `json:"list_name"`
+	InviterID   int        `json:"inviter_id"`
+	InviteeID   int        `json:"invitee_id"`
+	Role        string     `json:"role"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+}
+
+// InviteRequest identifies the invitee by username or email
+type InviteRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+func CreateSharingTables() error {
+	membersQuery := `
+	CREATE TABLE IF NOT EXISTS list_members (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		list_id INT NOT NULL,
+		user_id INT NOT NULL,
+		role VARCHAR(10) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		UNIQUE KEY unique_list_member (list_id, user_id),
+		INDEX idx_user_id (user_id)
+	)`
+
+	if _, err := database.DB.Exec(membersQuery); err != nil {
+		return err
+	}
+
+	invitationsQuery := `
+	CREATE TABLE IF NOT EXISTS list_invitations (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		list_id INT NOT NULL,
+		inviter_id INT NOT NULL,
+		invitee_id INT NOT NULL,
+		role VARCHAR(10) NOT NULL,
+		status VARCHAR(10) NOT NULL DEFAULT 'pending',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		responded_at TIMESTAMP NULL,
+		FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE,
+		FOREIGN KEY (inviter_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (invitee_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_invitee_status (invitee_id, status)
+	)`
+
+	_, err := database.DB.Exec(invitationsQuery)
+	return err
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+	"todo/internal/database"
+)
+
+// SmartListVersion is the version of the definition format written by the
+// API. Stored definitions of older versions are upgraded when they are read.
+const SmartListVersion = 1
+
+// MaxSmartLists caps the number of smart lists a user has in a tenant
+const MaxSmartLists = 100
+
+// Due windows of a smart list definition, relative to today in the user's
+// timezone
+const (
+	DueNone      = "none"
+	DueOverdue   = "overdue"
+	DueToday     = "today"
+	DueTomorrow  = "tomorrow"
+	DueThisWeek  = "this_week"
+	DueNext7Days = "next_7_days"
+)
+
+// SmartList is a saved filter over the todos a user can see. Count is only
+// set in the sidebar listing.
+type SmartList struct {
+	ID         int                 `json:"id"`
+	UserID     int                 `json:"user_id"`
+	OrgID      int                 `json:"org_id,omitempty"`
+	Name       string              `json:"name"`
+	Definition SmartListDefinition `json:"definition"`
+	Count      *int                `json:"count,omitempty"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+}
+
+// SmartListDefinition holds the conditions of a smart list, all of which a
+// todo must meet. Empty fields match every todo, so fields added in later
+// versions leave existing definitions unchanged.
+type SmartListDefinition struct {
+	Version        int      `json:"version"`
+	Completed      *bool    `json:"completed,omitempty"`
+	Tags           []string `json:"tags,omitempty"`       // every one of these tags
+	ListIDs        []int    `json:"list_ids,omitempty"`   // any of these lists
+	Priorities     []string `json:"priorities,omitempty"` // any of these priorities
+	States         []string `json:"states,omitempty"`     // any of these workflow states
+	Due            string   `json:"due,omitempty"`
+	AssignedToMe   bool     `json:"assigned_to_me,omitempty"`
+	Search         string   `json:"search,omitempty"` // in the title or description
+	IncludeSnoozed bool     `json:"include_snoozed,omitempty"`
+	Sort           string   `json:"sort,omitempty"` // manual, priority or smart
+}
+
+// SmartListRequest creates or replaces a smart list. The definition is
+// checked strictly: unknown fields are rejected.
+type SmartListRequest struct {
+	Name       string          `json:"name"`
+	Definition json.RawMessage `json:"definition"`
+}
+
+func CreateSmartListsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS smart_lists (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		org_id INT NOT NULL DEFAULT 0,
+		name VARCHAR(255) NOT NULL,
+		definition TEXT NOT NULL,
+		version INT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_user_org (user_id, org_id)
+	)`
+
+	_, err := database.DB.Exec(query)
+	return err
+}
@@ -0,0 +1,10 @@
+package models
+
+// SnoozeRequest hides a todo until a time given either as an RFC 3339
+// timestamp or in words relative to now in the user's timezone, such as
+// "monday 9am" or "in 2 hours". A date alone means the start of that day.
+// With MoveToTop, the todo moves to the top of the manual order on waking.
+type SnoozeRequest struct {
+	Until     string `json:"until"`
+	MoveToTop bool   `json:"move_to_top"`
+}
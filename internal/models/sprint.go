@@ -0,0 +1,152 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// Sprint statuses. A list has at most one active sprint.
+const (
+	SprintPlanned = "planned"
+	SprintActive  = "active"
+	SprintClosed  = "closed"
+)
+
+// Estimate units used to sum the estimates of a sprint's todos
+const (
+	EstimatePoints = "points"
+	EstimateHours  = "hours"
+)
+
+func IsValidEstimateUnit(unit string) bool {
+	return unit == EstimatePoints || unit == EstimateHours
+}
+
+// Sprint is a time box on a list. Start and end dates are inclusive and are
+// formatted as 2006-01-02.
+type Sprint struct {
+	ID        int        `json:"id"`
+	ListID    int        `json:"list_id"`
+	Name      string     `json:"name"`
+	Goal      string     `json:"goal"`
+	StartDate string     `json:"start_date"`
+	EndDate   string     `json:"end_date"`
+	Unit      string     `json:"unit"`
+	Status    string     `json:"status"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+	CreatedBy int        `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	// Totals of the todos currently in the sprint
+	TodoCount      int     `json:"todo_count"`
+	CompletedCount int     `json:"completed_count"`
+	Estimate       float64 `json:"estimate"`
+	Remaining      float64 `json:"remaining"`
+}
+
+// SprintRequest creates or edits a sprint
+type SprintRequest struct {
+	Name      string `json:"name"`
+	Goal      string `json:"goal"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Unit      string `json:"unit"`
+}
+
+// CloseSprintRequest closes a sprint. Unfinished todos move to NextSprintID,
+// or to the list's next planned sprint when it is not given.
+type CloseSprintRequest struct {
+	NextSprintID *int `json:"next_sprint_id,omitempty"`
+}
+
+// CloseSprintResult reports where the unfinished todos of a closed sprint went
+type CloseSprintResult struct {
+	Sprint            Sprint  `json:"sprint"`
+	NextSprint        *Sprint `json:"next_sprint,omitempty"`
+	RolledOver        []int   `json:"rolled_over"`
+	ReturnedToBacklog []int   `json:"returned_to_backlog"`
+}
+
+// SprintTodoRequest moves a todo into a sprint; a nil sprint_id removes it
+// from its sprint
+type SprintTodoRequest struct {
+	SprintID *int `json:"sprint_id"`
+}
+
+// SprintChart holds burndown and burnup series for a sprint, one value per
+// day in Dates. Values are nil for days that have not happened yet.
+type SprintChart struct {
+	SprintID int      `json:"sprint_id"`
+	Unit     string   `json:"unit"`
+	Timezone string   `json:"timezone"`
+	Dates    []string `json:"dates"`
+
+	// Scope is the total estimate in the sprint at the end of each day and
+	// Completed the part of it that was done; Remaining is their difference
+	Scope     []*float64 `json:"scope"`
+	Completed []*float64 `json:"completed"`
+	Remaining []*float64 `json:"remaining"`
+
+	// Ideal burns the scope at the start of the sprint down to zero evenly
+	Ideal []float64 `json:"ideal"`
+}
+
+// CreateSprintTables creates the sprints table, the history of which todos
+// were in which sprint, and the history of todo completion changes. Both
+// histories are needed to chart a sprint after the fact: todos move between
+// sprints when sprints close, and completion can be toggled back and forth.
+func CreateSprintTables() error {
+	sprintsQuery := `
+	CREATE TABLE IF NOT EXISTS sprints (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		list_id INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		goal TEXT,
+		start_date DATE NOT NULL,
+		end_date DATE NOT NULL,
+		unit VARCHAR(10) NOT NULL DEFAULT 'points',
+		status VARCHAR(10) NOT NULL DEFAULT 'planned',
+		closed_at TIMESTAMP NULL,
+		created_by INT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE,
+		INDEX idx_list_start (list_id, start_date)
+	)`
+
+	if _, err := database.DB.Exec(sprintsQuery); err != nil {
+		return err
+	}
+
+	// removed_at is NULL while the todo is in the sprint
+	membershipQuery := `
+	CREATE TABLE IF NOT EXISTS sprint_todos (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		sprint_id INT NOT NULL,
+		todo_id INT NOT NULL,
+		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		removed_at TIMESTAMP NULL,
+		FOREIGN KEY (sprint_id) REFERENCES sprints(id) ON DELETE CASCADE,
+		FOREIGN KEY (todo_id) REFERENCES todos(id) ON DELETE CASCADE,
+		INDEX idx_sprint_id (sprint_id),
+		INDEX idx_todo_id (todo_id)
+	)`
+
+	if _, err := database.DB.Exec(membershipQuery); err != nil {
+		return err
+	}
+
+	completionQuery := `
+	CREATE TABLE IF NOT EXISTS todo_completion_events (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		todo_id INT NOT NULL,
+		completed BOOLEAN NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (todo_id) REFERENCES todos(id) ON DELETE CASCADE,
+		INDEX idx_todo_created (todo_id, created_at)
+	)`
+
+	_, err := database.DB.Exec(completionQuery)
+	return err
+}
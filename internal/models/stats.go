@@ -0,0 +1,80 @@
+package models
+
+// Statistics breakdowns
+const (
+	StatsByList = "list"
+	StatsByTag  = "tag"
+)
+
+// StatsBucket counts the todos created and completed in one day or week,
+// starting at Start in the user's timezone
+type StatsBucket struct {
+	Start     string `json:"start"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+}
+
+// CompletionTime summarizes how long todos completed in the range took,
+// from creation to completion
+type CompletionTime struct {
+	Count          int     `json:"count"`
+	AverageSeconds float64 `json:"average_seconds"`
+}
+
+// Streak is a run of consecutive days with at least one completed todo. The
+// current streak ends today or yesterday; otherwise it is empty.
+type Streak struct {
+	Days  int    `json:"days"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type Streaks struct {
+	Current Streak `json:"current"`
+	Longest Streak `json:"longest"`
+}
+
+// WeekdayStats counts the todos completed on a weekday in the range
+type WeekdayStats struct {
+	Weekday   string `json:"weekday"`
+	Completed int    `json:"completed"`
+}
+
+// ListStats breaks the range down by list. ListID is nil for todos outside
+// any list.
+type ListStats struct {
+	ListID    *int   `json:"list_id"`
+	Name      string `json:"name"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+	Open      int    `json:"open"`
+}
+
+// TagStats breaks the range down by tag. A todo with several tags counts
+// towards each of them.
+type TagStats struct {
+	Tag       string `json:"tag"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+	Open      int    `json:"open"`
+}
+
+// Stats are the productivity statistics of the todos a user can see, over an
+// inclusive date range in the user's timezone. Streaks look back over the
+// last year regardless of the range. Either Lists or Tags is set, as chosen
+// by Breakdown.
+type Stats struct {
+	From           string         `json:"from"`
+	To             string         `json:"to"`
+	GroupBy        string         `json:"group_by"`
+	Timezone       string         `json:"timezone"`
+	Created        int            `json:"created"`
+	Completed      int            `json:"completed"`
+	Buckets        []StatsBucket  `json:"buckets"`
+	CompletionTime CompletionTime `json:"completion_time"`
+	Streaks        Streaks        `json:"streaks"`
+	Weekdays       []WeekdayStats `json:"busiest_weekdays"`
+	Breakdown      string         `json:"breakdown"`
+	Lists          []ListStats    `json:"lists,omitempty"`
+	Tags           []TagStats     `json:"tags,omitempty"`
+}
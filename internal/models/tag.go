@@ -0,0 +1,31 @@
+package models
+
+import "todo/internal/database"
+
+// Tag limits
+const (
+	MaxTagLength   = 64
+	MaxTagsPerTodo = 20
+)
+
+// TagCount is a tag with the number of visible todos carrying it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// CreateTodoTagsTable creates the todo_tags table. Tags are stored lowercase
+// without the leading #.
+func CreateTodoTagsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS todo_tags (
+		todo_id INT NOT NULL,
+		tag VARCHAR(64) NOT NULL,
+		PRIMARY KEY (todo_id, tag),
+		FOREIGN KEY (todo_id) REFERENCES todos(id) ON DELETE CASCADE,
+		INDEX idx_tag (tag)
+	)`
+
+	_, err := database.DB.Exec(query)
+	return err
+}
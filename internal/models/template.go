@@ -0,0 +1,99 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// MaxTemplateItems caps the number of todos in a template
+const MaxTemplateItems = 200
+
+// Template is a reusable set of todos. Titles and descriptions may contain
+// placeholders such as {{name}}, filled in when the template is instantiated.
+type Template struct {
+	ID          int            `json:"id"`
+	UserID      int            `json:"user_id"`
+	OrgID       int            `json:"org_id,omitempty"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Variables   []string       `json:"variables"`
+	Items       []TemplateItem `json:"items"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// TemplateItem is one todo of a template, in the order given by Position.
+// A todo created from it is due DueOffsetDays after the instantiation's start
+// date, at DueTime (HH:MM in the user's timezone) or else at the start of
+// that day.
+type TemplateItem struct {
+	Position      int      `json:"position"`
+	Title         string   `json:"title"`
+	Description   string   `json:"description"`
+	Priority      string   `json:"priority"`
+	Estimate      *float64 `json:"estimate,omitempty"`
+	DueOffsetDays *int     `json:"due_offset_days,omitempty"`
+	DueTime       string   `json:"due_time,omitempty"`
+	Tags          []string `json:"tags"`
+}
+
+// TemplateRequest creates or replaces a template; items are kept in the
+// order given
+type TemplateRequest struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Items       []TemplateItem `json:"items"`
+}
+
+// SnapshotRequest creates a template from the todos of a list
+type SnapshotRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// InstantiateRequest creates the todos of a template, optionally in a list.
+// StartDate (YYYY-MM-DD) defaults to today.
+type InstantiateRequest struct {
+	ListID    *int              `json:"list_id,omitempty"`
+	StartDate string            `json:"start_date,omitempty"`
+	Variables map[string]string `json:"variables"`
+}
+
+func CreateTemplateTables() error {
+	templatesQuery := `
+	CREATE TABLE IF NOT EXISTS todo_templates (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		org_id INT NOT NULL DEFAULT 0,
+		name VARCHAR(255) NOT NULL,
+		description TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_user_org (user_id, org_id)
+	)`
+
+	if _, err := database.DB.Exec(templatesQuery); err != nil {
+		return err
+	}
+
+	// Tags are stored as a comma-separated list of normalized tags
+	itemsQuery := `
+	CREATE TABLE IF NOT EXISTS template_items (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		template_id INT NOT NULL,
+		position INT NOT NULL,
+		title VARCHAR(255) NOT NULL,
+		description TEXT,
+		priority VARCHAR(10) NOT NULL DEFAULT 'none',
+		estimate DECIMAL(8,2) NULL,
+		due_offset_days INT NULL,
+		due_time VARCHAR(5) NULL,
+		tags VARCHAR(1400) NOT NULL DEFAULT '',
+		FOREIGN KEY (template_id) REFERENCES todo_templates(id) ON DELETE CASCADE,
+		INDEX idx_template_position (template_id, position)
+	)`
+
+	_, err := database.DB.Exec(itemsQuery)
+	return err
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"time"
+	"todo/internal/database"
+)
+
+// Time entry sources
+const (
+	TimeSourceTimer  = "timer"
+	TimeSourceManual = "manual"
+)
+
+// Report groupings
+const (
+	ReportByDay  = "day"
+	ReportByWeek = "week"
+)
+
+// TimeEntry is time spent by a user on a todo. EndedAt is nil while the
+// timer is running; Duration is then the time elapsed so far.
+type TimeEntry struct {
+	ID        int        `json:"id"`
+	TodoID    int        `json:"todo_id"`
+	TodoTitle string     `json:"todo_title"`
+	UserID    int        `json:"user_id"`
+	Source    string     `json:"source"`
+	Note      string     `json:"note"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Duration  int64      `json:"duration_seconds"`
+	Running   bool       `json:"running"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TimeEntryRequest creates or edits a manual entry. The end is given either
+// as ended_at or as a duration from started_at.
+type TimeEntryRequest struct {
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Duration  int64      `json:"duration_seconds,omitempty"`
+	Note      string     `json:"note"`
+}
+
+// UserTime is the time a user spent on a todo or list
+type UserTime struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Seconds  int64  `json:"seconds"`
+}
+
+// TodoTime is the time spent on a todo
+type TodoTime struct {
+	TodoID  int        `json:"todo_id"`
+	Title   string     `json:"title"`
+	Seconds int64      `json:"seconds"`
+	ByUser  []UserTime `json:"by_user,omitempty"`
+}
+
+// ListTime is the time spent on the todos of a list
+type ListTime struct {
+	ListID  int        `json:"list_id"`
+	Seconds int64      `json:"seconds"`
+	ByUser  []UserTime `json:"by_user"`
+	ByTodo  []TodoTime `json:"by_todo"`
+}
+
+// TimeReportBucket is the time tracked in one day or week, starting at Start
+// in the user's timezone
+type TimeReportBucket struct {
+	Start   string `json:"start"`
+	Seconds int64  `json:"seconds"`
+}
+
+type TimeReport struct {
+	From     string             `json:"from"`
+	To       string             `json:"to"`
+	GroupBy  string             `json:"group_by"`
+	Timezone string             `json:"timezone"`
+	Seconds  int64              `json:"seconds"`
+	Buckets  []TimeReportBucket `json:"buckets"`
+}
+
+// CreateTimeEntriesTable creates the time_entries table. Entries are billing
+// records, so they outlive their todo: todo_id has no foreign key and the
+// todo's organization is kept on the entry for reports.
+func CreateTimeEntriesTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS time_entries (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		todo_id INT NOT NULL,
+		org_id INT NOT NULL DEFAULT 0,
+		user_id INT NOT NULL,
+		source VARCHAR(10) NOT NULL,
+		note VARCHAR(500) NOT NULL DEFAULT '',
+		started_at DATETIME NOT NULL,
+		ended_at DATETIME NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_todo_id (todo_id),
+		INDEX idx_user_started (user_id, started_at),
+		INDEX idx_user_running (user_id, ended_at)
+	)`
+
+	_, err := database.DB.Exec(query)
+	return err
+}
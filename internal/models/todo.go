@@ -5,15 +5,87 @@ import (
 	"todo/internal/database"
 )
 
+// Priority levels, from lowest to highest
+const (
+	PriorityNone   = "none"
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+var priorityRanks = map[string]int{
+	PriorityNone:   0,
+	PriorityLow:    1,
+	PriorityMedium: 2,
+	PriorityHigh:   3,
+	PriorityUrgent: 4,
+}
+
+// MaxPriorityRank is the rank of the highest priority level
+const MaxPriorityRank = 4
+
+// IsValidPriority reports whether p is one of the known priority levels
+func IsValidPriority(p string) bool {
+	_, ok := priorityRanks[p]
+	return ok
+}
+
+// PriorityRank returns the numeric rank of a priority (0 for none or unknown)
+func PriorityRank(p string) int {
+	return priorityRanks[p]
+}
+
 type Todo struct {
-	ID          int       `json:"id"`
-	UserID      int       `json:"user_id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Completed   bool      `json:"completed"`
-	OrderNo     int       `json:"order_no"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	OrgID       int        `json:"org_id,omitempty"`
+	ListID      *int       `json:"list_id,omitempty"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Priority    string     `json:"priority"`
+	Estimate    *float64   `json:"estimate,omitempty"`
+	DueDate     *time.Time `json:"due_date,omitempty"`
+
+	// OrderNo is the todo's place in its owner's manual order. Archived todos
+	// leave the order and have none.
+	OrderNo    int        `json:"order_no"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+
+	// SprintID is the sprint the todo is planned in; it is changed through
+	// the sprint endpoints, not by updating the todo
+	SprintID *int `json:"sprint_id,omitempty"`
+
+	// State and StatePosition are only set for todos in a list, where they
+	// give the todo's board column and its position within that column
+	State         string `json:"state,omitempty"`
+	StatePosition int    `json:"state_position,omitempty"`
+
+	// SnoozedUntil hides the todo from the default todo views until then.
+	// With SnoozeToTop it moves to the top of the manual order on waking.
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"`
+	SnoozeToTop  bool       `json:"snooze_to_top,omitempty"`
+
+	// Recurrence repeats the todo when it is completed. It is a subset of the
+	// iCalendar RRULE format, such as FREQ=WEEKLY;INTERVAL=2.
+	Recurrence string `json:"recurrence,omitempty"`
+
+	// Tags is always set on todos returned by the API. When updating a todo,
+	// nil keeps its tags and an empty list removes them.
+	Tags []string `json:"tags"`
+
+	// Assignees is always set on todos returned by the API
+	Assignees []Assignee `json:"assignees"`
+
+	CreatedBy int       `json:"created_by"`
+	UpdatedBy int       `json:"updated_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Score is only set when todos are returned in smart order
+	Score *float64 `json:"score,omitempty"`
 }
 
 func CreateTodosTable() error {
@@ -21,18 +93,113 @@ func CreateTodosTable() error {
 	CREATE TABLE IF NOT EXISTS todos (
 		id INT AUTO_INCREMENT PRIMARY KEY,
 		user_id INT NOT NULL,
+		org_id INT NOT NULL DEFAULT 0,
+		list_id INT NULL,
 		title VARCHAR(255) NOT NULL,
 		description TEXT,
 		completed BOOLEAN DEFAULT FALSE,
-		order_no INT NOT NULL,
+		completed_at DATETIME NULL,
+		priority VARCHAR(10) NOT NULL DEFAULT 'none',
+		estimate DECIMAL(8,2) NULL,
+		due_date DATETIME NULL,
+		order_no INT NULL,
+		state VARCHAR(32) NULL,
+		state_position INT NOT NULL DEFAULT 0,
+		sprint_id INT NULL,
+		recurrence VARCHAR(64) NULL,
+		snoozed_until DATETIME NULL,
+		snooze_to_top BOOLEAN NOT NULL DEFAULT FALSE,
+		archived_at DATETIME NULL,
+		created_by INT NULL,
+		updated_by INT NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE SET NULL,
 		INDEX idx_user_id (user_id),
+		INDEX idx_list_state (list_id, state, state_position),
 		INDEX idx_user_order (user_id, order_no),
-		UNIQUE KEY unique_user_order (user_id, order_no)
+		INDEX idx_org_id (org_id),
+		INDEX idx_sprint_id (sprint_id),
+		INDEX idx_org_created (org_id, created_at),
+		INDEX idx_org_completed (org_id, completed_at),
+		INDEX idx_snoozed_until (snoozed_until),
+		INDEX idx_org_archived (org_id, archived_at),
+		UNIQUE KEY unique_user_org_order (user_id, org_id, order_no)
 	)`
 
-	_, err := database.DB.Exec(query)
-	return err
+	if _, err := database.DB.Exec(query); err != nil {
+		return err
+	}
+
+	for _, m := range todoColumnMigrations {
+		if err := database.AddColumnIfNotExists("todos", m.column, m.definition); err != nil {
+			return err
+		}
+	}
+	if err := database.AddIndexIfNotExists("todos", "idx_list_state", "(list_id, state, state_position)"); err != nil {
+		return err
+	}
+	if err := database.AddIndexIfNotExists("todos", "idx_org_id", "(org_id)"); err != nil {
+		return err
+	}
+	if err := database.AddIndexIfNotExists("todos", "idx_sprint_id", "(sprint_id)"); err != nil {
+		return err
+	}
+	if err := database.AddIndexIfNotExists("todos", "idx_org_created", "(org_id, created_at)"); err != nil {
+		return err
+	}
+	if err := database.AddIndexIfNotExists("todos", "idx_org_completed", "(org_id, completed_at)"); err != nil {
+		return err
+	}
+	if err := database.AddIndexIfNotExists("todos", "idx_snoozed_until", "(snoozed_until)"); err != nil {
+		return err
+	}
+	if err := database.AddIndexIfNotExists("todos", "idx_org_archived", "(org_id, archived_at)"); err != nil {
+		return err
+	}
+
+	// Archived todos have no order number, which the unique key allows
+	if err := database.MakeColumnNullable("todos", "order_no", "INT NULL"); err != nil {
+		return err
+	}
+
+	// Todos completed before completed_at existed get their last update time,
+	// the closest value available
+	_, err := database.DB.Exec(`
+		UPDATE todos
+		SET completed_at = updated_at, updated_at = updated_at
+		WHERE completed = TRUE AND completed_at IS NULL`)
+	if err != nil {
+		return err
+	}
+
+	// The manual order is kept per user and organization
+	if err := database.AddUniqueKeyIfNotExists("todos", "unique_user_org_order", "(user_id, org_id, order_no)"); err != nil {
+		return err
+	}
+	return database.DropIndexIfExists("todos", "unique_user_order")
+}
+
+// todoColumnMigrations lists the columns added after the initial todos schema,
+// so existing tables are brought up to date on startup
+var todoColumnMigrations = []struct {
+	column     string
+	definition string
+}{
+	{"priority", "VARCHAR(10) NOT NULL DEFAULT 'none' AFTER completed"},
+	{"due_date", "DATETIME NULL AFTER priority"},
+	{"list_id", "INT NULL AFTER user_id"},
+	{"state", "VARCHAR(32) NULL AFTER order_no"},
+	{"state_position", "INT NOT NULL DEFAULT 0 AFTER state"},
+	{"created_by", "INT NULL AFTER state_position"},
+	{"updated_by", "INT NULL AFTER created_by"},
+	{"org_id", "INT NOT NULL DEFAULT 0 AFTER user_id"},
+	{"estimate", "DECIMAL(8,2) NULL AFTER priority"},
+	{"sprint_id", "INT NULL AFTER state_position"},
+	{"completed_at", "DATETIME NULL AFTER completed"},
+	{"recurrence", "VARCHAR(64) NULL AFTER sprint_id"},
+	{"snoozed_until", "DATETIME NULL AFTER recurrence"},
+	{"snooze_to_top", "BOOLEAN NOT NULL DEFAULT FALSE AFTER snoozed_until"},
+	{"archived_at", "DATETIME NULL AFTER snooze_to_top"},
 }
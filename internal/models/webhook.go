@@ -0,0 +1,184 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+	"todo/internal/database"
+)
+
+// Webhook limits
+const (
+	MaxWebhooks         = 20 // per user, or per organization
+	MaxWebhookURLLength = 2048
+)
+
+// Webhook receives the todo events of a tenant by HTTP POST. Personal
+// webhooks belong to a user and receive the events of the todos the user
+// can see in the personal workspace. Organization webhooks are managed by
+// the organization's admins and receive the events of the todos in the
+// organization's lists; private todos of members are left out. URLs must
+// point at public addresses: the local machine and private networks are
+// refused, both when a webhook is saved and when it is called.
+//
+// Each request is signed: X-Webhook-Timestamp is the Unix time of the
+// attempt and X-Webhook-Signature is "sha256=" followed by the hex
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed with Secret.
+// X-Webhook-ID identifies the event and is the same across retries and
+// redeliveries. Secret is only returned when the webhook is created and
+// when the secret is rotated.
+//
+// The events of a todo are delivered in order: while a delivery is being
+// retried, the later deliveries of the todo to the same webhook wait for it.
+// Sequence in the payload numbers the events of a todo, so that receivers can
+// also tell the order of redeliveries.
+//
+// A webhook is disabled after too many failed attempts in a row, or when
+// its URL answers 410 Gone; enabling it again resumes its pending
+// deliveries.
+type Webhook struct {
+	ID                  int        `json:"id"`
+	OrgID               int        `json:"org_id,omitempty"`
+	UserID              int        `json:"user_id,omitempty"`
+	URL                 string     `json:"url"`
+	Events              []string   `json:"events"`
+	Description         string     `json:"description,omitempty"`
+	Secret              string     `json:"secret,omitempty"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+type WebhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Enabled     *bool    `json:"enabled,omitempty"` // defaults to true
+}
+
+// WebhookDelivery is an entry of a webhook's delivery log: one event sent
+// to the webhook, with the outcome of its last attempt. Payload is only
+// set when a single delivery is fetched.
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	ResponseBody   string          `json:"response_body,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	RedeliveryOf   *int            `json:"redelivery_of,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+}
+
+// WebhookDeliveryPage is one page of a webhook's delivery log, newest first
+type WebhookDeliveryPage struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Page       int               `json:"page"`
+	PageSize   int               `json:"page_size"`
+	Total      int               `json:"total"`
+}
+
+// WebhookPayload is the JSON body posted to webhooks
+type WebhookPayload struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	OrgID     int              `json:"org_id,omitempty"`
+	ActorID   int              `json:"actor_id,omitempty"`
+	Sequence  int              `json:"sequence"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      WebhookEventData `json:"data"`
+}
+
+// WebhookEventData is the todo an event is about, after the change or
+// before it for todo.deleted, with what changed
+type WebhookEventData struct {
+	Todo    *Todo    `json:"todo"`
+	Fields  []string `json:"fields,omitempty"`   // todo.updated
+	Tags    []string `json:"tags,omitempty"`     // todo.tagged
+	UserIDs []int    `json:"user_ids,omitempty"` // todo.assigned and todo.unassigned
+}
+
+func CreateWebhookTables() error {
+	// user_id owns personal webhooks and is NULL for organization webhooks,
+	// which outlive their creator. events is a JSON array of event types.
+	webhooksQuery := `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		org_id INT NOT NULL DEFAULT 0,
+		user_id INT NULL,
+		created_by INT NULL,
+		url VARCHAR(2048) NOT NULL,
+		events VARCHAR(512) NOT NULL,
+		description VARCHAR(255) NOT NULL DEFAULT '',
+		secret VARCHAR(64) NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		consecutive_failures INT NOT NULL DEFAULT 0,
+		disabled_at DATETIME NULL,
+		disabled_reason VARCHAR(255) NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+		INDEX idx_org_enabled (org_id, enabled),
+		INDEX idx_user_id (user_id)
+	)`
+
+	if _, err := database.DB.Exec(webhooksQuery); err != nil {
+		return err
+	}
+
+	// Redeliveries are new rows with the event_id and payload of the
+	// original delivery. dedupe_key makes queueing an event twice for the
+	// same webhook a no-op. todo_id and sequence order the deliveries of a
+	// todo's events to a webhook. All three are NULL for redeliveries, which
+	// are neither deduplicated nor held back.
+	deliveriesQuery := `
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		webhook_id INT NOT NULL,
+		dedupe_key VARCHAR(64) NULL UNIQUE,
+		todo_id INT NULL,
+		sequence INT NULL,
+		event_id CHAR(32) NOT NULL,
+		event VARCHAR(32) NOT NULL,
+		payload MEDIUMTEXT NOT NULL,
+		status VARCHAR(16) NOT NULL DEFAULT 'pending',
+		attempts INT NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		response_status INT NULL,
+		response_body TEXT NULL,
+		last_error TEXT NULL,
+		redelivery_of INT NULL,
+		delivered_at DATETIME NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE,
+		INDEX idx_status_next (status, next_attempt_at),
+		INDEX idx_webhook_id (webhook_id, id),
+		INDEX idx_webhook_todo (webhook_id, todo_id, status, sequence)
+	)`
+
+	if _, err := database.DB.Exec(deliveriesQuery); err != nil {
+		return err
+	}
+	if err := database.AddColumnIfNotExists("webhook_deliveries", "dedupe_key", "VARCHAR(64) NULL AFTER webhook_id"); err != nil {
+		return err
+	}
+	if err := database.AddUniqueKeyIfNotExists("webhook_deliveries", "dedupe_key", "(dedupe_key)"); err != nil {
+		return err
+	}
+	if err := database.AddColumnIfNotExists("webhook_deliveries", "todo_id", "INT NULL AFTER dedupe_key"); err != nil {
+		return err
+	}
+	if err := database.AddColumnIfNotExists("webhook_deliveries", "sequence", "INT NULL AFTER todo_id"); err != nil {
+		return err
+	}
+	return database.AddIndexIfNotExists("webhook_deliveries", "idx_webhook_todo", "(webhook_id, todo_id, status, sequence)")
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupActivityRoutes(api *mux.Router, activityHandler *handlers.ActivityHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/activity", protect(authService, activityHandler.GetActivity, scope)).Methods("GET")
+}
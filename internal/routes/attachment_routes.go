@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupAttachmentRoutes(api *mux.Router, attachmentHandler *handlers.AttachmentHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/todos/{id}/attachments", protect(authService, attachmentHandler.GetAttachments, scope)).Methods("GET")
+	api.Handle("/todos/{id}/attachments", protect(authService, attachmentHandler.UploadAttachment, scope)).Methods("POST")
+	api.Handle("/todos/{id}/attachments/{attachmentId}", protect(authService, attachmentHandler.DownloadAttachment, scope)).Methods("GET")
+	api.Handle("/todos/{id}/attachments/{attachmentId}", protect(authService, attachmentHandler.DeleteAttachment, scope)).Methods("DELETE")
+}
@@ -2,12 +2,16 @@ package routes
 
 import (
 	"todo/internal/handlers"
+	"todo/internal/services"
 
 	"github.com/gorilla/mux"
 )
 
-func SetupAuthRoutes(api *mux.Router, authHandler *handlers.Handler) {
+func SetupAuthRoutes(api *mux.Router, authHandler *handlers.Handler, authService *services.AuthService) {
 	api.HandleFunc("/auth/register", authHandler.Register).Methods("POST")
 	api.HandleFunc("/auth/login", authHandler.Login).Methods("POST")
 	api.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST")
+	api.Handle("/auth/me", protect(authService, authHandler.Me, nil)).Methods("GET")
+	api.Handle("/auth/default-org", protect(authService, authHandler.SetDefaultOrg, nil)).Methods("PUT")
+	api.Handle("/auth/timezone", protect(authService, authHandler.SetTimezone, nil)).Methods("PUT")
 }
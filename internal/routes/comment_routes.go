@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupCommentRoutes(api *mux.Router, commentHandler *handlers.CommentHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/todos/{id}/comments", protect(authService, commentHandler.GetComments, scope)).Methods("GET")
+	api.Handle("/todos/{id}/comments", protect(authService, commentHandler.CreateComment, scope)).Methods("POST")
+	api.Handle("/todos/{id}/comments/{commentId}", protect(authService, commentHandler.UpdateComment, scope)).Methods("PUT")
+	api.Handle("/todos/{id}/comments/{commentId}", protect(authService, commentHandler.DeleteComment, scope)).Methods("DELETE")
+	api.Handle("/todos/{id}/comments/{commentId}/history", protect(authService, commentHandler.GetCommentHistory, scope)).Methods("GET")
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupDuplicateRoutes(api *mux.Router, duplicateHandler *handlers.DuplicateHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/todos/{id}/duplicate", protect(authService, duplicateHandler.DuplicateTodo, scope)).Methods("POST")
+	api.Handle("/lists/{id}/duplicate", protect(authService, duplicateHandler.DuplicateList, scope)).Methods("POST")
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupEmailRoutes registers the email routes. Email preferences belong to
+// the user, so they are not scoped to an organization.
+func SetupEmailRoutes(api *mux.Router, emailHandler *handlers.EmailHandler, authService *services.AuthService) {
+	api.Handle("/email/preferences", protect(authService, emailHandler.GetPreferences, nil)).Methods("GET")
+	api.Handle("/email/preferences", protect(authService, emailHandler.UpdatePreferences, nil)).Methods("PUT")
+	api.HandleFunc("/email/unsubscribe", emailHandler.ConfirmUnsubscribe).Methods("GET")
+	api.HandleFunc("/email/unsubscribe", emailHandler.Unsubscribe).Methods("POST")
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupListRoutes(api *mux.Router, listHandler *handlers.ListHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/lists", protect(authService, listHandler.GetLists, scope)).Methods("GET")
+	api.Handle("/lists", protect(authService, listHandler.CreateList, scope)).Methods("POST")
+	api.Handle("/lists/{id}", protect(authService, listHandler.GetList, scope)).Methods("GET")
+	api.Handle("/lists/{id}", protect(authService, listHandler.UpdateList, scope)).Methods("PUT")
+	api.Handle("/lists/{id}", protect(authService, listHandler.DeleteList, scope)).Methods("DELETE")
+	api.Handle("/lists/{id}/workflow", protect(authService, listHandler.GetWorkflow, scope)).Methods("GET")
+	api.Handle("/lists/{id}/workflow", protect(authService, listHandler.UpdateWorkflow, scope)).Methods("PUT")
+	api.Handle("/lists/{id}/board", protect(authService, listHandler.GetBoard, scope)).Methods("GET")
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupNotificationRoutes(api *mux.Router, notificationHandler *handlers.NotificationHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/todos/{id}/watchers", protect(authService, notificationHandler.GetWatchers, scope)).Methods("GET")
+	api.Handle("/todos/{id}/watch", protect(authService, notificationHandler.WatchTodo, scope)).Methods("PUT")
+	api.Handle("/todos/{id}/watch", protect(authService, notificationHandler.UnwatchTodo, scope)).Methods("DELETE")
+	api.Handle("/notifications", protect(authService, notificationHandler.GetNotifications, scope)).Methods("GET")
+	api.Handle("/notifications/read", protect(authService, notificationHandler.MarkAllRead, scope)).Methods("POST")
+	api.Handle("/notifications/preferences", protect(authService, notificationHandler.GetPreferences, scope)).Methods("GET")
+	api.Handle("/notifications/preferences", protect(authService, notificationHandler.UpdatePreferences, scope)).Methods("PUT")
+	api.Handle("/notifications/{id}/read", protect(authService, notificationHandler.MarkRead, scope)).Methods("PUT")
+}
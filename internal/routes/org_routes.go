@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/middleware"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupOrgRoutes(api *mux.Router, orgHandler *handlers.OrgHandler, authService *services.AuthService, orgService *services.OrgService) {
+	orgScope := []mux.MiddlewareFunc{middleware.OrgMiddleware(orgService)}
+
+	api.Handle("/orgs", protect(authService, orgHandler.GetOrgs, nil)).Methods("GET")
+	api.Handle("/orgs", protect(authService, orgHandler.CreateOrg, nil)).Methods("POST")
+	api.Handle("/orgs/{org}", protect(authService, orgHandler.GetOrg, orgScope)).Methods("GET")
+	api.Handle("/orgs/{org}", protect(authService, orgHandler.UpdateOrg, orgScope)).Methods("PUT")
+	api.Handle("/orgs/{org}", protect(authService, orgHandler.DeleteOrg, orgScope)).Methods("DELETE")
+	api.Handle("/orgs/{org}/settings", protect(authService, orgHandler.GetSettings, orgScope)).Methods("GET")
+	api.Handle("/orgs/{org}/settings", protect(authService, orgHandler.UpdateSettings, orgScope)).Methods("PUT")
+	api.Handle("/orgs/{org}/members", protect(authService, orgHandler.GetMembers, orgScope)).Methods("GET")
+	api.Handle("/orgs/{org}/members", protect(authService, orgHandler.AddMember, orgScope)).Methods("POST")
+	api.Handle("/orgs/{org}/members/{userId}", protect(authService, orgHandler.UpdateMember, orgScope)).Methods("PUT")
+	api.Handle("/orgs/{org}/members/{userId}", protect(authService, orgHandler.RemoveMember, orgScope)).Methods("DELETE")
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupPushRoutes registers the Web Push routes. Devices belong to the user,
+// so they are not scoped to an organization.
+func SetupPushRoutes(api *mux.Router, pushHandler *handlers.PushHandler, authService *services.AuthService) {
+	api.Handle("/push/key", protect(authService, pushHandler.GetKey, nil)).Methods("GET")
+	api.Handle("/push/subscriptions", protect(authService, pushHandler.GetSubscriptions, nil)).Methods("GET")
+	api.Handle("/push/subscriptions", protect(authService, pushHandler.Subscribe, nil)).Methods("POST")
+	api.Handle("/push/subscriptions/{id}", protect(authService, pushHandler.Unsubscribe, nil)).Methods("DELETE")
+}
@@ -1,16 +1,89 @@
 package routes
 
 import (
+	"net/http"
 	"todo/internal/handlers"
+	"todo/internal/middleware"
 	"todo/internal/services"
 
 	"github.com/gorilla/mux"
 )
 
-func SetupRouter(todoHandler *handlers.TodoHandler, authHandler *handlers.Handler, authService *services.AuthService) *mux.Router {
+// Handlers groups the HTTP handlers served by the API
+type Handlers struct {
+	Todo         *handlers.TodoHandler
+	List         *handlers.ListHandler
+	Sharing      *handlers.SharingHandler
+	Comment      *handlers.CommentHandler
+	Attachment   *handlers.AttachmentHandler
+	Time         *handlers.TimeHandler
+	Sprint       *handlers.SprintHandler
+	Stats        *handlers.StatsHandler
+	Template     *handlers.TemplateHandler
+	Duplicate    *handlers.DuplicateHandler
+	SmartList    *handlers.SmartListHandler
+	Rule         *handlers.RuleHandler
+	Activity     *handlers.ActivityHandler
+	Notification *handlers.NotificationHandler
+	Email        *handlers.EmailHandler
+	Push         *handlers.PushHandler
+	Webhook      *handlers.WebhookHandler
+	Org          *handlers.OrgHandler
+	Auth         *handlers.Handler
+}
+
+func SetupRouter(h *Handlers, authService *services.AuthService, orgService *services.OrgService) *mux.Router {
 	router := mux.NewRouter()
 	api := router.PathPrefix("/api/v1").Subrouter()
-	SetupTodoRoutes(api, todoHandler, authService)
-	SetupAuthRoutes(api, authHandler)
+	SetupTodoRoutes(api, h.Todo, authService)
+	SetupListRoutes(api, h.List, authService)
+	SetupSharingRoutes(api, h.Sharing, authService)
+	SetupCommentRoutes(api, h.Comment, authService)
+	SetupAttachmentRoutes(api, h.Attachment, authService)
+	SetupTimeRoutes(api, h.Time, authService)
+	SetupSprintRoutes(api, h.Sprint, authService)
+	SetupStatsRoutes(api, h.Stats, authService)
+	SetupTemplateRoutes(api, h.Template, authService)
+	SetupDuplicateRoutes(api, h.Duplicate, authService)
+	SetupSmartListRoutes(api, h.SmartList, authService)
+	SetupRuleRoutes(api, h.Rule, authService)
+	SetupActivityRoutes(api, h.Activity, authService)
+	SetupNotificationRoutes(api, h.Notification, authService)
+	SetupEmailRoutes(api, h.Email, authService)
+	SetupPushRoutes(api, h.Push, authService)
+	SetupWebhookRoutes(api, h.Webhook, authService)
+	SetupOrgRoutes(api, h.Org, authService, orgService)
+	SetupAuthRoutes(api, h.Auth, authService)
+	api.Handle("/attachments/usage", protect(authService, h.Attachment.GetUsage, nil)).Methods("GET")
+	api.Handle("/timer", protect(authService, h.Time.GetRunningTimer, nil)).Methods("GET")
+
+	// The same resources scoped to an organization, e.g. /api/v1/orgs/acme/todos
+	orgScope := middleware.OrgMiddleware(orgService)
+	orgAPI := api.PathPrefix("/orgs/{org}").Subrouter()
+	SetupTodoRoutes(orgAPI, h.Todo, authService, orgScope)
+	SetupListRoutes(orgAPI, h.List, authService, orgScope)
+	SetupSharingRoutes(orgAPI, h.Sharing, authService, orgScope)
+	SetupCommentRoutes(orgAPI, h.Comment, authService, orgScope)
+	SetupAttachmentRoutes(orgAPI, h.Attachment, authService, orgScope)
+	SetupTimeRoutes(orgAPI, h.Time, authService, orgScope)
+	SetupSprintRoutes(orgAPI, h.Sprint, authService, orgScope)
+	SetupStatsRoutes(orgAPI, h.Stats, authService, orgScope)
+	SetupTemplateRoutes(orgAPI, h.Template, authService, orgScope)
+	SetupDuplicateRoutes(orgAPI, h.Duplicate, authService, orgScope)
+	SetupSmartListRoutes(orgAPI, h.SmartList, authService, orgScope)
+	SetupRuleRoutes(orgAPI, h.Rule, authService, orgScope)
+	SetupActivityRoutes(orgAPI, h.Activity, authService, orgScope)
+	SetupNotificationRoutes(orgAPI, h.Notification, authService, orgScope)
+	SetupWebhookRoutes(orgAPI, h.Webhook, authService, orgScope)
 	return router
 }
+
+// protect requires authentication for a handler, then applies the scope
+// middlewares (such as OrgMiddleware) which rely on the authenticated user
+func protect(authService *services.AuthService, handler http.HandlerFunc, scope []mux.MiddlewareFunc) http.Handler {
+	var h http.Handler = handler
+	for i := len(scope) - 1; i >= 0; i-- {
+		h = scope[i](h)
+	}
+	return middleware.AuthMiddleware(authService)(h)
+}
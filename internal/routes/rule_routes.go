@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupRuleRoutes(api *mux.Router, ruleHandler *handlers.RuleHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/rules", protect(authService, ruleHandler.GetRules, scope)).Methods("GET")
+	api.Handle("/rules", protect(authService, ruleHandler.CreateRule, scope)).Methods("POST")
+	api.Handle("/rules/{id}", protect(authService, ruleHandler.GetRule, scope)).Methods("GET")
+	api.Handle("/rules/{id}", protect(authService, ruleHandler.UpdateRule, scope)).Methods("PUT")
+	api.Handle("/rules/{id}", protect(authService, ruleHandler.DeleteRule, scope)).Methods("DELETE")
+	api.Handle("/rules/{id}/executions", protect(authService, ruleHandler.GetExecutions, scope)).Methods("GET")
+}
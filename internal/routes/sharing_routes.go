@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupSharingRoutes(api *mux.Router, sharingHandler *handlers.SharingHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/lists/{id}/members", protect(authService, sharingHandler.GetMembers, scope)).Methods("GET")
+	api.Handle("/lists/{id}/members/{userId}", protect(authService, sharingHandler.UpdateMember, scope)).Methods("PUT")
+	api.Handle("/lists/{id}/members/{userId}", protect(authService, sharingHandler.RemoveMember, scope)).Methods("DELETE")
+	api.Handle("/lists/{id}/invitations", protect(authService, sharingHandler.GetListInvitations, scope)).Methods("GET")
+	api.Handle("/lists/{id}/invitations", protect(authService, sharingHandler.Invite, scope)).Methods("POST")
+	api.Handle("/lists/{id}/invitations/{invitationId}", protect(authService, sharingHandler.CancelInvitation, scope)).Methods("DELETE")
+	api.Handle("/invitations", protect(authService, sharingHandler.GetMyInvitations, scope)).Methods("GET")
+	api.Handle("/invitations/{id}/accept", protect(authService, sharingHandler.AcceptInvitation, scope)).Methods("POST")
+	api.Handle("/invitations/{id}/decline", protect(authService, sharingHandler.DeclineInvitation, scope)).Methods("POST")
+}
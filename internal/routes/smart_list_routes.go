@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupSmartListRoutes(api *mux.Router, smartListHandler *handlers.SmartListHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/smart-lists", protect(authService, smartListHandler.GetSmartLists, scope)).Methods("GET")
+	api.Handle("/smart-lists", protect(authService, smartListHandler.CreateSmartList, scope)).Methods("POST")
+	api.Handle("/smart-lists/{id}", protect(authService, smartListHandler.GetSmartList, scope)).Methods("GET")
+	api.Handle("/smart-lists/{id}", protect(authService, smartListHandler.UpdateSmartList, scope)).Methods("PUT")
+	api.Handle("/smart-lists/{id}", protect(authService, smartListHandler.DeleteSmartList, scope)).Methods("DELETE")
+	api.Handle("/smart-lists/{id}/todos", protect(authService, smartListHandler.GetTodos, scope)).Methods("GET")
+}
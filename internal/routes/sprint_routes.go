@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupSprintRoutes(api *mux.Router, sprintHandler *handlers.SprintHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/lists/{id}/sprints", protect(authService, sprintHandler.GetSprints, scope)).Methods("GET")
+	api.Handle("/lists/{id}/sprints", protect(authService, sprintHandler.CreateSprint, scope)).Methods("POST")
+	api.Handle("/sprints/{id}", protect(authService, sprintHandler.GetSprint, scope)).Methods("GET")
+	api.Handle("/sprints/{id}", protect(authService, sprintHandler.UpdateSprint, scope)).Methods("PUT")
+	api.Handle("/sprints/{id}", protect(authService, sprintHandler.DeleteSprint, scope)).Methods("DELETE")
+	api.Handle("/sprints/{id}/start", protect(authService, sprintHandler.StartSprint, scope)).Methods("POST")
+	api.Handle("/sprints/{id}/close", protect(authService, sprintHandler.CloseSprint, scope)).Methods("POST")
+	api.Handle("/sprints/{id}/chart", protect(authService, sprintHandler.GetChart, scope)).Methods("GET")
+	api.Handle("/todos/{id}/sprint", protect(authService, sprintHandler.SetTodoSprint, scope)).Methods("PUT")
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupStatsRoutes(api *mux.Router, statsHandler *handlers.StatsHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/stats", protect(authService, statsHandler.GetStats, scope)).Methods("GET")
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupTemplateRoutes(api *mux.Router, templateHandler *handlers.TemplateHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/templates", protect(authService, templateHandler.GetTemplates, scope)).Methods("GET")
+	api.Handle("/templates", protect(authService, templateHandler.CreateTemplate, scope)).Methods("POST")
+	api.Handle("/templates/{id}", protect(authService, templateHandler.GetTemplate, scope)).Methods("GET")
+	api.Handle("/templates/{id}", protect(authService, templateHandler.UpdateTemplate, scope)).Methods("PUT")
+	api.Handle("/templates/{id}", protect(authService, templateHandler.DeleteTemplate, scope)).Methods("DELETE")
+	api.Handle("/templates/{id}/instantiate", protect(authService, templateHandler.Instantiate, scope)).Methods("POST")
+	api.Handle("/lists/{id}/template", protect(authService, templateHandler.CreateFromList, scope)).Methods("POST")
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupTimeRoutes(api *mux.Router, timeHandler *handlers.TimeHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/todos/{id}/timer/start", protect(authService, timeHandler.StartTimer, scope)).Methods("POST")
+	api.Handle("/todos/{id}/timer/stop", protect(authService, timeHandler.StopTimer, scope)).Methods("POST")
+	api.Handle("/todos/{id}/time", protect(authService, timeHandler.GetTodoTime, scope)).Methods("GET")
+	api.Handle("/todos/{id}/time-entries", protect(authService, timeHandler.GetEntries, scope)).Methods("GET")
+	api.Handle("/todos/{id}/time-entries", protect(authService, timeHandler.CreateEntry, scope)).Methods("POST")
+	api.Handle("/todos/{id}/time-entries/{entryId}", protect(authService, timeHandler.UpdateEntry, scope)).Methods("PUT")
+	api.Handle("/todos/{id}/time-entries/{entryId}", protect(authService, timeHandler.DeleteEntry, scope)).Methods("DELETE")
+	api.Handle("/lists/{id}/time", protect(authService, timeHandler.GetListTime, scope)).Methods("GET")
+	api.Handle("/time/report", protect(authService, timeHandler.GetReport, scope)).Methods("GET")
+	api.Handle("/time/export", protect(authService, timeHandler.ExportCSV, scope)).Methods("GET")
+}
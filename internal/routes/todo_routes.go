@@ -1,21 +1,37 @@
 package routes
 
 import (
-	"net/http"
 	"todo/internal/handlers"
-	"todo/internal/middleware"
 	"todo/internal/services"
 
 	"github.com/gorilla/mux"
 )
 
-func SetupTodoRoutes(api *mux.Router, todoHandler *handlers.TodoHandler, authService *services.AuthService) {
-	api.Handle("/todos", middleware.AuthMiddleware(authService)(http.HandlerFunc(todoHandler.GetTodos))).Methods("GET")
-	api.Handle("/todos", middleware.AuthMiddleware(authService)(http.HandlerFunc(todoHandler.CreateTodo))).Methods("POST")
-	api.Handle("/todos/{id}", middleware.AuthMiddleware(authService)(http.HandlerFunc(todoHandler.GetTodo))).Methods("GET")
-	api.Handle("/todos/{id}", middleware.AuthMiddleware(authService)(http.HandlerFunc(todoHandler.UpdateTodo))).Methods("PUT")
-	api.Handle("/todos/{id}", middleware.AuthMiddleware(authService)(http.HandlerFunc(todoHandler.DeleteTodo))).Methods("DELETE")
-	api.Handle("/todos/{id}/reorder", middleware.AuthMiddleware(authService)(http.HandlerFunc(todoHandler.ReorderTodo))).Methods("PUT")
+func SetupTodoRoutes(api *mux.Router, todoHandler *handlers.TodoHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/todos", protect(authService, todoHandler.GetTodos, scope)).Methods("GET")
+	api.Handle("/todos", protect(authService, todoHandler.CreateTodo, scope)).Methods("POST")
+	api.Handle("/todos/quick", protect(authService, todoHandler.QuickAdd, scope)).Methods("POST")
+	api.Handle("/tags", protect(authService, todoHandler.GetTags, scope)).Methods("GET")
+	api.Handle("/undo", protect(authService, todoHandler.Undo, scope)).Methods("POST")
+	api.Handle("/redo", protect(authService, todoHandler.Redo, scope)).Methods("POST")
+	api.Handle("/todos/views", protect(authService, todoHandler.GetDueViewCounts, scope)).Methods("GET")
+	api.Handle("/todos/views/{view}", protect(authService, todoHandler.GetDueView, scope)).Methods("GET")
+	api.Handle("/todos/archive", protect(authService, todoHandler.GetArchive, scope)).Methods("GET")
+	api.Handle("/todos/archive/policy", protect(authService, todoHandler.GetArchivePolicy, scope)).Methods("GET")
+	api.Handle("/todos/archive/policy", protect(authService, todoHandler.UpdateArchivePolicy, scope)).Methods("PUT")
+	api.Handle("/todos/{id}", protect(authService, todoHandler.GetTodo, scope)).Methods("GET")
+	api.Handle("/todos/{id}", protect(authService, todoHandler.UpdateTodo, scope)).Methods("PUT")
+	api.Handle("/todos/{id}", protect(authService, todoHandler.DeleteTodo, scope)).Methods("DELETE")
+	api.Handle("/todos/{id}/reorder", protect(authService, todoHandler.ReorderTodo, scope)).Methods("PUT")
+	api.Handle("/todos/{id}/state", protect(authService, todoHandler.TransitionTodo, scope)).Methods("PUT")
+	api.Handle("/todos/{id}/snooze", protect(authService, todoHandler.SnoozeTodo, scope)).Methods("PUT")
+	api.Handle("/todos/{id}/snooze", protect(authService, todoHandler.UnsnoozeTodo, scope)).Methods("DELETE")
+	api.Handle("/todos/{id}/restore", protect(authService, todoHandler.RestoreTodo, scope)).Methods("POST")
+	api.Handle("/todos/{id}/assignees", protect(authService, todoHandler.GetAssignees, scope)).Methods("GET")
+	api.Handle("/todos/{id}/assignees", protect(authService, todoHandler.SetAssignees, scope)).Methods("PUT")
+	api.Handle("/todos/{id}/assignees", protect(authService, todoHandler.AddAssignees, scope)).Methods("POST")
+	api.Handle("/todos/{id}/assignees/history", protect(authService, todoHandler.GetAssignmentHistory, scope)).Methods("GET")
+	api.Handle("/todos/{id}/assignees/{userId}", protect(authService, todoHandler.RemoveAssignee, scope)).Methods("DELETE")
 }
 
 	// api.HandleFunc("/todos", todoHandler.CreateTodo).Methods("POST")
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"todo/internal/handlers"
+	"todo/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func SetupWebhookRoutes(api *mux.Router, webhookHandler *handlers.WebhookHandler, authService *services.AuthService, scope ...mux.MiddlewareFunc) {
+	api.Handle("/webhooks", protect(authService, webhookHandler.GetWebhooks, scope)).Methods("GET")
+	api.Handle("/webhooks", protect(authService, webhookHandler.CreateWebhook, scope)).Methods("POST")
+	api.Handle("/webhooks/{id}", protect(authService, webhookHandler.GetWebhook, scope)).Methods("GET")
+	api.Handle("/webhooks/{id}", protect(authService, webhookHandler.UpdateWebhook, scope)).Methods("PUT")
+	api.Handle("/webhooks/{id}", protect(authService, webhookHandler.DeleteWebhook, scope)).Methods("DELETE")
+	api.Handle("/webhooks/{id}/secret", protect(authService, webhookHandler.RotateSecret, scope)).Methods("POST")
+	api.Handle("/webhooks/{id}/deliveries", protect(authService, webhookHandler.GetDeliveries, scope)).Methods("GET")
+	api.Handle("/webhooks/{id}/deliveries/{deliveryId}", protect(authService, webhookHandler.GetDelivery, scope)).Methods("GET")
+	api.Handle("/webhooks/{id}/deliveries/{deliveryId}/redeliver", protect(authService, webhookHandler.Redeliver, scope)).Methods("POST")
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"todo/internal/models"
+)
+
+// orgAccess is a user's standing in an organization
+type orgAccess struct {
+	Role     string // "" when the user is not a member
+	Settings models.OrgSettings
+}
+
+// loadOrgAccess reads the user's organization role and the organization's settings
+func loadOrgAccess(db sqlExecutor, orgID, userID int) (*orgAccess, error) {
+	var role sql.NullString
+	var settings sql.NullString
+	err := db.QueryRow(`
+		SELECT m.role, o.settings
+		FROM organizations o
+		LEFT JOIN org_members m ON m.org_id = o.id AND m.user_id = ?
+		WHERE o.id = ?`, userID, orgID).Scan(&role, &settings)
+	if err == sql.ErrNoRows {
+		return &orgAccess{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error checking organization access: %v", err)
+	}
+
+	return &orgAccess{Role: role.String, Settings: parseOrgSettings(settings.String)}, nil
+}
+
+// parseOrgSettings decodes stored settings on top of the defaults, so settings
+// added later get their default value for existing organizations
+func parseOrgSettings(raw string) models.OrgSettings {
+	settings := models.DefaultOrgSettings
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &settings)
+	}
+	return settings
+}
+
+// listRole returns the user's role on a list: owner for the creator, the
+// member role for members, or "" when the user has no access. For lists in an
+// organization, the user must still be an organization member; org admins can
+// administer every list and other members get the organization's default role.
+func listRole(db sqlExecutor, list *models.List, userID int) (string, error) {
+	role := ""
+	if list.UserID == userID {
+		role = models.RoleOwner
+	} else {
+		err := db.QueryRow(`
+			SELECT role
+			FROM list_members
+			WHERE list_id = ? AND user_id = ?`, list.ID, userID).Scan(&role)
+		if err != nil && err != sql.ErrNoRows {
+			return "", fmt.Errorf("error checking list access: %v", err)
+		}
+	}
+
+	if list.OrgID == 0 {
+		return role, nil
+	}
+
+	access, err := loadOrgAccess(db, list.OrgID, userID)
+	if err != nil {
+		return "", err
+	}
+	return orgListRole(role, access), nil
+}
+
+// orgListRole combines the role a user holds on an organization list as its
+// owner or member with their access to the organization
+func orgListRole(role string, access *orgAccess) string {
+	if access.Role == "" {
+		return ""
+	}
+	if models.HasOrgRole(access.Role, models.OrgRoleAdmin) && !models.HasRole(role, models.RoleAdmin) {
+		role = models.RoleAdmin
+	}
+	if role == "" {
+		role = access.Settings.DefaultListRole
+	}
+	return role
+}
+
+// todoRole returns the user's role on a todo. Todos in a list inherit the
+// list's permissions; todos outside a list are private to their owner.
+func todoRole(db sqlExecutor, todo *models.Todo, userID int) (string, error) {
+	if todo.ListID == nil {
+		if todo.UserID != userID {
+			return "", nil
+		}
+		if todo.OrgID != 0 {
+			access, err := loadOrgAccess(db, todo.OrgID, userID)
+			if err != nil {
+				return "", err
+			}
+			if access.Role == "" {
+				return "", nil
+			}
+		}
+		return models.RoleOwner, nil
+	}
+
+	list := models.List{ID: *todo.ListID}
+	err := db.QueryRow("SELECT user_id, org_id FROM lists WHERE id = ?", list.ID).Scan(&list.UserID, &list.OrgID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error checking list access: %v", err)
+	}
+	return listRole(db, &list, userID)
+}
+
+// inPlaceholders returns "?, ?, ?" for n arguments
+func inPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// DefaultActivityAggregateWindow is used when ACTIVITY_AGGREGATE_WINDOW is not
+// set: edits of a todo by the same user this close together share an entry
+const DefaultActivityAggregateWindow = 5 * time.Minute
+
+// Activity pages default to DefaultActivityPageSize entries
+const (
+	DefaultActivityPageSize = 50
+	MaxActivityPageSize     = 200
+)
+
+// aggregatedVerbs are the verbs whose rapid repeats are merged
+var aggregatedVerbs = map[string]bool{EventTodoUpdated: true, EventTodoReordered: true}
+
+// fieldNames are how the changed fields of a todo read in summaries
+var fieldNames = map[string]string{
+	"title":         "the title",
+	"description":   "the description",
+	"completed":     "the completion",
+	"priority":      "the priority",
+	"estimate":      "the estimate",
+	"due_date":      "the due date",
+	"list_id":       "the list",
+	"state":         "the state",
+	"recurrence":    "the recurrence",
+	"tags":          "the tags",
+	"snoozed_until": "the snooze",
+	"archived_at":   "the archiving",
+}
+
+// ActivityFilter narrows the activity feed; zero fields match everything
+type ActivityFilter struct {
+	ListID  int
+	TodoID  int
+	ActorID int
+}
+
+// ActivityService serves the activity feed of a tenant
+type ActivityService struct {
+	lists *ListService
+	orgID int
+}
+
+func NewActivityService() *ActivityService {
+	return &ActivityService{
+		lists: NewListService(),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *ActivityService) ForOrg(orgID int) *ActivityService {
+	return &ActivityService{
+		lists: s.lists.ForOrg(orgID),
+		orgID: orgID,
+	}
+}
+
+// GetActivity returns a page of the activity the user can see, most recent
+// first: that of the todos they can see, including deleted ones, and their own
+// account activity
+func (s *ActivityService) GetActivity(userID int, filter ActivityFilter, page, pageSize int) (*models.ActivityPage, error) {
+	if page < 1 {
+		return nil, fmt.Errorf("invalid page: must be at least 1")
+	}
+	if pageSize < 1 || pageSize > MaxActivityPageSize {
+		return nil, fmt.Errorf("invalid page_size: must be between 1 and %d", MaxActivityPageSize)
+	}
+
+	listIDs, err := s.lists.accessibleListIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	where := "a.org_id = ? AND ((a.todo_id IS NULL AND a.actor_id = ?) OR (a.list_id IS NULL AND a.owner_id = ?)"
+	args := []interface{}{s.orgID, userID, userID}
+	if len(listIDs) > 0 {
+		where += " OR a.list_id IN (" + inPlaceholders(len(listIDs)) + ")"
+		for _, id := range listIDs {
+			args = append(args, id)
+		}
+	}
+	where += ")"
+	if filter.ListID != 0 {
+		where += " AND a.list_id = ?"
+		args = append(args, filter.ListID)
+	}
+	if filter.TodoID != 0 {
+		where += " AND a.todo_id = ?"
+		args = append(args, filter.TodoID)
+	}
+	if filter.ActorID != 0 {
+		where += " AND a.actor_id = ?"
+		args = append(args, filter.ActorID)
+	}
+
+	result := &models.ActivityPage{Activities: []models.Activity{}, Page: page, PageSize: pageSize}
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM activities a WHERE "+where, args...).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+
+	args = append(args, pageSize, (page-1)*pageSize)
+	rows, err := database.DB.Query(`
+		SELECT a.id, a.org_id, a.verb, a.actor_id, u.username, a.todo_id, a.list_id, a.todo_title, a.details, a.count,
+			a.created_at, a.updated_at
+		FROM activities a
+		LEFT JOIN users u ON u.id = a.actor_id
+		WHERE `+where+`
+		ORDER BY a.updated_at DESC, a.id DESC
+		LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var activity models.Activity
+		var actorID, todoID, listID sql.NullInt64
+		var actorName sql.NullString
+		var details string
+		err := rows.Scan(&activity.ID, &activity.OrgID, &activity.Verb, &actorID, &actorName, &todoID, &listID,
+			&activity.TodoTitle, &details, &activity.Count, &activity.CreatedAt, &activity.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			activity.ActorID = &id
+		}
+		if todoID.Valid {
+			id := int(todoID.Int64)
+			activity.TodoID = &id
+		}
+		if listID.Valid {
+			id := int(listID.Int64)
+			activity.ListID = &id
+		}
+		activity.ActorName = actorName.String
+		if err := json.Unmarshal([]byte(details), &activity.Details); err != nil {
+			return nil, fmt.Errorf("error reading activity %d: %v", activity.ID, err)
+		}
+		activity.Summary = summarize(&activity)
+		result.Activities = append(result.Activities, activity)
+	}
+	return result, rows.Err()
+}
+
+// recordTodoEvent adds a todo event to the activity feed, at the time the
+// event happened rather than when it was relayed
+func recordTodoEvent(event *OutboxEvent) error {
+	if event.Todo == nil {
+		return nil
+	}
+	if gone, err := orgDeleted(event.OrgID); gone || err != nil {
+		return err
+	}
+	details := models.ActivityDetails{Fields: event.Fields, Tags: event.Tags}
+	switch event.Type {
+	case EventTodoReordered:
+		details.Position = event.Todo.OrderNo
+	case EventTodoStateChanged:
+		details.State = event.Todo.State
+	case EventTodoAssigned, EventTodoUnassigned:
+		names, err := usernames(event.UserIDs)
+		if err != nil {
+			return err
+		}
+		details.Users = names
+	}
+	return recordActivity(event.OrgID, event.Type, event.ActorID, event.Todo, details, event.CreatedAt)
+}
+
+// recordAccountActivity adds an account change of a user to their feed in the
+// personal workspace. Failures are only logged.
+func recordAccountActivity(verb string, userID int, details models.ActivityDetails) {
+	if err := recordActivity(0, verb, userID, nil, details, time.Now().UTC()); err != nil {
+		log.Printf("Error recording activity of user %d: %v", userID, err)
+	}
+}
+
+// recordActivity inserts an activity entry that happened at the given time,
+// or merges it into the latest entry of the todo when that is one of the same
+// kind by the same actor shortly before
+func recordActivity(orgID int, verb string, actorID int, todo *models.Todo, details models.ActivityDetails, at time.Time) error {
+	var actor interface{}
+	if actorID != 0 {
+		actor = actorID
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if todo != nil && actorID != 0 && aggregatedVerbs[verb] {
+		window := envDuration("ACTIVITY_AGGREGATE_WINDOW", DefaultActivityAggregateWindow)
+		var id, latestActor int
+		var latestVerb, latestDetails string
+		var updatedAt time.Time
+		err := tx.QueryRow(`
+			SELECT id, verb, COALESCE(actor_id, 0), details, updated_at
+			FROM activities
+			WHERE todo_id = ?
+			ORDER BY id DESC
+			LIMIT 1
+			FOR UPDATE`, todo.ID).Scan(&id, &latestVerb, &latestActor, &latestDetails, &updatedAt)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && latestVerb == verb && latestActor == actorID && at.Sub(updatedAt) <= window {
+			var merged models.ActivityDetails
+			if err := json.Unmarshal([]byte(latestDetails), &merged); err != nil {
+				return err
+			}
+			for _, field := range details.Fields {
+				if !containsString(merged.Fields, field) {
+					merged.Fields = append(merged.Fields, field)
+				}
+			}
+			merged.Position = details.Position
+			raw, err := json.Marshal(merged)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`
+				UPDATE activities
+				SET count = count + 1, details = ?, todo_title = ?, list_id = ?, updated_at = ?
+				WHERE id = ?`, string(raw), todo.Title, todo.ListID, at, id)
+			if err != nil {
+				return err
+			}
+			return tx.Commit()
+		}
+	}
+
+	raw, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	var todoID, listID, ownerID interface{}
+	title := ""
+	if todo != nil {
+		todoID, listID, ownerID, title = todo.ID, todo.ListID, todo.UserID, todo.Title
+	}
+	_, err = tx.Exec(`
+		INSERT INTO activities (org_id, verb, actor_id, owner_id, todo_id, list_id, todo_title, details, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		orgID, verb, actor, ownerID, todoID, listID, title, string(raw), at, at)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// usernames returns the names of the given users, in order
+func usernames(userIDs []int) ([]string, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	rows, err := database.DB.Query("SELECT id, username FROM users WHERE id IN ("+inPlaceholders(len(userIDs))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		byID[id] = name
+	}
+	names := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if name, ok := byID[id]; ok {
+			names = append(names, name)
+		}
+	}
+	return names, rows.Err()
+}
+
+// summarize describes an activity in a sentence, such as "alice completed
+// "Buy milk""
+func summarize(activity *models.Activity) string {
+	actor := activity.ActorName
+	if activity.ActorID == nil {
+		actor = "The system"
+	} else if actor == "" {
+		actor = "A deleted user"
+	}
+	title := fmt.Sprintf("%q", activity.TodoTitle)
+	details := activity.Details
+
+	var summary string
+	switch activity.Verb {
+	case EventTodoCreated:
+		summary = fmt.Sprintf("%s created %s", actor, title)
+	case EventTodoUpdated:
+		var fields []string
+		for _, field := range details.Fields {
+			if name, ok := fieldNames[field]; ok {
+				fields = append(fields, name)
+			}
+		}
+		if len(fields) == 0 {
+			summary = fmt.Sprintf("%s edited %s", actor, title)
+		} else {
+			summary = fmt.Sprintf("%s changed %s of %s", actor, joinWords(fields), title)
+		}
+	case EventTodoCompleted:
+		summary = fmt.Sprintf("%s completed %s", actor, title)
+	case EventTodoDeleted:
+		summary = fmt.Sprintf("%s deleted %s", actor, title)
+	case EventTodoReordered:
+		summary = fmt.Sprintf("%s moved %s to position %d", actor, title, details.Position)
+	case EventTodoStateChanged:
+		summary = fmt.Sprintf("%s moved %s to %s", actor, title, details.State)
+	case EventTodoAssigned:
+		summary = fmt.Sprintf("%s assigned %s to %s", actor, title, joinWords(details.Users))
+	case EventTodoUnassigned:
+		summary = fmt.Sprintf("%s unassigned %s from %s", actor, joinWords(details.Users), title)
+	case EventTodoTagged:
+		tags := make([]string, len(details.Tags))
+		for i, tag := range details.Tags {
+			tags[i] = "#" + tag
+		}
+		summary = fmt.Sprintf("%s tagged %s with %s", actor, title, joinWords(tags))
+	case models.NotificationCommented:
+		summary = fmt.Sprintf("%s commented on %s", actor, title)
+	case models.NotificationMentioned:
+		summary = fmt.Sprintf("%s mentioned you in a comment on %s", actor, title)
+	case models.ActivityUserRegistered:
+		summary = fmt.Sprintf("%s signed up", actor)
+	case models.ActivityUserLoggedIn:
+		summary = fmt.Sprintf("%s logged in", actor)
+	case models.ActivityUserLoggedOut:
+		summary = fmt.Sprintf("%s logged out", actor)
+	case models.ActivityUserTimezoneChanged:
+		summary = fmt.Sprintf("%s changed their timezone to %s", actor, details.Timezone)
+	case models.ActivityUserDefaultOrgChanged:
+		summary = fmt.Sprintf("%s changed their default workspace", actor)
+	default:
+		summary = fmt.Sprintf("%s: %s", actor, activity.Verb)
+	}
+	if activity.Count > 1 {
+		summary += fmt.Sprintf(" (%d times)", activity.Count)
+	}
+	return summary
+}
+
+// joinWords joins words as in "a, b and c"
+func joinWords(words []string) string {
+	if len(words) <= 1 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " and " + words[len(words)-1]
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Address ranges that are not reachable on the public internet, besides
+// those the net.IP methods already know of
+var nonPublicNetworks = mustParseCIDRs(
+	"0.0.0.0/8",     // "this" network
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"192.0.2.0/24",  // documentation
+	"198.18.0.0/15", // benchmarking
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"240.0.0.0/4",  // reserved, and the broadcast address
+	"64:ff9b::/96", // NAT64, which can map to any IPv4 address
+	"2001:db8::/32",
+)
+
+// allowLocalEndpoints tells whether webhooks and push subscriptions may
+// target the local machine and private networks, as set with
+// ALLOW_LOCAL_ENDPOINTS. It is meant for development against local receivers;
+// in production these URLs are set by users, and letting them reach internal
+// services would expose those services.
+func allowLocalEndpoints() bool {
+	allow, _ := strconv.ParseBool(os.Getenv("ALLOW_LOCAL_ENDPOINTS"))
+	return allow
+}
+
+// isPublicIP reports whether an address is a unicast address of the public
+// internet
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPublicHost resolves a host and fails unless all of its addresses are
+// public
+func checkPublicHost(host string) error {
+	if allowLocalEndpoints() {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublicIP(ip) {
+			return fmt.Errorf("%s is not a public address", host)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return fmt.Errorf("%s resolves to %s, which is not a public address", host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// publicDialer returns a dialer refusing to connect to addresses that are
+// not public. The check runs on the address actually dialed, after name
+// resolution, so a name that resolved to a public address when a URL was
+// saved cannot be pointed at an internal one later.
+func publicDialer(timeout time.Duration) *net.Dialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if allowLocalEndpoints() {
+		return dialer
+	}
+	dialer.Control = func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+			return fmt.Errorf("refusing to connect to %s: not a public address", host)
+		}
+		return nil
+	}
+	return dialer
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
@@ -0,0 +1,382 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// DefaultArchiveSweepInterval is used when ARCHIVE_SWEEP_INTERVAL is not set
+const DefaultArchiveSweepInterval = time.Hour
+
+// Archive pages default to DefaultArchivePageSize todos
+const (
+	DefaultArchivePageSize = 50
+	MaxArchivePageSize     = 200
+)
+
+// defaultArchiveAfterDays is the policy of users without one of their own,
+// from ARCHIVE_AFTER_DAYS. By default todos are never archived.
+func defaultArchiveAfterDays() int {
+	return int(envInt64("ARCHIVE_AFTER_DAYS", 0))
+}
+
+// GetArchive returns a page of the archived todos the user can see, most
+// recently archived first
+func (s *TodoService) GetArchive(userID, page, pageSize int) (*models.ArchivePage, error) {
+	if page < 1 {
+		return nil, fmt.Errorf("invalid page: must be at least 1")
+	}
+	if pageSize < 1 || pageSize > MaxArchivePageSize {
+		return nil, fmt.Errorf("invalid page_size: must be between 1 and %d", MaxArchivePageSize)
+	}
+
+	where, args, err := s.accessibleTo(userID)
+	if err != nil {
+		return nil, err
+	}
+	where += " AND archived_at IS NOT NULL"
+
+	result := &models.ArchivePage{Todos: []models.Todo{}, Page: page, PageSize: pageSize}
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM todos WHERE "+where, args...).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+
+	args = append(args, pageSize, (page-1)*pageSize)
+	rows, err := database.DB.Query(`
+		SELECT `+todoColumns+`
+		FROM todos
+		WHERE `+where+`
+		ORDER BY archived_at DESC, id DESC
+		LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Todos = append(result.Todos, *todo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, attachDetails(database.DB, result.Todos)
+}
+
+// Restore brings an archived todo back at the end of its owner's manual order
+// and, for todos in a list, at the end of its board column
+func (s *TodoService) Restore(id, userID int) (*models.Todo, error) {
+	todo, err := s.authorize(id, userID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if todo.ArchivedAt == nil {
+		return nil, fmt.Errorf("todo is not archived")
+	}
+	if todo, err = withDetails(s.db(), todo); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	orderNo, err := s.getNextOrderNo(tx, todo.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting next order number: %v", err)
+	}
+	statePosition := 0
+	if todo.ListID != nil && todo.State != "" {
+		count, err := countInState(tx, *todo.ListID, todo.State, id)
+		if err != nil {
+			return nil, err
+		}
+		statePosition = count + 1
+	}
+
+	result, err := tx.Exec(`
+		UPDATE todos
+		SET archived_at = NULL, order_no = ?, state_position = ?, updated_by = ?
+		WHERE id = ? AND org_id = ? AND archived_at IS NOT NULL`,
+		orderNo, statePosition, userID, id, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("todo is not archived")
+	}
+	restored, err := loadTodo(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	event := TodoEvent{Type: EventTodoUpdated, Todo: restored, ActorID: userID, Fields: []string{"archived_at"}}
+	if err := s.stage(tx, event); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.emit(event)
+	s.journal(userID, models.OperationRestore, todo, restored)
+	return restored, nil
+}
+
+// archive archives a todo again when the restore that brought it back is
+// undone, taking it out of its board column and the manual order
+func (s *TodoService) archive(id int, at time.Time, userID int) error {
+	todo, err := s.authorizeActive(id, userID, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if todo.ListID != nil && todo.State != "" {
+		if err := removeFromColumn(tx, *todo.ListID, todo.State, todo.StatePosition, id); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+		UPDATE todos
+		SET archived_at = ?, order_no = NULL, state_position = 0, updated_by = ?
+		WHERE id = ? AND org_id = ?`, at, userID, id, s.orgID)
+	if err != nil {
+		return fmt.Errorf("error archiving todo %d: %v", id, err)
+	}
+	if err := s.renumberOrder(tx, todo.UserID); err != nil {
+		return err
+	}
+
+	archived, err := loadTodo(tx, id)
+	if err != nil {
+		return err
+	}
+	event := TodoEvent{Type: EventTodoUpdated, Todo: archived, ActorID: userID, Fields: []string{"archived_at"}}
+	if err := s.stage(tx, event); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.emit(event)
+	return nil
+}
+
+// GetArchivePolicy returns the user's archive policy in the service's tenant
+func (s *TodoService) GetArchivePolicy(userID int) (*models.ArchivePolicy, error) {
+	var policy models.ArchivePolicy
+	err := database.DB.QueryRow(`
+		SELECT after_days, updated_at
+		FROM archive_policies
+		WHERE user_id = ? AND org_id = ?`, userID, s.orgID).Scan(&policy.AfterDays, &policy.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return &models.ArchivePolicy{AfterDays: defaultArchiveAfterDays(), Default: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// UpdateArchivePolicy sets how many days after completion the todos the user
+// owns in the service's tenant are archived. It applies to todos in the
+// user's lists, shared or not, as they are part of the user's manual order.
+func (s *TodoService) UpdateArchivePolicy(policy *models.ArchivePolicy, userID int) (*models.ArchivePolicy, error) {
+	if policy.AfterDays < 0 || policy.AfterDays > models.MaxArchiveAfterDays {
+		return nil, fmt.Errorf("invalid after_days: must be between 0 and %d", models.MaxArchiveAfterDays)
+	}
+
+	_, err := database.DB.Exec(`
+		INSERT INTO archive_policies (user_id, org_id, after_days)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE after_days = VALUES(after_days)`,
+		userID, s.orgID, policy.AfterDays)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetArchivePolicy(userID)
+}
+
+// ArchiveCompleted archives the todos of every tenant completed longer ago
+// than their owner's policy allows. It returns the number of todos archived.
+func (s *TodoService) ArchiveCompleted() (int, error) {
+	defaultDays := defaultArchiveAfterDays()
+	now := time.Now().UTC()
+	rows, err := database.DB.Query(`
+		SELECT DISTINCT t.user_id, t.org_id, COALESCE(p.after_days, ?)
+		FROM todos t
+		LEFT JOIN archive_policies p ON p.user_id = t.user_id AND p.org_id = t.org_id
+		WHERE t.completed = TRUE AND t.archived_at IS NULL AND COALESCE(p.after_days, ?) > 0
+			AND t.completed_at <= DATE_SUB(?, INTERVAL COALESCE(p.after_days, ?) DAY)`,
+		defaultDays, defaultDays, now, defaultDays)
+	if err != nil {
+		return 0, err
+	}
+	type owner struct{ userID, orgID, days int }
+	var owners []owner
+	for rows.Next() {
+		var o owner
+		if err := rows.Scan(&o.userID, &o.orgID, &o.days); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		owners = append(owners, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	archived := 0
+	for _, o := range owners {
+		n, err := s.ForOrg(o.orgID).archiveOwned(o.userID, now.AddDate(0, 0, -o.days), now)
+		if err != nil {
+			return archived, fmt.Errorf("error archiving todos of user %d: %v", o.userID, err)
+		}
+		archived += n
+	}
+	return archived, nil
+}
+
+// archiveOwned archives the owner's todos completed before cutoff, taking them
+// out of their board columns and renumbering the rest of the manual order
+func (s *TodoService) archiveOwned(ownerID int, cutoff, now time.Time) (int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Columns are closed from the bottom up, so the positions read here stay
+	// valid while the gaps above them are closed
+	rows, err := tx.Query(`
+		SELECT id, list_id, state, state_position
+		FROM todos
+		WHERE user_id = ? AND org_id = ? AND completed = TRUE AND archived_at IS NULL AND completed_at <= ?
+		ORDER BY state_position DESC
+		FOR UPDATE`, ownerID, s.orgID, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	type column struct {
+		todoID   int
+		listID   sql.NullInt64
+		state    sql.NullString
+		position int
+	}
+	var todos []column
+	for rows.Next() {
+		var c column
+		if err := rows.Scan(&c.todoID, &c.listID, &c.state, &c.position); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		todos = append(todos, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, c := range todos {
+		if c.listID.Valid && c.state.Valid {
+			if err := removeFromColumn(tx, int(c.listID.Int64), c.state.String, c.position, c.todoID); err != nil {
+				return 0, err
+			}
+		}
+		_, err := tx.Exec(`
+			UPDATE todos
+			SET archived_at = ?, order_no = NULL, state_position = 0, updated_at = updated_at
+			WHERE id = ?`, now, c.todoID)
+		if err != nil {
+			return 0, fmt.Errorf("error archiving todo %d: %v", c.todoID, err)
+		}
+	}
+	if err := s.renumberOrder(tx, ownerID); err != nil {
+		return 0, err
+	}
+
+	// The archiver is the actor, so the events have no user
+	events := make([]TodoEvent, 0, len(todos))
+	for _, c := range todos {
+		archived, err := loadTodo(tx, c.todoID)
+		if err != nil {
+			return 0, err
+		}
+		events = append(events, TodoEvent{Type: EventTodoUpdated, Todo: archived, Fields: []string{"archived_at"}})
+	}
+	if err := s.stage(tx, events...); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	s.emit(events...)
+	return len(todos), nil
+}
+
+// renumberOrder closes the gaps in the owner's manual order. Todos only move
+// up, in order, so no two ever share an order number.
+func (s *TodoService) renumberOrder(db sqlExecutor, ownerID int) error {
+	rows, err := db.Query(`
+		SELECT id, order_no
+		FROM todos
+		WHERE user_id = ? AND org_id = ? AND order_no IS NOT NULL
+		ORDER BY order_no ASC`, ownerID, s.orgID)
+	if err != nil {
+		return err
+	}
+	var moves [][2]int // todo ID and new order number
+	position := 0
+	for rows.Next() {
+		var id, orderNo int
+		if err := rows.Scan(&id, &orderNo); err != nil {
+			rows.Close()
+			return err
+		}
+		position++
+		if orderNo != position {
+			moves = append(moves, [2]int{id, position})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, move := range moves {
+		if _, err := db.Exec("UPDATE todos SET order_no = ?, updated_at = updated_at WHERE id = ?", move[1], move[0]); err != nil {
+			return fmt.Errorf("error updating order numbers: %v", err)
+		}
+	}
+	return nil
+}
+
+// RunArchiver calls ArchiveCompleted every ARCHIVE_SWEEP_INTERVAL. It never
+// returns.
+func (s *TodoService) RunArchiver() {
+	interval := envDuration("ARCHIVE_SWEEP_INTERVAL", DefaultArchiveSweepInterval)
+	for {
+		archived, err := s.ArchiveCompleted()
+		if err != nil {
+			log.Println("Archive sweep failed:", err)
+		} else if archived > 0 {
+			log.Printf("Archive sweep archived %d todos", archived)
+		}
+		time.Sleep(interval)
+	}
+}
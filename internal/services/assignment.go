@@ -0,0 +1,349 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// GetAssignees returns the users assigned to a todo
+func (s *TodoService) GetAssignees(id, userID int) ([]models.Assignee, error) {
+	todo, err := s.GetByID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	return todo.Assignees, nil
+}
+
+// SetAssignees replaces the assignees of a todo. Every assignee must be able
+// to see the todo.
+func (s *TodoService) SetAssignees(id int, assigneeIDs []int, userID int) ([]models.Assignee, error) {
+	return s.changeAssignees(id, assigneeIDs, userID, true)
+}
+
+// Assign adds assignees to a todo, keeping the existing ones
+func (s *TodoService) Assign(id int, assigneeIDs []int, userID int) ([]models.Assignee, error) {
+	if len(assigneeIDs) == 0 {
+		return nil, fmt.Errorf("user_ids is required")
+	}
+	return s.changeAssignees(id, assigneeIDs, userID, false)
+}
+
+// Unassign removes an assignee. Editors can unassign anyone; assignees can
+// always unassign themselves.
+func (s *TodoService) Unassign(id, assigneeID, userID int) error {
+	required := models.RoleEditor
+	if assigneeID == userID {
+		required = models.RoleViewer
+	}
+	todo, err := s.authorize(id, userID, required)
+	if err != nil {
+		return err
+	}
+	if todo, err = withDetails(s.db(), todo); err != nil {
+		return err
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	removed, err := removeAssignee(tx, id, assigneeID, &userID, "")
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fmt.Errorf("assignee not found")
+	}
+	changed, err := loadTodo(tx, id)
+	if err != nil {
+		return err
+	}
+	event := TodoEvent{Type: EventTodoUnassigned, Todo: changed, ActorID: userID, UserIDs: []int{assigneeID}}
+	if err := s.stage(tx, event); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.emit(event)
+	s.journal(userID, models.OperationUnassign, todo, changed)
+	return nil
+}
+
+// GetAssignmentHistory returns the assignment changes of a todo, newest first
+func (s *TodoService) GetAssignmentHistory(id, userID int) ([]models.AssignmentEvent, error) {
+	if _, err := s.authorize(id, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT e.id, e.todo_id, e.user_id, u.username, e.action, e.actor_id, e.reason, e.created_at
+		FROM todo_assignment_events e
+		JOIN users u ON u.id = e.user_id
+		WHERE e.todo_id = ?
+		ORDER BY e.created_at DESC, e.id DESC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AssignmentEvent{}
+	for rows.Next() {
+		var event models.AssignmentEvent
+		var actorID sql.NullInt64
+		var reason sql.NullString
+		err := rows.Scan(&event.ID, &event.TodoID, &event.UserID, &event.Username, &event.Action,
+			&actorID, &reason, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			actor := int(actorID.Int64)
+			event.ActorID = &actor
+		}
+		event.Reason = reason.String
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (s *TodoService) changeAssignees(id int, assigneeIDs []int, userID int, replace bool) ([]models.Assignee, error) {
+	todo, err := s.authorizeActive(id, userID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if todo, err = withDetails(s.db(), todo); err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	wanted := make(map[int]bool)
+	for _, assigneeID := range assigneeIDs {
+		if wanted[assigneeID] {
+			continue
+		}
+		role, err := todoRole(s.db(), todo, assigneeID)
+		if err != nil {
+			return nil, err
+		}
+		if role == "" {
+			return nil, fmt.Errorf("user %d cannot access this todo", assigneeID)
+		}
+		wanted[assigneeID] = true
+		ids = append(ids, assigneeID)
+	}
+
+	current, err := assigneeIDsOf(s.db(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var added, removed []int
+	for _, assigneeID := range ids {
+		if current[assigneeID] {
+			continue
+		}
+		added = append(added, assigneeID)
+		_, err := tx.Exec(`
+			INSERT INTO todo_assignees (todo_id, user_id, assigned_by)
+			VALUES (?, ?, ?)`, id, assigneeID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("error assigning user: %v", err)
+		}
+		if err := recordAssignment(tx, id, assigneeID, models.AssignmentAssigned, &userID, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	if replace {
+		for assigneeID := range current {
+			if wanted[assigneeID] {
+				continue
+			}
+			if _, err := removeAssignee(tx, id, assigneeID, &userID, ""); err != nil {
+				return nil, err
+			}
+			removed = append(removed, assigneeID)
+		}
+	}
+
+	var changed *models.Todo
+	var events []TodoEvent
+	if len(added) > 0 || len(removed) > 0 {
+		if changed, err = loadTodo(tx, id); err != nil {
+			return nil, err
+		}
+		if len(added) > 0 {
+			events = append(events, TodoEvent{Type: EventTodoAssigned, Todo: changed, ActorID: userID, UserIDs: added})
+		}
+		if len(removed) > 0 {
+			events = append(events, TodoEvent{Type: EventTodoUnassigned, Todo: changed, ActorID: userID, UserIDs: removed})
+		}
+		if err := s.stage(tx, events...); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if changed != nil {
+		s.emit(events...)
+		s.journal(userID, models.OperationAssign, todo, changed)
+	}
+	return s.GetAssignees(id, userID)
+}
+
+// assigneeIDsOf returns the set of users assigned to a todo
+func assigneeIDsOf(db sqlExecutor, todoID int) (map[int]bool, error) {
+	rows, err := db.Query("SELECT user_id FROM todo_assignees WHERE todo_id = ?", todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// removeAssignee unassigns a user and records the change, reporting whether
+// the user was assigned
+func removeAssignee(db sqlExecutor, todoID, assigneeID int, actorID *int, reason string) (bool, error) {
+	result, err := db.Exec("DELETE FROM todo_assignees WHERE todo_id = ? AND user_id = ?", todoID, assigneeID)
+	if err != nil {
+		return false, fmt.Errorf("error unassigning user: %v", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return false, nil
+	}
+	return true, recordAssignment(db, todoID, assigneeID, models.AssignmentUnassigned, actorID, reason)
+}
+
+func recordAssignment(db sqlExecutor, todoID, assigneeID int, action string, actorID *int, reason string) error {
+	_, err := db.Exec(`
+		INSERT INTO todo_assignment_events (todo_id, user_id, action, actor_id, reason)
+		VALUES (?, ?, ?, ?, ?)`,
+		todoID, assigneeID, action, actorID, nullableString(reason))
+	if err != nil {
+		return fmt.Errorf("error recording assignment: %v", err)
+	}
+	return nil
+}
+
+// unassignWithoutAccess removes the assignees that can no longer see their
+// todo. where filters the candidate assignments on todo_assignees a and
+// todos t; it is called after memberships change or a todo changes list.
+// It returns a todo.unassigned event, without actor, for each todo that lost
+// assignees, for the caller to stage in the same transaction.
+func unassignWithoutAccess(db sqlExecutor, where string, args ...interface{}) ([]TodoEvent, error) {
+	rows, err := db.Query(`
+		SELECT a.todo_id, a.user_id
+		FROM todo_assignees a
+		JOIN todos t ON t.id = a.todo_id
+		WHERE `+where+`
+		ORDER BY a.todo_id ASC, a.user_id ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error checking assignees: %v", err)
+	}
+
+	var candidates [][2]int
+	for rows.Next() {
+		var todoID, assigneeID int
+		if err := rows.Scan(&todoID, &assigneeID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, [2]int{todoID, assigneeID})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var todoIDs []int
+	removed := make(map[int][]int) // assignees removed, by todo
+	for _, c := range candidates {
+		todo, err := scanTodo(db.QueryRow("SELECT "+todoColumns+" FROM todos WHERE id = ?", c[0]))
+		if err != nil {
+			return nil, err
+		}
+		role, err := todoRole(db, todo, c[1])
+		if err != nil {
+			return nil, err
+		}
+		if role != "" {
+			continue
+		}
+		if _, err := removeAssignee(db, c[0], c[1], nil, models.AssignmentReasonAccessLost); err != nil {
+			return nil, err
+		}
+		if removed[c[0]] == nil {
+			todoIDs = append(todoIDs, c[0])
+		}
+		removed[c[0]] = append(removed[c[0]], c[1])
+	}
+
+	events := make([]TodoEvent, 0, len(todoIDs))
+	for _, todoID := range todoIDs {
+		todo, err := loadTodo(db, todoID)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, TodoEvent{Type: EventTodoUnassigned, Todo: todo, UserIDs: removed[todoID]})
+	}
+	return events, nil
+}
+
+// attachAssignees loads the assignees of the given todos in one query
+func attachAssignees(db sqlExecutor, todos []models.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int, len(todos))
+	args := make([]interface{}, len(todos))
+	for i := range todos {
+		todos[i].Assignees = []models.Assignee{}
+		index[todos[i].ID] = i
+		args[i] = todos[i].ID
+	}
+
+	rows, err := db.Query(`
+		SELECT a.todo_id, a.user_id, u.username, a.assigned_by, a.assigned_at
+		FROM todo_assignees a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.todo_id IN (`+inPlaceholders(len(todos))+`)
+		ORDER BY a.assigned_at ASC, a.user_id ASC`, args...)
+	if err != nil {
+		return fmt.Errorf("error loading assignees: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todoID int
+		var assignee models.Assignee
+		if err := rows.Scan(&todoID, &assignee.UserID, &assignee.Username, &assignee.AssignedBy, &assignee.AssignedAt); err != nil {
+			return err
+		}
+		i := index[todoID]
+		todos[i].Assignees = append(todos[i].Assignees, assignee)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+	"todo/internal/storage"
+)
+
+// Attachment limits used when ATTACHMENT_MAX_SIZE or ATTACHMENT_QUOTA is not set
+const (
+	DefaultAttachmentMaxSize = 25 << 20  // per file
+	DefaultAttachmentQuota   = 250 << 20 // per user
+)
+
+// DefaultAttachmentGCInterval is used when ATTACHMENT_GC_INTERVAL is not set
+const DefaultAttachmentGCInterval = 5 * time.Minute
+
+// AttachmentService stores todo attachments: metadata in the database and
+// content in a blob store. Blobs are only removed by CollectGarbage, which
+// runs in the background, so a failing blob store never blocks deletes.
+type AttachmentService struct {
+	todos      *TodoService
+	store      storage.BlobStore
+	maxSize    int64
+	quota      int64
+	gcInterval time.Duration
+}
+
+func NewAttachmentService(store storage.BlobStore) *AttachmentService {
+	return &AttachmentService{
+		todos:      NewTodoService(),
+		store:      store,
+		maxSize:    envInt64("ATTACHMENT_MAX_SIZE", DefaultAttachmentMaxSize),
+		quota:      envInt64("ATTACHMENT_QUOTA", DefaultAttachmentQuota),
+		gcInterval: envDuration("ATTACHMENT_GC_INTERVAL", DefaultAttachmentGCInterval),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *AttachmentService) ForOrg(orgID int) *AttachmentService {
+	scoped := *s
+	scoped.todos = s.todos.ForOrg(orgID)
+	return &scoped
+}
+
+// MaxSize is the largest file that can be uploaded
+func (s *AttachmentService) MaxSize() int64 {
+	return s.maxSize
+}
+
+const attachmentColumns = `id, todo_id, filename, content_type, size, uploaded_by, created_at, storage_key`
+
+// GetAll returns the attachments of a todo, oldest first
+func (s *AttachmentService) GetAll(todoID, userID int) ([]models.Attachment, error) {
+	if _, err := s.todos.authorize(todoID, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	return queryAttachments(`
+		SELECT `+attachmentColumns+`
+		FROM todo_attachments
+		WHERE todo_id = ? AND deleted_at IS NULL
+		ORDER BY created_at ASC, id ASC`, todoID)
+}
+
+// Upload stores a file of the given size. The content type is sniffed from
+// the first bytes rather than trusted from the client.
+func (s *AttachmentService) Upload(todoID int, filename string, file io.Reader, size int64, userID int) (*models.Attachment, error) {
+	if _, err := s.todos.authorize(todoID, userID, models.RoleEditor); err != nil {
+		return nil, err
+	}
+
+	filename = cleanFilename(filename)
+	if filename == "" {
+		return nil, fmt.Errorf("filename is required")
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("file is empty")
+	}
+	if size > s.maxSize {
+		return nil, fmt.Errorf("file too large: maximum size is %d bytes", s.maxSize)
+	}
+
+	usage, err := s.GetUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+	if usage.Used+size > usage.Quota {
+		return nil, fmt.Errorf("storage quota exceeded: %d of %d bytes used", usage.Used, usage.Quota)
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	head = head[:n]
+	contentType := sniffContentType(head, filename)
+
+	key, err := newStorageKey(todoID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if err := s.store.Put(ctx, key, io.MultiReader(bytes.NewReader(head), file), size, contentType); err != nil {
+		return nil, fmt.Errorf("error storing file: %v", err)
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO todo_attachments (todo_id, uploaded_by, filename, content_type, size, storage_key)
+		VALUES (?, ?, ?, ?, ?, ?)`, todoID, userID, filename, contentType, size, key)
+	if err != nil {
+		s.store.Delete(ctx, key)
+		return nil, fmt.Errorf("error saving attachment: %v", err)
+	}
+
+	id, _ := result.LastInsertId()
+	return s.get(todoID, int(id))
+}
+
+// Open returns an attachment with its content, which the caller must close
+func (s *AttachmentService) Open(todoID, attachmentID, userID int) (*models.Attachment, storage.Blob, error) {
+	if _, err := s.todos.authorize(todoID, userID, models.RoleViewer); err != nil {
+		return nil, nil, err
+	}
+	attachment, err := s.get(todoID, attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blob, err := s.store.Open(context.Background(), attachment.StorageKey)
+	if err == storage.ErrNotFound {
+		return nil, nil, fmt.Errorf("attachment not found")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening attachment: %v", err)
+	}
+	return attachment, blob, nil
+}
+
+// Delete hides an attachment immediately; its blob is removed by the garbage
+// collector
+func (s *AttachmentService) Delete(todoID, attachmentID, userID int) error {
+	if _, err := s.todos.authorize(todoID, userID, models.RoleEditor); err != nil {
+		return err
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE todo_attachments
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND todo_id = ? AND deleted_at IS NULL`, attachmentID, todoID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("attachment not found")
+	}
+	return nil
+}
+
+// GetUsage returns the storage used by the user's attachments on existing
+// todos. A blob shared by duplicated todos is counted once.
+func (s *AttachmentService) GetUsage(userID int) (*models.StorageUsage, error) {
+	usage := &models.StorageUsage{Quota: s.quota}
+	err := database.DB.QueryRow(`
+		SELECT COALESCE(SUM(size), 0)
+		FROM (
+			SELECT DISTINCT a.storage_key, a.size
+			FROM todo_attachments a
+			JOIN todos t ON t.id = a.todo_id
+			WHERE a.uploaded_by = ? AND a.deleted_at IS NULL
+		) blobs`, userID).Scan(&usage.Used)
+	if err != nil {
+		return nil, fmt.Errorf("error checking storage usage: %v", err)
+	}
+	return usage, nil
+}
+
+// CollectGarbage removes the blobs and metadata of deleted attachments and of
+// attachments whose todo has been deleted. A blob shared with other
+// attachments is kept until its last attachment is collected. It returns the
+// number of attachments removed.
+func (s *AttachmentService) CollectGarbage() (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT a.id, a.storage_key
+		FROM todo_attachments a
+		LEFT JOIN todos t ON t.id = a.todo_id
+		WHERE a.deleted_at IS NOT NULL OR t.id IS NULL
+		LIMIT 500`)
+	if err != nil {
+		return 0, err
+	}
+
+	type garbage struct {
+		id  int
+		key string
+	}
+	var candidates []garbage
+	for rows.Next() {
+		var g garbage
+		if err := rows.Scan(&g.id, &g.key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		candidates = append(candidates, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, g := range candidates {
+		var shared int
+		err := database.DB.QueryRow("SELECT COUNT(*) FROM todo_attachments WHERE storage_key = ? AND id <> ?", g.key, g.id).Scan(&shared)
+		if err != nil {
+			return removed, err
+		}
+		if shared == 0 {
+			if err := s.store.Delete(context.Background(), g.key); err != nil {
+				return removed, fmt.Errorf("error deleting blob %s: %v", g.key, err)
+			}
+		}
+		if _, err := database.DB.Exec("DELETE FROM todo_attachments WHERE id = ?", g.id); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RunGarbageCollector calls CollectGarbage every ATTACHMENT_GC_INTERVAL. It
+// never returns.
+func (s *AttachmentService) RunGarbageCollector() {
+	for {
+		removed, err := s.CollectGarbage()
+		if err != nil {
+			log.Println("Attachment garbage collection failed:", err)
+		} else if removed > 0 {
+			log.Printf("Attachment garbage collection removed %d attachments", removed)
+		}
+		time.Sleep(s.gcInterval)
+	}
+}
+
+func (s *AttachmentService) get(todoID, attachmentID int) (*models.Attachment, error) {
+	attachments, err := queryAttachments(`
+		SELECT `+attachmentColumns+`
+		FROM todo_attachments
+		WHERE id = ? AND todo_id = ? AND deleted_at IS NULL`, attachmentID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, fmt.Errorf("attachment not found")
+	}
+	return &attachments[0], nil
+}
+
+func queryAttachments(query string, args ...interface{}) ([]models.Attachment, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		var a models.Attachment
+		err := rows.Scan(&a.ID, &a.TodoID, &a.Filename, &a.ContentType, &a.Size, &a.UploadedBy, &a.CreatedAt, &a.StorageKey)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// sniffContentType detects the type from the content. When the content is
+// not recognized, the file extension is used instead.
+func sniffContentType(head []byte, filename string) string {
+	contentType := http.DetectContentType(head)
+	if contentType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); byExt != "" {
+			return byExt
+		}
+	}
+	return contentType
+}
+
+// cleanFilename strips any directory part and control characters from an
+// uploaded file name
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "." || name == "/" {
+		return ""
+	}
+	if len(name) > 255 {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:255-len(ext)], "") + ext
+	}
+	return name
+}
+
+func newStorageKey(todoID int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating storage key: %v", err)
+	}
+	return fmt.Sprintf("todos/%d/%s", todoID, hex.EncodeToString(b)), nil
+}
+
+func envInt64(key string, fallback int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// envDuration reads a duration such as "5m" from the environment
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// Comment pages default to DefaultCommentPageSize top-level comments
+const (
+	DefaultCommentPageSize = 20
+	MaxCommentPageSize     = 100
+)
+
+// CommentService manages comments on todos. Reading comments requires access
+// to the todo and writing them requires the editor role.
+type CommentService struct {
+	todos *TodoService
+}
+
+func NewCommentService() *CommentService {
+	return &CommentService{
+		todos: NewTodoService(),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *CommentService) ForOrg(orgID int) *CommentService {
+	return &CommentService{todos: s.todos.ForOrg(orgID)}
+}
+
+const commentColumns = `c.id, c.todo_id, c.user_id, u.username, c.parent_id, c.body, c.edited, c.created_at, c.updated_at`
+
+// GetComments returns a page of a todo's top-level comments, oldest first,
+// each with all of its replies
+func (s *CommentService) GetComments(todoID, userID, page, pageSize int) (*models.CommentPage, error) {
+	if _, err := s.todos.authorize(todoID, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		return nil, fmt.Errorf("invalid page: must be at least 1")
+	}
+	if pageSize < 1 || pageSize > MaxCommentPageSize {
+		return nil, fmt.Errorf("invalid page_size: must be between 1 and %d", MaxCommentPageSize)
+	}
+
+	result := &models.CommentPage{Comments: []models.Comment{}, Page: page, PageSize: pageSize}
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM todo_comments
+		WHERE todo_id = ? AND parent_id IS NULL`, todoID).Scan(&result.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	threads, err := queryComments(`
+		SELECT `+commentColumns+`
+		FROM todo_comments c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.todo_id = ? AND c.parent_id IS NULL
+		ORDER BY c.created_at ASC, c.id ASC
+		LIMIT ? OFFSET ?`, todoID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(threads) == 0 {
+		return result, nil
+	}
+
+	args := make([]interface{}, len(threads))
+	index := make(map[int]int, len(threads))
+	for i, thread := range threads {
+		args[i] = thread.ID
+		index[thread.ID] = i
+	}
+	replies, err := queryComments(`
+		SELECT `+commentColumns+`
+		FROM todo_comments c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.parent_id IN (`+inPlaceholders(len(threads))+`)
+		ORDER BY c.created_at ASC, c.id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := attachMentions(threads); err != nil {
+		return nil, err
+	}
+	if err := attachMentions(replies); err != nil {
+		return nil, err
+	}
+	for _, reply := range replies {
+		i := index[*reply.ParentID]
+		threads[i].Replies = append(threads[i].Replies, reply)
+	}
+
+	result.Comments = threads
+	return result, nil
+}
+
+// Create adds a comment or, with a parent_id, a reply to a top-level comment
+func (s *CommentService) Create(todoID int, req *models.CommentRequest, userID int) (*models.Comment, error) {
+	todo, err := s.todos.authorize(todoID, userID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	body, err := validateCommentBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ParentID != nil {
+		parent, err := s.getComment(todoID, *req.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent.ParentID != nil {
+			return nil, fmt.Errorf("replies cannot be replied to")
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO todo_comments (todo_id, user_id, parent_id, body)
+		VALUES (?, ?, ?, ?)`, todoID, userID, req.ParentID, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating comment: %v", err)
+	}
+	id, _ := result.LastInsertId()
+
+	if err := saveMentions(tx, int(id), todo, body); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	comment, err := s.getWithMentions(todoID, int(id))
+	if err != nil {
+		return nil, err
+	}
+	notifyComment(s.todos.orgID, todo, comment)
+	return comment, nil
+}
+
+// Update changes the body of a comment. Only the author can edit a comment;
+// the previous body is kept in the edit history.
+func (s *CommentService) Update(todoID, commentID int, req *models.CommentRequest, userID int) (*models.Comment, error) {
+	todo, err := s.todos.authorize(todoID, userID, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := s.getWithMentions(todoID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.UserID != userID {
+		return nil, fmt.Errorf("access denied")
+	}
+	body, err := validateCommentBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	if body == comment.Body {
+		return comment, nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO comment_edits (comment_id, body) VALUES (?, ?)", commentID, comment.Body); err != nil {
+		return nil, fmt.Errorf("error saving edit history: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE todo_comments SET body = ?, edited = TRUE WHERE id = ?", body, commentID); err != nil {
+		return nil, fmt.Errorf("error updating comment: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM comment_mentions WHERE comment_id = ?", commentID); err != nil {
+		return nil, err
+	}
+	if err := saveMentions(tx, commentID, todo, body); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	after, err := s.getWithMentions(todoID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	notifyMentions(s.todos.orgID, todo, comment, after)
+	return after, nil
+}
+
+// Delete removes a comment; replies are removed with it. Only the author can
+// delete a comment.
+func (s *CommentService) Delete(todoID, commentID, userID int) error {
+	if _, err := s.todos.authorize(todoID, userID, models.RoleViewer); err != nil {
+		return err
+	}
+	comment, err := s.getComment(todoID, commentID)
+	if err != nil {
+		return err
+	}
+	if comment.UserID != userID {
+		return fmt.Errorf("access denied")
+	}
+
+	_, err = database.DB.Exec("DELETE FROM todo_comments WHERE id = ?", commentID)
+	return err
+}
+
+// GetHistory returns the previous bodies of a comment, newest first
+func (s *CommentService) GetHistory(todoID, commentID, userID int) ([]models.CommentEdit, error) {
+	if _, err := s.todos.authorize(todoID, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	if _, err := s.getComment(todoID, commentID); err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, comment_id, body, edited_at
+		FROM comment_edits
+		WHERE comment_id = ?
+		ORDER BY edited_at DESC, id DESC`, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := []models.CommentEdit{}
+	for rows.Next() {
+		var edit models.CommentEdit
+		if err := rows.Scan(&edit.ID, &edit.CommentID, &edit.Body, &edit.EditedAt); err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit)
+	}
+	return edits, rows.Err()
+}
+
+func (s *CommentService) getComment(todoID, commentID int) (*models.Comment, error) {
+	comments, err := queryComments(`
+		SELECT `+commentColumns+`
+		FROM todo_comments c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.id = ? AND c.todo_id = ?`, commentID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return nil, fmt.Errorf("comment not found")
+	}
+	return &comments[0], nil
+}
+
+func (s *CommentService) getWithMentions(todoID, commentID int) (*models.Comment, error) {
+	comment, err := s.getComment(todoID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	comments := []models.Comment{*comment}
+	if err := attachMentions(comments); err != nil {
+		return nil, err
+	}
+	return &comments[0], nil
+}
+
+func validateCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", fmt.Errorf("body is required")
+	}
+	if len(body) > models.MaxCommentLength {
+		return "", fmt.Errorf("body must be at most %d characters", models.MaxCommentLength)
+	}
+	return body, nil
+}
+
+func queryComments(query string, args ...interface{}) ([]models.Comment, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		var parentID sql.NullInt64
+		err := rows.Scan(&comment.ID, &comment.TodoID, &comment.UserID, &comment.Username, &parentID,
+			&comment.Body, &comment.Edited, &comment.CreatedAt, &comment.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			comment.ParentID = &id
+		}
+		comment.Mentions = []models.Mention{}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// attachMentions loads the resolved mentions of the given comments
+func attachMentions(comments []models.Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int, len(comments))
+	args := make([]interface{}, len(comments))
+	for i, comment := range comments {
+		index[comment.ID] = i
+		args[i] = comment.ID
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT m.comment_id, m.user_id, u.username
+		FROM comment_mentions m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.comment_id IN (`+inPlaceholders(len(comments))+`)
+		ORDER BY u.username ASC`, args...)
+	if err != nil {
+		return fmt.Errorf("error loading mentions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var commentID int
+		var mention models.Mention
+		if err := rows.Scan(&commentID, &mention.UserID, &mention.Username); err != nil {
+			return err
+		}
+		i := index[commentID]
+		comments[i].Mentions = append(comments[i].Mentions, mention)
+	}
+	return rows.Err()
+}
+
+var (
+	mentionRegex  = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9_.\-]+)`)
+	codeSpanRegex = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+)
+
+// parseMentions returns the distinct @usernames of a Markdown body, ignoring
+// code spans and fenced code blocks
+func parseMentions(body string) []string {
+	body = codeSpanRegex.ReplaceAllString(body, " ")
+
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionRegex.FindAllStringSubmatch(body, -1) {
+		username := strings.TrimRight(match[1], ".-")
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// saveMentions resolves the @usernames of a comment against users.username.
+// Users who cannot see the todo are not mentioned, so mentions never reveal
+// a todo to someone without access.
+func saveMentions(db sqlExecutor, commentID int, todo *models.Todo, body string) error {
+	usernames := parseMentions(body)
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(usernames))
+	for i, username := range usernames {
+		args[i] = username
+	}
+	rows, err := db.Query("SELECT id FROM users WHERE username IN ("+inPlaceholders(len(usernames))+")", args...)
+	if err != nil {
+		return fmt.Errorf("error resolving mentions: %v", err)
+	}
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range userIDs {
+		role, err := todoRole(db, todo, id)
+		if err != nil {
+			return err
+		}
+		if role == "" {
+			continue
+		}
+		if _, err := db.Exec("INSERT INTO comment_mentions (comment_id, user_id) VALUES (?, ?)", commentID, id); err != nil {
+			return fmt.Errorf("error saving mention: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// Due-date views, as served by GetDueView
+const (
+	ViewToday    = "today"
+	ViewUpcoming = "upcoming"
+	ViewOverdue  = "overdue"
+)
+
+// upcomingDays is the number of days after today in the upcoming view
+const upcomingDays = 7
+
+// dueWindows returns the start of today in the user's timezone and the UTC
+// ranges of the due-date views. Overdue ends where today starts, so a todo
+// due earlier today is still in today's view.
+func dueWindows(loc *time.Location) (today time.Time, windows map[string][2]time.Time) {
+	today = localMidnight(time.Now().In(loc))
+	tomorrow := today.AddDate(0, 0, 1)
+	return today, map[string][2]time.Time{
+		ViewOverdue:  {time.Time{}, today.UTC()},
+		ViewToday:    {today.UTC(), tomorrow.UTC()},
+		ViewUpcoming: {tomorrow.UTC(), tomorrow.AddDate(0, 0, upcomingDays).UTC()},
+	}
+}
+
+// GetDueViewCounts counts the open todos in each due-date view. Completed and
+// snoozed todos are not counted.
+func (s *TodoService) GetDueViewCounts(userID int) (*models.DueViewCounts, error) {
+	loc, err := userLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+	where, args, err := s.visibleTo(userID)
+	if err != nil {
+		return nil, err
+	}
+	today, windows := dueWindows(loc)
+
+	query := []interface{}{
+		windows[ViewToday][0], windows[ViewToday][1],
+		windows[ViewUpcoming][0], windows[ViewUpcoming][1],
+		windows[ViewOverdue][1],
+	}
+	counts := &models.DueViewCounts{Date: today.Format("2006-01-02"), Timezone: loc.String()}
+	err = database.DB.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN due_date >= ? AND due_date < ? THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN due_date >= ? AND due_date < ? THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN due_date < ? THEN 1 ELSE 0 END), 0)
+		FROM todos
+		WHERE `+where+` AND completed = FALSE AND snoozed_until IS NULL AND due_date IS NOT NULL`,
+		append(query, args...)...).Scan(&counts.Today, &counts.Upcoming, &counts.Overdue)
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetDueView returns the open todos due today, in the next seven days or
+// before today, by due day. The upcoming view has a group for every day, even
+// an empty one; the others only for days with todos. Within a day, the user's
+// own todos come first, then those of shared lists, each in manual order.
+func (s *TodoService) GetDueView(view string, userID int) (*models.DueView, error) {
+	if view != ViewToday && view != ViewUpcoming && view != ViewOverdue {
+		return nil, fmt.Errorf("invalid view: must be one of %s, %s, %s", ViewToday, ViewUpcoming, ViewOverdue)
+	}
+
+	loc, err := userLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+	where, args, err := s.visibleTo(userID)
+	if err != nil {
+		return nil, err
+	}
+	today, windows := dueWindows(loc)
+	window := windows[view]
+
+	where += " AND completed = FALSE AND snoozed_until IS NULL AND due_date < ?"
+	args = append(args, window[1])
+	if !window[0].IsZero() {
+		where += " AND due_date >= ?"
+		args = append(args, window[0])
+	}
+	todos, err := s.queryTodos(where, args, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.DueView{
+		View:     view,
+		Date:     today.Format("2006-01-02"),
+		Timezone: loc.String(),
+		Count:    len(todos),
+		Groups:   []models.DueViewGroup{},
+	}
+	index := make(map[string]int)
+	if view == ViewUpcoming {
+		for day := 1; day <= upcomingDays; day++ {
+			date := today.AddDate(0, 0, day).Format("2006-01-02")
+			index[date] = len(result.Groups)
+			result.Groups = append(result.Groups, models.DueViewGroup{Date: date, Todos: []models.Todo{}})
+		}
+	}
+	for _, todo := range todos {
+		date := todo.DueDate.In(loc).Format("2006-01-02")
+		i, ok := index[date]
+		if !ok {
+			i = len(result.Groups)
+			index[date] = i
+			result.Groups = append(result.Groups, models.DueViewGroup{Date: date, Todos: []models.Todo{}})
+		}
+		result.Groups[i].Todos = append(result.Groups[i].Todos, todo)
+		result.Groups[i].Count++
+	}
+	sort.SliceStable(result.Groups, func(i, j int) bool {
+		return result.Groups[i].Date < result.Groups[j].Date
+	})
+	return result, nil
+}
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// DuplicateService copies todos and lists. A copy keeps the title,
+// description, priority, estimate, due date, recurrence and workflow state of
+// the original; assignees, comments, time entries and sprint membership are
+// not copied.
+type DuplicateService struct {
+	todos *TodoService
+	lists *ListService
+	orgID int
+}
+
+func NewDuplicateService() *DuplicateService {
+	return &DuplicateService{
+		todos: NewTodoService(),
+		lists: NewListService(),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *DuplicateService) ForOrg(orgID int) *DuplicateService {
+	return &DuplicateService{
+		todos: s.todos.ForOrg(orgID),
+		lists: s.lists.ForOrg(orgID),
+		orgID: orgID,
+	}
+}
+
+// DuplicateTodo copies a todo into the same list, for the same owner. The
+// copy goes right after the original unless a position is requested.
+func (s *DuplicateService) DuplicateTodo(id int, req *models.DuplicateRequest, userID int) (*models.Todo, error) {
+	original, err := s.todos.authorizeActive(id, userID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	position := original.OrderNo + 1
+	if req.Position != nil {
+		nextOrderNo, err := s.todos.getNextOrderNo(tx, original.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting next order number: %v", err)
+		}
+		if *req.Position < 1 || *req.Position > nextOrderNo {
+			return nil, fmt.Errorf("invalid position: must be between 1 and %d", nextOrderNo)
+		}
+		position = *req.Position
+	}
+
+	copyID, err := s.copyTodo(tx, original, original.ListID, original.UserID, req, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.todos.moveBlock(tx, original.UserID, []int{copyID}, position); err != nil {
+		return nil, err
+	}
+
+	copied, err := loadTodo(tx, copyID)
+	if err != nil {
+		return nil, err
+	}
+	events := createdEvents(copied, userID)
+	if err := s.todos.stage(tx, events...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.todos.emit(events...)
+	s.todos.journal(userID, models.OperationCreate, nil, copied)
+	return copied, nil
+}
+
+// DuplicateList copies a list and its workflow into a new list owned by the
+// user. With children, the list's todos are copied too, keeping their manual
+// order and board positions; at most MaxDuplicateTodos todos are copied. The
+// copied todos go right after the original list's todos when the user owns
+// them, otherwise at the end of the user's todos, unless a position is
+// requested. Each copied todo is journaled as created, so undo removes them
+// one at a time.
+func (s *DuplicateService) DuplicateList(id int, req *models.DuplicateRequest, userID int) (*models.DuplicateListResult, error) {
+	list, err := s.lists.GetByID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.lists.checkCanCreate(userID); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = list.Name + " (copy)"
+	}
+	if len(name) > 255 {
+		return nil, fmt.Errorf("name must be at most 255 characters")
+	}
+
+	var todos []models.Todo
+	if req.IncludeChildren {
+		var count int
+		err := database.DB.QueryRow("SELECT COUNT(*) FROM todos WHERE list_id = ? AND org_id = ? AND archived_at IS NULL", id, s.orgID).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count > models.MaxDuplicateTodos {
+			return nil, fmt.Errorf("list has too many todos to duplicate: %d of at most %d", count, models.MaxDuplicateTodos)
+		}
+		if todos, err = s.listTodos(id); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	workflow, err := loadWorkflow(tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading workflow: %v", err)
+	}
+
+	nextOrderNo, err := s.todos.getNextOrderNo(tx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting next order number: %v", err)
+	}
+	position := nextOrderNo
+	if req.Position != nil {
+		if *req.Position < 1 || *req.Position > nextOrderNo {
+			return nil, fmt.Errorf("invalid position: must be between 1 and %d", nextOrderNo)
+		}
+		position = *req.Position
+	} else if list.UserID == userID && len(todos) > 0 {
+		position = todos[len(todos)-1].OrderNo + 1
+	}
+
+	result, err := tx.Exec("INSERT INTO lists (user_id, org_id, name) VALUES (?, ?, ?)", userID, s.orgID, name)
+	if err != nil {
+		return nil, err
+	}
+	newID, _ := result.LastInsertId()
+	listID := int(newID)
+
+	if err := saveWorkflow(tx, listID, workflow); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(todos))
+	for i := range todos {
+		copyID, err := s.copyTodo(tx, &todos[i], &listID, userID, req, userID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("UPDATE todos SET state_position = ? WHERE id = ?", todos[i].StatePosition, copyID); err != nil {
+			return nil, fmt.Errorf("error updating board position: %v", err)
+		}
+		ids = append(ids, copyID)
+	}
+	if err := s.todos.moveBlock(tx, userID, ids, position); err != nil {
+		return nil, err
+	}
+
+	var events []TodoEvent
+	copies := make([]*models.Todo, 0, len(ids))
+	for _, copyID := range ids {
+		copied, err := loadTodo(tx, copyID)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, copied)
+		events = append(events, createdEvents(copied, userID)...)
+	}
+	if err := s.todos.stage(tx, events...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.todos.emit(events...)
+	for _, copied := range copies {
+		s.todos.journal(userID, models.OperationCreate, nil, copied)
+	}
+
+	copied, err := s.lists.GetByID(listID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DuplicateListResult{List: copied, Todos: len(ids)}, nil
+}
+
+// copyTodo inserts a copy of a todo at the end of the owner's manual order,
+// with its tags and attachments when requested
+func (s *DuplicateService) copyTodo(tx sqlExecutor, original *models.Todo, listID *int, ownerID int, req *models.DuplicateRequest, userID int) (int, error) {
+	todo := &models.Todo{
+		ListID:      listID,
+		Title:       original.Title,
+		Description: original.Description,
+		Completed:   original.Completed,
+		Priority:    original.Priority,
+		Estimate:    original.Estimate,
+		DueDate:     original.DueDate,
+		State:       original.State,
+		Recurrence:  original.Recurrence,
+	}
+	copyID, err := s.todos.insertTodo(tx, todo, ownerID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if req.IncludeTags {
+		if _, err := tx.Exec("INSERT INTO todo_tags (todo_id, tag) SELECT ?, tag FROM todo_tags WHERE todo_id = ?", copyID, original.ID); err != nil {
+			return 0, fmt.Errorf("error copying tags: %v", err)
+		}
+	}
+	if req.IncludeAttachments {
+		// The copy shares the original's blobs; the garbage collector only
+		// removes a blob once no attachment refers to it
+		_, err := tx.Exec(`
+			INSERT INTO todo_attachments (todo_id, uploaded_by, filename, content_type, size, storage_key)
+			SELECT ?, uploaded_by, filename, content_type, size, storage_key
+			FROM todo_attachments
+			WHERE todo_id = ? AND deleted_at IS NULL
+			ORDER BY id ASC`, copyID, original.ID)
+		if err != nil {
+			return 0, fmt.Errorf("error copying attachments: %v", err)
+		}
+	}
+	return copyID, nil
+}
+
+// listTodos returns the active todos of a list in manual order
+func (s *DuplicateService) listTodos(listID int) ([]models.Todo, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+todoColumns+`
+		FROM todos
+		WHERE list_id = ? AND org_id = ? AND archived_at IS NULL
+		ORDER BY order_no ASC`, listID, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []models.Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, *todo)
+	}
+	return todos, rows.Err()
+}
+
+// moveBlock moves todos just added at the end of the owner's manual order to
+// start at position, shifting the todos from that position down
+func (s *TodoService) moveBlock(tx sqlExecutor, ownerID int, ids []int, position int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// Park the moved todos on negative numbers first, so that the shift never
+	// collides with them on the unique order key
+	idArgs := make([]interface{}, len(ids))
+	for i, id := range ids {
+		idArgs[i] = id
+	}
+	_, err := tx.Exec("UPDATE todos SET order_no = -order_no WHERE id IN ("+inPlaceholders(len(ids))+")", idArgs...)
+	if err != nil {
+		return fmt.Errorf("error updating order numbers: %v", err)
+	}
+
+	// Shift from the end, as MySQL checks the unique key after each row
+	_, err = tx.Exec(`
+		UPDATE todos
+		SET order_no = order_no + ?
+		WHERE user_id = ? AND org_id = ? AND order_no >= ?
+		ORDER BY order_no DESC`, len(ids), ownerID, s.orgID, position)
+	if err != nil {
+		return fmt.Errorf("error updating order numbers: %v", err)
+	}
+
+	for i, id := range ids {
+		if _, err := tx.Exec("UPDATE todos SET order_no = ? WHERE id = ?", position+i, id); err != nil {
+			return fmt.Errorf("error updating todo order: %v", err)
+		}
+	}
+	return nil
+}
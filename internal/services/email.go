@@ -0,0 +1,649 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/mailer"
+	"todo/internal/models"
+)
+
+// DefaultEmailInterval is used when EMAIL_SWEEP_INTERVAL is not set: how
+// often reminders and digests are queued and the queue is delivered
+const DefaultEmailInterval = time.Minute
+
+// Delivery of queued emails
+const (
+	MaxEmailAttempts = 6
+	emailRetryDelay  = time.Minute // doubled after each failed attempt
+	emailMaxDelay    = time.Hour
+	emailLease       = 5 * time.Minute // how long a delivery attempt holds an email
+	emailBatchSize   = 50
+	emailSendTimeout = time.Minute
+)
+
+// Preferences of users who have not set their own
+var (
+	defaultReminderOffsets = []int{60}
+	defaultDigestHour      = 8
+)
+
+// EmailService sends reminders and daily digests by email. Preferences
+// belong to the user and apply to every tenant.
+type EmailService struct {
+	mailer mailer.Mailer
+	todos  *TodoService
+}
+
+func NewEmailService(m mailer.Mailer) *EmailService {
+	return &EmailService{
+		mailer: m,
+		todos:  NewTodoService(),
+	}
+}
+
+// emailSettings are a user's email preferences with what is needed to email
+// them
+type emailSettings struct {
+	prefs      models.EmailPreferences
+	quietStart sql.NullInt64
+	quietEnd   sql.NullInt64
+	lastDigest sql.NullString
+	email      string
+	username   string
+	loc        *time.Location
+}
+
+// GetPreferences returns the user's email preferences
+func (s *EmailService) GetPreferences(userID int) (*models.EmailPreferences, error) {
+	settings, err := loadEmailSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &settings.prefs, nil
+}
+
+// UpdatePreferences replaces the user's email preferences
+func (s *EmailService) UpdatePreferences(userID int, prefs *models.EmailPreferences) (*models.EmailPreferences, error) {
+	if len(prefs.ReminderOffsets) > models.MaxReminderOffsets {
+		return nil, fmt.Errorf("invalid reminder_offsets: at most %d offsets", models.MaxReminderOffsets)
+	}
+	offsets := []int{}
+	for _, offset := range prefs.ReminderOffsets {
+		if offset < 1 || offset > models.MaxReminderOffsetMinute {
+			return nil, fmt.Errorf("invalid reminder_offsets: must be between 1 and %d minutes", models.MaxReminderOffsetMinute)
+		}
+		if !containsInt(offsets, offset) {
+			offsets = append(offsets, offset)
+		}
+	}
+	sort.Ints(offsets)
+	if prefs.DigestHour < 0 || prefs.DigestHour > 23 {
+		return nil, fmt.Errorf("invalid digest_hour: must be between 0 and 23")
+	}
+	if (prefs.QuietHoursStart == "") != (prefs.QuietHoursEnd == "") {
+		return nil, fmt.Errorf("invalid quiet hours: set both quiet_hours_start and quiet_hours_end, or neither")
+	}
+	var quietStart, quietEnd interface{}
+	if prefs.QuietHoursStart != "" {
+		start, err := parseClock(prefs.QuietHoursStart)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet_hours_start: %v", err)
+		}
+		end, err := parseClock(prefs.QuietHoursEnd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet_hours_end: %v", err)
+		}
+		quietStart, quietEnd = start, end
+	}
+	var unsubscribedAt interface{}
+	if prefs.Unsubscribed {
+		unsubscribedAt = time.Now().UTC()
+	}
+	rawOffsets, err := json.Marshal(offsets)
+	if err != nil {
+		return nil, err
+	}
+	token, err := newUnsubscribeToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Unsubscribing again keeps the time of the first unsubscription
+	_, err = database.DB.Exec(`
+		INSERT INTO email_preferences
+			(user_id, reminders, reminder_offsets, digest, digest_hour, quiet_start, quiet_end, unsubscribed_at, unsubscribe_token)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			reminders = VALUES(reminders), reminder_offsets = VALUES(reminder_offsets), digest = VALUES(digest),
+			digest_hour = VALUES(digest_hour), quiet_start = VALUES(quiet_start), quiet_end = VALUES(quiet_end),
+			unsubscribed_at = CASE WHEN VALUES(unsubscribed_at) IS NULL THEN NULL
+				ELSE COALESCE(unsubscribed_at, VALUES(unsubscribed_at)) END`,
+		userID, prefs.Reminders, string(rawOffsets), prefs.Digest, prefs.DigestHour, quietStart, quietEnd,
+		unsubscribedAt, token)
+	if err != nil {
+		return nil, fmt.Errorf("error saving email preferences: %v", err)
+	}
+	return s.GetPreferences(userID)
+}
+
+// CheckUnsubscribeToken fails unless the token is that of an unsubscribe
+// link, so that the link can be confirmed before it is used
+func (s *EmailService) CheckUnsubscribeToken(token string) error {
+	_, err := unsubscribeUser(token)
+	return err
+}
+
+// Unsubscribe stops all email to the user of an unsubscribe link. It needs no
+// authentication: the token is the proof.
+func (s *EmailService) Unsubscribe(token string) error {
+	userID, err := unsubscribeUser(token)
+	if err != nil {
+		return err
+	}
+	_, err = database.DB.Exec(`
+		UPDATE email_preferences
+		SET unsubscribed_at = COALESCE(unsubscribed_at, ?)
+		WHERE user_id = ?`, time.Now().UTC(), userID)
+	return err
+}
+
+// unsubscribeUser returns the user of an unsubscribe token
+func unsubscribeUser(token string) (int, error) {
+	if token == "" {
+		return 0, fmt.Errorf("invalid unsubscribe link")
+	}
+	var userID int
+	err := database.DB.QueryRow("SELECT user_id FROM email_preferences WHERE unsubscribe_token = ?", token).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("invalid unsubscribe link")
+	}
+	return userID, err
+}
+
+// QueueReminders emails the reminders that are due, except to unsubscribed
+// users. It returns the number of reminders queued.
+func (s *EmailService) QueueReminders(now time.Time) (int, error) {
+	reminders, err := dueReminders(now)
+	if err != nil {
+		return 0, err
+	}
+	workspaces := make(map[int]string)
+	queued := 0
+	for _, r := range reminders {
+		ok, err := s.queueReminder(r, now, workspaces)
+		if err != nil {
+			return queued, fmt.Errorf("error queueing reminder of todo %d: %v", r.todo.ID, err)
+		}
+		if ok {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+func (s *EmailService) queueReminder(r reminder, now time.Time, workspaces map[int]string) (bool, error) {
+	if r.settings.prefs.Unsubscribed {
+		return false, nil
+	}
+	key := r.key()
+	if exists, err := emailQueued(key); err != nil || exists {
+		return false, err
+	}
+	workspace, err := workspaceName(r.todo.OrgID, workspaces)
+	if err != nil {
+		return false, err
+	}
+
+	token, err := ensureUnsubscribeToken(r.userID)
+	if err != nil {
+		return false, err
+	}
+	data := mailer.ReminderData{
+		Username:       r.settings.username,
+		Title:          r.todo.Title,
+		Workspace:      workspace,
+		Due:            r.todo.DueDate.In(r.settings.loc).Format("Mon Jan 2, 15:04 MST"),
+		DueIn:          dueIn(r.todo.DueDate.Sub(now)),
+		UnsubscribeURL: unsubscribeURL(token),
+	}
+	subject := fmt.Sprintf("Reminder: %s is due %s", r.todo.Title, data.DueIn)
+	return queueEmail(r.userID, models.EmailReminder, key, r.settings, subject, "reminder", data, now)
+}
+
+// QueueDigests queues the daily digest of each user whose digest hour has
+// come today in their timezone: the open todos due today and those overdue,
+// in every workspace. Users with nothing due get no digest. It returns the
+// number of digests queued.
+func (s *EmailService) QueueDigests(now time.Time) (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT u.id
+		FROM users u
+		LEFT JOIN email_preferences p ON p.user_id = u.id
+		WHERE p.user_id IS NULL OR (p.digest = TRUE AND p.unsubscribed_at IS NULL)`)
+	if err != nil {
+		return 0, err
+	}
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, userID := range userIDs {
+		ok, err := s.queueDigest(userID, now)
+		if err != nil {
+			return queued, fmt.Errorf("error queueing digest of user %d: %v", userID, err)
+		}
+		if ok {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+func (s *EmailService) queueDigest(userID int, now time.Time) (bool, error) {
+	settings, err := loadEmailSettings(userID)
+	if err != nil {
+		return false, err
+	}
+	local := now.In(settings.loc)
+	date := local.Format("2006-01-02")
+	if local.Hour() < settings.prefs.DigestHour || strings.HasPrefix(settings.lastDigest.String, date) {
+		return false, nil
+	}
+
+	data := mailer.DigestData{Username: settings.username, Date: local.Format("Monday, January 2")}
+	tenants, err := userTenants(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, tenant := range tenants {
+		todos := s.todos.ForOrg(tenant.orgID)
+		for _, view := range []string{ViewOverdue, ViewToday} {
+			due, err := todos.GetDueView(view, userID)
+			if err != nil {
+				return false, err
+			}
+			for _, group := range due.Groups {
+				for _, todo := range group.Todos {
+					item := mailer.DigestItem{Title: todo.Title, Workspace: tenant.name}
+					if view == ViewToday {
+						item.Due = todo.DueDate.In(settings.loc).Format("15:04")
+						data.Today = append(data.Today, item)
+					} else {
+						item.Due = todo.DueDate.In(settings.loc).Format("Mon Jan 2")
+						data.Overdue = append(data.Overdue, item)
+					}
+				}
+			}
+		}
+	}
+
+	token, err := ensureUnsubscribeToken(userID)
+	if err != nil {
+		return false, err
+	}
+	queued := false
+	if len(data.Today) > 0 || len(data.Overdue) > 0 {
+		data.UnsubscribeURL = unsubscribeURL(token)
+		subject := fmt.Sprintf("Your todos for %s: %d due today, %d overdue", data.Date, len(data.Today), len(data.Overdue))
+		key := fmt.Sprintf("digest:%d:%s", userID, date)
+		if queued, err = queueEmail(userID, models.EmailDigest, key, settings, subject, "digest", data, now); err != nil {
+			return false, err
+		}
+	}
+	_, err = database.DB.Exec("UPDATE email_preferences SET last_digest_on = ? WHERE user_id = ?", date, userID)
+	return queued, err
+}
+
+// DeliverQueued sends the queued emails that are due. Failed emails are
+// retried with exponential backoff, up to MaxEmailAttempts attempts; emails
+// the server rejects for good fail right away. It returns the number of
+// emails sent.
+func (s *EmailService) DeliverQueued(now time.Time) (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, recipient, subject, text_body, html_body, attempts, next_attempt_at
+		FROM email_queue
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at ASC, id ASC
+		LIMIT ?`, models.DeliveryPending, now, emailBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	type queuedEmail struct {
+		id, userID, attempts int
+		message              mailer.Message
+		due                  time.Time
+	}
+	var emails []queuedEmail
+	for rows.Next() {
+		var e queuedEmail
+		err := rows.Scan(&e.id, &e.userID, &e.message.To, &e.message.Subject, &e.message.Text, &e.message.HTML,
+			&e.attempts, &e.due)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		emails = append(emails, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, e := range emails {
+		// Claim the email so that another worker does not send it too; if
+		// this one dies, the email is retried once the lease ends
+		result, err := database.DB.Exec(`
+			UPDATE email_queue
+			SET next_attempt_at = ?
+			WHERE id = ? AND status = ? AND next_attempt_at = ?`,
+			now.Add(emailLease), e.id, models.DeliveryPending, e.due)
+		if err != nil {
+			return sent, err
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 0 {
+			continue
+		}
+
+		var token string
+		var unsubscribed bool
+		err = database.DB.QueryRow(`
+			SELECT unsubscribe_token, unsubscribed_at IS NOT NULL
+			FROM email_preferences
+			WHERE user_id = ?`, e.userID).Scan(&token, &unsubscribed)
+		if err != nil {
+			return sent, err
+		}
+		if unsubscribed {
+			if _, err := database.DB.Exec("UPDATE email_queue SET status = ? WHERE id = ?", models.DeliveryCancelled, e.id); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		e.message.Headers = map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeURL(token) + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), emailSendTimeout)
+		sendErr := s.mailer.Send(ctx, &e.message)
+		cancel()
+
+		attempts := e.attempts + 1
+		switch {
+		case sendErr == nil:
+			_, err = database.DB.Exec(`
+				UPDATE email_queue
+				SET status = ?, attempts = ?, sent_at = ?, last_error = NULL
+				WHERE id = ?`, models.DeliverySent, attempts, time.Now().UTC(), e.id)
+			sent++
+		case mailer.IsPermanent(sendErr) || attempts >= MaxEmailAttempts:
+			log.Printf("Email %d to user %d failed for good: %v", e.id, e.userID, sendErr)
+			_, err = database.DB.Exec(`
+				UPDATE email_queue
+				SET status = ?, attempts = ?, last_error = ?
+				WHERE id = ?`, models.DeliveryFailed, attempts, sendErr.Error(), e.id)
+		default:
+			_, err = database.DB.Exec(`
+				UPDATE email_queue
+				SET attempts = ?, last_error = ?, next_attempt_at = ?
+				WHERE id = ?`, attempts, sendErr.Error(), time.Now().UTC().Add(backoff(attempts, emailRetryDelay, emailMaxDelay)), e.id)
+		}
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// backoff is the wait before the next attempt after the given number of
+// failed ones: initial, doubled after each failure, capped at max
+func backoff(attempts int, initial, max time.Duration) time.Duration {
+	delay := initial
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// RunMailer queues reminders and digests and delivers the queue every
+// EMAIL_SWEEP_INTERVAL. It never returns.
+func (s *EmailService) RunMailer() {
+	interval := envDuration("EMAIL_SWEEP_INTERVAL", DefaultEmailInterval)
+	for {
+		now := time.Now().UTC()
+		if queued, err := s.QueueReminders(now); err != nil {
+			log.Println("Reminder sweep failed:", err)
+		} else if queued > 0 {
+			log.Printf("Reminder sweep queued %d emails", queued)
+		}
+		if queued, err := s.QueueDigests(now); err != nil {
+			log.Println("Digest sweep failed:", err)
+		} else if queued > 0 {
+			log.Printf("Digest sweep queued %d emails", queued)
+		}
+		if sent, err := s.DeliverQueued(now); err != nil {
+			log.Println("Email delivery failed:", err)
+		} else if sent > 0 {
+			log.Printf("Email delivery sent %d emails", sent)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// queueEmail renders an email and queues it for delivery after the user's
+// quiet hours. It reports false when an email with the same key was queued
+// before.
+func queueEmail(userID int, kind, key string, settings *emailSettings, subject, template string, data interface{}, now time.Time) (bool, error) {
+	text, html, err := mailer.Render(template, data)
+	if err != nil {
+		return false, fmt.Errorf("error rendering %s email: %v", template, err)
+	}
+	result, err := database.DB.Exec(`
+		INSERT INTO email_queue (user_id, kind, dedupe_key, recipient, subject, text_body, html_body, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE id = id`,
+		userID, kind, key, settings.email, truncate(subject, 255), text, html, quietUntil(settings, now))
+	if err != nil {
+		return false, err
+	}
+	inserted, _ := result.RowsAffected()
+	return inserted == 1, nil
+}
+
+func emailQueued(key string) (bool, error) {
+	var exists bool
+	err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM email_queue WHERE dedupe_key = ?)", key).Scan(&exists)
+	return exists, err
+}
+
+// quietUntil returns when the user's quiet hours around now end, or now when
+// it is not quiet time. Quiet hours may span midnight, such as 22:00 to 07:00.
+func quietUntil(settings *emailSettings, now time.Time) time.Time {
+	if !settings.quietStart.Valid || !settings.quietEnd.Valid || settings.quietStart.Int64 == settings.quietEnd.Int64 {
+		return now
+	}
+	start, end := int(settings.quietStart.Int64), int(settings.quietEnd.Int64)
+	local := now.In(settings.loc)
+	minute := local.Hour()*60 + local.Minute()
+	midnight := localMidnight(local)
+	endToday := time.Date(midnight.Year(), midnight.Month(), midnight.Day(), end/60, end%60, 0, 0, settings.loc)
+
+	switch {
+	case start < end && minute >= start && minute < end:
+		return endToday.UTC()
+	case start > end && minute >= start:
+		return endToday.AddDate(0, 0, 1).UTC()
+	case start > end && minute < end:
+		return endToday.UTC()
+	}
+	return now
+}
+
+// loadEmailSettings reads the user's email preferences, or the defaults
+func loadEmailSettings(userID int) (*emailSettings, error) {
+	var settings emailSettings
+	var timezone string
+	var offsets, unsubscribedAt sql.NullString
+	var reminders, digest sql.NullBool
+	var digestHour sql.NullInt64
+	var updatedAt sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT u.email, u.username, u.timezone, p.reminders, p.reminder_offsets, p.digest, p.digest_hour,
+			p.quiet_start, p.quiet_end, p.unsubscribed_at, p.last_digest_on, p.updated_at
+		FROM users u
+		LEFT JOIN email_preferences p ON p.user_id = u.id
+		WHERE u.id = ?`, userID).Scan(&settings.email, &settings.username, &timezone, &reminders, &offsets, &digest,
+		&digestHour, &settings.quietStart, &settings.quietEnd, &unsubscribedAt, &settings.lastDigest, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if settings.loc, err = time.LoadLocation(timezone); err != nil {
+		settings.loc = time.UTC
+	}
+
+	prefs := &settings.prefs
+	if !offsets.Valid {
+		*prefs = models.EmailPreferences{
+			Reminders:       true,
+			ReminderOffsets: defaultReminderOffsets,
+			Digest:          true,
+			DigestHour:      defaultDigestHour,
+			Default:         true,
+		}
+		return &settings, nil
+	}
+	if err := json.Unmarshal([]byte(offsets.String), &prefs.ReminderOffsets); err != nil {
+		return nil, fmt.Errorf("error reading email preferences: %v", err)
+	}
+	prefs.Reminders = reminders.Bool
+	prefs.Digest = digest.Bool
+	prefs.DigestHour = int(digestHour.Int64)
+	if settings.quietStart.Valid && settings.quietEnd.Valid {
+		prefs.QuietHoursStart = formatClock(int(settings.quietStart.Int64))
+		prefs.QuietHoursEnd = formatClock(int(settings.quietEnd.Int64))
+	}
+	prefs.Unsubscribed = unsubscribedAt.Valid
+	prefs.UpdatedAt = updatedAt.Time
+	return &settings, nil
+}
+
+// ensureUnsubscribeToken returns the token of the user's unsubscribe links,
+// saving the default preferences with a new token if the user has none
+func ensureUnsubscribeToken(userID int) (string, error) {
+	token, err := newUnsubscribeToken()
+	if err != nil {
+		return "", err
+	}
+	offsets, err := json.Marshal(defaultReminderOffsets)
+	if err != nil {
+		return "", err
+	}
+	_, err = database.DB.Exec(`
+		INSERT INTO email_preferences (user_id, reminder_offsets, digest_hour, unsubscribe_token)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE user_id = user_id`, userID, string(offsets), defaultDigestHour, token)
+	if err != nil {
+		return "", err
+	}
+	err = database.DB.QueryRow("SELECT unsubscribe_token FROM email_preferences WHERE user_id = ?", userID).Scan(&token)
+	return token, err
+}
+
+func newUnsubscribeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating unsubscribe token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// unsubscribeURL is the link to the public unsubscribe endpoint. APP_URL is
+// the public address of the API.
+func unsubscribeURL(token string) string {
+	base := os.Getenv("APP_URL")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return strings.TrimSuffix(base, "/") + "/api/v1/email/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+type tenant struct {
+	orgID int
+	name  string
+}
+
+// userTenants returns the personal workspace, unnamed, and the
+// organizations the user belongs to
+func userTenants(userID int) ([]tenant, error) {
+	rows, err := database.DB.Query(`
+		SELECT o.id, o.name
+		FROM org_members m
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = ?
+		ORDER BY o.name ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []tenant{{}}
+	for rows.Next() {
+		var t tenant
+		if err := rows.Scan(&t.orgID, &t.name); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+// parseClock reads a time of day such as "22:00" as minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("must be a time such as 22:00")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// truncate shortens s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"todo/internal/models"
+)
+
+// Todo events, emitted by TodoService once a mutation has committed
+const (
+	EventTodoCreated      = "todo.created"
+	EventTodoUpdated      = "todo.updated"
+	EventTodoCompleted    = "todo.completed"
+	EventTodoDeleted      = "todo.deleted"
+	EventTodoReordered    = "todo.reordered"
+	EventTodoStateChanged = "todo.state_changed"
+	EventTodoAssigned     = "todo.assigned"
+	EventTodoUnassigned   = "todo.unassigned"
+	EventTodoTagged       = "todo.tagged"
+
+	// EventTodoOverdue is not emitted by mutations; the rule sweeper raises
+	// it for todos overdue for a rule's number of days
+	EventTodoOverdue = "todo.overdue"
+)
+
+// TodoEvent describes a change to a todo. Todo is the todo after the change,
+// or before it for todo.deleted, with its tags and assignees.
+type TodoEvent struct {
+	Type    string
+	Todo    *models.Todo
+	ActorID int
+	Tags    []string // the tags added, for todo.tagged
+	UserIDs []int    // the users assigned or unassigned
+	Fields  []string // the fields changed, for todo.updated
+}
+
+// emit hands the events of a committed mutation to the rules engine and
+// wakes the outbox relay, which publishes them to the activity feed,
+// notifications and webhooks. Mutations stage their events in the outbox in
+// their own transaction, so no event is lost when the process stops before
+// they are published. Rules run right away, as the chain of rules they start
+// is tracked through s. The events of an undo or redo are held until all of
+// its changes have committed.
+func (s *TodoService) emit(events ...TodoEvent) {
+	if s.replaying != nil {
+		s.replaying.events = append(s.replaying.events, events...)
+		return
+	}
+	wakeRelay()
+	runRules(s, events)
+}
+
+// createdEvents returns the events of a new todo: todo.created, then
+// todo.tagged when it has tags
+func createdEvents(todo *models.Todo, actorID int) []TodoEvent {
+	events := []TodoEvent{{Type: EventTodoCreated, Todo: todo, ActorID: actorID}}
+	if len(todo.Tags) > 0 {
+		events = append(events, TodoEvent{Type: EventTodoTagged, Todo: todo, ActorID: actorID, Tags: todo.Tags})
+	}
+	return events
+}
+
+// changeEvents returns the events of an update from before to after: always
+// todo.updated, then completion, state and tag changes
+func changeEvents(before, after *models.Todo, actorID int) []TodoEvent {
+	fields := differingFields(before, after, editableFields)
+	events := []TodoEvent{{Type: EventTodoUpdated, Todo: after, ActorID: actorID, Fields: fields}}
+	if after.Completed && !before.Completed {
+		events = append(events, TodoEvent{Type: EventTodoCompleted, Todo: after, ActorID: actorID})
+	}
+	if after.State != "" && after.State != before.State {
+		events = append(events, TodoEvent{Type: EventTodoStateChanged, Todo: after, ActorID: actorID})
+	}
+	if added := addedTags(before.Tags, after.Tags); len(added) > 0 {
+		events = append(events, TodoEvent{Type: EventTodoTagged, Todo: after, ActorID: actorID, Tags: added})
+	}
+	return events
+}
+
+// editableFields are the fields of a todo an update can change
+var editableFields = map[string]bool{
+	"title": true, "description": true, "completed": true, "priority": true, "estimate": true,
+	"due_date": true, "list_id": true, "state": true, "recurrence": true, "tags": true,
+}
+
+// addedTags returns the tags in after that are not in before
+func addedTags(before, after []string) []string {
+	had := make(map[string]bool, len(before))
+	for _, tag := range before {
+		had[tag] = true
+	}
+	var added []string
+	for _, tag := range after {
+		if !had[tag] {
+			added = append(added, tag)
+		}
+	}
+	return added
+}
+
+// withDetails loads the tags and assignees of a todo read by authorize
+func withDetails(db sqlExecutor, todo *models.Todo) (*models.Todo, error) {
+	todos := []models.Todo{*todo}
+	if err := attachDetails(db, todos); err != nil {
+		return nil, err
+	}
+	return &todos[0], nil
+}
@@ -0,0 +1,767 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// todoField is a part of a todo that undo and redo compare and restore
+type todoField struct {
+	name  string
+	value func(*models.Todo) string
+}
+
+// todoFields lists the fields of a todo an operation can change. Fields an
+// operation changed are checked for later changes before it is undone.
+var todoFields = []todoField{
+	{"title", func(t *models.Todo) string { return t.Title }},
+	{"description", func(t *models.Todo) string { return t.Description }},
+	{"completed", func(t *models.Todo) string { return strconv.FormatBool(t.Completed) }},
+	{"priority", func(t *models.Todo) string { return t.Priority }},
+	{"estimate", func(t *models.Todo) string {
+		if t.Estimate == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*t.Estimate, 'f', 2, 64)
+	}},
+	{"due_date", func(t *models.Todo) string { return formatSnapshotTime(t.DueDate) }},
+	{"list_id", func(t *models.Todo) string {
+		if t.ListID == nil {
+			return ""
+		}
+		return strconv.Itoa(*t.ListID)
+	}},
+	{"state", func(t *models.Todo) string { return t.State }},
+	{"recurrence", func(t *models.Todo) string { return t.Recurrence }},
+	{"tags", func(t *models.Todo) string {
+		tags := append([]string{}, t.Tags...)
+		sort.Strings(tags)
+		return strings.Join(tags, ",")
+	}},
+	{"archived_at", func(t *models.Todo) string { return formatSnapshotTime(t.ArchivedAt) }},
+	{"state_position", func(t *models.Todo) string { return strconv.Itoa(t.StatePosition) }},
+	{"order_no", func(t *models.Todo) string { return strconv.Itoa(t.OrderNo) }},
+	{"snoozed_until", func(t *models.Todo) string {
+		return formatSnapshotTime(t.SnoozedUntil) + " " + strconv.FormatBool(t.SnoozeToTop)
+	}},
+	{"assignees", func(t *models.Todo) string {
+		ids := make([]int, len(t.Assignees))
+		for i, a := range t.Assignees {
+			ids[i] = a.UserID
+		}
+		sort.Ints(ids)
+		return fmt.Sprint(ids)
+	}},
+}
+
+// positionalFields move when other todos do, so they are not compared before
+// a todo is deleted
+var positionalFields = map[string]bool{"state_position": true, "order_no": true}
+
+func formatSnapshotTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// differingFields returns the names of the fields in names on which a and b
+// differ; nil names means every field
+func differingFields(a, b *models.Todo, names map[string]bool) []string {
+	var fields []string
+	for _, f := range todoFields {
+		if names != nil && !names[f.name] {
+			continue
+		}
+		if f.value(a) != f.value(b) {
+			fields = append(fields, f.name)
+		}
+	}
+	return fields
+}
+
+// contentFields are the fields compared before a todo is deleted
+func contentFields() map[string]bool {
+	content := make(map[string]bool)
+	for _, f := range todoFields {
+		content[f.name] = !positionalFields[f.name]
+	}
+	return content
+}
+
+func conflictError(reason string) error {
+	return fmt.Errorf("conflict: %s", reason)
+}
+
+// todoTx is the transaction of a todo mutation
+type todoTx interface {
+	sqlExecutor
+	Commit() error
+	Rollback() error
+}
+
+// replayTx is the transaction an undo or redo makes all of its changes in,
+// so that it is applied in full or not at all. The mutations it goes through
+// join it: their commits and rollbacks are left to the undo or redo, which
+// emits their events once it has committed.
+type replayTx struct {
+	*sql.Tx
+	events []TodoEvent
+	next   *models.Todo // the occurrence spawned by completing a recurring todo again
+}
+
+func (t *replayTx) Commit() error {
+	return nil
+}
+
+func (t *replayTx) Rollback() error {
+	return nil
+}
+
+// begin starts the transaction of a mutation, or joins the one of the undo or
+// redo in progress
+func (s *TodoService) begin() (todoTx, error) {
+	if s.replaying != nil {
+		return s.replaying, nil
+	}
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// db returns what reads go through: the transaction of the undo or redo in
+// progress, so that they see its changes, or the database
+func (s *TodoService) db() sqlExecutor {
+	if s.replaying != nil {
+		return s.replaying
+	}
+	return database.DB
+}
+
+// journal records a committed operation in the user's undo journal and drops
+// the operations undone before it, which can no longer be redone. Changes
+// made by rules and by undo and redo themselves are not journaled.
+func (s *TodoService) journal(userID int, kind string, before, after *models.Todo) {
+	s.journalOccurrence(userID, kind, before, after, nil)
+}
+
+// journalOccurrence is journal for an operation that may have completed a
+// recurring todo and spawned its next occurrence, which undoing the operation
+// deletes. A redo hands the occurrence it spawned to the journal entry.
+func (s *TodoService) journalOccurrence(userID int, kind string, before, after, next *models.Todo) {
+	if s.replaying != nil {
+		if next != nil {
+			s.replaying.next = next
+		}
+		return
+	}
+	if s.chain != nil {
+		return
+	}
+	if err := s.writeJournal(userID, kind, before, after, next); err != nil {
+		log.Printf("Error journaling %s of a todo: %v", kind, err)
+	}
+}
+
+func (s *TodoService) writeJournal(userID int, kind string, before, after, next *models.Todo) error {
+	todoID := 0
+	if before != nil {
+		todoID = before.ID
+	} else if after != nil {
+		todoID = after.ID
+	}
+	beforeState, err := marshalSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterState, err := marshalSnapshot(after)
+	if err != nil {
+		return err
+	}
+	nextState, err := marshalSnapshot(next)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM todo_operations WHERE user_id = ? AND org_id = ? AND undone = TRUE", userID, s.orgID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO todo_operations (user_id, org_id, kind, todo_id, before_state, after_state, next_state)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, userID, s.orgID, kind, todoID, beforeState, afterState, nextState)
+	if err != nil {
+		return err
+	}
+
+	// Keep the latest MaxJournalOperations operations
+	var oldest int
+	err = tx.QueryRow(`
+		SELECT id
+		FROM todo_operations
+		WHERE user_id = ? AND org_id = ?
+		ORDER BY id DESC
+		LIMIT 1 OFFSET ?`, userID, s.orgID, models.MaxJournalOperations-1).Scan(&oldest)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil {
+		if _, err := tx.Exec("DELETE FROM todo_operations WHERE user_id = ? AND org_id = ? AND id < ?", userID, s.orgID, oldest); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func marshalSnapshot(todo *models.Todo) (interface{}, error) {
+	if todo == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+func unmarshalSnapshot(raw sql.NullString) (*models.Todo, error) {
+	if !raw.Valid {
+		return nil, nil
+	}
+	var todo models.Todo
+	if err := json.Unmarshal([]byte(raw.String), &todo); err != nil {
+		return nil, fmt.Errorf("error reading journal: %v", err)
+	}
+	return &todo, nil
+}
+
+// Undo reverts the user's latest operation in the tenant that has not been
+// undone. Only the fields the operation changed are reverted, and only if
+// nothing has changed them since; otherwise a conflict is reported and the
+// operation stays in the journal. Undoing the completion of a recurring todo
+// also deletes the occurrence it spawned, under the same rule. Comments and
+// sprint planning of a deleted todo are not brought back.
+func (s *TodoService) Undo(userID int) (*models.Operation, error) {
+	return s.replay(userID, true)
+}
+
+// Redo applies again the operation undone last, under the same rules as Undo.
+// Any new operation clears the operations that could be redone.
+func (s *TodoService) Redo(userID int) (*models.Operation, error) {
+	return s.replay(userID, false)
+}
+
+func (s *TodoService) replay(userID int, undo bool) (*models.Operation, error) {
+	query := `
+		SELECT id, kind, todo_id, before_state, after_state, next_state, created_at
+		FROM todo_operations
+		WHERE user_id = ? AND org_id = ? AND undone = FALSE
+		ORDER BY id DESC
+		LIMIT 1
+		FOR UPDATE`
+	if !undo {
+		query = `
+		SELECT id, kind, todo_id, before_state, after_state, next_state, created_at
+		FROM todo_operations
+		WHERE user_id = ? AND org_id = ? AND undone = TRUE
+		ORDER BY id ASC
+		LIMIT 1
+		FOR UPDATE`
+	}
+
+	// The checks for later changes and every change the operation made are
+	// replayed in one transaction
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var op models.Operation
+	var beforeState, afterState, nextState sql.NullString
+	err = tx.QueryRow(query, userID, s.orgID).Scan(&op.ID, &op.Kind, &op.TodoID, &beforeState, &afterState, &nextState, &op.CreatedAt)
+	if err == sql.ErrNoRows {
+		if undo {
+			return nil, fmt.Errorf("nothing to undo")
+		}
+		return nil, fmt.Errorf("nothing to redo")
+	}
+	if err != nil {
+		return nil, err
+	}
+	before, err := unmarshalSnapshot(beforeState)
+	if err != nil {
+		return nil, err
+	}
+	after, err := unmarshalSnapshot(afterState)
+	if err != nil {
+		return nil, err
+	}
+	next, err := unmarshalSnapshot(nextState)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lock the todos first, so that nothing changes them between the checks
+	// for later changes and the replay, and the checks see the latest changes
+	if err := lockTodo(tx, op.TodoID); err != nil {
+		return nil, err
+	}
+	if undo && next != nil {
+		if err := lockTodo(tx, next.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	from, to := before, after
+	if undo {
+		from, to = after, before
+	}
+	replayer := *s
+	replayer.replaying = &replayTx{Tx: tx}
+	if undo && next != nil {
+		if err := replayer.deleteOccurrence(next, userID); err != nil {
+			return nil, err
+		}
+	}
+	if op.Todo, err = replayer.applySnapshot(userID, from, to); err != nil {
+		return nil, err
+	}
+
+	if undo {
+		_, err = tx.Exec("UPDATE todo_operations SET undone = TRUE WHERE id = ?", op.ID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Completing a recurring todo again spawned a new occurrence
+		spawned, err := marshalSnapshot(replayer.replaying.next)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec("UPDATE todo_operations SET undone = FALSE, next_state = ? WHERE id = ?", spawned, op.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.emit(replayer.replaying.events...)
+	op.Undone = undo
+	return &op, nil
+}
+
+// deleteOccurrence deletes the next occurrence spawned by the completion of a
+// recurring todo being undone, unless it has changed since. An occurrence
+// deleted in the meantime is left alone.
+func (s *TodoService) deleteOccurrence(next *models.Todo, userID int) error {
+	current, err := s.GetByID(next.ID, userID)
+	if err != nil {
+		if err.Error() == "todo not found" {
+			return nil
+		}
+		return err
+	}
+	if fields := differingFields(current, next, contentFields()); len(fields) > 0 {
+		return conflictError("the next occurrence has changed since: " + strings.Join(fields, ", "))
+	}
+	return s.Delete(next.ID, userID)
+}
+
+// lockTodo locks a todo, if it exists, until the end of the transaction
+func lockTodo(tx sqlExecutor, id int) error {
+	var locked int
+	err := tx.QueryRow("SELECT id FROM todos WHERE id = ? FOR UPDATE", id).Scan(&locked)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	return nil
+}
+
+// applySnapshot moves a todo from one snapshot to the other: deleting it,
+// recreating it, or changing the fields that differ between them. It returns
+// the todo afterwards, or nil once it has been deleted.
+func (s *TodoService) applySnapshot(userID int, from, to *models.Todo) (*models.Todo, error) {
+	if from == nil {
+		return s.recreate(to, userID)
+	}
+
+	current, err := s.GetByID(from.ID, userID)
+	if err != nil {
+		if err.Error() == "todo not found" {
+			return nil, conflictError("the todo no longer exists")
+		}
+		return nil, err
+	}
+
+	if to == nil {
+		if fields := differingFields(current, from, contentFields()); len(fields) > 0 {
+			return nil, conflictError("the todo has changed since: " + strings.Join(fields, ", "))
+		}
+		return nil, s.Delete(from.ID, userID)
+	}
+
+	changed := make(map[string]bool)
+	for _, name := range differingFields(from, to, nil) {
+		changed[name] = true
+	}
+	if changed["archived_at"] {
+		return s.applyArchive(current, from, to, userID)
+	}
+	if fields := differingFields(current, from, changed); len(fields) > 0 {
+		return nil, conflictError("the todo has changed since: " + strings.Join(fields, ", "))
+	}
+	if current.ArchivedAt != nil {
+		return nil, conflictError("the todo has been archived since")
+	}
+
+	if changed["title"] || changed["description"] || changed["completed"] || changed["priority"] || changed["estimate"] ||
+		changed["due_date"] || changed["list_id"] || changed["state"] || changed["recurrence"] || changed["tags"] {
+		if err := s.restoreContent(current, to, changed, userID); err != nil {
+			return nil, err
+		}
+	}
+	if changed["state_position"] {
+		if err := s.restoreStatePosition(to, userID); err != nil {
+			return nil, err
+		}
+	}
+	if changed["order_no"] {
+		if err := s.restoreOrder(to, userID); err != nil {
+			return nil, err
+		}
+	}
+	if changed["snoozed_until"] {
+		if err := s.restoreSnooze(to, userID); err != nil {
+			return nil, err
+		}
+	}
+	if changed["assignees"] {
+		if err := s.restoreAssignees(current, to, userID); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetByID(to.ID, userID)
+}
+
+// applyArchive archives a restored todo again, or restores it again. Its
+// positions are not compared, as they follow from the restore.
+func (s *TodoService) applyArchive(current, from, to *models.Todo, userID int) (*models.Todo, error) {
+	if fields := differingFields(current, from, contentFields()); len(fields) > 0 {
+		return nil, conflictError("the todo has changed since: " + strings.Join(fields, ", "))
+	}
+	if to.ArchivedAt != nil {
+		if err := s.archive(to.ID, *to.ArchivedAt, userID); err != nil {
+			return nil, err
+		}
+	} else if _, err := s.Restore(to.ID, userID); err != nil {
+		return nil, err
+	}
+	return s.GetByID(to.ID, userID)
+}
+
+// restoreContent updates the changed editable fields of a todo to their
+// values in the snapshot, keeping the others
+func (s *TodoService) restoreContent(current, to *models.Todo, changed map[string]bool, userID int) error {
+	update := *current
+	update.ListID, update.State, update.Tags = nil, "", nil
+	if changed["title"] {
+		update.Title = to.Title
+	}
+	if changed["description"] {
+		update.Description = to.Description
+	}
+	if changed["completed"] {
+		update.Completed = to.Completed
+	}
+	if changed["priority"] {
+		update.Priority = to.Priority
+	}
+	if changed["estimate"] {
+		update.Estimate = to.Estimate
+	}
+	if changed["due_date"] {
+		update.DueDate = to.DueDate
+	}
+	if changed["recurrence"] {
+		update.Recurrence = to.Recurrence
+	}
+	if changed["list_id"] {
+		listID := 0
+		if to.ListID != nil {
+			listID = *to.ListID
+		}
+		update.ListID = &listID
+	}
+	if changed["state"] {
+		update.State = to.State
+	}
+	if changed["tags"] {
+		update.Tags = append([]string{}, to.Tags...)
+	}
+	_, err := s.Update(to.ID, &update, userID)
+	return err
+}
+
+// restoreStatePosition moves a todo back to its position in its column, or
+// as close to it as the column allows
+func (s *TodoService) restoreStatePosition(to *models.Todo, userID int) error {
+	current, err := s.authorize(to.ID, userID, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+	if current.ListID == nil || !sameListID(current.ListID, to.ListID) || current.State != to.State {
+		return nil
+	}
+	others, err := countInState(s.db(), *current.ListID, current.State, current.ID)
+	if err != nil {
+		return err
+	}
+	position := clampPosition(to.StatePosition, others+1)
+	if position == current.StatePosition {
+		return nil
+	}
+	_, err = s.TransitionTodo(to.ID, userID, to.State, position)
+	return err
+}
+
+// restoreOrder moves a todo back to its place in the manual order, or as
+// close to it as the order allows
+func (s *TodoService) restoreOrder(to *models.Todo, userID int) error {
+	current, err := s.authorize(to.ID, userID, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+	maxOrderNo, err := s.getMaxOrderNo(current.UserID)
+	if err != nil {
+		return err
+	}
+	position := clampPosition(to.OrderNo, maxOrderNo)
+	if position == current.OrderNo {
+		return nil
+	}
+	return s.ReorderTodos(userID, to.ID, position)
+}
+
+// restoreSnooze snoozes a todo again until the snapshot's time, or wakes it
+// when that time has passed
+func (s *TodoService) restoreSnooze(to *models.Todo, userID int) error {
+	var until *time.Time
+	moveToTop := false
+	if to.SnoozedUntil != nil && to.SnoozedUntil.After(time.Now()) {
+		until, moveToTop = to.SnoozedUntil, to.SnoozeToTop
+	}
+	tx, err := s.begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE todos
+		SET snoozed_until = ?, snooze_to_top = ?, updated_by = ?
+		WHERE id = ? AND org_id = ?`, until, moveToTop, userID, to.ID, s.orgID)
+	if err != nil {
+		return err
+	}
+	changed, err := loadTodo(tx, to.ID)
+	if err != nil {
+		return err
+	}
+	event := TodoEvent{Type: EventTodoUpdated, Todo: changed, ActorID: userID, Fields: []string{"snoozed_until"}}
+	if err := s.stage(tx, event); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.emit(event)
+	return nil
+}
+
+// restoreAssignees assigns and unassigns users to match the snapshot
+func (s *TodoService) restoreAssignees(current, to *models.Todo, userID int) error {
+	wanted := make(map[int]bool)
+	for _, a := range to.Assignees {
+		wanted[a.UserID] = true
+	}
+	var add []int
+	for id := range wanted {
+		found := false
+		for _, a := range current.Assignees {
+			found = found || a.UserID == id
+		}
+		if !found {
+			add = append(add, id)
+		}
+	}
+	if len(add) > 0 {
+		sort.Ints(add)
+		if _, err := s.Assign(to.ID, add, userID); err != nil {
+			return err
+		}
+	}
+	for _, a := range current.Assignees {
+		if wanted[a.UserID] {
+			continue
+		}
+		if err := s.Unassign(to.ID, a.UserID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recreate inserts a deleted todo again under its former ID, back in its
+// place in the manual order and on the board where possible
+func (s *TodoService) recreate(todo *models.Todo, userID int) (*models.Todo, error) {
+	var count int
+	if err := s.db().QueryRow("SELECT COUNT(*) FROM todos WHERE id = ?", todo.ID).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, conflictError("the todo exists again")
+	}
+	if todo.ListID != nil {
+		if _, err := s.lists.getWithRole(*todo.ListID, userID, models.RoleEditor); err != nil {
+			return nil, err
+		}
+	} else if todo.UserID != userID {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	archived := todo.ArchivedAt != nil
+	completed := todo.Completed
+	state, statePosition := todo.State, 0
+	if todo.ListID != nil && !archived {
+		workflow, err := loadWorkflow(tx, *todo.ListID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading workflow: %v", err)
+		}
+		target := findState(workflow, todo.State)
+		if target == nil {
+			if target, err = stateForNewTodo(workflow, todo); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkWIPLimit(tx, *todo.ListID, target, 0); err != nil {
+			return nil, err
+		}
+		count, err := countInState(tx, *todo.ListID, target.Name, 0)
+		if err != nil {
+			return nil, err
+		}
+		state, completed = target.Name, target.IsTerminal
+		statePosition = count + 1
+		if todo.StatePosition >= 1 && todo.StatePosition <= count {
+			if err := insertIntoColumn(tx, *todo.ListID, state, todo.StatePosition, todo.ID); err != nil {
+				return nil, err
+			}
+			statePosition = todo.StatePosition
+		}
+	}
+
+	var orderNo interface{}
+	nextOrderNo := 0
+	if !archived {
+		if nextOrderNo, err = s.getNextOrderNo(tx, todo.UserID); err != nil {
+			return nil, fmt.Errorf("error getting next order number: %v", err)
+		}
+		orderNo = nextOrderNo
+	}
+	var completedAt *time.Time
+	if completed {
+		now := time.Now().UTC()
+		completedAt = &now
+		if todo.CompletedAt != nil {
+			completedAt = todo.CompletedAt
+		}
+	}
+	var snoozedUntil *time.Time
+	if todo.SnoozedUntil != nil && todo.SnoozedUntil.After(time.Now()) {
+		snoozedUntil = todo.SnoozedUntil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO todos (id, user_id, org_id, list_id, title, description, completed, completed_at, priority, estimate, due_date,
+			order_no, state, state_position, recurrence, snoozed_until, snooze_to_top, archived_at, created_by, updated_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		todo.ID, todo.UserID, s.orgID, todo.ListID, todo.Title, todo.Description, completed, completedAt, todo.Priority,
+		todo.Estimate, todo.DueDate, orderNo, nullableString(state), statePosition, nullableString(todo.Recurrence),
+		snoozedUntil, snoozedUntil != nil && todo.SnoozeToTop, todo.ArchivedAt, todo.CreatedBy, userID, todo.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error recreating todo: %v", err)
+	}
+	if err := setTags(tx, todo.ID, todo.Tags); err != nil {
+		return nil, err
+	}
+	for _, a := range todo.Assignees {
+		role, err := todoRole(tx, todo, a.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if role == "" {
+			continue
+		}
+		_, err = tx.Exec(`
+			INSERT INTO todo_assignees (todo_id, user_id, assigned_by)
+			VALUES (?, ?, ?)`, todo.ID, a.UserID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("error assigning user: %v", err)
+		}
+		if err := recordAssignment(tx, todo.ID, a.UserID, models.AssignmentAssigned, &userID, ""); err != nil {
+			return nil, err
+		}
+	}
+	if !archived && todo.OrderNo >= 1 && todo.OrderNo < nextOrderNo {
+		if err := s.moveBlock(tx, todo.UserID, []int{todo.ID}, todo.OrderNo); err != nil {
+			return nil, err
+		}
+	}
+	created, err := loadTodo(tx, todo.ID)
+	if err != nil {
+		return nil, err
+	}
+	event := TodoEvent{Type: EventTodoCreated, Todo: created, ActorID: userID}
+	if err := s.stage(tx, event); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.emit(event)
+	return created, nil
+}
+
+func clampPosition(position, max int) int {
+	if position > max {
+		position = max
+	}
+	if position < 1 {
+		position = 1
+	}
+	return position
+}
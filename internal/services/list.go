@@ -0,0 +1,395 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// ListService manages the lists of one tenant: the personal workspace
+// (org 0) or an organization. Every query is filtered on the service's org,
+// so a list of another tenant can never be read through it.
+type ListService struct {
+	orgID int
+}
+
+func NewListService() *ListService {
+	return &ListService{}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *ListService) ForOrg(orgID int) *ListService {
+	return &ListService{orgID: orgID}
+}
+
+// todos returns a TodoService of the tenant, for the changes lists make to
+// their todos
+func (s *ListService) todos() *TodoService {
+	return NewTodoService().ForOrg(s.orgID)
+}
+
+// GetAll returns the lists the user can access in the service's tenant
+func (s *ListService) GetAll(userID int) ([]models.List, error) {
+	// Organization lists may be visible to every member, so all of them are
+	// candidates and the organization access decides; personal lists need
+	// ownership or membership.
+	access := &orgAccess{}
+	if s.orgID != 0 {
+		var err error
+		if access, err = loadOrgAccess(database.DB, s.orgID, userID); err != nil {
+			return nil, err
+		}
+		if access.Role == "" {
+			return []models.List{}, nil
+		}
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT l.id, l.user_id, l.org_id, l.name, l.created_at, l.updated_at, m.role
+		FROM lists l
+		LEFT JOIN list_members m ON m.list_id = l.id AND m.user_id = ?
+		WHERE l.org_id = ? AND (l.org_id <> 0 OR l.user_id = ? OR m.user_id IS NOT NULL)
+		ORDER BY l.id ASC`, userID, s.orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []models.List{}
+	for rows.Next() {
+		var list models.List
+		var memberRole sql.NullString
+		if err := rows.Scan(&list.ID, &list.UserID, &list.OrgID, &list.Name, &list.CreatedAt, &list.UpdatedAt, &memberRole); err != nil {
+			return nil, err
+		}
+		list.Role = memberRole.String
+		if list.UserID == userID {
+			list.Role = models.RoleOwner
+		}
+		if s.orgID != 0 {
+			list.Role = orgListRole(list.Role, access)
+		}
+		if list.Role == "" {
+			continue
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+// accessibleListIDs returns the IDs of the lists the user can access
+func (s *ListService) accessibleListIDs(userID int) ([]int, error) {
+	lists, err := s.GetAll(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(lists))
+	for i, list := range lists {
+		ids[i] = list.ID
+	}
+	return ids, nil
+}
+
+// GetByID returns a list the user owns or is a member of
+func (s *ListService) GetByID(id, userID int) (*models.List, error) {
+	return s.getWithRole(id, userID, models.RoleViewer)
+}
+
+// getWithRole returns the list when the user holds at least the required role.
+// Users without any access get "list not found" so list IDs are not leaked.
+func (s *ListService) getWithRole(id, userID int, required string) (*models.List, error) {
+	var list models.List
+	err := database.DB.QueryRow(`
+		SELECT id, user_id, org_id, name, created_at, updated_at
+		FROM lists
+		WHERE id = ? AND org_id = ?`, id, s.orgID).
+		Scan(&list.ID, &list.UserID, &list.OrgID, &list.Name, &list.CreatedAt, &list.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("list not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := listRole(database.DB, &list, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, fmt.Errorf("list not found")
+	}
+	if !models.HasRole(role, required) {
+		return nil, fmt.Errorf("access denied")
+	}
+	list.Role = role
+	return &list, nil
+}
+
+// Create creates a list with the default workflow
+func (s *ListService) Create(list *models.List, userID int) (*models.List, error) {
+	list.Name = strings.TrimSpace(list.Name)
+	if list.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	if err := s.checkCanCreate(userID); err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO lists (user_id, org_id, name) VALUES (?, ?, ?)", userID, s.orgID, list.Name)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+
+	if err := saveWorkflow(tx, int(id), &models.DefaultWorkflow); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetByID(int(id), userID)
+}
+
+// checkCanCreate checks that the user may create lists in the tenant. In an
+// organization, members may only do so when its settings allow it.
+func (s *ListService) checkCanCreate(userID int) error {
+	if s.orgID == 0 {
+		return nil
+	}
+	access, err := loadOrgAccess(database.DB, s.orgID, userID)
+	if err != nil {
+		return err
+	}
+	if access.Role == "" {
+		return fmt.Errorf("organization not found")
+	}
+	if !access.Settings.MembersCanCreateLists && !models.HasOrgRole(access.Role, models.OrgRoleAdmin) {
+		return fmt.Errorf("access denied")
+	}
+	return nil
+}
+
+func (s *ListService) Update(id int, list *models.List, userID int) (*models.List, error) {
+	list.Name = strings.TrimSpace(list.Name)
+	if list.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	if _, err := s.getWithRole(id, userID, models.RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	_, err := database.DB.Exec("UPDATE lists SET name = ? WHERE id = ? AND org_id = ?", list.Name, id, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id, userID)
+}
+
+// Delete removes a list. Its todos are kept and moved out of the list, and
+// unassigned from the members who could only see them through it. Only the
+// owner can delete a list.
+func (s *ListService) Delete(id, userID int) error {
+	if _, err := s.getWithRole(id, userID, models.RoleOwner); err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// The detached todos stay visible to their owners only: their other
+	// assignees are unassigned below
+	detached, err := loadTodos(tx, "list_id = ? AND org_id = ? ORDER BY id FOR UPDATE", id, s.orgID)
+	if err != nil {
+		return fmt.Errorf("error detaching todos: %v", err)
+	}
+	todoIDs := make([]interface{}, len(detached))
+	for i, todo := range detached {
+		todoIDs[i] = todo.ID
+	}
+
+	_, err = tx.Exec(`
+		UPDATE todos
+		SET list_id = NULL, state = NULL, state_position = 0, sprint_id = NULL
+		WHERE list_id = ? AND org_id = ?`, id, s.orgID)
+	if err != nil {
+		return fmt.Errorf("error detaching todos: %v", err)
+	}
+
+	result, err := tx.Exec("DELETE FROM lists WHERE id = ? AND user_id = ? AND org_id = ?", id, userID, s.orgID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("list not found")
+	}
+	var unassigned []TodoEvent
+	if len(todoIDs) > 0 {
+		if unassigned, err = unassignWithoutAccess(tx, "a.todo_id IN ("+inPlaceholders(len(todoIDs))+")", todoIDs...); err != nil {
+			return err
+		}
+	}
+
+	todos := s.todos()
+	var events []TodoEvent
+	for _, before := range detached {
+		after, err := loadTodo(tx, before.ID)
+		if err != nil {
+			return err
+		}
+		events = append(events, changeEvents(&before, after, userID)...)
+	}
+	events = append(events, unassigned...)
+	if err := todos.stage(tx, events...); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	todos.emit(events...)
+	return nil
+}
+
+func (s *ListService) GetWorkflow(id, userID int) (*models.Workflow, error) {
+	if _, err := s.GetByID(id, userID); err != nil {
+		return nil, err
+	}
+	return loadWorkflow(database.DB, id)
+}
+
+// SetWorkflow replaces the states and transitions of a list. States that still
+// contain todos cannot be removed.
+func (s *ListService) SetWorkflow(id int, workflow *models.Workflow, userID int) (*models.Workflow, error) {
+	if _, err := s.getWithRole(id, userID, models.RoleAdmin); err != nil {
+		return nil, err
+	}
+	if err := validateWorkflow(workflow); err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT DISTINCT state
+		FROM todos
+		WHERE list_id = ? AND state IS NOT NULL`, id)
+	if err != nil {
+		return nil, err
+	}
+	var usedStates []string
+	for rows.Next() {
+		var state string
+		if err := rows.Scan(&state); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		usedStates = append(usedStates, state)
+	}
+	rows.Close()
+
+	for _, state := range usedStates {
+		if findState(workflow, state) == nil {
+			return nil, fmt.Errorf("state %s still has todos and cannot be removed", state)
+		}
+	}
+
+	if err := saveWorkflow(tx, id, workflow); err != nil {
+		return nil, err
+	}
+
+	// Keep completed in sync when a state changes between open and terminal
+	todos := s.todos()
+	var events []TodoEvent
+	for _, state := range workflow.States {
+		changed, err := todos.syncStateCompletion(tx, id, state, userID)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, changed...)
+	}
+	if err := todos.stage(tx, events...); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	todos.emit(events...)
+	return loadWorkflow(database.DB, id)
+}
+
+// GetBoard returns the todos of a list grouped by workflow state, in column order
+func (s *ListService) GetBoard(id, userID int) (*models.Board, error) {
+	list, err := s.GetByID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	workflow, err := loadWorkflow(database.DB, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT `+todoColumns+`
+		FROM todos
+		WHERE list_id = ? AND org_id = ? AND archived_at IS NULL
+		ORDER BY state_position ASC, order_no ASC`, id, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []models.Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, *todo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := attachDetails(database.DB, todos); err != nil {
+		return nil, err
+	}
+
+	byState := make(map[string][]models.Todo)
+	for _, todo := range todos {
+		byState[todo.State] = append(byState[todo.State], todo)
+	}
+
+	board := &models.Board{List: *list, Columns: []models.BoardColumn{}}
+	for _, state := range workflow.States {
+		todos := byState[state.Name]
+		if todos == nil {
+			todos = []models.Todo{}
+		}
+		board.Columns = append(board.Columns, models.BoardColumn{
+			State: state,
+			Count: len(todos),
+			Todos: todos,
+		})
+	}
+	return board, nil
+}
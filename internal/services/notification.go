@@ -0,0 +1,605 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// Notification pages default to DefaultNotificationPageSize notifications
+const (
+	DefaultNotificationPageSize = 20
+	MaxNotificationPageSize     = 100
+)
+
+// maxExcerptLength is how much of a comment body notifications quote, in runes
+const maxExcerptLength = 140
+
+// NotificationKinds are the kinds of notifications, in the order preferences
+// list them. Users are notified of every kind unless they turn it off.
+var NotificationKinds = []string{
+	EventTodoUpdated,
+	EventTodoCompleted,
+	EventTodoDeleted,
+	EventTodoStateChanged,
+	EventTodoAssigned,
+	EventTodoUnassigned,
+	EventTodoTagged,
+	models.NotificationCommented,
+	models.NotificationMentioned,
+}
+
+// NotificationService manages the watchers of todos and the notification
+// inboxes of a tenant. Notification preferences are shared by all tenants.
+type NotificationService struct {
+	todos *TodoService
+}
+
+func NewNotificationService() *NotificationService {
+	return &NotificationService{
+		todos: NewTodoService(),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *NotificationService) ForOrg(orgID int) *NotificationService {
+	return &NotificationService{todos: s.todos.ForOrg(orgID)}
+}
+
+// Watch makes the user follow a todo they can see. Watching a todo twice is
+// not an error.
+func (s *NotificationService) Watch(todoID, userID int) ([]models.Watcher, error) {
+	if _, err := s.todos.authorize(todoID, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	if err := addWatchers(todoID, userID); err != nil {
+		return nil, err
+	}
+	return getWatchers(todoID)
+}
+
+// Unwatch stops the user following a todo. Like Watch, it is idempotent.
+func (s *NotificationService) Unwatch(todoID, userID int) error {
+	if _, err := s.todos.authorize(todoID, userID, models.RoleViewer); err != nil {
+		return err
+	}
+	_, err := database.DB.Exec("DELETE FROM todo_watchers WHERE todo_id = ? AND user_id = ?", todoID, userID)
+	return err
+}
+
+// GetWatchers returns the users following a todo, earliest first
+func (s *NotificationService) GetWatchers(todoID, userID int) ([]models.Watcher, error) {
+	if _, err := s.todos.authorize(todoID, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	return getWatchers(todoID)
+}
+
+// GetNotifications returns a page of the user's inbox in the service's
+// tenant, most recent first, optionally only the unread notifications
+func (s *NotificationService) GetNotifications(userID int, unreadOnly bool, page, pageSize int) (*models.NotificationPage, error) {
+	if page < 1 {
+		return nil, fmt.Errorf("invalid page: must be at least 1")
+	}
+	if pageSize < 1 || pageSize > MaxNotificationPageSize {
+		return nil, fmt.Errorf("invalid page_size: must be between 1 and %d", MaxNotificationPageSize)
+	}
+
+	result := &models.NotificationPage{Notifications: []models.Notification{}, Page: page, PageSize: pageSize}
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*), COUNT(CASE WHEN read_at IS NULL THEN 1 END)
+		FROM notifications
+		WHERE user_id = ? AND org_id = ?`, userID, s.todos.orgID).Scan(&result.Total, &result.Unread)
+	if err != nil {
+		return nil, err
+	}
+	where := "n.user_id = ? AND n.org_id = ?"
+	if unreadOnly {
+		where += " AND n.read_at IS NULL"
+		result.Total = result.Unread
+	}
+
+	notifications, err := queryNotifications(`
+		WHERE `+where+`
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT ? OFFSET ?`, userID, s.todos.orgID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	result.Notifications = notifications
+	return result, nil
+}
+
+// MarkRead marks one of the user's notifications read or unread
+func (s *NotificationService) MarkRead(id, userID int, req *models.ReadRequest) (*models.Notification, error) {
+	var readAt interface{}
+	if req.Read {
+		readAt = time.Now().UTC()
+	}
+	// Marking a read notification read again keeps the time it was first read
+	result, err := database.DB.Exec(`
+		UPDATE notifications
+		SET read_at = CASE WHEN ? IS NULL THEN NULL ELSE COALESCE(read_at, ?) END
+		WHERE id = ? AND user_id = ? AND org_id = ?`,
+		readAt, readAt, id, userID, s.todos.orgID)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		if err := s.checkOwned(id, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	notifications, err := queryNotifications("WHERE n.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(notifications) == 0 {
+		return nil, fmt.Errorf("notification not found")
+	}
+	return &notifications[0], nil
+}
+
+// checkOwned tells apart a notification that was left unchanged from one the
+// user does not have
+func (s *NotificationService) checkOwned(id, userID int) error {
+	var exists bool
+	err := database.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM notifications WHERE id = ? AND user_id = ? AND org_id = ?)`,
+		id, userID, s.todos.orgID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("notification not found")
+	}
+	return nil
+}
+
+// MarkAllRead marks every unread notification of the user's inbox read and
+// returns how many there were
+func (s *NotificationService) MarkAllRead(userID int) (int, error) {
+	result, err := database.DB.Exec(`
+		UPDATE notifications
+		SET read_at = ?
+		WHERE user_id = ? AND org_id = ? AND read_at IS NULL`,
+		time.Now().UTC(), userID, s.todos.orgID)
+	if err != nil {
+		return 0, err
+	}
+	marked, _ := result.RowsAffected()
+	return int(marked), nil
+}
+
+// GetPreferences returns which kinds of notifications the user receives
+func (s *NotificationService) GetPreferences(userID int) (*models.NotificationPreferences, error) {
+	disabled, err := disabledKinds([]int{userID})
+	if err != nil {
+		return nil, err
+	}
+	prefs := &models.NotificationPreferences{Kinds: make(map[string]bool, len(NotificationKinds))}
+	for _, kind := range NotificationKinds {
+		prefs.Kinds[kind] = !disabled[userID][kind]
+	}
+	return prefs, nil
+}
+
+// UpdatePreferences turns kinds of notifications on or off for the user
+func (s *NotificationService) UpdatePreferences(userID int, prefs *models.NotificationPreferences) (*models.NotificationPreferences, error) {
+	for kind := range prefs.Kinds {
+		if !containsString(NotificationKinds, kind) {
+			return nil, fmt.Errorf("invalid notification kind: %s", kind)
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for kind, enabled := range prefs.Kinds {
+		_, err := tx.Exec(`
+			INSERT INTO notification_preferences (user_id, kind, enabled)
+			VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE enabled = VALUES(enabled)`, userID, kind, enabled)
+		if err != nil {
+			return nil, fmt.Errorf("error saving notification preferences: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetPreferences(userID)
+}
+
+// notifyTodoEvent notifies the watchers of a todo of an event, except the
+// user who made the change. Assigned users start watching the todo.
+func notifyTodoEvent(event *OutboxEvent) error {
+	if event.Todo == nil || !containsString(NotificationKinds, event.Type) {
+		return nil
+	}
+	if gone, err := orgDeleted(event.OrgID); gone || err != nil {
+		return err
+	}
+	todo := event.Todo
+	if event.Type == EventTodoAssigned {
+		if err := addWatchers(todo.ID, event.UserIDs...); err != nil {
+			return err
+		}
+	}
+	recipients, err := watcherIDs(todo.ID)
+	if err != nil {
+		return err
+	}
+	// Unassigned users hear about it even when they no longer watch the todo
+	if event.Type == EventTodoUnassigned {
+		for _, id := range event.UserIDs {
+			if !containsInt(recipients, id) {
+				recipients = append(recipients, id)
+			}
+		}
+	}
+
+	details := models.ActivityDetails{Fields: event.Fields, Tags: event.Tags}
+	switch event.Type {
+	case EventTodoStateChanged:
+		details.State = todo.State
+	case EventTodoAssigned, EventTodoUnassigned:
+		if details.Users, err = usernames(event.UserIDs); err != nil {
+			return err
+		}
+	}
+
+	// The notifications are added at once, so an event handled again after a
+	// failure notifies nobody twice
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	notified, err := addNotifications(tx, event.OrgID, recipients, event.Type, event.ActorID, todo, nil, details, event.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if event.Type == EventTodoDeleted {
+		if _, err := tx.Exec("DELETE FROM todo_watchers WHERE todo_id = ?", todo.ID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Assigned users are also told on their devices
+	if event.Type == EventTodoAssigned {
+		for _, id := range event.UserIDs {
+			if containsInt(notified, id) {
+				pushAssignment(id, todo, event.ActorID)
+			}
+		}
+	}
+	return nil
+}
+
+// notifyComment notifies the users mentioned in a comment, and the other
+// watchers of the todo, of a new comment. The author starts watching the
+// todo. Failures are only logged.
+func notifyComment(orgID int, todo *models.Todo, comment *models.Comment) {
+	if err := addWatchers(todo.ID, comment.UserID); err != nil {
+		log.Printf("Error notifying watchers of todo %d: %v", todo.ID, err)
+		return
+	}
+	watchers, err := watcherIDs(todo.ID)
+	if err != nil {
+		log.Printf("Error notifying watchers of todo %d: %v", todo.ID, err)
+		return
+	}
+
+	var mentioned []int
+	for _, mention := range comment.Mentions {
+		mentioned = append(mentioned, mention.UserID)
+	}
+	var others []int
+	for _, id := range watchers {
+		if !containsInt(mentioned, id) {
+			others = append(others, id)
+		}
+	}
+
+	details := models.ActivityDetails{Excerpt: excerpt(comment.Body)}
+	if _, err := notify(orgID, mentioned, models.NotificationMentioned, comment.UserID, todo, &comment.ID, details, time.Now().UTC()); err != nil {
+		log.Printf("Error notifying mentions of comment %d: %v", comment.ID, err)
+	}
+	if _, err := notify(orgID, others, models.NotificationCommented, comment.UserID, todo, &comment.ID, details, time.Now().UTC()); err != nil {
+		log.Printf("Error notifying watchers of todo %d: %v", todo.ID, err)
+	}
+}
+
+// notifyMentions notifies the users newly mentioned by an edit of a comment
+func notifyMentions(orgID int, todo *models.Todo, before, after *models.Comment) {
+	var mentioned []int
+	for _, mention := range after.Mentions {
+		already := false
+		for _, previous := range before.Mentions {
+			already = already || previous.UserID == mention.UserID
+		}
+		if !already {
+			mentioned = append(mentioned, mention.UserID)
+		}
+	}
+	details := models.ActivityDetails{Excerpt: excerpt(after.Body)}
+	if _, err := notify(orgID, mentioned, models.NotificationMentioned, after.UserID, todo, &after.ID, details, time.Now().UTC()); err != nil {
+		log.Printf("Error notifying mentions of comment %d: %v", after.ID, err)
+	}
+}
+
+// notify adds a notification, of something that happened at the given time,
+// to the inbox of each recipient other than the actor who still has access to
+// the todo and has not turned the kind off, in one transaction. It returns
+// the users notified.
+func notify(orgID int, recipients []int, kind string, actorID int, todo *models.Todo, commentID *int, details models.ActivityDetails, at time.Time) ([]int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	notified, err := addNotifications(tx, orgID, recipients, kind, actorID, todo, commentID, details, at)
+	if err != nil {
+		return nil, err
+	}
+	return notified, tx.Commit()
+}
+
+// addNotifications is notify within a transaction
+func addNotifications(tx sqlExecutor, orgID int, recipients []int, kind string, actorID int, todo *models.Todo, commentID *int, details models.ActivityDetails, at time.Time) ([]int, error) {
+	var candidates []int
+	for _, id := range recipients {
+		if id != actorID {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	disabled, err := disabledKinds(candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	var notified []int
+	for _, userID := range candidates {
+		if disabled[userID][kind] {
+			continue
+		}
+		role, err := todoRole(tx, todo, userID)
+		if err != nil {
+			return nil, err
+		}
+		if role == "" {
+			continue
+		}
+		if err := addNotification(tx, orgID, userID, kind, actorID, todo, commentID, details, at); err != nil {
+			return nil, err
+		}
+		notified = append(notified, userID)
+	}
+	return notified, nil
+}
+
+// addNotification inserts a notification or, for an edit, merges it into the
+// user's unread notification of an earlier edit of the todo by the same actor
+func addNotification(tx sqlExecutor, orgID, userID int, kind string, actorID int, todo *models.Todo, commentID *int, details models.ActivityDetails, at time.Time) error {
+	var actor interface{}
+	if actorID != 0 {
+		actor = actorID
+	}
+
+	if kind == EventTodoUpdated {
+		var id int
+		var unread string
+		err := tx.QueryRow(`
+			SELECT id, details
+			FROM notifications
+			WHERE user_id = ? AND org_id = ? AND todo_id = ? AND kind = ? AND COALESCE(actor_id, 0) = ?
+				AND read_at IS NULL
+			ORDER BY id DESC
+			LIMIT 1
+			FOR UPDATE`, userID, orgID, todo.ID, kind, actorID).Scan(&id, &unread)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			var merged models.ActivityDetails
+			if err := json.Unmarshal([]byte(unread), &merged); err != nil {
+				return err
+			}
+			for _, field := range details.Fields {
+				if !containsString(merged.Fields, field) {
+					merged.Fields = append(merged.Fields, field)
+				}
+			}
+			raw, err := json.Marshal(merged)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`
+				UPDATE notifications
+				SET count = count + 1, details = ?, todo_title = ?, updated_at = ?
+				WHERE id = ?`, string(raw), todo.Title, at, id)
+			return err
+		}
+	}
+
+	raw, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO notifications (user_id, org_id, kind, actor_id, todo_id, todo_title, comment_id, details, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, orgID, kind, actor, todo.ID, todo.Title, commentID, string(raw), at, at)
+	return err
+}
+
+// disabledKinds returns, for each of the users, the notification kinds they
+// turned off
+func disabledKinds(userIDs []int) (map[int]map[string]bool, error) {
+	args := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	rows, err := database.DB.Query(`
+		SELECT user_id, kind
+		FROM notification_preferences
+		WHERE enabled = FALSE AND user_id IN (`+inPlaceholders(len(userIDs))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	disabled := make(map[int]map[string]bool)
+	for rows.Next() {
+		var userID int
+		var kind string
+		if err := rows.Scan(&userID, &kind); err != nil {
+			return nil, err
+		}
+		if disabled[userID] == nil {
+			disabled[userID] = make(map[string]bool)
+		}
+		disabled[userID][kind] = true
+	}
+	return disabled, rows.Err()
+}
+
+// addWatchers makes users follow a todo, ignoring those already following it
+func addWatchers(todoID int, userIDs ...int) error {
+	for _, userID := range userIDs {
+		_, err := database.DB.Exec(`
+			INSERT INTO todo_watchers (todo_id, user_id)
+			VALUES (?, ?)
+			ON DUPLICATE KEY UPDATE todo_id = todo_id`, todoID, userID)
+		if err != nil {
+			return fmt.Errorf("error adding watcher: %v", err)
+		}
+	}
+	return nil
+}
+
+func getWatchers(todoID int) ([]models.Watcher, error) {
+	rows, err := database.DB.Query(`
+		SELECT w.user_id, u.username, w.created_at
+		FROM todo_watchers w
+		JOIN users u ON u.id = w.user_id
+		WHERE w.todo_id = ?
+		ORDER BY w.created_at ASC, w.user_id ASC`, todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watchers := []models.Watcher{}
+	for rows.Next() {
+		var watcher models.Watcher
+		if err := rows.Scan(&watcher.UserID, &watcher.Username, &watcher.CreatedAt); err != nil {
+			return nil, err
+		}
+		watchers = append(watchers, watcher)
+	}
+	return watchers, rows.Err()
+}
+
+func watcherIDs(todoID int) ([]int, error) {
+	rows, err := database.DB.Query("SELECT user_id FROM todo_watchers WHERE todo_id = ? ORDER BY user_id ASC", todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func queryNotifications(conditions string, args ...interface{}) ([]models.Notification, error) {
+	rows, err := database.DB.Query(`
+		SELECT n.id, n.org_id, n.kind, n.actor_id, u.username, n.todo_id, n.todo_title, n.comment_id, n.details, n.count,
+			n.read_at, n.created_at, n.updated_at
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.actor_id
+		`+conditions, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var actorID, commentID sql.NullInt64
+		var actorName sql.NullString
+		var readAt sql.NullTime
+		var details string
+		err := rows.Scan(&n.ID, &n.OrgID, &n.Kind, &actorID, &actorName, &n.TodoID, &n.TodoTitle, &commentID, &details,
+			&n.Count, &readAt, &n.CreatedAt, &n.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			n.ActorID = &id
+		}
+		if commentID.Valid {
+			id := int(commentID.Int64)
+			n.CommentID = &id
+		}
+		if readAt.Valid {
+			n.Read = true
+			n.ReadAt = &readAt.Time
+		}
+		n.ActorName = actorName.String
+		if err := json.Unmarshal([]byte(details), &n.Details); err != nil {
+			return nil, fmt.Errorf("error reading notification %d: %v", n.ID, err)
+		}
+		n.Summary = summarize(&models.Activity{
+			Verb: n.Kind, ActorID: n.ActorID, ActorName: n.ActorName, TodoTitle: n.TodoTitle,
+			Details: n.Details, Count: n.Count,
+		})
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// excerpt shortens a comment body for notifications
+func excerpt(body string) string {
+	if utf8.RuneCountInString(body) <= maxExcerptLength {
+		return body
+	}
+	runes := []rune(body)
+	return string(runes[:maxExcerptLength-1]) + "…"
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
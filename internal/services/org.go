@@ -0,0 +1,530 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+type OrgService struct{}
+
+func NewOrgService() *OrgService {
+	return &OrgService{}
+}
+
+var slugRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,63}$`)
+var slugInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// GetAll returns the organizations the user belongs to
+func (s *OrgService) GetAll(userID int) ([]models.OrgMembership, error) {
+	return userOrganizations(userID)
+}
+
+// userOrganizations is shared with AuthService, which reports a user's
+// organizations on login
+func userOrganizations(userID int) ([]models.OrgMembership, error) {
+	rows, err := database.DB.Query(`
+		SELECT o.id, o.name, o.slug, m.role, m.created_at
+		FROM org_members m
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = ?
+		ORDER BY o.name ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []models.OrgMembership{}
+	for rows.Next() {
+		var membership models.OrgMembership
+		if err := rows.Scan(&membership.OrgID, &membership.Name, &membership.Slug, &membership.Role, &membership.JoinedAt); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, membership)
+	}
+	return memberships, rows.Err()
+}
+
+// GetMembership resolves an organization by ID or slug and returns the user's
+// membership. Non-members get "organization not found".
+func (s *OrgService) GetMembership(ref string, userID int) (*models.OrgMembership, error) {
+	column := "o.slug"
+	var arg interface{} = ref
+	if id, err := strconv.Atoi(ref); err == nil {
+		column = "o.id"
+		arg = id
+	}
+
+	var membership models.OrgMembership
+	err := database.DB.QueryRow(`
+		SELECT o.id, o.name, o.slug, m.role, m.created_at
+		FROM organizations o
+		JOIN org_members m ON m.org_id = o.id AND m.user_id = ?
+		WHERE `+column+` = ?`, userID, arg).
+		Scan(&membership.OrgID, &membership.Name, &membership.Slug, &membership.Role, &membership.JoinedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("organization not found")
+	}
+	return &membership, err
+}
+
+// Create creates an organization with the user as its owner
+func (s *OrgService) Create(org *models.Organization, userID int) (*models.Organization, error) {
+	org.Name = strings.TrimSpace(org.Name)
+	if org.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if org.Slug == "" {
+		org.Slug = strings.Trim(slugInvalidChars.ReplaceAllString(strings.ToLower(org.Name), "-"), "-")
+	}
+	if !slugRegex.MatchString(org.Slug) {
+		return nil, fmt.Errorf("invalid slug: use 2-64 lowercase letters, digits or dashes")
+	}
+
+	var count int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM organizations WHERE slug = ?", org.Slug).Scan(&count); err != nil {
+		return nil, fmt.Errorf("error checking slug: %v", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("organization with this slug already exists")
+	}
+
+	settings, err := json.Marshal(models.DefaultOrgSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO organizations (name, slug, settings, created_by)
+		VALUES (?, ?, ?, ?)`, org.Name, org.Slug, string(settings), userID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating organization: %v", err)
+	}
+	id, _ := result.LastInsertId()
+
+	_, err = tx.Exec("INSERT INTO org_members (org_id, user_id, role) VALUES (?, ?, ?)", id, userID, models.OrgRoleOwner)
+	if err != nil {
+		return nil, fmt.Errorf("error adding owner: %v", err)
+	}
+
+	// The first organization becomes the user's default
+	_, err = tx.Exec("UPDATE users SET default_org_id = ? WHERE id = ? AND default_org_id IS NULL", id, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error updating default organization: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetByID(int(id), userID)
+}
+
+func (s *OrgService) GetByID(orgID, userID int) (*models.Organization, error) {
+	access, err := s.requireRole(orgID, userID, models.OrgRoleMember)
+	if err != nil {
+		return nil, err
+	}
+
+	var org models.Organization
+	err = database.DB.QueryRow(`
+		SELECT id, name, slug, created_by, created_at, updated_at
+		FROM organizations
+		WHERE id = ?`, orgID).
+		Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedBy, &org.CreatedAt, &org.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("organization not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	org.Settings = access.Settings
+	org.Role = access.Role
+	return &org, nil
+}
+
+func (s *OrgService) Update(orgID int, org *models.Organization, userID int) (*models.Organization, error) {
+	org.Name = strings.TrimSpace(org.Name)
+	if org.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if _, err := s.requireRole(orgID, userID, models.OrgRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	if _, err := database.DB.Exec("UPDATE organizations SET name = ? WHERE id = ?", org.Name, orgID); err != nil {
+		return nil, err
+	}
+	return s.GetByID(orgID, userID)
+}
+
+// Delete removes an organization with all of its lists and todos, and
+// everything else kept in it: webhooks, rules, templates, smart lists,
+// archive policies, time entries with their running timers, activity,
+// notifications and the undo history
+func (s *OrgService) Delete(orgID, userID int) error {
+	if _, err := s.requireRole(orgID, userID, models.OrgRoleOwner); err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	deleted, err := loadTodos(tx, "org_id = ? ORDER BY id FOR UPDATE", orgID)
+	if err != nil {
+		return err
+	}
+	// Watchers have no foreign key on their todo
+	_, err = tx.Exec("DELETE FROM todo_watchers WHERE todo_id IN (SELECT id FROM todos WHERE org_id = ?)", orgID)
+	if err != nil {
+		return fmt.Errorf("error deleting watchers: %v", err)
+	}
+	for _, table := range orgTables {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE org_id = ?", orgID); err != nil {
+			return fmt.Errorf("error deleting %s: %v", table, err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM todos WHERE org_id = ?", orgID); err != nil {
+		return fmt.Errorf("error deleting todos: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM lists WHERE org_id = ?", orgID); err != nil {
+		return fmt.Errorf("error deleting lists: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE users SET default_org_id = NULL WHERE default_org_id = ?", orgID); err != nil {
+		return fmt.Errorf("error updating default organizations: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM organizations WHERE id = ?", orgID); err != nil {
+		return fmt.Errorf("error deleting organization: %v", err)
+	}
+
+	todos := NewTodoService().ForOrg(orgID)
+	events := make([]TodoEvent, len(deleted))
+	for i := range deleted {
+		events[i] = TodoEvent{Type: EventTodoDeleted, Todo: &deleted[i], ActorID: userID}
+	}
+	if err := todos.stage(tx, events...); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	todos.emit(events...)
+	return nil
+}
+
+// orgTables are the tables with rows of an organization besides todos and
+// lists. The rows referencing theirs, such as webhook deliveries and rule
+// executions, are deleted by their foreign keys.
+var orgTables = []string{
+	"webhooks", "todo_rules", "todo_templates", "smart_lists", "archive_policies",
+	"time_entries", "activities", "notifications", "todo_operations",
+}
+
+func (s *OrgService) GetSettings(orgID, userID int) (*models.OrgSettings, error) {
+	access, err := s.requireRole(orgID, userID, models.OrgRoleMember)
+	if err != nil {
+		return nil, err
+	}
+	return &access.Settings, nil
+}
+
+func (s *OrgService) UpdateSettings(orgID int, settings *models.OrgSettings, userID int) (*models.OrgSettings, error) {
+	if _, err := s.requireRole(orgID, userID, models.OrgRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	if settings.Timezone == "" {
+		settings.Timezone = models.DefaultOrgSettings.Timezone
+	}
+	if _, err := time.LoadLocation(settings.Timezone); err != nil {
+		return nil, fmt.Errorf("invalid timezone: %s", settings.Timezone)
+	}
+	if settings.DefaultListRole != "" && !models.IsValidMemberRole(settings.DefaultListRole) {
+		return nil, fmt.Errorf("invalid default list role: must be empty or one of viewer, editor, admin")
+	}
+
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE organizations SET settings = ? WHERE id = ?", string(raw), orgID); err != nil {
+		return nil, err
+	}
+	// A narrower default list role can take members' access to todos away
+	events, err := unassignWithoutAccess(tx, "t.org_id = ?", orgID)
+	if err != nil {
+		return nil, err
+	}
+	if err := commitUnassigned(tx, orgID, events); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (s *OrgService) GetMembers(orgID, userID int) ([]models.OrgMember, error) {
+	if _, err := s.requireRole(orgID, userID, models.OrgRoleMember); err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT m.org_id, m.user_id, u.username, u.email, m.role, m.created_at
+		FROM org_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = ?
+		ORDER BY m.created_at ASC`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.OrgMember{}
+	for rows.Next() {
+		var member models.OrgMember
+		if err := rows.Scan(&member.OrgID, &member.UserID, &member.Username, &member.Email, &member.Role, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// AddMember adds a registered user to the organization. Only owners can add owners.
+func (s *OrgService) AddMember(orgID int, req *models.AddOrgMemberRequest, userID int) (*models.OrgMember, error) {
+	access, err := s.requireRole(orgID, userID, models.OrgRoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if req.Role == "" {
+		req.Role = models.OrgRoleMember
+	}
+	if !models.IsValidOrgRole(req.Role) {
+		return nil, fmt.Errorf("invalid role: must be one of owner, admin, member")
+	}
+	if req.Role == models.OrgRoleOwner && access.Role != models.OrgRoleOwner {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	var member models.OrgMember
+	username, email := strings.TrimSpace(req.Username), strings.TrimSpace(req.Email)
+	switch {
+	case username != "":
+		err = database.DB.QueryRow("SELECT id, username, email FROM users WHERE username = ?", username).
+			Scan(&member.UserID, &member.Username, &member.Email)
+	case email != "":
+		err = database.DB.QueryRow("SELECT id, username, email FROM users WHERE email = ?", email).
+			Scan(&member.UserID, &member.Username, &member.Email)
+	default:
+		return nil, fmt.Errorf("username or email is required")
+	}
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding user: %v", err)
+	}
+
+	if role, err := s.memberRole(orgID, member.UserID); err != nil {
+		return nil, err
+	} else if role != "" {
+		return nil, fmt.Errorf("user is already a member of this organization")
+	}
+
+	_, err = database.DB.Exec("INSERT INTO org_members (org_id, user_id, role) VALUES (?, ?, ?)", orgID, member.UserID, req.Role)
+	if err != nil {
+		return nil, fmt.Errorf("error adding member: %v", err)
+	}
+	if _, err := database.DB.Exec("UPDATE users SET default_org_id = ? WHERE id = ? AND default_org_id IS NULL", orgID, member.UserID); err != nil {
+		return nil, fmt.Errorf("error updating default organization: %v", err)
+	}
+
+	member.OrgID = orgID
+	member.Role = req.Role
+	member.JoinedAt = time.Now()
+	return &member, nil
+}
+
+// UpdateMemberRole changes a member's role, unassigning them from the todos
+// they can no longer see. Granting or revoking ownership requires an owner,
+// and the last owner cannot be demoted.
+func (s *OrgService) UpdateMemberRole(orgID, memberID int, role string, userID int) error {
+	access, err := s.requireRole(orgID, userID, models.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+	if !models.IsValidOrgRole(role) {
+		return fmt.Errorf("invalid role: must be one of owner, admin, member")
+	}
+
+	current, err := s.memberRole(orgID, memberID)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		return fmt.Errorf("member not found")
+	}
+	if (role == models.OrgRoleOwner || current == models.OrgRoleOwner) && access.Role != models.OrgRoleOwner {
+		return fmt.Errorf("access denied")
+	}
+	if current == models.OrgRoleOwner && role != models.OrgRoleOwner {
+		if err := s.checkNotLastOwner(orgID); err != nil {
+			return err
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE org_members SET role = ? WHERE org_id = ? AND user_id = ?", role, orgID, memberID); err != nil {
+		return err
+	}
+	// Demoted admins lose the access to lists their role gave them
+	events, err := unassignWithoutAccess(tx, "t.org_id = ? AND a.user_id = ?", orgID, memberID)
+	if err != nil {
+		return err
+	}
+	return commitUnassigned(tx, orgID, events)
+}
+
+// RemoveMember removes a user from the organization, revoking their access to
+// every organization list immediately. Members can remove themselves to leave.
+func (s *OrgService) RemoveMember(orgID, memberID, userID int) error {
+	required := models.OrgRoleAdmin
+	if memberID == userID {
+		required = models.OrgRoleMember
+	}
+	access, err := s.requireRole(orgID, userID, required)
+	if err != nil {
+		return err
+	}
+
+	current, err := s.memberRole(orgID, memberID)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		return fmt.Errorf("member not found")
+	}
+	if current == models.OrgRoleOwner {
+		if memberID != userID && access.Role != models.OrgRoleOwner {
+			return fmt.Errorf("access denied")
+		}
+		if err := s.checkNotLastOwner(orgID); err != nil {
+			return err
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM org_members WHERE org_id = ? AND user_id = ?", orgID, memberID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM list_members
+		WHERE user_id = ? AND list_id IN (SELECT id FROM lists WHERE org_id = ?)`, memberID, orgID)
+	if err != nil {
+		return fmt.Errorf("error removing list memberships: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE users SET default_org_id = NULL WHERE id = ? AND default_org_id = ?", memberID, orgID); err != nil {
+		return fmt.Errorf("error updating default organization: %v", err)
+	}
+	events, err := unassignWithoutAccess(tx, "t.org_id = ? AND a.user_id = ?", orgID, memberID)
+	if err != nil {
+		return err
+	}
+	return commitUnassigned(tx, orgID, events)
+}
+
+// commitUnassigned stages the events of the unassignments a membership change
+// made, commits and emits them
+func commitUnassigned(tx *sql.Tx, orgID int, events []TodoEvent) error {
+	todos := NewTodoService().ForOrg(orgID)
+	if err := todos.stage(tx, events...); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	todos.emit(events...)
+	return nil
+}
+
+// requireRole returns the user's access when they hold at least the required
+// organization role. Non-members get "organization not found".
+func (s *OrgService) requireRole(orgID, userID int, required string) (*orgAccess, error) {
+	access, err := loadOrgAccess(database.DB, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if access.Role == "" {
+		return nil, fmt.Errorf("organization not found")
+	}
+	if !models.HasOrgRole(access.Role, required) {
+		return nil, fmt.Errorf("access denied")
+	}
+	return access, nil
+}
+
+func (s *OrgService) memberRole(orgID, userID int) (string, error) {
+	var role string
+	err := database.DB.QueryRow("SELECT role FROM org_members WHERE org_id = ? AND user_id = ?", orgID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+func (s *OrgService) checkNotLastOwner(orgID int) error {
+	var owners int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM org_members WHERE org_id = ? AND role = ?", orgID, models.OrgRoleOwner).Scan(&owners)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return fmt.Errorf("organization must keep at least one owner")
+	}
+	return nil
+}
+
+// orgDeleted reports whether an event belongs to an organization that no
+// longer exists. Its activity and notifications were deleted with it, so the
+// events still relayed afterwards, such as those of its deleted todos, are
+// not recorded again.
+func orgDeleted(orgID int) (bool, error) {
+	if orgID == 0 {
+		return false, nil
+	}
+	var exists bool
+	err := database.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM organizations WHERE id = ?)", orgID).Scan(&exists)
+	return !exists, err
+}
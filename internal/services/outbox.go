@@ -0,0 +1,486 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// DefaultOutboxInterval is used when OUTBOX_RELAY_INTERVAL is not set: how
+// often the relay looks for events to publish when no mutation wakes it
+const DefaultOutboxInterval = 5 * time.Second
+
+// Relaying of outbox events
+const (
+	MaxOutboxAttempts      = 20
+	outboxRetryDelay       = 5 * time.Second // doubled after each failed attempt
+	outboxMaxDelay         = time.Hour
+	outboxLease            = time.Minute // how long a publish attempt holds an event
+	outboxBatchSize        = 200
+	outboxPublishTimeout   = 30 * time.Second
+	outboxRetention        = 7 * 24 * time.Hour
+	aggregateTodo          = "todo"
+	defaultOutboxSinkNames = "bus,webhook"
+)
+
+// relayWake wakes the relay as soon as a mutation has committed events
+var relayWake = make(chan struct{}, 1)
+
+// OutboxEvent is a todo event as relayed from the outbox. ID is the
+// idempotency key of the event: delivery is at least once, and an event
+// published again always has the same ID. Sequence numbers the events of
+// a todo in the order they happened.
+type OutboxEvent struct {
+	TodoEvent
+	ID        string
+	OrgID     int
+	Sequence  int
+	CreatedAt time.Time
+}
+
+// OutboxSink receives the events relayed from the outbox, in order per todo.
+// An error makes the relay publish the event to every sink again later, so
+// sinks must tolerate events they have already received.
+type OutboxSink interface {
+	Name() string
+	Publish(ctx context.Context, event *OutboxEvent) error
+}
+
+// outboxPayload is the part of a todo event stored as JSON
+type outboxPayload struct {
+	Todo    *models.Todo `json:"todo"`
+	ActorID int          `json:"actor_id,omitempty"`
+	Tags    []string     `json:"tags,omitempty"`
+	UserIDs []int        `json:"user_ids,omitempty"`
+	Fields  []string     `json:"fields,omitempty"`
+}
+
+// stage writes the events of a mutation to the outbox, in the mutation's
+// transaction, so that they are published if and only if it commits
+func (s *TodoService) stage(tx sqlExecutor, events ...TodoEvent) error {
+	now := time.Now().UTC()
+	for _, event := range events {
+		if event.Todo == nil {
+			continue
+		}
+		_, err := tx.Exec(`
+			INSERT INTO outbox_sequences (aggregate_type, aggregate_id, last_sequence)
+			VALUES (?, ?, 1)
+			ON DUPLICATE KEY UPDATE last_sequence = last_sequence + 1`, aggregateTodo, event.Todo.ID)
+		if err != nil {
+			return fmt.Errorf("error writing event to outbox: %v", err)
+		}
+		var sequence int
+		err = tx.QueryRow(`
+			SELECT last_sequence
+			FROM outbox_sequences
+			WHERE aggregate_type = ? AND aggregate_id = ?`, aggregateTodo, event.Todo.ID).Scan(&sequence)
+		if err != nil {
+			return fmt.Errorf("error writing event to outbox: %v", err)
+		}
+
+		eventID, err := newEventID()
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(outboxPayload{
+			Todo: event.Todo, ActorID: event.ActorID, Tags: event.Tags, UserIDs: event.UserIDs, Fields: event.Fields,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO outbox_events (event_id, org_id, aggregate_type, aggregate_id, sequence, event, payload,
+				next_attempt_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			eventID, s.orgID, aggregateTodo, event.Todo.ID, sequence, event.Type, string(payload), now, now)
+		if err != nil {
+			return fmt.Errorf("error writing event to outbox: %v", err)
+		}
+	}
+	return nil
+}
+
+// wakeRelay makes the relay publish the events just committed without
+// waiting for its next sweep
+func wakeRelay() {
+	select {
+	case relayWake <- struct{}{}:
+	default:
+	}
+}
+
+// loadTodo reads a todo with its details through the transaction of a
+// mutation, for the events staged in it
+func loadTodo(db sqlExecutor, id int) (*models.Todo, error) {
+	todo, err := scanTodo(db.QueryRow("SELECT "+todoColumns+" FROM todos WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+	todos := []models.Todo{*todo}
+	if err := attachDetails(db, todos); err != nil {
+		return nil, err
+	}
+	return &todos[0], nil
+}
+
+// loadTodos reads the todos matching a condition with their details, for the
+// events of changes made to many todos at once. The condition may end with
+// ORDER BY and locking clauses.
+func loadTodos(db sqlExecutor, where string, args ...interface{}) ([]models.Todo, error) {
+	rows, err := db.Query("SELECT "+todoColumns+" FROM todos WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	var todos []models.Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		todos = append(todos, *todo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return todos, attachDetails(db, todos)
+}
+
+// OutboxRelay publishes the events of the outbox to its sinks
+type OutboxRelay struct {
+	sinks []OutboxSink
+}
+
+func NewOutboxRelay(sinks ...OutboxSink) *OutboxRelay {
+	return &OutboxRelay{
+		sinks: sinks,
+	}
+}
+
+// OutboxSinksFromEnv returns the sinks named in OUTBOX_SINKS, a comma
+// separated list of bus, webhook and log. By default events go to the
+// in-process bus and to webhooks.
+func OutboxSinksFromEnv(bus *EventBus) ([]OutboxSink, error) {
+	names := os.Getenv("OUTBOX_SINKS")
+	if names == "" {
+		names = defaultOutboxSinkNames
+	}
+	var sinks []OutboxSink
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "bus":
+			sinks = append(sinks, bus)
+		case "webhook":
+			sinks = append(sinks, NewWebhookSink())
+		case "log":
+			sinks = append(sinks, NewLogSink())
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown outbox sink %q: must be bus, webhook or log", name)
+		}
+	}
+	return sinks, nil
+}
+
+// RelayPending publishes the outbox events that are due. The events of a todo
+// are published in order: while one is failing, the later ones wait. Failed
+// events are retried with exponential backoff, up to MaxOutboxAttempts
+// attempts, after which they are marked failed and the todo's later events
+// go ahead. It returns the number of events published.
+func (r *OutboxRelay) RelayPending(now time.Time) (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, event_id, org_id, aggregate_type, aggregate_id, sequence, event, payload, attempts,
+			next_attempt_at, created_at
+		FROM outbox_events
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY id ASC
+		LIMIT ?`, models.DeliveryPending, now, outboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	type pendingEvent struct {
+		OutboxEvent
+		id, attempts, aggregateID int
+		aggregateType, payload    string
+		due                       time.Time
+	}
+	var aggregates []string
+	byAggregate := make(map[string][]pendingEvent)
+	for rows.Next() {
+		var e pendingEvent
+		err := rows.Scan(&e.id, &e.ID, &e.OrgID, &e.aggregateType, &e.aggregateID, &e.Sequence, &e.Type, &e.payload,
+			&e.attempts, &e.due, &e.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		key := fmt.Sprintf("%s:%d", e.aggregateType, e.aggregateID)
+		if _, ok := byAggregate[key]; !ok {
+			aggregates = append(aggregates, key)
+		}
+		byAggregate[key] = append(byAggregate[key], e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, key := range aggregates {
+		events := byAggregate[key]
+		sort.Slice(events, func(i, j int) bool { return events[i].Sequence < events[j].Sequence })
+
+		// An earlier event still pending, backing off or held by another
+		// relay, holds back the aggregate
+		var earlier int
+		err := database.DB.QueryRow(`
+			SELECT COUNT(*)
+			FROM outbox_events
+			WHERE aggregate_type = ? AND aggregate_id = ? AND status = ? AND sequence < ?`,
+			events[0].aggregateType, events[0].aggregateID, models.DeliveryPending, events[0].Sequence).Scan(&earlier)
+		if err != nil {
+			return published, err
+		}
+		if earlier > 0 {
+			continue
+		}
+
+		for _, e := range events {
+			// Claim the event so that another relay does not publish it too;
+			// if this one dies, the event is retried once the lease ends
+			result, err := database.DB.Exec(`
+				UPDATE outbox_events
+				SET next_attempt_at = ?
+				WHERE id = ? AND status = ? AND next_attempt_at = ?`,
+				now.Add(outboxLease), e.id, models.DeliveryPending, e.due)
+			if err != nil {
+				return published, err
+			}
+			if claimed, _ := result.RowsAffected(); claimed == 0 {
+				break
+			}
+
+			attempts := e.attempts + 1
+			publishErr := r.publish(&e.OutboxEvent, e.payload)
+			if publishErr == nil {
+				_, err = database.DB.Exec(`
+					UPDATE outbox_events
+					SET status = ?, attempts = ?, last_error = NULL, published_at = ?
+					WHERE id = ?`, models.DeliverySent, attempts, time.Now().UTC(), e.id)
+				if err != nil {
+					return published, err
+				}
+				published++
+				continue
+			}
+
+			if attempts >= MaxOutboxAttempts {
+				log.Printf("Outbox event %s (%s of %s) failed for good: %v", e.ID, e.Type, key, publishErr)
+				_, err = database.DB.Exec(`
+					UPDATE outbox_events
+					SET status = ?, attempts = ?, last_error = ?
+					WHERE id = ?`, models.DeliveryFailed, attempts, publishErr.Error(), e.id)
+				if err != nil {
+					return published, err
+				}
+				continue
+			}
+			_, err = database.DB.Exec(`
+				UPDATE outbox_events
+				SET attempts = ?, last_error = ?, next_attempt_at = ?
+				WHERE id = ?`, attempts, publishErr.Error(),
+				time.Now().UTC().Add(backoff(attempts, outboxRetryDelay, outboxMaxDelay)), e.id)
+			if err != nil {
+				return published, err
+			}
+			break
+		}
+	}
+	return published, nil
+}
+
+// publish decodes an event and hands it to every sink in turn
+func (r *OutboxRelay) publish(event *OutboxEvent, payload string) error {
+	var p outboxPayload
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		return fmt.Errorf("error reading event: %v", err)
+	}
+	event.Todo, event.ActorID, event.Tags, event.UserIDs, event.Fields = p.Todo, p.ActorID, p.Tags, p.UserIDs, p.Fields
+
+	ctx, cancel := context.WithTimeout(context.Background(), outboxPublishTimeout)
+	defer cancel()
+	for _, sink := range r.sinks {
+		if err := sink.Publish(ctx, event); err != nil {
+			return fmt.Errorf("%s sink: %v", sink.Name(), err)
+		}
+	}
+	return nil
+}
+
+// RunRelay publishes pending events whenever a mutation commits, and at least
+// every OUTBOX_RELAY_INTERVAL for retries. It also prunes events published
+// longer ago than the retention. It never returns.
+func (r *OutboxRelay) RunRelay() {
+	interval := envDuration("OUTBOX_RELAY_INTERVAL", DefaultOutboxInterval)
+	lastPrune := time.Time{}
+	for {
+		now := time.Now().UTC()
+		if published, err := r.RelayPending(now); err != nil {
+			log.Println("Outbox relay failed:", err)
+		} else if published == outboxBatchSize {
+			continue // more may be waiting
+		}
+
+		if now.Sub(lastPrune) >= time.Hour {
+			if err := pruneOutbox(now.Add(-outboxRetention)); err != nil {
+				log.Println("Outbox cleanup failed:", err)
+			}
+			lastPrune = now
+		}
+
+		select {
+		case <-relayWake:
+		case <-time.After(interval):
+		}
+	}
+}
+
+// pruneOutbox deletes the events published or failed before cutoff, and the
+// record of their handling by the bus
+func pruneOutbox(cutoff time.Time) error {
+	_, err := database.DB.Exec(`
+		DELETE FROM outbox_events
+		WHERE status != ? AND created_at < ?`, models.DeliveryPending, cutoff)
+	if err != nil {
+		return err
+	}
+	_, err = database.DB.Exec("DELETE FROM outbox_consumed WHERE consumed_at < ?", cutoff)
+	return err
+}
+
+// EventBus is the in-process sink: it hands each event to its subscribers,
+// in the order they subscribed. The bus records the events each subscriber
+// has handled, using the event ID as idempotency key, so an event published
+// again only goes to the subscribers that have not handled it yet.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers []busSubscriber
+}
+
+type busSubscriber struct {
+	name   string
+	handle func(*OutboxEvent) error
+}
+
+// NewEventBus returns a bus with the activity feed and notifications
+// subscribed
+func NewEventBus() *EventBus {
+	bus := &EventBus{}
+	bus.Subscribe("activity", recordTodoEvent)
+	bus.Subscribe("notifications", notifyTodoEvent)
+	return bus
+}
+
+// Subscribe adds a subscriber under a name unique to the bus. A subscriber
+// returning an error gets the event again later.
+func (b *EventBus) Subscribe(name string, handle func(*OutboxEvent) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, busSubscriber{name: name, handle: handle})
+}
+
+func (b *EventBus) Name() string {
+	return "bus"
+}
+
+func (b *EventBus) Publish(ctx context.Context, event *OutboxEvent) error {
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, sub := range subscribers {
+		var handled int
+		err := database.DB.QueryRow(`
+			SELECT COUNT(*)
+			FROM outbox_consumed
+			WHERE consumer = ? AND event_id = ?`, sub.name, event.ID).Scan(&handled)
+		if err != nil {
+			return err
+		}
+		if handled > 0 {
+			continue
+		}
+		if err := sub.handle(event); err != nil {
+			return fmt.Errorf("%s: %v", sub.name, err)
+		}
+		_, err = database.DB.Exec(`
+			INSERT INTO outbox_consumed (consumer, event_id, consumed_at)
+			VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE consumer = consumer`, sub.name, event.ID, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WebhookSink queues events for the webhooks subscribed to them. The event
+// ID is sent as X-Webhook-ID, and an event is queued once per webhook.
+type WebhookSink struct{}
+
+func NewWebhookSink() *WebhookSink {
+	return &WebhookSink{}
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, event *OutboxEvent) error {
+	return queueWebhookEvent(event)
+}
+
+// LogSink writes events to the log, one JSON line each
+type LogSink struct{}
+
+func NewLogSink() *LogSink {
+	return &LogSink{}
+}
+
+func (s *LogSink) Name() string {
+	return "log"
+}
+
+func (s *LogSink) Publish(ctx context.Context, event *OutboxEvent) error {
+	line, err := json.Marshal(struct {
+		ID       string `json:"id"`
+		Type     string `json:"type"`
+		OrgID    int    `json:"org_id,omitempty"`
+		TodoID   int    `json:"todo_id"`
+		Sequence int    `json:"sequence"`
+		outboxPayload
+		CreatedAt time.Time `json:"created_at"`
+	}{
+		ID: event.ID, Type: event.Type, OrgID: event.OrgID, TodoID: event.Todo.ID, Sequence: event.Sequence,
+		outboxPayload: outboxPayload{
+			Todo: event.Todo, ActorID: event.ActorID, Tags: event.Tags, UserIDs: event.UserIDs, Fields: event.Fields,
+		},
+		CreatedAt: event.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Event %s", line)
+	return nil
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+	"todo/internal/webpush"
+)
+
+// DefaultPushInterval is used when PUSH_SWEEP_INTERVAL is not set: how often
+// push reminders are queued and the queue is delivered
+const DefaultPushInterval = time.Minute
+
+// Delivery of queued push messages
+const (
+	MaxPushAttempts   = 6
+	pushRetryDelay    = 30 * time.Second // doubled after each failed attempt
+	pushMaxDelay      = 30 * time.Minute
+	pushLease         = 5 * time.Minute // how long a delivery attempt holds a message
+	pushBatchSize     = 100
+	pushSendTimeout   = 30 * time.Second
+	assignmentPushTTL = 24 * time.Hour
+)
+
+// PushService sends Web Push notifications of reminders and assignments to
+// the devices of users. Subscriptions belong to the user and receive the
+// messages of every tenant.
+type PushService struct {
+	client *webpush.Client
+}
+
+// NewPushService sends push messages through client, which it restricts to
+// public addresses: endpoints are checked when subscribing, but their hosts
+// may resolve elsewhere later.
+func NewPushService(client *webpush.Client) *PushService {
+	client.SetDialer(publicDialer(pushSendTimeout).DialContext)
+	return &PushService{
+		client: client,
+	}
+}
+
+// GetKey returns the VAPID public key browsers must subscribe with
+func (s *PushService) GetKey() *models.PushKey {
+	return &models.PushKey{PublicKey: s.client.PublicKey()}
+}
+
+// Subscribe registers a device of the user. Registering an endpoint again
+// updates its keys, and moves it to the user if another user had it.
+func (s *PushService) Subscribe(userID int, req *models.PushSubscriptionRequest) (*models.PushSubscription, error) {
+	if err := validateEndpoint(req.Endpoint); err != nil {
+		return nil, err
+	}
+	p256dh, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(req.Keys.P256dh, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid keys.p256dh: must be URL-safe base64")
+	}
+	if _, err := ecdh.P256().NewPublicKey(p256dh); err != nil {
+		return nil, fmt.Errorf("invalid keys.p256dh: must be a P-256 public key")
+	}
+	auth, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(req.Keys.Auth, "="))
+	if err != nil || len(auth) != 16 {
+		return nil, fmt.Errorf("invalid keys.auth: must be 16 bytes of URL-safe base64")
+	}
+	deviceName := strings.TrimSpace(req.DeviceName)
+	if len(deviceName) > 255 {
+		return nil, fmt.Errorf("invalid device_name: at most 255 characters")
+	}
+
+	var count int
+	err = database.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM push_subscriptions
+		WHERE user_id = ? AND endpoint_hash != ?`, userID, endpointHash(req.Endpoint)).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count >= models.MaxPushSubscriptions {
+		return nil, fmt.Errorf("too many devices: at most %d", models.MaxPushSubscriptions)
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO push_subscriptions (user_id, endpoint, endpoint_hash, p256dh, auth, device_name)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), p256dh = VALUES(p256dh), auth = VALUES(auth),
+			device_name = VALUES(device_name)`,
+		userID, req.Endpoint, endpointHash(req.Endpoint), req.Keys.P256dh, req.Keys.Auth, deviceName)
+	if err != nil {
+		return nil, fmt.Errorf("error saving push subscription: %v", err)
+	}
+
+	subscriptions, err := querySubscriptions("endpoint_hash = ?", endpointHash(req.Endpoint))
+	if err != nil {
+		return nil, err
+	}
+	if len(subscriptions) == 0 {
+		return nil, fmt.Errorf("push subscription not found")
+	}
+	return &subscriptions[0], nil
+}
+
+// GetSubscriptions returns the devices of the user, oldest first
+func (s *PushService) GetSubscriptions(userID int) ([]models.PushSubscription, error) {
+	return querySubscriptions("user_id = ?", userID)
+}
+
+// Unsubscribe removes a device of the user, with the messages queued for it
+func (s *PushService) Unsubscribe(id, userID int) error {
+	result, err := database.DB.Exec("DELETE FROM push_subscriptions WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("push subscription not found")
+	}
+	return nil
+}
+
+// QueueReminders pushes the reminders that are due to every device of their
+// users. It returns the number of messages queued.
+func (s *PushService) QueueReminders(now time.Time) (int, error) {
+	reminders, err := dueReminders(now)
+	if err != nil {
+		return 0, err
+	}
+	queued := 0
+	for _, r := range reminders {
+		payload := models.PushPayload{
+			Kind:   models.PushReminder,
+			Title:  r.todo.Title,
+			Body:   fmt.Sprintf("Due %s, at %s", dueIn(r.todo.DueDate.Sub(now)), r.todo.DueDate.In(r.settings.loc).Format("15:04")),
+			TodoID: r.todo.ID,
+			OrgID:  r.todo.OrgID,
+		}
+		n, err := queuePush(r.userID, r.key(), payload, webpush.UrgencyHigh, *r.todo.DueDate, r.settings, now)
+		if err != nil {
+			return queued, fmt.Errorf("error queueing push reminder of todo %d: %v", r.todo.ID, err)
+		}
+		queued += n
+	}
+	return queued, nil
+}
+
+// DeliverQueued sends the queued push messages that are due. Subscriptions
+// the push service no longer knows (404 or 410) are removed. Other failures
+// are retried with exponential backoff, up to MaxPushAttempts attempts, unless
+// the push service rejected the message for good. Messages whose time to live
+// ran out are cancelled. It returns the number of messages sent.
+func (s *PushService) DeliverQueued(now time.Time) (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT q.id, q.subscription_id, s.user_id, s.endpoint, s.p256dh, s.auth, q.payload, q.urgency, q.topic,
+			q.attempts, q.next_attempt_at, q.expires_at
+		FROM push_queue q
+		JOIN push_subscriptions s ON s.id = q.subscription_id
+		WHERE q.status = ? AND q.next_attempt_at <= ?
+		ORDER BY q.next_attempt_at ASC, q.id ASC
+		LIMIT ?`, models.DeliveryPending, now, pushBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	type queuedPush struct {
+		id, subscriptionID, userID, attempts int
+		subscription                         webpush.Subscription
+		payload                              string
+		options                              webpush.Options
+		due, expires                         time.Time
+	}
+	var messages []queuedPush
+	for rows.Next() {
+		var m queuedPush
+		err := rows.Scan(&m.id, &m.subscriptionID, &m.userID, &m.subscription.Endpoint, &m.subscription.P256dh,
+			&m.subscription.Auth, &m.payload, &m.options.Urgency, &m.options.Topic, &m.attempts, &m.due, &m.expires)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, m := range messages {
+		if !m.expires.After(now) {
+			if _, err := database.DB.Exec("UPDATE push_queue SET status = ? WHERE id = ?", models.DeliveryCancelled, m.id); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		// Claim the message so that another worker does not send it too; if
+		// this one dies, the message is retried once the lease ends
+		result, err := database.DB.Exec(`
+			UPDATE push_queue
+			SET next_attempt_at = ?
+			WHERE id = ? AND status = ? AND next_attempt_at = ?`,
+			now.Add(pushLease), m.id, models.DeliveryPending, m.due)
+		if err != nil {
+			return sent, err
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 0 {
+			continue
+		}
+
+		m.options.TTL = m.expires.Sub(now)
+		ctx, cancel := context.WithTimeout(context.Background(), pushSendTimeout)
+		sendErr := s.client.Send(ctx, m.subscription, []byte(m.payload), m.options)
+		cancel()
+
+		attempts := m.attempts + 1
+		switch {
+		case sendErr == nil:
+			_, err = database.DB.Exec(`
+				UPDATE push_queue
+				SET status = ?, attempts = ?, sent_at = ?, last_error = NULL
+				WHERE id = ?`, models.DeliverySent, attempts, time.Now().UTC(), m.id)
+			if err == nil {
+				_, err = database.DB.Exec("UPDATE push_subscriptions SET last_success_at = ? WHERE id = ?",
+					time.Now().UTC(), m.subscriptionID)
+			}
+			sent++
+		case webpush.IsGone(sendErr):
+			log.Printf("Push subscription %d of user %d expired, removing it", m.subscriptionID, m.userID)
+			_, err = database.DB.Exec("DELETE FROM push_subscriptions WHERE id = ?", m.subscriptionID)
+		case webpush.IsPermanent(sendErr) || attempts >= MaxPushAttempts:
+			log.Printf("Push message %d to user %d failed for good: %v", m.id, m.userID, sendErr)
+			_, err = database.DB.Exec(`
+				UPDATE push_queue
+				SET status = ?, attempts = ?, last_error = ?
+				WHERE id = ?`, models.DeliveryFailed, attempts, sendErr.Error(), m.id)
+		default:
+			_, err = database.DB.Exec(`
+				UPDATE push_queue
+				SET attempts = ?, last_error = ?, next_attempt_at = ?
+				WHERE id = ?`, attempts, sendErr.Error(),
+				time.Now().UTC().Add(backoff(attempts, pushRetryDelay, pushMaxDelay)), m.id)
+		}
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// RunPusher queues push reminders and delivers the queue every
+// PUSH_SWEEP_INTERVAL. It never returns.
+func (s *PushService) RunPusher() {
+	interval := envDuration("PUSH_SWEEP_INTERVAL", DefaultPushInterval)
+	for {
+		now := time.Now().UTC()
+		if queued, err := s.QueueReminders(now); err != nil {
+			log.Println("Push reminder sweep failed:", err)
+		} else if queued > 0 {
+			log.Printf("Push reminder sweep queued %d messages", queued)
+		}
+		if sent, err := s.DeliverQueued(now); err != nil {
+			log.Println("Push delivery failed:", err)
+		} else if sent > 0 {
+			log.Printf("Push delivery sent %d messages", sent)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// pushAssignment queues a push message for a user assigned to a todo. Failures
+// are only logged.
+func pushAssignment(userID int, todo *models.Todo, actorID int) {
+	settings, err := loadEmailSettings(userID)
+	if err != nil {
+		log.Printf("Error pushing assignment of todo %d: %v", todo.ID, err)
+		return
+	}
+	body := "You were assigned this todo"
+	if names, err := usernames([]int{actorID}); err == nil && len(names) == 1 {
+		body = names[0] + " assigned you this todo"
+	}
+	payload := models.PushPayload{Kind: models.PushAssigned, Title: todo.Title, Body: body, TodoID: todo.ID, OrgID: todo.OrgID}
+	now := time.Now().UTC()
+	if _, err := queuePush(userID, "", payload, webpush.UrgencyNormal, now.Add(assignmentPushTTL), settings, now); err != nil {
+		log.Printf("Error pushing assignment of todo %d: %v", todo.ID, err)
+	}
+}
+
+// queuePush queues a message for each device of the user, to be sent after
+// their quiet hours and dropped at expires. A non-empty key makes queueing
+// the same message twice a no-op. It returns the number of messages queued.
+func queuePush(userID int, key string, payload models.PushPayload, urgency string, expires time.Time, settings *emailSettings, now time.Time) (int, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	if len(raw) > webpush.MaxPayloadSize {
+		return 0, fmt.Errorf("push payload too large: %d bytes", len(raw))
+	}
+	subscriptions, err := querySubscriptions("user_id = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, sub := range subscriptions {
+		var dedupeKey interface{}
+		if key != "" {
+			dedupeKey = fmt.Sprintf("%s:%d", key, sub.ID)
+		}
+		// Messages about the same todo replace each other at the push service
+		result, err := database.DB.Exec(`
+			INSERT INTO push_queue (subscription_id, dedupe_key, payload, urgency, topic, next_attempt_at, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE id = id`,
+			sub.ID, dedupeKey, string(raw), urgency, fmt.Sprintf("todo-%d", payload.TodoID), quietUntil(settings, now), expires)
+		if err != nil {
+			return queued, err
+		}
+		if inserted, _ := result.RowsAffected(); inserted == 1 {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+func querySubscriptions(conditions string, args ...interface{}) ([]models.PushSubscription, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, endpoint, device_name, created_at, last_success_at
+		FROM push_subscriptions
+		WHERE `+conditions+`
+		ORDER BY created_at ASC, id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []models.PushSubscription{}
+	for rows.Next() {
+		var sub models.PushSubscription
+		var lastSuccess sql.NullTime
+		if err := rows.Scan(&sub.ID, &sub.Endpoint, &sub.DeviceName, &sub.CreatedAt, &lastSuccess); err != nil {
+			return nil, err
+		}
+		if lastSuccess.Valid {
+			sub.LastSuccessAt = &lastSuccess.Time
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+	return subscriptions, rows.Err()
+}
+
+// validateEndpoint requires an HTTPS push service URL on a public host.
+// Plain HTTP and local hosts, for stand-ins such as cmd/fakepush, are only
+// allowed with ALLOW_LOCAL_ENDPOINTS.
+func validateEndpoint(endpoint string) error {
+	if len(endpoint) > 2048 {
+		return fmt.Errorf("invalid endpoint: at most 2048 characters")
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid endpoint: must be an absolute URL")
+	}
+	if u.Scheme != "https" && (u.Scheme != "http" || !allowLocalEndpoints()) {
+		return fmt.Errorf("invalid endpoint: must be an HTTPS URL")
+	}
+	if err := checkPublicHost(u.Hostname()); err != nil {
+		return fmt.Errorf("invalid endpoint: %v", err)
+	}
+	return nil
+}
+
+func endpointHash(endpoint string) string {
+	sum := sha256.Sum256([]byte(endpoint))
+	return hex.EncodeToString(sum[:])
+}
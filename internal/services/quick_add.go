@@ -0,0 +1,515 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"todo/internal/models"
+)
+
+// QuickAdd parses free text into a todo and creates it, unless the request
+// is a preview. See parseQuickAdd for the syntax.
+func (s *TodoService) QuickAdd(req *models.QuickAddRequest, userID int) (*models.QuickAddResult, error) {
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		return nil, fmt.Errorf("text is required")
+	}
+	if len(text) > 1000 {
+		return nil, fmt.Errorf("text must be at most 1000 characters")
+	}
+
+	loc, err := userLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+	parsed := parseQuickAdd(text, time.Now().In(loc))
+
+	if parsed.ListName != "" {
+		list, err := s.findListByName(parsed.ListName, userID)
+		if err != nil {
+			return nil, err
+		}
+		parsed.ListID = &list.ID
+	}
+
+	result := &models.QuickAddResult{Parsed: parsed}
+	if req.Preview {
+		return result, nil
+	}
+	if parsed.Title == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+
+	todo, err := s.Create(&models.Todo{
+		ListID:     parsed.ListID,
+		Title:      parsed.Title,
+		Priority:   parsed.Priority,
+		DueDate:    parsed.DueDate,
+		Recurrence: parsed.Recurrence,
+		Tags:       parsed.Tags,
+	}, userID)
+	if err != nil {
+		return nil, err
+	}
+	result.Todo = todo
+	return result, nil
+}
+
+// findListByName finds a list the user can access by name, ignoring case and
+// treating - and _ as spaces. The user's own lists win over shared ones.
+func (s *TodoService) findListByName(name string, userID int) (*models.List, error) {
+	lists, err := s.lists.GetAll(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	normalize := func(value string) string {
+		value = strings.NewReplacer("-", " ", "_", " ").Replace(strings.ToLower(value))
+		return strings.Join(strings.Fields(value), " ")
+	}
+	want := normalize(name)
+	var found *models.List
+	for i := range lists {
+		if normalize(lists[i].Name) != want {
+			continue
+		}
+		if found == nil || (lists[i].UserID == userID && found.UserID != userID) {
+			found = &lists[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("list %q not found", name)
+	}
+	return found, nil
+}
+
+// parseQuickAdd extracts the parts of a quick-add text, relative to now in
+// the user's timezone. Whatever is not recognized becomes the title.
+//
+//	#tag                     a tag
+//	@list or @"Some list"    the target list
+//	!low !medium !high !urgent or !1 (urgent) to !4 (low)
+//	every day|week|month|year, every 2 weeks, every monday
+//	today, tomorrow, tonight, monday, next friday, next week, next month,
+//	in 3 days, in 2 hours, 2026-03-01, mar 1, 1st march (optionally with a year)
+//	9am, 9:30 pm, 21:00, at 9, noon, midnight
+//
+// Dates may be preceded by on, due or by, and times by at. A time without a
+// date means today, or tomorrow once that time has passed.
+func parseQuickAdd(text string, now time.Time) models.ParsedTodo {
+	p := quickAddParser{words: splitQuickAdd(text), now: now}
+	parsed := models.ParsedTodo{Tags: []string{}}
+
+	var title []string
+	for p.i < len(p.words) {
+		word := p.words[p.i]
+		lower := strings.ToLower(word)
+
+		switch {
+		case quickTagPattern.MatchString(word):
+			parsed.Tags = appendTag(parsed.Tags, strings.ToLower(word[1:]))
+			p.i++
+		case len(word) > 1 && word[0] == '@':
+			parsed.ListName = strings.Trim(word[1:], `"`)
+			p.i++
+		case quickPriorities[lower] != "":
+			parsed.Priority = quickPriorities[lower]
+			p.i++
+		case p.recurrence(&parsed):
+		case p.dateOrTime():
+		default:
+			title = append(title, word)
+			p.i++
+		}
+	}
+	parsed.Title = strings.Join(title, " ")
+
+	if p.date != nil || p.hasTime {
+		due, allDay := p.due()
+		parsed.DueDate = &due
+		parsed.AllDay = allDay
+	}
+	return parsed
+}
+
+var quickTagPattern = regexp.MustCompile(`^#[\p{L}\p{N}_-]{1,64}$`)
+
+var quickPriorities = map[string]string{
+	"!none": models.PriorityNone, "!low": models.PriorityLow, "!medium": models.PriorityMedium,
+	"!med": models.PriorityMedium, "!high": models.PriorityHigh, "!urgent": models.PriorityUrgent,
+	"!1": models.PriorityUrgent, "!2": models.PriorityHigh, "!3": models.PriorityMedium, "!4": models.PriorityLow,
+}
+
+var quickWeekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var quickMonths = map[string]time.Month{
+	"january": time.January, "jan": time.January,
+	"february": time.February, "feb": time.February,
+	"march": time.March, "mar": time.March,
+	"april": time.April, "apr": time.April,
+	"may":  time.May,
+	"june": time.June, "jun": time.June,
+	"july": time.July, "jul": time.July,
+	"august": time.August, "aug": time.August,
+	"september": time.September, "sep": time.September, "sept": time.September,
+	"october": time.October, "oct": time.October,
+	"november": time.November, "nov": time.November,
+	"december": time.December, "dec": time.December,
+}
+
+// quickUnits maps duration words to recurrence frequencies
+var quickUnits = map[string]string{
+	"day": FreqDaily, "days": FreqDaily,
+	"week": FreqWeekly, "weeks": FreqWeekly,
+	"month": FreqMonthly, "months": FreqMonthly,
+	"year": FreqYearly, "years": FreqYearly,
+}
+
+var (
+	quickTimePattern  = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	quickDayPattern   = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)?,?$`)
+	quickYearPattern  = regexp.MustCompile(`^\d{4}$`)
+	quickCountPattern = regexp.MustCompile(`^(\d{1,3}|a|an)$`)
+)
+
+type quickAddParser struct {
+	words []string
+	i     int
+	now   time.Time
+
+	date    *time.Time // midnight of the due day, in now's location
+	hasTime bool
+	hour    int
+	minute  int
+
+	// ambiguous is set for hours like "at 5", which may mean 5am or 5pm
+	ambiguous bool
+}
+
+// word returns the lowercased word at offset from the current one, or ""
+func (p *quickAddParser) word(offset int) string {
+	if p.i+offset >= len(p.words) {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(p.words[p.i+offset], ","))
+}
+
+func (p *quickAddParser) today() time.Time {
+	return time.Date(p.now.Year(), p.now.Month(), p.now.Day(), 0, 0, 0, 0, p.now.Location())
+}
+
+// recurrence consumes "every ..." and reports whether it matched
+func (p *quickAddParser) recurrence(parsed *models.ParsedTodo) bool {
+	if p.word(0) != "every" {
+		return false
+	}
+	next := p.word(1)
+
+	if freq, ok := quickUnits[next]; ok {
+		parsed.Recurrence = recurrence{Freq: freq, Interval: 1}.String()
+		p.i += 2
+		return true
+	}
+	if next == "other" {
+		if freq, ok := quickUnits[p.word(2)]; ok {
+			parsed.Recurrence = recurrence{Freq: freq, Interval: 2}.String()
+			p.i += 3
+			return true
+		}
+	}
+	if interval, err := strconv.Atoi(next); err == nil && interval >= 1 && interval <= maxRecurrenceInterval {
+		if freq, ok := quickUnits[p.word(2)]; ok {
+			parsed.Recurrence = recurrence{Freq: freq, Interval: interval}.String()
+			p.i += 3
+			return true
+		}
+	}
+	if weekday, ok := quickWeekdays[next]; ok {
+		parsed.Recurrence = recurrence{Freq: FreqWeekly, Interval: 1}.String()
+		if p.date == nil {
+			day := p.nextWeekday(weekday, true)
+			p.date = &day
+		}
+		p.i += 2
+		return true
+	}
+	return false
+}
+
+// dateOrTime consumes a date or a time, with an optional leading preposition,
+// and reports whether it matched
+func (p *quickAddParser) dateOrTime() bool {
+	start := p.i
+	switch p.word(0) {
+	case "on", "due", "by":
+		p.i++
+		if p.date == nil && p.matchDate(true) {
+			return true
+		}
+		if !p.hasTime && p.matchTime(false) {
+			return true
+		}
+	case "at":
+		p.i++
+		if !p.hasTime && p.matchTime(true) {
+			return true
+		}
+	default:
+		if p.date == nil && p.matchDate(false) {
+			return true
+		}
+		if !p.hasTime && p.matchTime(false) {
+			return true
+		}
+	}
+	p.i = start
+	return false
+}
+
+// matchDate consumes a date at the current word. Weekday abbreviations such
+// as "sat" are only dates after a preposition, so they stay usable in titles.
+func (p *quickAddParser) matchDate(afterPreposition bool) bool {
+	today := p.today()
+	set := func(day time.Time, words int) bool {
+		p.date = &day
+		p.i += words
+		return true
+	}
+
+	w := p.word(0)
+	switch w {
+	case "today":
+		return set(today, 1)
+	case "tonight":
+		if !p.hasTime {
+			p.hasTime, p.hour, p.minute = true, 20, 0
+		}
+		return set(today, 1)
+	case "tomorrow", "tmr", "tmrw":
+		return set(today.AddDate(0, 0, 1), 1)
+	case "next":
+		switch next := p.word(1); next {
+		case "week":
+			daysSinceMonday := (int(today.Weekday()) + 6) % 7
+			return set(today.AddDate(0, 0, 7-daysSinceMonday), 2)
+		case "month":
+			return set(time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location()), 2)
+		case "year":
+			return set(time.Date(today.Year()+1, time.January, 1, 0, 0, 0, 0, today.Location()), 2)
+		default:
+			if weekday, ok := quickWeekdays[next]; ok {
+				return set(p.nextWeekday(weekday, false), 2)
+			}
+		}
+		return false
+	case "in":
+		count := p.word(1)
+		if !quickCountPattern.MatchString(count) {
+			return false
+		}
+		n := 1
+		if count != "a" && count != "an" {
+			n, _ = strconv.Atoi(count)
+		}
+		switch unit := p.word(2); unit {
+		case "minute", "minutes", "min", "mins", "hour", "hours", "hr", "hrs":
+			d := time.Duration(n) * time.Minute
+			if strings.HasPrefix(unit, "h") {
+				d = time.Duration(n) * time.Hour
+			}
+			at := p.now.Add(d)
+			day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+			p.hasTime, p.hour, p.minute = true, at.Hour(), at.Minute()
+			return set(day, 3)
+		default:
+			switch quickUnits[unit] {
+			case FreqDaily:
+				return set(today.AddDate(0, 0, n), 3)
+			case FreqWeekly:
+				return set(today.AddDate(0, 0, 7*n), 3)
+			case FreqMonthly:
+				return set(today.AddDate(0, n, 0), 3)
+			case FreqYearly:
+				return set(today.AddDate(n, 0, 0), 3)
+			}
+		}
+		return false
+	}
+
+	if weekday, ok := quickWeekdays[w]; ok && (afterPreposition || w == strings.ToLower(weekday.String())) {
+		return set(p.nextWeekday(weekday, true), 1)
+	}
+	if day, err := time.ParseInLocation("2006-01-02", w, today.Location()); err == nil {
+		return set(day, 1)
+	}
+
+	// "mar 1", "march 1st" or "1 mar", "1st march", each with an optional year
+	month, day, words := time.Month(0), 0, 0
+	if m, ok := quickMonths[w]; ok {
+		if match := quickDayPattern.FindStringSubmatch(p.word(1)); match != nil {
+			month, words = m, 2
+			day, _ = strconv.Atoi(match[1])
+		}
+	} else if match := quickDayPattern.FindStringSubmatch(w); match != nil {
+		if m, ok := quickMonths[p.word(1)]; ok {
+			month, words = m, 2
+			day, _ = strconv.Atoi(match[1])
+		}
+	}
+	if words == 0 || day < 1 || day > 31 {
+		return false
+	}
+	year := today.Year()
+	explicitYear := quickYearPattern.MatchString(p.word(words))
+	if explicitYear {
+		year, _ = strconv.Atoi(p.word(words))
+		words++
+	}
+	date := time.Date(year, month, day, 0, 0, 0, 0, today.Location())
+	if date.Month() != month {
+		return false // e.g. feb 30
+	}
+	if !explicitYear && date.Before(today) {
+		date = date.AddDate(1, 0, 0)
+	}
+	return set(date, words)
+}
+
+// matchTime consumes a time at the current word. Bare numbers are only taken
+// as hours after "at", so "buy 3 apples" keeps its number.
+func (p *quickAddParser) matchTime(afterAt bool) bool {
+	w := p.word(0)
+	switch w {
+	case "noon", "midday":
+		p.hasTime, p.hour, p.minute = true, 12, 0
+		p.i++
+		return true
+	case "midnight":
+		p.hasTime, p.hour, p.minute = true, 0, 0
+		p.i++
+		return true
+	}
+
+	words := 1
+	if next := p.word(1); (next == "am" || next == "pm") && quickTimePattern.MatchString(w) {
+		w += next
+		words = 2
+	}
+	match := quickTimePattern.FindStringSubmatch(w)
+	if match == nil {
+		return false
+	}
+	if match[2] == "" && match[3] == "" && !afterAt {
+		return false
+	}
+
+	hour, _ := strconv.Atoi(match[1])
+	minute := 0
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+	if minute > 59 {
+		return false
+	}
+	switch match[3] {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return false
+		}
+		hour %= 12
+		if match[3] == "pm" {
+			hour += 12
+		}
+	default:
+		if hour > 23 {
+			return false
+		}
+		p.ambiguous = match[2] == "" && hour >= 1 && hour <= 11
+	}
+
+	p.hasTime, p.hour, p.minute = true, hour, minute
+	p.i += words
+	return true
+}
+
+// nextWeekday returns the next day falling on weekday, which may be today
+// when includeToday is set
+func (p *quickAddParser) nextWeekday(weekday time.Weekday, includeToday bool) time.Time {
+	today := p.today()
+	days := (int(weekday) - int(today.Weekday()) + 7) % 7
+	if days == 0 && !includeToday {
+		days = 7
+	}
+	return today.AddDate(0, 0, days)
+}
+
+// due combines the parsed date and time into a UTC due date
+func (p *quickAddParser) due() (time.Time, bool) {
+	if !p.hasTime {
+		return p.date.UTC(), true
+	}
+
+	day := p.today()
+	if p.date != nil {
+		day = *p.date
+	}
+	due := time.Date(day.Year(), day.Month(), day.Day(), p.hour, p.minute, 0, 0, day.Location())
+	if p.ambiguous {
+		// "at 5" is the next 5 o'clock when no date is given, and otherwise
+		// the afternoon for hours no one usually means in the early morning
+		pm := due.Add(12 * time.Hour)
+		if (p.date == nil && !due.After(p.now) && pm.After(p.now)) || (p.date != nil && p.hour < 7) {
+			due = pm
+		}
+	}
+	if p.date == nil && !due.After(p.now) {
+		due = due.AddDate(0, 0, 1)
+	}
+	return due.UTC(), false
+}
+
+// splitQuickAdd splits text into words, keeping @"quoted list names" together
+func splitQuickAdd(text string) []string {
+	var words []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range text {
+		switch {
+		case r == '"' && (quoted || current.String() == "@"):
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				words = append(words, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		words = append(words, current.String())
+	}
+	return words
+}
+
+func appendTag(tags []string, tag string) []string {
+	for _, existing := range tags {
+		if existing == tag {
+			return tags
+		}
+	}
+	return append(tags, tag)
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"todo/internal/models"
+)
+
+func TestParseQuickAdd(t *testing.T) {
+	// A Wednesday morning, in a timezone behind UTC so that local and UTC
+	// dates differ around midnight
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	now := time.Date(2026, time.March, 4, 10, 0, 0, 0, loc)
+	at := func(month time.Month, day, hour, minute int) *time.Time {
+		due := time.Date(2026, month, day, hour, minute, 0, 0, loc).UTC()
+		return &due
+	}
+
+	tests := []struct {
+		text       string
+		title      string
+		due        *time.Time
+		allDay     bool
+		tags       []string
+		priority   string
+		recurrence string
+		listName   string
+	}{
+		{text: "Buy milk", title: "Buy milk"},
+		{text: "Buy milk tomorrow #errands !high", title: "Buy milk", due: at(time.March, 5, 0, 0), allDay: true,
+			tags: []string{"errands"}, priority: models.PriorityHigh},
+		{text: "#a #b #a note", title: "note", tags: []string{"a", "b"}},
+		{text: "pay rent in 3 days", title: "pay rent", due: at(time.March, 7, 0, 0), allDay: true},
+		{text: "renew passport in a month", title: "renew passport", due: at(time.April, 4, 0, 0), allDay: true},
+		{text: "deploy in 2 hours", title: "deploy", due: at(time.March, 4, 12, 0)},
+		{text: "stretch in 90 mins", title: "stretch", due: at(time.March, 4, 11, 30)},
+		{text: "review next friday", title: "review", due: at(time.March, 6, 0, 0), allDay: true},
+		{text: "review next wednesday", title: "review", due: at(time.March, 11, 0, 0), allDay: true},
+		{text: "plan next week", title: "plan", due: at(time.March, 9, 0, 0), allDay: true},
+		{text: "budget next month", title: "budget", due: at(time.April, 1, 0, 0), allDay: true},
+		{text: "report friday 3pm", title: "report", due: at(time.March, 6, 15, 0)},
+		{text: "report on wed", title: "report", due: at(time.March, 4, 0, 0), allDay: true},
+		{text: "call mom at 5", title: "call mom", due: at(time.March, 4, 17, 0)},
+		{text: "run at 7:30", title: "run", due: at(time.March, 5, 7, 30)},
+		{text: "lunch at noon", title: "lunch", due: at(time.March, 4, 12, 0)},
+		{text: "movie tonight", title: "movie", due: at(time.March, 4, 20, 0)},
+		{text: "call bank tomorrow at 5", title: "call bank", due: at(time.March, 5, 17, 0)},
+		{text: "dentist mar 1", title: "dentist", due: func() *time.Time {
+			due := time.Date(2027, time.March, 1, 0, 0, 0, 0, loc).UTC()
+			return &due
+		}(), allDay: true},
+		{text: "party 14th march", title: "party", due: at(time.March, 14, 0, 0), allDay: true},
+		{text: "taxes @\"Home stuff\" due 2026-04-15", title: "taxes", due: at(time.April, 15, 0, 0), allDay: true,
+			listName: "Home stuff"},
+		{text: "gym every monday", title: "gym", due: at(time.March, 9, 0, 0), allDay: true, recurrence: "FREQ=WEEKLY"},
+		{text: "water plants every 2 weeks", title: "water plants", recurrence: "FREQ=WEEKLY;INTERVAL=2"},
+		{text: "backup every other day !1", title: "backup", recurrence: "FREQ=DAILY;INTERVAL=2", priority: models.PriorityUrgent},
+		{text: "buy 3 apples", title: "buy 3 apples"},
+		{text: "sat meeting", title: "sat meeting"},
+		{text: "feb 30 party", title: "feb 30 party"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			parsed := parseQuickAdd(test.text, now)
+			if parsed.Title != test.title {
+				t.Errorf("title = %q, want %q", parsed.Title, test.title)
+			}
+			switch {
+			case test.due == nil && parsed.DueDate != nil:
+				t.Errorf("due = %v, want none", parsed.DueDate)
+			case test.due != nil && (parsed.DueDate == nil || !parsed.DueDate.Equal(*test.due)):
+				t.Errorf("due = %v, want %v", parsed.DueDate, test.due)
+			}
+			if parsed.AllDay != test.allDay {
+				t.Errorf("all day = %v, want %v", parsed.AllDay, test.allDay)
+			}
+			tags := test.tags
+			if tags == nil {
+				tags = []string{}
+			}
+			if !reflect.DeepEqual(parsed.Tags, tags) {
+				t.Errorf("tags = %q, want %q", parsed.Tags, tags)
+			}
+			if parsed.Priority != test.priority {
+				t.Errorf("priority = %q, want %q", parsed.Priority, test.priority)
+			}
+			if parsed.Recurrence != test.recurrence {
+				t.Errorf("recurrence = %q, want %q", parsed.Recurrence, test.recurrence)
+			}
+			if parsed.ListName != test.listName {
+				t.Errorf("list = %q, want %q", parsed.ListName, test.listName)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo/internal/models"
+)
+
+// Recurrence frequencies, as in iCalendar RRULEs
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+	FreqYearly  = "YEARLY"
+)
+
+// maxRecurrenceInterval caps INTERVAL in a recurrence rule
+const maxRecurrenceInterval = 365
+
+// recurrence is a parsed rule: every Interval days, weeks, months or years
+type recurrence struct {
+	Freq     string
+	Interval int
+}
+
+// parseRecurrence parses the supported subset of RRULE: FREQ with an
+// optional INTERVAL, e.g. FREQ=MONTHLY or FREQ=WEEKLY;INTERVAL=2
+func parseRecurrence(rule string) (recurrence, error) {
+	r := recurrence{Interval: 1}
+	invalid := fmt.Errorf("invalid recurrence: must be like FREQ=WEEKLY;INTERVAL=2 with FREQ one of DAILY, WEEKLY, MONTHLY, YEARLY")
+
+	for _, part := range strings.Split(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:"), ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return r, invalid
+		}
+		switch key {
+		case "FREQ":
+			if value != FreqDaily && value != FreqWeekly && value != FreqMonthly && value != FreqYearly {
+				return r, invalid
+			}
+			r.Freq = value
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 || interval > maxRecurrenceInterval {
+				return r, fmt.Errorf("invalid recurrence: INTERVAL must be between 1 and %d", maxRecurrenceInterval)
+			}
+			r.Interval = interval
+		default:
+			return r, invalid
+		}
+	}
+	if r.Freq == "" {
+		return r, invalid
+	}
+	return r, nil
+}
+
+// String formats the rule in its canonical form
+func (r recurrence) String() string {
+	if r.Interval == 1 {
+		return "FREQ=" + r.Freq
+	}
+	return fmt.Sprintf("FREQ=%s;INTERVAL=%d", r.Freq, r.Interval)
+}
+
+// after returns the occurrence following t
+func (r recurrence) after(t time.Time) time.Time {
+	switch r.Freq {
+	case FreqDaily:
+		return t.AddDate(0, 0, r.Interval)
+	case FreqWeekly:
+		return t.AddDate(0, 0, 7*r.Interval)
+	case FreqMonthly:
+		return t.AddDate(0, r.Interval, 0)
+	default:
+		return t.AddDate(r.Interval, 0, 0)
+	}
+}
+
+// normalizeRecurrence validates the todo's rule and rewrites it canonically
+func normalizeRecurrence(todo *models.Todo) error {
+	if strings.TrimSpace(todo.Recurrence) == "" {
+		todo.Recurrence = ""
+		return nil
+	}
+	r, err := parseRecurrence(todo.Recurrence)
+	if err != nil {
+		return err
+	}
+	todo.Recurrence = r.String()
+	return nil
+}
+
+// spawnNextOccurrence creates the next occurrence of a recurring todo that
+// has just been completed. The copy takes over the rule, so completing the
+// original again does not repeat it twice. The new due date follows the old
+// one and skips occurrences already in the past; without a due date the todo
+// repeats from now. Workflow WIP limits are not applied to occurrences, so a
+// full column never prevents completing a todo. It returns the new todo, for
+// the events of the completion.
+func (s *TodoService) spawnNextOccurrence(tx sqlExecutor, todo *models.Todo, userID int) (*models.Todo, error) {
+	r, err := parseRecurrence(todo.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var dueDate time.Time
+	if todo.DueDate != nil {
+		dueDate = r.after(*todo.DueDate)
+		for i := 0; !dueDate.After(now) && i < 10000; i++ {
+			dueDate = r.after(dueDate)
+		}
+	} else {
+		dueDate = r.after(now).UTC().Truncate(time.Minute)
+	}
+
+	state := ""
+	statePosition := 0
+	if todo.ListID != nil {
+		workflow, err := loadWorkflow(tx, *todo.ListID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading workflow: %v", err)
+		}
+		open, err := stateForNewTodo(workflow, &models.Todo{})
+		if err != nil {
+			return nil, err
+		}
+		count, err := countInState(tx, *todo.ListID, open.Name, 0)
+		if err != nil {
+			return nil, err
+		}
+		state = open.Name
+		statePosition = count + 1
+	}
+
+	nextOrderNo, err := s.getNextOrderNo(tx, todo.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting next order number: %v", err)
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO todos (user_id, org_id, list_id, title, description, completed, priority, estimate, due_date, order_no, state, state_position, recurrence, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, FALSE, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		todo.UserID, s.orgID, todo.ListID, todo.Title, todo.Description, todo.Priority, todo.Estimate, dueDate,
+		nextOrderNo, nullableString(state), statePosition, r.String(), userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating next occurrence: %v", err)
+	}
+	nextID, _ := result.LastInsertId()
+
+	if _, err := tx.Exec("INSERT INTO todo_tags (todo_id, tag) SELECT ?, tag FROM todo_tags WHERE todo_id = ?", nextID, todo.ID); err != nil {
+		return nil, fmt.Errorf("error copying tags: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE todos SET recurrence = NULL WHERE id = ?", todo.ID); err != nil {
+		return nil, fmt.Errorf("error updating recurrence: %v", err)
+	}
+	return loadTodo(tx, int(nextID))
+}
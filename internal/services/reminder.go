@@ -0,0 +1,135 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// reminder is a todo whose reminder is due for a user, at one of their
+// reminder offsets
+type reminder struct {
+	todo     *models.Todo
+	userID   int
+	offset   int
+	settings *emailSettings
+}
+
+// key identifies the reminder; changing the due date makes a new one
+func (r reminder) key() string {
+	return fmt.Sprintf("reminder:%d:%d:%d:%d", r.todo.ID, r.userID, r.todo.DueDate.Unix(), r.offset)
+}
+
+// dueReminders returns the reminders due at now, for the owner and assignees
+// of each open todo due within their reminder offsets. When several offsets
+// have passed, only the nearest one is returned, so a todo created close to
+// its due date gets a single reminder. Users with reminders off and users who
+// can no longer see the todo get none.
+func dueReminders(now time.Time) ([]reminder, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+todoColumns+`
+		FROM todos
+		WHERE completed = FALSE AND archived_at IS NULL AND snoozed_until IS NULL AND due_date > ? AND due_date <= ?`,
+		now, now.Add(models.MaxReminderOffsetMinute*time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	var todos []models.Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		todos = append(todos, *todo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := attachDetails(database.DB, todos); err != nil {
+		return nil, err
+	}
+
+	cache := make(map[int]*emailSettings)
+	var reminders []reminder
+	for i := range todos {
+		todo := &todos[i]
+		recipients := []int{todo.UserID}
+		for _, assignee := range todo.Assignees {
+			if !containsInt(recipients, assignee.UserID) {
+				recipients = append(recipients, assignee.UserID)
+			}
+		}
+		for _, userID := range recipients {
+			settings, ok := cache[userID]
+			if !ok {
+				if settings, err = loadEmailSettings(userID); err != nil {
+					return nil, err
+				}
+				cache[userID] = settings
+			}
+			if !settings.prefs.Reminders {
+				continue
+			}
+			offset := 0
+			for _, o := range settings.prefs.ReminderOffsets {
+				if !todo.DueDate.Add(-time.Duration(o) * time.Minute).After(now) {
+					offset = o
+					break
+				}
+			}
+			if offset == 0 {
+				continue
+			}
+			role, err := todoRole(database.DB, todo, userID)
+			if err != nil {
+				return nil, err
+			}
+			if role != "" {
+				reminders = append(reminders, reminder{todo: todo, userID: userID, offset: offset, settings: settings})
+			}
+		}
+	}
+	return reminders, nil
+}
+
+// workspaceName returns the name of an organization, or "" for the personal
+// workspace
+func workspaceName(orgID int, cache map[int]string) (string, error) {
+	if orgID == 0 {
+		return "", nil
+	}
+	if name, ok := cache[orgID]; ok {
+		return name, nil
+	}
+	var name string
+	if err := database.DB.QueryRow("SELECT name FROM organizations WHERE id = ?", orgID).Scan(&name); err != nil {
+		return "", err
+	}
+	cache[orgID] = name
+	return name, nil
+}
+
+// dueIn describes a duration until a due date, such as "in 2 hours"
+func dueIn(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("in 1 %s", unit)
+		}
+		return fmt.Sprintf("in %d %ss", n, unit)
+	}
+	d = d.Round(time.Minute)
+	switch {
+	case d < time.Minute:
+		return "now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return plural(int(d.Round(time.Hour)/time.Hour), "hour")
+	default:
+		return plural(int(d.Round(24*time.Hour)/(24*time.Hour)), "day")
+	}
+}
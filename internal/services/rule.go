@@ -0,0 +1,632 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// MaxRuleDepth is how many rules deep a chain may go: a rule whose actions
+// trigger another rule is one level deeper. Within a chain, a rule also runs
+// at most once per todo, so rules cannot trigger each other forever.
+const MaxRuleDepth = 3
+
+// DefaultRuleSweepInterval is used when RULE_SWEEP_INTERVAL is not set
+const DefaultRuleSweepInterval = 5 * time.Minute
+
+// ruleExecutionRetention is how long the execution log is kept. Entries of
+// overdue rules are kept as long as the rule, as they record which due dates
+// a rule has fired for.
+const ruleExecutionRetention = 30 * 24 * time.Hour
+
+// Rule execution pages default to DefaultRuleExecutionPageSize entries
+const (
+	DefaultRuleExecutionPageSize = 50
+	MaxRuleExecutionPageSize     = 200
+)
+
+// ruleChain tracks the rules run because of one mutation, see runRules
+type ruleChain struct {
+	depth int
+	fired map[[2]int]bool // rule and todo IDs
+}
+
+// ruleDefinition is the part of a rule stored as JSON
+type ruleDefinition struct {
+	Trigger    models.RuleTrigger    `json:"trigger"`
+	Conditions models.RuleConditions `json:"conditions"`
+	Actions    []models.RuleAction   `json:"actions"`
+}
+
+// RuleService manages a user's automation rules. Rules are personal and
+// belong to the tenant they were created in.
+type RuleService struct {
+	todos *TodoService
+	lists *ListService
+	orgID int
+}
+
+func NewRuleService() *RuleService {
+	return &RuleService{
+		todos: NewTodoService(),
+		lists: NewListService(),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *RuleService) ForOrg(orgID int) *RuleService {
+	return &RuleService{
+		todos: s.todos.ForOrg(orgID),
+		lists: s.lists.ForOrg(orgID),
+		orgID: orgID,
+	}
+}
+
+func (s *RuleService) GetRules(userID int) ([]models.Rule, error) {
+	return queryRules("user_id = ? AND org_id = ? ORDER BY name ASC, id ASC", userID, s.orgID)
+}
+
+func (s *RuleService) GetRule(id, userID int) (*models.Rule, error) {
+	rules, err := queryRules("id = ? AND user_id = ? AND org_id = ?", id, userID, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("rule not found")
+	}
+	return &rules[0], nil
+}
+
+func (s *RuleService) CreateRule(req *models.RuleRequest, userID int) (*models.Rule, error) {
+	if err := s.validateRule(req, userID); err != nil {
+		return nil, err
+	}
+
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM todo_rules WHERE user_id = ? AND org_id = ?", userID, s.orgID).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count >= models.MaxRules {
+		return nil, fmt.Errorf("rule limit reached: at most %d rules", models.MaxRules)
+	}
+
+	definition, err := json.Marshal(ruleDefinition{Trigger: req.Trigger, Conditions: req.Conditions, Actions: req.Actions})
+	if err != nil {
+		return nil, err
+	}
+	result, err := database.DB.Exec(`
+		INSERT INTO todo_rules (user_id, org_id, name, enabled, list_id, trigger_event, definition)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, s.orgID, req.Name, req.Enabled == nil || *req.Enabled, req.ListID, req.Trigger.Event, string(definition))
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	return s.GetRule(int(id), userID)
+}
+
+// UpdateRule replaces a rule
+func (s *RuleService) UpdateRule(id int, req *models.RuleRequest, userID int) (*models.Rule, error) {
+	if _, err := s.GetRule(id, userID); err != nil {
+		return nil, err
+	}
+	if err := s.validateRule(req, userID); err != nil {
+		return nil, err
+	}
+
+	definition, err := json.Marshal(ruleDefinition{Trigger: req.Trigger, Conditions: req.Conditions, Actions: req.Actions})
+	if err != nil {
+		return nil, err
+	}
+	_, err = database.DB.Exec(`
+		UPDATE todo_rules
+		SET name = ?, enabled = ?, list_id = ?, trigger_event = ?, definition = ?
+		WHERE id = ? AND user_id = ? AND org_id = ?`,
+		req.Name, req.Enabled == nil || *req.Enabled, req.ListID, req.Trigger.Event, string(definition), id, userID, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetRule(id, userID)
+}
+
+func (s *RuleService) DeleteRule(id, userID int) error {
+	result, err := database.DB.Exec("DELETE FROM todo_rules WHERE id = ? AND user_id = ? AND org_id = ?", id, userID, s.orgID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("rule not found")
+	}
+	return nil
+}
+
+// GetExecutions returns a page of a rule's execution log, newest first
+func (s *RuleService) GetExecutions(id, userID, page, pageSize int) (*models.RuleExecutionPage, error) {
+	if _, err := s.GetRule(id, userID); err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		return nil, fmt.Errorf("invalid page: must be at least 1")
+	}
+	if pageSize < 1 || pageSize > MaxRuleExecutionPageSize {
+		return nil, fmt.Errorf("invalid page_size: must be between 1 and %d", MaxRuleExecutionPageSize)
+	}
+
+	result := &models.RuleExecutionPage{Executions: []models.RuleExecution{}, Page: page, PageSize: pageSize}
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM rule_executions WHERE rule_id = ?", id).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, rule_id, todo_id, event, status, message, depth, created_at
+		FROM rule_executions
+		WHERE rule_id = ?
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?`, id, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var execution models.RuleExecution
+		var todoID sql.NullInt64
+		err := rows.Scan(&execution.ID, &execution.RuleID, &todoID, &execution.Event, &execution.Status,
+			&execution.Message, &execution.Depth, &execution.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if todoID.Valid {
+			id := int(todoID.Int64)
+			execution.TodoID = &id
+		}
+		result.Executions = append(result.Executions, execution)
+	}
+	return result, rows.Err()
+}
+
+// validateRule trims and checks a rule. The list, if any, must be visible to
+// the user; whether the actions are allowed is checked when they run.
+func (s *RuleService) validateRule(req *models.RuleRequest, userID int) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(req.Name) > 255 {
+		return fmt.Errorf("name must be at most 255 characters")
+	}
+	if req.ListID != nil {
+		if _, err := s.lists.GetByID(*req.ListID, userID); err != nil {
+			return err
+		}
+	}
+
+	trigger := &req.Trigger
+	switch trigger.Event {
+	case EventTodoCreated, EventTodoUpdated, EventTodoCompleted, EventTodoDeleted, EventTodoReordered,
+		EventTodoStateChanged, EventTodoAssigned, EventTodoUnassigned:
+		trigger.Tag, trigger.Days = "", 0
+	case EventTodoTagged:
+		trigger.Days = 0
+		if trigger.Tag != "" {
+			tags, err := normalizeTags([]string{trigger.Tag})
+			if err != nil {
+				return err
+			}
+			trigger.Tag = tags[0]
+		}
+	case EventTodoOverdue:
+		trigger.Tag = ""
+		if trigger.Days < 0 || trigger.Days > 365 {
+			return fmt.Errorf("trigger days must be between 0 and 365")
+		}
+	default:
+		return fmt.Errorf("invalid trigger event: must be one of %s", strings.Join([]string{
+			EventTodoCreated, EventTodoUpdated, EventTodoCompleted, EventTodoDeleted, EventTodoReordered,
+			EventTodoStateChanged, EventTodoAssigned, EventTodoUnassigned, EventTodoTagged, EventTodoOverdue,
+		}, ", "))
+	}
+
+	conditions := &req.Conditions
+	tags, err := normalizeTags(conditions.Tags)
+	if err != nil {
+		return err
+	}
+	conditions.Tags = tags
+	if len(conditions.Tags) == 0 {
+		conditions.Tags = nil
+	}
+	for _, priority := range conditions.Priorities {
+		if !models.IsValidPriority(priority) {
+			return fmt.Errorf("invalid priority %q: must be one of none, low, medium, high, urgent", priority)
+		}
+	}
+	conditions.TitleContains = strings.TrimSpace(conditions.TitleContains)
+
+	if len(req.Actions) == 0 {
+		return fmt.Errorf("a rule needs at least one action")
+	}
+	if len(req.Actions) > models.MaxRuleActions {
+		return fmt.Errorf("a rule can have at most %d actions", models.MaxRuleActions)
+	}
+	for i := range req.Actions {
+		if err := validateRuleAction(&req.Actions[i], trigger.Event); err != nil {
+			return fmt.Errorf("action %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func validateRuleAction(action *models.RuleAction, event string) error {
+	if event == EventTodoDeleted && action.Type != models.ActionCreateTodo {
+		return fmt.Errorf("only %s can run when a todo is deleted", models.ActionCreateTodo)
+	}
+
+	switch action.Type {
+	case models.ActionCreateTodo:
+		action.Title = strings.TrimSpace(action.Title)
+		if action.Title == "" || len(action.Title) > 255 {
+			return fmt.Errorf("title must be between 1 and 255 characters")
+		}
+		todo := models.Todo{Priority: action.Priority, Tags: action.Tags}
+		if err := normalizeTodo(&todo); err != nil {
+			return err
+		}
+		action.Priority, action.Tags = todo.Priority, todo.Tags
+		if action.DueInDays != nil && (*action.DueInDays < 0 || *action.DueInDays > 3650) {
+			return fmt.Errorf("due_in_days must be between 0 and 3650")
+		}
+	case models.ActionMoveToTop, models.ActionComplete:
+	case models.ActionAssign:
+		if action.UserID <= 0 {
+			return fmt.Errorf("user_id is required")
+		}
+	case models.ActionSetPriority:
+		if !models.IsValidPriority(action.Priority) {
+			return fmt.Errorf("invalid priority: must be one of none, low, medium, high, urgent")
+		}
+	case models.ActionAddTag:
+		tags, err := normalizeTags([]string{action.Tag})
+		if err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return fmt.Errorf("tag is required")
+		}
+		action.Tag = tags[0]
+	case models.ActionSetState:
+		action.State = strings.TrimSpace(action.State)
+		if action.State == "" {
+			return fmt.Errorf("state is required")
+		}
+	default:
+		return fmt.Errorf("invalid action type: must be one of %s", strings.Join([]string{
+			models.ActionCreateTodo, models.ActionMoveToTop, models.ActionAssign, models.ActionSetPriority,
+			models.ActionAddTag, models.ActionSetState, models.ActionComplete,
+		}, ", "))
+	}
+	return nil
+}
+
+// runRules runs the enabled rules triggered by events raised through s.
+// Actions run through a copy of s one level deeper in the chain; the events
+// they raise come back here, and rules past MaxRuleDepth or already run for
+// the todo in this chain are skipped. Failures are only logged.
+func runRules(s *TodoService, events []TodoEvent) {
+	chain := s.chain
+	if chain == nil {
+		chain = &ruleChain{fired: make(map[[2]int]bool)}
+	}
+
+	for _, event := range events {
+		if event.Todo == nil {
+			continue
+		}
+		owners, ownerArgs := ruleOwnersOf(event.Todo)
+		args := append([]interface{}{s.orgID, event.Type}, ownerArgs...)
+		rules, err := queryRules("org_id = ? AND trigger_event = ? AND enabled = TRUE AND "+owners+" ORDER BY id ASC", args...)
+		if err != nil {
+			log.Printf("Error loading rules for %s: %v", event.Type, err)
+			continue
+		}
+		for i := range rules {
+			rule := &rules[i]
+			if !ruleApplies(rule, &event) {
+				continue
+			}
+
+			key := [2]int{rule.ID, event.Todo.ID}
+			if chain.fired[key] {
+				continue
+			}
+			chain.fired[key] = true
+			if chain.depth >= MaxRuleDepth {
+				logExecution(rule.ID, &event, chain.depth, models.ExecutionSkipped,
+					fmt.Sprintf("loop protection: rules may only trigger each other %d levels deep", MaxRuleDepth))
+				continue
+			}
+
+			actor := s.ForOrg(rule.OrgID)
+			actor.chain = &ruleChain{depth: chain.depth + 1, fired: chain.fired}
+			status, message := models.ExecutionSucceeded, ""
+			if message, err = runActions(actor, rule, &event); err != nil {
+				status, message = models.ExecutionFailed, err.Error()
+			}
+			logExecution(rule.ID, &event, chain.depth, status, message)
+		}
+	}
+}
+
+// ruleOwnersOf limits the rules a todo's events may trigger to those of the
+// users who can access it: its owner outside lists, the members of an
+// organization for its lists, and the owner and members of a personal list.
+// ruleApplies checks their role on the todo.
+func ruleOwnersOf(todo *models.Todo) (string, []interface{}) {
+	switch {
+	case todo.ListID == nil:
+		return "user_id = ?", []interface{}{todo.UserID}
+	case todo.OrgID != 0:
+		return "user_id IN (SELECT user_id FROM org_members WHERE org_id = ?)", []interface{}{todo.OrgID}
+	default:
+		return "user_id IN (SELECT user_id FROM lists WHERE id = ? UNION SELECT user_id FROM list_members WHERE list_id = ?)",
+			[]interface{}{*todo.ListID, *todo.ListID}
+	}
+}
+
+// ruleApplies checks the rule's list, trigger options and conditions, and
+// that the rule's owner can see the todo
+func ruleApplies(rule *models.Rule, event *TodoEvent) bool {
+	todo := event.Todo
+	if rule.ListID != nil && !sameListID(rule.ListID, todo.ListID) {
+		return false
+	}
+	if event.Type == EventTodoTagged && rule.Trigger.Tag != "" && !containsString(event.Tags, rule.Trigger.Tag) {
+		return false
+	}
+
+	conditions := rule.Conditions
+	for _, tag := range conditions.Tags {
+		if !containsString(todo.Tags, tag) {
+			return false
+		}
+	}
+	if len(conditions.Priorities) > 0 && !containsString(conditions.Priorities, todo.Priority) {
+		return false
+	}
+	if len(conditions.States) > 0 && !containsString(conditions.States, todo.State) {
+		return false
+	}
+	if conditions.Completed != nil && *conditions.Completed != todo.Completed {
+		return false
+	}
+	if conditions.TitleContains != "" && !strings.Contains(strings.ToLower(todo.Title), strings.ToLower(conditions.TitleContains)) {
+		return false
+	}
+
+	role, err := todoRole(database.DB, todo, rule.UserID)
+	return err == nil && role != ""
+}
+
+// runActions runs the actions of a rule in order as its owner, stopping at
+// the first failure. It returns a summary of what was done.
+func runActions(s *TodoService, rule *models.Rule, event *TodoEvent) (string, error) {
+	todo := event.Todo
+	var done []string
+	for i, action := range rule.Actions {
+		var err error
+		switch action.Type {
+		case models.ActionCreateTodo:
+			var created *models.Todo
+			if created, err = createFollowUp(s, rule.UserID, todo, action); err == nil {
+				done = append(done, fmt.Sprintf("created todo %d", created.ID))
+			}
+		case models.ActionMoveToTop:
+			if err = s.ReorderTodos(rule.UserID, todo.ID, 1); err == nil {
+				done = append(done, "moved to top")
+			}
+		case models.ActionAssign:
+			if _, err = s.Assign(todo.ID, []int{action.UserID}, rule.UserID); err == nil {
+				done = append(done, fmt.Sprintf("assigned user %d", action.UserID))
+			}
+		case models.ActionSetState:
+			if _, err = s.TransitionTodo(todo.ID, rule.UserID, action.State, 0); err == nil {
+				done = append(done, "moved to "+action.State)
+			}
+		case models.ActionSetPriority, models.ActionAddTag, models.ActionComplete:
+			err = updateFromRule(s, rule.UserID, todo.ID, action)
+			if err == nil {
+				done = append(done, action.Type)
+			}
+		}
+		if err != nil {
+			return "", fmt.Errorf("action %d (%s): %v", i+1, action.Type, err)
+		}
+	}
+	return strings.Join(done, "; "), nil
+}
+
+// createFollowUp creates the todo of a create_todo action, due the given
+// number of days after today in the owner's timezone
+func createFollowUp(s *TodoService, ownerID int, trigger *models.Todo, action models.RuleAction) (*models.Todo, error) {
+	variables := map[string]string{"title": trigger.Title}
+	todo := &models.Todo{
+		ListID:      trigger.ListID,
+		Title:       strings.TrimSpace(fillPlaceholders(action.Title, variables)),
+		Description: fillPlaceholders(action.Description, variables),
+		Priority:    action.Priority,
+		Tags:        action.Tags,
+	}
+	if action.ListID != nil {
+		todo.ListID = action.ListID
+	}
+	todo.Title = truncate(todo.Title, 255)
+	if action.DueInDays != nil {
+		loc, err := userLocation(ownerID)
+		if err != nil {
+			return nil, err
+		}
+		due := localMidnight(time.Now().In(loc)).AddDate(0, 0, *action.DueInDays).UTC()
+		todo.DueDate = &due
+	}
+	return s.Create(todo, ownerID)
+}
+
+// updateFromRule changes one field of a todo through Update, keeping the rest
+func updateFromRule(s *TodoService, ownerID, todoID int, action models.RuleAction) error {
+	todo, err := s.GetByID(todoID, ownerID)
+	if err != nil {
+		return err
+	}
+	todo.ListID = nil // keeps the list
+	switch action.Type {
+	case models.ActionSetPriority:
+		todo.Priority = action.Priority
+	case models.ActionAddTag:
+		if containsString(todo.Tags, action.Tag) {
+			return nil
+		}
+		todo.Tags = append(todo.Tags, action.Tag)
+	case models.ActionComplete:
+		if todo.Completed {
+			return nil
+		}
+		todo.Completed = true
+		todo.State = ""
+	}
+	_, err = s.Update(todoID, todo, ownerID)
+	return err
+}
+
+// logExecution records the outcome of a rule in its execution log
+func logExecution(ruleID int, event *TodoEvent, depth int, status, message string) {
+	var dueDate interface{}
+	if event.Type == EventTodoOverdue {
+		dueDate = event.Todo.DueDate
+	}
+	message = truncate(message, 1000)
+	_, err := database.DB.Exec(`
+		INSERT INTO rule_executions (rule_id, todo_id, event, status, message, depth, due_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		ruleID, event.Todo.ID, event.Type, status, message, depth, dueDate)
+	if err != nil {
+		log.Printf("Error logging execution of rule %d: %v", ruleID, err)
+	}
+}
+
+// SweepOverdue raises todo.overdue for the open todos that have been overdue
+// for at least the days of each overdue rule, once per due date, and prunes
+// the execution logs. It returns the number of todos the rules fired for.
+func (s *RuleService) SweepOverdue() (int, error) {
+	_, err := database.DB.Exec("DELETE FROM rule_executions WHERE created_at < ? AND due_date IS NULL",
+		time.Now().Add(-ruleExecutionRetention).UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error pruning execution logs: %v", err)
+	}
+
+	rules, err := queryRules("trigger_event = ? AND enabled = TRUE ORDER BY id ASC", EventTodoOverdue)
+	if err != nil {
+		return 0, err
+	}
+
+	fired := 0
+	for i := range rules {
+		rule := &rules[i]
+		todos := s.todos.ForOrg(rule.OrgID)
+		where, args, err := todos.visibleTo(rule.UserID)
+		if err != nil {
+			return fired, err
+		}
+		where += ` AND completed = FALSE AND snoozed_until IS NULL AND due_date <= ?
+			AND NOT EXISTS (SELECT 1 FROM rule_executions e WHERE e.rule_id = ? AND e.todo_id = todos.id AND e.due_date = todos.due_date)`
+		args = append(args, time.Now().AddDate(0, 0, -rule.Trigger.Days).UTC(), rule.ID)
+		if rule.ListID != nil {
+			where += " AND list_id = ?"
+			args = append(args, *rule.ListID)
+		}
+
+		overdue, err := todos.queryTodos(where, args, rule.UserID)
+		if err != nil {
+			return fired, fmt.Errorf("error finding overdue todos for rule %d: %v", rule.ID, err)
+		}
+		for j := range overdue {
+			event := TodoEvent{Type: EventTodoOverdue, Todo: &overdue[j], ActorID: rule.UserID}
+			if !ruleApplies(rule, &event) {
+				continue
+			}
+			actor := todos.ForOrg(rule.OrgID)
+			actor.chain = &ruleChain{depth: 1, fired: map[[2]int]bool{{rule.ID, overdue[j].ID}: true}}
+			status, message := models.ExecutionSucceeded, ""
+			if message, err = runActions(actor, rule, &event); err != nil {
+				status, message = models.ExecutionFailed, err.Error()
+			}
+			logExecution(rule.ID, &event, 0, status, message)
+			fired++
+		}
+	}
+	return fired, nil
+}
+
+// RunOverdueSweeper calls SweepOverdue every RULE_SWEEP_INTERVAL. It never
+// returns.
+func (s *RuleService) RunOverdueSweeper() {
+	interval := envDuration("RULE_SWEEP_INTERVAL", DefaultRuleSweepInterval)
+	for {
+		fired, err := s.SweepOverdue()
+		if err != nil {
+			log.Println("Overdue rule sweep failed:", err)
+		} else if fired > 0 {
+			log.Printf("Overdue rule sweep fired for %d todos", fired)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func queryRules(where string, args ...interface{}) ([]models.Rule, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, org_id, name, enabled, list_id, definition, created_at, updated_at
+		FROM todo_rules
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.Rule{}
+	for rows.Next() {
+		var rule models.Rule
+		var listID sql.NullInt64
+		var definition string
+		err := rows.Scan(&rule.ID, &rule.UserID, &rule.OrgID, &rule.Name, &rule.Enabled, &listID, &definition,
+			&rule.CreatedAt, &rule.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if listID.Valid {
+			id := int(listID.Int64)
+			rule.ListID = &id
+		}
+		var def ruleDefinition
+		if err := json.Unmarshal([]byte(definition), &def); err != nil {
+			return nil, fmt.Errorf("error reading rule %d: %v", rule.ID, err)
+		}
+		rule.Trigger, rule.Conditions, rule.Actions = def.Trigger, def.Conditions, def.Actions
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -57,6 +57,7 @@ func (s *AuthService) Register(req *models.RegisterRequest) (*models.AuthRespons
 	if err != nil {
 		return nil, err
 	}
+	recordAccountActivity(models.ActivityUserRegistered, user.ID, models.ActivityDetails{})
 
 	// Generate JWT token
 	token, err := s.generateJWTToken(user)
@@ -64,9 +65,16 @@ func (s *AuthService) Register(req *models.RegisterRequest) (*models.AuthRespons
 		return nil, fmt.Errorf("error generating token: %v", err)
 	}
 
+	// A user can belong to several organizations
+	organizations, err := userOrganizations(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching organizations: %v", err)
+	}
+
 	return &models.AuthResponse{
-		Token: token,
-		User:  *user,
+		Token:         token,
+		User:          *user,
+		Organizations: organizations,
 	}, nil
 }
 
@@ -99,6 +107,7 @@ func (s *AuthService) Login(req *models.LoginRequest) (*models.AuthResponse, err
 	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
 		return nil, fmt.Errorf("incorrect password")
 	}
+	recordAccountActivity(models.ActivityUserLoggedIn, user.ID, models.ActivityDetails{})
 
 	// Generate JWT token
 	token, err := s.generateJWTToken(user)
@@ -106,9 +115,16 @@ func (s *AuthService) Login(req *models.LoginRequest) (*models.AuthResponse, err
 		return nil, fmt.Errorf("error generating token: %v", err)
 	}
 
+	// A user can belong to several organizations
+	organizations, err := userOrganizations(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching organizations: %v", err)
+	}
+
 	return &models.AuthResponse{
-		Token: token,
-		User:  *user,
+		Token:         token,
+		User:          *user,
+		Organizations: organizations,
 	}, nil
 }
 
@@ -138,6 +154,7 @@ func (s *AuthService) Logout(tokenString string) error {
 	if err != nil {
 		return fmt.Errorf("error blacklisting token: %v", err)
 	}
+	recordAccountActivity(models.ActivityUserLoggedOut, int(userID), models.ActivityDetails{})
 
 	return nil
 }
@@ -213,9 +230,11 @@ func (s *AuthService) ValidateToken(tokenString string) (*models.UserInfo, error
 
 func (s *AuthService) getUserByID(id int) (*models.UserInfo, error) {
 	var user models.User
+	var defaultOrgID sql.NullInt64
+	var timezone string
 	err := database.DB.QueryRow(
-		"SELECT id, username, email, created_at, updated_at FROM users WHERE id = ?", id,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+		"SELECT id, username, email, default_org_id, timezone, created_at, updated_at FROM users WHERE id = ?", id,
+	).Scan(&user.ID, &user.Username, &user.Email, &defaultOrgID, &timezone, &user.CreatedAt, &user.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("user not found")
@@ -224,20 +243,16 @@ func (s *AuthService) getUserByID(id int) (*models.UserInfo, error) {
 		return nil, err
 	}
 
-	return &models.UserInfo{
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-	}, nil
+	return newUserInfo(&user, defaultOrgID, timezone), nil
 }
 
 func (s *AuthService) getUserByEmail(email string) (*models.UserInfo, error) {
 	var user models.User
+	var defaultOrgID sql.NullInt64
+	var timezone string
 	err := database.DB.QueryRow(
-		"SELECT id, username, email, created_at, updated_at FROM users WHERE email = ?", email,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+		"SELECT id, username, email, default_org_id, timezone, created_at, updated_at FROM users WHERE email = ?", email,
+	).Scan(&user.ID, &user.Username, &user.Email, &defaultOrgID, &timezone, &user.CreatedAt, &user.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("user not found")
@@ -246,13 +261,74 @@ func (s *AuthService) getUserByEmail(email string) (*models.UserInfo, error) {
 		return nil, err
 	}
 
-	return &models.UserInfo{
+	return newUserInfo(&user, defaultOrgID, timezone), nil
+}
+
+func newUserInfo(user *models.User, defaultOrgID sql.NullInt64, timezone string) *models.UserInfo {
+	info := &models.UserInfo{
 		ID:        user.ID,
 		Username:  user.Username,
 		Email:     user.Email,
+		Timezone:  timezone,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
-	}, nil
+	}
+	if defaultOrgID.Valid {
+		id := int(defaultOrgID.Int64)
+		info.DefaultOrgID = &id
+	}
+	return info
+}
+
+// GetMe returns the user together with every organization they belong to
+func (s *AuthService) GetMe(userID int) (*models.MeResponse, error) {
+	user, err := s.getUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	organizations, err := userOrganizations(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching organizations: %v", err)
+	}
+
+	return &models.MeResponse{User: *user, Organizations: organizations}, nil
+}
+
+// SetDefaultOrg chooses the organization clients open first. A nil orgID
+// selects the personal workspace.
+func (s *AuthService) SetDefaultOrg(userID int, orgID *int) (*models.UserInfo, error) {
+	if orgID != nil {
+		var count int
+		err := database.DB.QueryRow(
+			"SELECT COUNT(*) FROM org_members WHERE org_id = ? AND user_id = ?", *orgID, userID,
+		).Scan(&count)
+		if err != nil {
+			return nil, fmt.Errorf("error checking organization: %v", err)
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("organization not found")
+		}
+	}
+
+	if _, err := database.DB.Exec("UPDATE users SET default_org_id = ? WHERE id = ?", orgID, userID); err != nil {
+		return nil, fmt.Errorf("error updating default organization: %v", err)
+	}
+	recordAccountActivity(models.ActivityUserDefaultOrgChanged, userID, models.ActivityDetails{})
+	return s.getUserByID(userID)
+}
+
+// SetTimezone sets the IANA timezone used for the user's reports
+func (s *AuthService) SetTimezone(userID int, timezone string) (*models.UserInfo, error) {
+	if _, err := time.LoadLocation(timezone); timezone == "" || err != nil {
+		return nil, fmt.Errorf("invalid timezone: %s", timezone)
+	}
+
+	if _, err := database.DB.Exec("UPDATE users SET timezone = ? WHERE id = ?", timezone, userID); err != nil {
+		return nil, fmt.Errorf("error updating timezone: %v", err)
+	}
+	recordAccountActivity(models.ActivityUserTimezoneChanged, userID, models.ActivityDetails{Timezone: timezone})
+	return s.getUserByID(userID)
 }
 
 func (s *AuthService) generateJWTToken(user *models.UserInfo) (string, error) {
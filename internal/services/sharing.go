@@ -0,0 +1,351 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// SharingService manages list members and invitations. Access is checked on
+// every request, so removing a member or changing a role applies immediately.
+type SharingService struct {
+	lists *ListService
+}
+
+func NewSharingService() *SharingService {
+	return &SharingService{
+		lists: NewListService(),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *SharingService) ForOrg(orgID int) *SharingService {
+	return &SharingService{lists: s.lists.ForOrg(orgID)}
+}
+
+// GetMembers returns the owner followed by the members of a list
+func (s *SharingService) GetMembers(listID, userID int) ([]models.ListMember, error) {
+	list, err := s.lists.GetByID(listID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []models.ListMember{}
+	var owner models.ListMember
+	err = database.DB.QueryRow("SELECT id, username FROM users WHERE id = ?", list.UserID).
+		Scan(&owner.UserID, &owner.Username)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching list owner: %v", err)
+	}
+	owner.ListID = list.ID
+	owner.Role = models.RoleOwner
+	owner.CreatedAt = list.CreatedAt
+	members = append(members, owner)
+
+	rows, err := database.DB.Query(`
+		SELECT m.list_id, m.user_id, u.username, m.role, m.created_at
+		FROM list_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.list_id = ?
+		ORDER BY m.created_at ASC`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member models.ListMember
+		if err := rows.Scan(&member.ListID, &member.UserID, &member.Username, &member.Role, &member.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// Invite invites a registered user to a list. The invitee becomes a member
+// once they accept.
+func (s *SharingService) Invite(listID int, req *models.InviteRequest, userID int) (*models.ListInvitation, error) {
+	list, err := s.lists.getWithRole(listID, userID, models.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if !models.IsValidMemberRole(req.Role) {
+		return nil, fmt.Errorf("invalid role: must be one of viewer, editor, admin")
+	}
+
+	var inviteeID int
+	username, email := strings.TrimSpace(req.Username), strings.TrimSpace(req.Email)
+	switch {
+	case username != "":
+		err = database.DB.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&inviteeID)
+	case email != "":
+		err = database.DB.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&inviteeID)
+	default:
+		return nil, fmt.Errorf("username or email is required")
+	}
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding user: %v", err)
+	}
+
+	if inviteeID == list.UserID {
+		return nil, fmt.Errorf("user already has access to this list")
+	}
+
+	// Organization lists can only be shared within the organization
+	if list.OrgID != 0 {
+		access, err := loadOrgAccess(database.DB, list.OrgID, inviteeID)
+		if err != nil {
+			return nil, err
+		}
+		if access.Role == "" {
+			return nil, fmt.Errorf("user is not a member of this organization")
+		}
+	}
+	if _, err := s.memberRole(listID, inviteeID); err == nil {
+		return nil, fmt.Errorf("user is already a member of this list")
+	}
+
+	var pending int
+	err = database.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM list_invitations
+		WHERE list_id = ? AND invitee_id = ? AND status = ?`,
+		listID, inviteeID, models.InvitationPending).Scan(&pending)
+	if err != nil {
+		return nil, fmt.Errorf("error checking invitations: %v", err)
+	}
+	if pending > 0 {
+		return nil, fmt.Errorf("user already has a pending invitation")
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO list_invitations (list_id, inviter_id, invitee_id, role, status)
+		VALUES (?, ?, ?, ?, ?)`,
+		listID, userID, inviteeID, req.Role, models.InvitationPending)
+	if err != nil {
+		return nil, fmt.Errorf("error creating invitation: %v", err)
+	}
+
+	id, _ := result.LastInsertId()
+	return s.getInvitation(int(id))
+}
+
+// GetListInvitations returns the pending invitations of a list
+func (s *SharingService) GetListInvitations(listID, userID int) ([]models.ListInvitation, error) {
+	if _, err := s.lists.getWithRole(listID, userID, models.RoleAdmin); err != nil {
+		return nil, err
+	}
+	return s.queryInvitations("i.list_id = ? AND i.status = ?", listID, models.InvitationPending)
+}
+
+// CancelInvitation withdraws a pending invitation
+func (s *SharingService) CancelInvitation(listID, invitationID, userID int) error {
+	if _, err := s.lists.getWithRole(listID, userID, models.RoleAdmin); err != nil {
+		return err
+	}
+
+	result, err := database.DB.Exec(`
+		DELETE FROM list_invitations
+		WHERE id = ? AND list_id = ? AND status = ?`,
+		invitationID, listID, models.InvitationPending)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("invitation not found")
+	}
+	return nil
+}
+
+// GetMyInvitations returns the pending invitations addressed to the user
+func (s *SharingService) GetMyInvitations(userID int) ([]models.ListInvitation, error) {
+	return s.queryInvitations("i.invitee_id = ? AND i.status = ?", userID, models.InvitationPending)
+}
+
+// AcceptInvitation adds the invitee to the list with the invited role
+func (s *SharingService) AcceptInvitation(invitationID, userID int) (*models.ListInvitation, error) {
+	invitation, err := s.pendingInvitationFor(invitationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO list_members (list_id, user_id, role)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE role = VALUES(role)`,
+		invitation.ListID, userID, invitation.Role)
+	if err != nil {
+		return nil, fmt.Errorf("error adding member: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE list_invitations
+		SET status = ?, responded_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, models.InvitationAccepted, invitationID)
+	if err != nil {
+		return nil, fmt.Errorf("error updating invitation: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.getInvitation(invitationID)
+}
+
+// DeclineInvitation rejects an invitation without granting access
+func (s *SharingService) DeclineInvitation(invitationID, userID int) (*models.ListInvitation, error) {
+	if _, err := s.pendingInvitationFor(invitationID, userID); err != nil {
+		return nil, err
+	}
+
+	_, err := database.DB.Exec(`
+		UPDATE list_invitations
+		SET status = ?, responded_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, models.InvitationDeclined, invitationID)
+	if err != nil {
+		return nil, fmt.Errorf("error updating invitation: %v", err)
+	}
+	return s.getInvitation(invitationID)
+}
+
+// UpdateMemberRole changes the role of an existing member
+func (s *SharingService) UpdateMemberRole(listID, memberID int, role string, userID int) error {
+	if _, err := s.lists.getWithRole(listID, userID, models.RoleAdmin); err != nil {
+		return err
+	}
+	if !models.IsValidMemberRole(role) {
+		return fmt.Errorf("invalid role: must be one of viewer, editor, admin")
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE list_members
+		SET role = ?
+		WHERE list_id = ? AND user_id = ?`, role, listID, memberID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		// MySQL reports 0 affected rows when the role is unchanged
+		if _, err := s.memberRole(listID, memberID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveMember revokes a member's access. Admins can remove anyone but the
+// owner; every member can remove themselves to leave a list.
+func (s *SharingService) RemoveMember(listID, memberID, userID int) error {
+	required := models.RoleAdmin
+	if memberID == userID {
+		required = models.RoleViewer
+	}
+	if _, err := s.lists.getWithRole(listID, userID, required); err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM list_members WHERE list_id = ? AND user_id = ?", listID, memberID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("member not found")
+	}
+
+	// The former member can no longer work on the list's todos
+	events, err := unassignWithoutAccess(tx, "t.list_id = ? AND a.user_id = ?", listID, memberID)
+	if err != nil {
+		return err
+	}
+	todos := s.lists.todos()
+	if err := todos.stage(tx, events...); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	todos.emit(events...)
+	return nil
+}
+
+func (s *SharingService) memberRole(listID, memberID int) (string, error) {
+	var role string
+	err := database.DB.QueryRow("SELECT role FROM list_members WHERE list_id = ? AND user_id = ?", listID, memberID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("member not found")
+	}
+	return role, err
+}
+
+func (s *SharingService) pendingInvitationFor(invitationID, userID int) (*models.ListInvitation, error) {
+	invitation, err := s.getInvitation(invitationID)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.InviteeID != userID {
+		return nil, fmt.Errorf("invitation not found")
+	}
+	if invitation.Status != models.InvitationPending {
+		return nil, fmt.Errorf("invitation is already %s", invitation.Status)
+	}
+	return invitation, nil
+}
+
+func (s *SharingService) getInvitation(id int) (*models.ListInvitation, error) {
+	invitations, err := s.queryInvitations("i.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(invitations) == 0 {
+		return nil, fmt.Errorf("invitation not found")
+	}
+	return &invitations[0], nil
+}
+
+func (s *SharingService) queryInvitations(where string, args ...interface{}) ([]models.ListInvitation, error) {
+	rows, err := database.DB.Query(`
+		SELECT i.id, i.list_id, l.name, i.inviter_id, i.invitee_id, i.role, i.status, i.created_at, i.responded_at
+		FROM list_invitations i
+		JOIN lists l ON l.id = i.list_id
+		WHERE `+where+`
+		ORDER BY i.created_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []models.ListInvitation{}
+	for rows.Next() {
+		var invitation models.ListInvitation
+		var respondedAt sql.NullTime
+		err := rows.Scan(&invitation.ID, &invitation.ListID, &invitation.ListName, &invitation.InviterID,
+			&invitation.InviteeID, &invitation.Role, &invitation.Status, &invitation.CreatedAt, &respondedAt)
+		if err != nil {
+			return nil, err
+		}
+		if respondedAt.Valid {
+			invitation.RespondedAt = &respondedAt.Time
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// SmartListService manages saved filters over the todos a user can see.
+// Smart lists are personal and belong to the tenant they were created in.
+type SmartListService struct {
+	todos *TodoService
+	orgID int
+}
+
+func NewSmartListService() *SmartListService {
+	return &SmartListService{
+		todos: NewTodoService(),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *SmartListService) ForOrg(orgID int) *SmartListService {
+	return &SmartListService{
+		todos: s.todos.ForOrg(orgID),
+		orgID: orgID,
+	}
+}
+
+// GetSmartLists returns the user's smart lists by name, each with the number
+// of todos it currently matches
+func (s *SmartListService) GetSmartLists(userID int) ([]models.SmartList, error) {
+	smartLists, err := s.query("user_id = ? AND org_id = ? ORDER BY name ASC, id ASC", userID, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := userLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range smartLists {
+		where, args, err := s.compile(&smartLists[i].Definition, userID, loc)
+		if err != nil {
+			return nil, err
+		}
+		var count int
+		if err := database.DB.QueryRow("SELECT COUNT(*) FROM todos WHERE "+where, args...).Scan(&count); err != nil {
+			return nil, fmt.Errorf("error counting todos of %s: %v", smartLists[i].Name, err)
+		}
+		smartLists[i].Count = &count
+	}
+	return smartLists, nil
+}
+
+func (s *SmartListService) GetSmartList(id, userID int) (*models.SmartList, error) {
+	smartLists, err := s.query("id = ? AND user_id = ? AND org_id = ?", id, userID, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(smartLists) == 0 {
+		return nil, fmt.Errorf("smart list not found")
+	}
+	return &smartLists[0], nil
+}
+
+func (s *SmartListService) CreateSmartList(req *models.SmartListRequest, userID int) (*models.SmartList, error) {
+	name, definition, err := validateSmartList(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int
+	err = database.DB.QueryRow("SELECT COUNT(*) FROM smart_lists WHERE user_id = ? AND org_id = ?", userID, s.orgID).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count >= models.MaxSmartLists {
+		return nil, fmt.Errorf("smart list limit reached: at most %d smart lists", models.MaxSmartLists)
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO smart_lists (user_id, org_id, name, definition, version)
+		VALUES (?, ?, ?, ?, ?)`, userID, s.orgID, name, definition, models.SmartListVersion)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	return s.GetSmartList(int(id), userID)
+}
+
+// UpdateSmartList replaces the name and definition of a smart list. The
+// definition is saved in the current version.
+func (s *SmartListService) UpdateSmartList(id int, req *models.SmartListRequest, userID int) (*models.SmartList, error) {
+	if _, err := s.GetSmartList(id, userID); err != nil {
+		return nil, err
+	}
+	name, definition, err := validateSmartList(req)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE smart_lists
+		SET name = ?, definition = ?, version = ?
+		WHERE id = ? AND user_id = ? AND org_id = ?`,
+		name, definition, models.SmartListVersion, id, userID, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSmartList(id, userID)
+}
+
+func (s *SmartListService) DeleteSmartList(id, userID int) error {
+	result, err := database.DB.Exec("DELETE FROM smart_lists WHERE id = ? AND user_id = ? AND org_id = ?", id, userID, s.orgID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("smart list not found")
+	}
+	return nil
+}
+
+// GetTodos evaluates a smart list, returning the matching todos in the order
+// of its definition
+func (s *SmartListService) GetTodos(id, userID int) ([]models.Todo, error) {
+	smartList, err := s.GetSmartList(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := userLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+	where, args, err := s.compile(&smartList.Definition, userID, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	todos, err := s.todos.queryTodos(where, args, userID)
+	if err != nil {
+		return nil, err
+	}
+	switch smartList.Definition.Sort {
+	case SortPriority:
+		sortByPriority(todos)
+	case SortSmart:
+		sortBySmartScore(todos, s.todos.weights, time.Now())
+	}
+	if todos == nil {
+		todos = []models.Todo{}
+	}
+	return todos, nil
+}
+
+// compile turns a definition into a condition on the todos table, limited to
+// the todos the user can see
+func (s *SmartListService) compile(def *models.SmartListDefinition, userID int, loc *time.Location) (string, []interface{}, error) {
+	where, args, err := s.todos.visibleTo(userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !def.IncludeSnoozed {
+		where += " AND snoozed_until IS NULL"
+	}
+	if def.Completed != nil {
+		where += " AND completed = ?"
+		args = append(args, *def.Completed)
+	}
+	for _, tag := range def.Tags {
+		where += " AND id IN (SELECT todo_id FROM todo_tags WHERE tag = ?)"
+		args = append(args, tag)
+	}
+	if len(def.ListIDs) > 0 {
+		where += " AND list_id IN (" + inPlaceholders(len(def.ListIDs)) + ")"
+		for _, id := range def.ListIDs {
+			args = append(args, id)
+		}
+	}
+	if len(def.Priorities) > 0 {
+		where += " AND priority IN (" + inPlaceholders(len(def.Priorities)) + ")"
+		for _, priority := range def.Priorities {
+			args = append(args, priority)
+		}
+	}
+	if len(def.States) > 0 {
+		where += " AND state IN (" + inPlaceholders(len(def.States)) + ")"
+		for _, state := range def.States {
+			args = append(args, state)
+		}
+	}
+	if def.AssignedToMe {
+		where += " AND id IN (SELECT todo_id FROM todo_assignees WHERE user_id = ?)"
+		args = append(args, userID)
+	}
+	if def.Search != "" {
+		pattern := "%" + escapeLike(def.Search) + "%"
+		where += " AND (title LIKE ? OR description LIKE ?)"
+		args = append(args, pattern, pattern)
+	}
+
+	if def.Due == models.DueNone {
+		where += " AND due_date IS NULL"
+	} else if def.Due != "" {
+		start, end := dueRange(def.Due, loc)
+		where += " AND due_date < ?"
+		args = append(args, end.UTC())
+		if !start.IsZero() {
+			where += " AND due_date >= ?"
+			args = append(args, start.UTC())
+		}
+	}
+	return where, args, nil
+}
+
+// dueRange returns the local range [start, end) of a due window; start is
+// zero for overdue, which has no lower bound. Weeks start on Monday.
+func dueRange(due string, loc *time.Location) (time.Time, time.Time) {
+	today := localMidnight(time.Now().In(loc))
+	switch due {
+	case models.DueOverdue:
+		return time.Time{}, today
+	case models.DueTomorrow:
+		return today.AddDate(0, 0, 1), today.AddDate(0, 0, 2)
+	case models.DueThisWeek:
+		monday := bucketStart(today, models.ReportByWeek)
+		return monday, monday.AddDate(0, 0, 7)
+	case models.DueNext7Days:
+		return today, today.AddDate(0, 0, 7)
+	default:
+		return today, today.AddDate(0, 0, 1)
+	}
+}
+
+// query loads smart lists matching the condition, upgrading their definitions
+func (s *SmartListService) query(where string, args ...interface{}) ([]models.SmartList, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, org_id, name, definition, version, created_at, updated_at
+		FROM smart_lists
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	smartLists := []models.SmartList{}
+	for rows.Next() {
+		var smartList models.SmartList
+		var definition string
+		var version int
+		err := rows.Scan(&smartList.ID, &smartList.UserID, &smartList.OrgID, &smartList.Name, &definition, &version,
+			&smartList.CreatedAt, &smartList.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(definition), &smartList.Definition); err != nil {
+			return nil, fmt.Errorf("error reading smart list %d: %v", smartList.ID, err)
+		}
+		if err := upgradeDefinition(&smartList.Definition, version); err != nil {
+			return nil, fmt.Errorf("error reading smart list %d: %v", smartList.ID, err)
+		}
+		smartLists = append(smartLists, smartList)
+	}
+	return smartLists, rows.Err()
+}
+
+// upgradeDefinition brings a definition stored in an older version up to the
+// current one. A new version adds a step converting from the one before it;
+// fields that are only added need none, as empty fields match every todo.
+func upgradeDefinition(def *models.SmartListDefinition, version int) error {
+	if version < 1 || version > models.SmartListVersion {
+		return fmt.Errorf("unsupported definition version %d", version)
+	}
+	def.Version = models.SmartListVersion
+	return nil
+}
+
+// validateSmartList checks a request and returns the trimmed name and the
+// normalized definition as stored
+func validateSmartList(req *models.SmartListRequest) (string, string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return "", "", fmt.Errorf("name is required")
+	}
+	if len(name) > 255 {
+		return "", "", fmt.Errorf("name must be at most 255 characters")
+	}
+	if len(bytes.TrimSpace(req.Definition)) == 0 || bytes.Equal(bytes.TrimSpace(req.Definition), []byte("null")) {
+		return "", "", fmt.Errorf("definition is required")
+	}
+
+	var def models.SmartListDefinition
+	decoder := json.NewDecoder(bytes.NewReader(req.Definition))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&def); err != nil {
+		return "", "", fmt.Errorf("invalid definition: %v", err)
+	}
+	version := def.Version
+	if version == 0 {
+		version = models.SmartListVersion
+	}
+	if err := upgradeDefinition(&def, version); err != nil {
+		return "", "", fmt.Errorf("invalid definition: %v", err)
+	}
+	if err := normalizeDefinition(&def); err != nil {
+		return "", "", fmt.Errorf("invalid definition: %v", err)
+	}
+
+	stored, err := json.Marshal(def)
+	if err != nil {
+		return "", "", err
+	}
+	return name, string(stored), nil
+}
+
+// normalizeDefinition validates the conditions of a definition, normalizing
+// tags the same way as on todos
+func normalizeDefinition(def *models.SmartListDefinition) error {
+	tags, err := normalizeTags(def.Tags)
+	if err != nil {
+		return err
+	}
+	def.Tags = tags
+	if len(def.Tags) == 0 {
+		def.Tags = nil
+	}
+
+	if len(def.ListIDs) > 100 {
+		return fmt.Errorf("at most 100 list_ids")
+	}
+	for _, id := range def.ListIDs {
+		if id <= 0 {
+			return fmt.Errorf("list_ids must be list IDs")
+		}
+	}
+
+	for _, priority := range def.Priorities {
+		if !models.IsValidPriority(priority) {
+			return fmt.Errorf("invalid priority %q: must be one of none, low, medium, high, urgent", priority)
+		}
+	}
+
+	if len(def.States) > 50 {
+		return fmt.Errorf("at most 50 states")
+	}
+	for i, state := range def.States {
+		def.States[i] = strings.TrimSpace(state)
+		if def.States[i] == "" || len(def.States[i]) > 32 {
+			return fmt.Errorf("states must be between 1 and 32 characters")
+		}
+	}
+
+	switch def.Due {
+	case "", models.DueNone, models.DueOverdue, models.DueToday, models.DueTomorrow, models.DueThisWeek, models.DueNext7Days:
+	default:
+		return fmt.Errorf("due must be one of %s, %s, %s, %s, %s, %s", models.DueNone, models.DueOverdue,
+			models.DueToday, models.DueTomorrow, models.DueThisWeek, models.DueNext7Days)
+	}
+
+	def.Search = strings.TrimSpace(def.Search)
+	if len(def.Search) > 255 {
+		return fmt.Errorf("search must be at most 255 characters")
+	}
+
+	if def.Sort != "" && def.Sort != SortManual && def.Sort != SortPriority && def.Sort != SortSmart {
+		return fmt.Errorf("sort must be one of %s, %s, %s", SortManual, SortPriority, SortSmart)
+	}
+	return nil
+}
+
+// escapeLike escapes the LIKE wildcards in a search term
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(term)
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"todo/internal/models"
+)
+
+// Sort modes accepted by GetAllSorted
+const (
+	SortManual   = "manual"
+	SortPriority = "priority"
+	SortSmart    = "smart"
+)
+
+// SmartSortWeights controls how much each factor contributes to a todo's
+// smart score. Every factor is normalized to [0, 1] before weighting.
+type SmartSortWeights struct {
+	Priority float64 // higher priority scores higher
+	DueDate  float64 // overdue and soon-due todos score higher
+	Age      float64 // older todos slowly bubble up
+	Manual   float64 // todos higher in the manual order score higher
+}
+
+// DefaultSmartSortWeights are used for any weight not set in the environment
+var DefaultSmartSortWeights = SmartSortWeights{
+	Priority: 0.4,
+	DueDate:  0.3,
+	Age:      0.1,
+	Manual:   0.2,
+}
+
+// LoadSmartSortWeights reads the smart sort weights from environment variables
+func LoadSmartSortWeights() SmartSortWeights {
+	weights := DefaultSmartSortWeights
+	weights.Priority = envFloat("SMART_SORT_PRIORITY_WEIGHT", weights.Priority)
+	weights.DueDate = envFloat("SMART_SORT_DUE_WEIGHT", weights.DueDate)
+	weights.Age = envFloat("SMART_SORT_AGE_WEIGHT", weights.Age)
+	weights.Manual = envFloat("SMART_SORT_MANUAL_WEIGHT", weights.Manual)
+	return weights
+}
+
+func envFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+// smartScore computes the weighted score of a todo. maxOrderNo is the largest
+// order_no among the todos being sorted.
+func smartScore(todo *models.Todo, weights SmartSortWeights, maxOrderNo int, now time.Time) float64 {
+	priority := float64(models.PriorityRank(todo.Priority)) / models.MaxPriorityRank
+
+	// Due date urgency: 1 when overdue, decaying with the number of days left
+	var due float64
+	if todo.DueDate != nil {
+		days := todo.DueDate.Sub(now).Hours() / 24
+		if days <= 0 {
+			due = 1
+		} else {
+			due = 1 / (1 + days)
+		}
+	}
+
+	// Age saturates towards 1, reaching 0.5 after a week
+	ageDays := now.Sub(todo.CreatedAt).Hours() / 24
+	if ageDays < 0 {
+		ageDays = 0
+	}
+	age := ageDays / (ageDays + 7)
+
+	manual := 1.0
+	if maxOrderNo > 1 {
+		manual = 1 - float64(todo.OrderNo-1)/float64(maxOrderNo-1)
+	}
+
+	return weights.Priority*priority + weights.DueDate*due + weights.Age*age + weights.Manual*manual
+}
+
+// sortBySmartScore scores every todo and sorts by descending score.
+// Completed todos always come after open ones.
+func sortBySmartScore(todos []models.Todo, weights SmartSortWeights, now time.Time) {
+	maxOrderNo := 0
+	for _, todo := range todos {
+		if todo.OrderNo > maxOrderNo {
+			maxOrderNo = todo.OrderNo
+		}
+	}
+
+	for i := range todos {
+		score := smartScore(&todos[i], weights, maxOrderNo, now)
+		todos[i].Score = &score
+	}
+
+	sort.SliceStable(todos, func(i, j int) bool {
+		if todos[i].Completed != todos[j].Completed {
+			return !todos[i].Completed
+		}
+		if *todos[i].Score != *todos[j].Score {
+			return *todos[i].Score > *todos[j].Score
+		}
+		return todos[i].OrderNo < todos[j].OrderNo
+	})
+}
+
+// sortByPriority orders todos by descending priority, keeping the manual
+// order within each priority level
+func sortByPriority(todos []models.Todo) {
+	sort.SliceStable(todos, func(i, j int) bool {
+		ri, rj := models.PriorityRank(todos[i].Priority), models.PriorityRank(todos[j].Priority)
+		if ri != rj {
+			return ri > rj
+		}
+		return todos[i].OrderNo < todos[j].OrderNo
+	})
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// DefaultSnoozeSweepInterval is used when SNOOZE_SWEEP_INTERVAL is not set
+const DefaultSnoozeSweepInterval = time.Minute
+
+// maxSnooze caps how far ahead a todo can be snoozed
+const maxSnooze = 5 * 365 * 24 * time.Hour
+
+// Snooze hides a todo from the default todo views until the requested time,
+// without changing its due date
+func (s *TodoService) Snooze(id int, req *models.SnoozeRequest, userID int) (*models.Todo, error) {
+	todo, err := s.authorizeActive(id, userID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if todo, err = withDetails(s.db(), todo); err != nil {
+		return nil, err
+	}
+	if todo.Completed {
+		return nil, fmt.Errorf("completed todos cannot be snoozed")
+	}
+
+	loc, err := userLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().In(loc)
+	until, err := parseSnoozeUntil(req.Until, now)
+	if err != nil {
+		return nil, err
+	}
+	if !until.After(now) {
+		return nil, fmt.Errorf("invalid until: must be in the future")
+	}
+	if until.Sub(now) > maxSnooze {
+		return nil, fmt.Errorf("invalid until: todos can be snoozed for at most 5 years")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE todos
+		SET snoozed_until = ?, snooze_to_top = ?, updated_by = ?
+		WHERE id = ? AND org_id = ?`,
+		until.UTC().Truncate(time.Second), req.MoveToTop, userID, id, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := s.commitSnooze(tx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.journal(userID, models.OperationSnooze, todo, changed)
+	return changed, nil
+}
+
+// Unsnooze brings a snoozed todo back right away, without moving it
+func (s *TodoService) Unsnooze(id, userID int) (*models.Todo, error) {
+	todo, err := s.authorize(id, userID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if todo, err = withDetails(s.db(), todo); err != nil {
+		return nil, err
+	}
+	if todo.SnoozedUntil == nil {
+		return nil, fmt.Errorf("todo is not snoozed")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE todos
+		SET snoozed_until = NULL, snooze_to_top = FALSE, updated_by = ?
+		WHERE id = ? AND org_id = ?`, userID, id, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := s.commitSnooze(tx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.journal(userID, models.OperationUnsnooze, todo, changed)
+	return changed, nil
+}
+
+// commitSnooze stages the event of a snooze change, commits it and returns
+// the todo afterwards
+func (s *TodoService) commitSnooze(tx *sql.Tx, id, userID int) (*models.Todo, error) {
+	changed, err := loadTodo(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	event := TodoEvent{Type: EventTodoUpdated, Todo: changed, ActorID: userID, Fields: []string{"snoozed_until"}}
+	if err := s.stage(tx, event); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.emit(event)
+	return changed, nil
+}
+
+// WakeSnoozed brings back the todos of every tenant whose snooze has ended,
+// moving those that asked for it to the top of their owner's manual order.
+// It returns the number of todos woken.
+func (s *TodoService) WakeSnoozed() (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+todoColumns+`
+		FROM todos
+		WHERE snoozed_until <= ?
+		ORDER BY snoozed_until ASC
+		LIMIT 500`, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	var due []models.Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, *todo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	woken := 0
+	for i := range due {
+		ok, err := s.ForOrg(due[i].OrgID).wake(&due[i])
+		if err != nil {
+			return woken, fmt.Errorf("error waking todo %d: %v", due[i].ID, err)
+		}
+		if ok {
+			woken++
+		}
+	}
+	return woken, nil
+}
+
+// wake clears the snooze of a todo, unless it has been changed since it was
+// loaded
+func (s *TodoService) wake(todo *models.Todo) (bool, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE todos
+		SET snoozed_until = NULL, snooze_to_top = FALSE
+		WHERE id = ? AND snoozed_until = ?`, todo.ID, todo.SnoozedUntil)
+	if err != nil {
+		return false, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return false, nil
+	}
+
+	if todo.SnoozeToTop && todo.OrderNo > 1 {
+		// Park the todo first so the shift never collides with it on the
+		// unique order key
+		if _, err := tx.Exec("UPDATE todos SET order_no = 0 WHERE id = ?", todo.ID); err != nil {
+			return false, fmt.Errorf("error updating todo order: %v", err)
+		}
+		_, err = tx.Exec(`
+			UPDATE todos
+			SET order_no = order_no + 1
+			WHERE user_id = ? AND org_id = ? AND order_no >= 1 AND order_no < ?`,
+			todo.UserID, s.orgID, todo.OrderNo)
+		if err != nil {
+			return false, fmt.Errorf("error updating order numbers: %v", err)
+		}
+		if _, err := tx.Exec("UPDATE todos SET order_no = 1 WHERE id = ?", todo.ID); err != nil {
+			return false, fmt.Errorf("error updating todo order: %v", err)
+		}
+	}
+	// The sweeper is the actor, so the event has no user
+	woken, err := loadTodo(tx, todo.ID)
+	if err != nil {
+		return false, err
+	}
+	event := TodoEvent{Type: EventTodoUpdated, Todo: woken, Fields: []string{"snoozed_until"}}
+	if err := s.stage(tx, event); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	s.emit(event)
+	return true, nil
+}
+
+// RunSnoozeSweeper calls WakeSnoozed every SNOOZE_SWEEP_INTERVAL. It never
+// returns.
+func (s *TodoService) RunSnoozeSweeper() {
+	interval := envDuration("SNOOZE_SWEEP_INTERVAL", DefaultSnoozeSweepInterval)
+	for {
+		woken, err := s.WakeSnoozed()
+		if err != nil {
+			log.Println("Snooze sweep failed:", err)
+		} else if woken > 0 {
+			log.Printf("Snooze sweep woke %d todos", woken)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// parseSnoozeUntil reads an RFC 3339 timestamp, or else a date and time in
+// the quick-add syntax relative to now
+func parseSnoozeUntil(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("until is required")
+	}
+	if until, err := time.Parse(time.RFC3339, value); err == nil {
+		return until, nil
+	}
+
+	parsed := parseQuickAdd(value, now)
+	if parsed.DueDate == nil || parsed.Title != "" || len(parsed.Tags) > 0 || parsed.Priority != "" ||
+		parsed.Recurrence != "" || parsed.ListName != "" {
+		return time.Time{}, fmt.Errorf("invalid until: must be a timestamp like 2006-01-02T15:04:05Z or a time like \"monday 9am\"")
+	}
+	return *parsed.DueDate, nil
+}
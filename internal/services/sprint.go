@@ -0,0 +1,665 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// maxSprintDays caps the length of a sprint
+const maxSprintDays = 366
+
+// SprintService plans the todos of a list in sprints and charts their
+// progress. Sprints belong to a list: viewers of the list can see them and
+// editors can plan them.
+type SprintService struct {
+	todos *TodoService
+	lists *ListService
+	orgID int
+}
+
+func NewSprintService() *SprintService {
+	return &SprintService{
+		todos: NewTodoService(),
+		lists: NewListService(),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *SprintService) ForOrg(orgID int) *SprintService {
+	return &SprintService{
+		todos: s.todos.ForOrg(orgID),
+		lists: s.lists.ForOrg(orgID),
+		orgID: orgID,
+	}
+}
+
+// sprintSelect loads sprints with the totals of the todos currently in them
+const sprintSelect = `
+	SELECT s.id, s.list_id, s.name, COALESCE(s.goal, ''), s.start_date, s.end_date, s.unit, s.status,
+		s.closed_at, s.created_by, s.created_at, s.updated_at,
+		COUNT(t.id), COALESCE(SUM(t.completed), 0), COALESCE(SUM(t.estimate), 0),
+		COALESCE(SUM(CASE WHEN t.completed THEN 0 ELSE t.estimate END), 0)
+	FROM sprints s
+	JOIN lists l ON l.id = s.list_id
+	LEFT JOIN todos t ON t.sprint_id = s.id`
+
+// GetSprints returns the sprints of a list by start date
+func (s *SprintService) GetSprints(listID, userID int) ([]models.Sprint, error) {
+	if _, err := s.lists.getWithRole(listID, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	return querySprints(sprintSelect+`
+		WHERE s.list_id = ? AND l.org_id = ?
+		GROUP BY s.id
+		ORDER BY s.start_date ASC, s.id ASC`, listID, s.orgID)
+}
+
+func (s *SprintService) GetSprint(id, userID int) (*models.Sprint, error) {
+	return s.authorize(id, userID, models.RoleViewer)
+}
+
+func (s *SprintService) CreateSprint(listID int, req *models.SprintRequest, userID int) (*models.Sprint, error) {
+	if _, err := s.lists.getWithRole(listID, userID, models.RoleEditor); err != nil {
+		return nil, err
+	}
+	if err := validateSprint(req); err != nil {
+		return nil, err
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO sprints (list_id, name, goal, start_date, end_date, unit, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		listID, req.Name, req.Goal, req.StartDate, req.EndDate, req.Unit, userID)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	return s.GetSprint(int(id), userID)
+}
+
+// UpdateSprint edits a sprint that has not been closed
+func (s *SprintService) UpdateSprint(id int, req *models.SprintRequest, userID int) (*models.Sprint, error) {
+	sprint, err := s.authorize(id, userID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if sprint.Status == models.SprintClosed {
+		return nil, fmt.Errorf("sprint is already closed")
+	}
+	if err := validateSprint(req); err != nil {
+		return nil, err
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE sprints
+		SET name = ?, goal = ?, start_date = ?, end_date = ?, unit = ?
+		WHERE id = ?`,
+		req.Name, req.Goal, req.StartDate, req.EndDate, req.Unit, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSprint(id, userID)
+}
+
+// DeleteSprint removes a sprint; its todos go back to the list's backlog.
+// List admins can delete sprints.
+func (s *SprintService) DeleteSprint(id, userID int) error {
+	if _, err := s.authorize(id, userID, models.RoleAdmin); err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE todos SET sprint_id = NULL WHERE sprint_id = ?", id); err != nil {
+		return fmt.Errorf("error detaching todos: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM sprints WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// StartSprint makes a planned sprint the list's active sprint
+func (s *SprintService) StartSprint(id, userID int) (*models.Sprint, error) {
+	sprint, err := s.authorize(id, userID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if sprint.Status != models.SprintPlanned {
+		return nil, fmt.Errorf("sprint is already %s", sprint.Status)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the list so two sprints cannot be started at once
+	var locked int
+	if err := tx.QueryRow("SELECT id FROM lists WHERE id = ? FOR UPDATE", sprint.ListID).Scan(&locked); err != nil {
+		return nil, fmt.Errorf("error locking list: %v", err)
+	}
+	var active int
+	err = tx.QueryRow("SELECT COUNT(*) FROM sprints WHERE list_id = ? AND status = ?",
+		sprint.ListID, models.SprintActive).Scan(&active)
+	if err != nil {
+		return nil, err
+	}
+	if active > 0 {
+		return nil, fmt.Errorf("list already has an active sprint")
+	}
+
+	if _, err := tx.Exec("UPDATE sprints SET status = ? WHERE id = ?", models.SprintActive, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetSprint(id, userID)
+}
+
+// CloseSprint closes a sprint. Its unfinished todos roll over into the next
+// sprint: the one requested, or else the list's earliest planned sprint. When
+// there is none they go back to the backlog.
+func (s *SprintService) CloseSprint(id int, req *models.CloseSprintRequest, userID int) (*models.CloseSprintResult, error) {
+	sprint, err := s.authorize(id, userID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if sprint.Status == models.SprintClosed {
+		return nil, fmt.Errorf("sprint is already closed")
+	}
+
+	var next *models.Sprint
+	if req.NextSprintID != nil {
+		next, err = s.authorize(*req.NextSprintID, userID, models.RoleEditor)
+		if err != nil {
+			return nil, err
+		}
+		if next.ListID != sprint.ListID || next.ID == sprint.ID {
+			return nil, fmt.Errorf("next sprint must be another sprint of the same list")
+		}
+		if next.Status == models.SprintClosed {
+			return nil, fmt.Errorf("next sprint is already closed")
+		}
+	} else {
+		var nextID int
+		err := database.DB.QueryRow(`
+			SELECT id FROM sprints
+			WHERE list_id = ? AND status = ? AND id <> ?
+			ORDER BY start_date ASC, id ASC
+			LIMIT 1`, sprint.ListID, models.SprintPlanned, id).Scan(&nextID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if err == nil {
+			if next, err = s.GetSprint(nextID, userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result, err := tx.Exec(`
+		UPDATE sprints SET status = ?, closed_at = ?
+		WHERE id = ? AND status <> ?`, models.SprintClosed, now, id, models.SprintClosed)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("sprint is already closed")
+	}
+
+	unfinished, err := unfinishedTodoIDs(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	var nextID *int
+	if next != nil {
+		nextID = &next.ID
+	}
+	for _, todoID := range unfinished {
+		if err := moveToSprint(tx, todoID, nextID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	closed, err := s.GetSprint(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	closeResult := &models.CloseSprintResult{
+		Sprint:            *closed,
+		RolledOver:        []int{},
+		ReturnedToBacklog: []int{},
+	}
+	if next != nil {
+		if closeResult.NextSprint, err = s.GetSprint(next.ID, userID); err != nil {
+			return nil, err
+		}
+		closeResult.RolledOver = unfinished
+	} else {
+		closeResult.ReturnedToBacklog = unfinished
+	}
+	return closeResult, nil
+}
+
+// SetTodoSprint moves a todo into a sprint of its list, or back to the
+// backlog when sprintID is nil
+func (s *SprintService) SetTodoSprint(todoID int, sprintID *int, userID int) (*models.Todo, error) {
+	todo, err := s.todos.authorize(todoID, userID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	if sprintID != nil {
+		if todo.ListID == nil {
+			return nil, fmt.Errorf("only todos in a list can be planned in a sprint")
+		}
+		sprint, err := s.authorize(*sprintID, userID, models.RoleViewer)
+		if err != nil {
+			return nil, err
+		}
+		if sprint.ListID != *todo.ListID {
+			return nil, fmt.Errorf("sprint belongs to another list")
+		}
+		if sprint.Status == models.SprintClosed {
+			return nil, fmt.Errorf("sprint is already closed")
+		}
+	}
+
+	if sameListID(todo.SprintID, sprintID) {
+		return todo, nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := moveToSprint(tx, todoID, sprintID, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.todos.GetByID(todoID, userID)
+}
+
+// GetChart returns the burndown and burnup series of a sprint, one point per
+// day in the user's timezone. Each day is evaluated at its end from the
+// history of which todos were in the sprint and when they were completed.
+// Estimates are taken as they are now; sprints without any estimates are
+// charted by number of todos.
+func (s *SprintService) GetChart(id, userID int) (*models.SprintChart, error) {
+	sprint, err := s.authorize(id, userID, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := userLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := loadSprintMembers(id)
+	if err != nil {
+		return nil, err
+	}
+	unit := sprint.Unit
+	if !anyEstimate(members) {
+		unit = "todos"
+		for i := range members {
+			members[i].estimate = 1
+		}
+	}
+
+	start, err := time.ParseInLocation("2006-01-02", sprint.StartDate, loc)
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.ParseInLocation("2006-01-02", sprint.EndDate, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	chart := &models.SprintChart{
+		SprintID:  id,
+		Unit:      unit,
+		Timezone:  loc.String(),
+		Dates:     []string{},
+		Scope:     []*float64{},
+		Completed: []*float64{},
+		Remaining: []*float64{},
+		Ideal:     []float64{},
+	}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		chart.Dates = append(chart.Dates, day.Format("2006-01-02"))
+		if day.After(now) {
+			chart.Scope = append(chart.Scope, nil)
+			chart.Completed = append(chart.Completed, nil)
+			chart.Remaining = append(chart.Remaining, nil)
+			continue
+		}
+
+		// A day is measured at its end, or now for today. A closed sprint
+		// stops changing when it is closed.
+		at := day.AddDate(0, 0, 1)
+		if at.After(now) {
+			at = now
+		}
+		if sprint.ClosedAt != nil && at.After(*sprint.ClosedAt) {
+			at = *sprint.ClosedAt
+		}
+
+		var scope, done float64
+		for _, m := range members {
+			if !m.inSprintAt(at) {
+				continue
+			}
+			scope += m.estimate
+			if m.completedAt(at) {
+				done += m.estimate
+			}
+		}
+		scope, done = round2(scope), round2(done)
+		remaining := round2(scope - done)
+		chart.Scope = append(chart.Scope, &scope)
+		chart.Completed = append(chart.Completed, &done)
+		chart.Remaining = append(chart.Remaining, &remaining)
+	}
+
+	// The ideal line starts from the scope at the end of the first day, or
+	// from the current scope when the sprint has not started
+	initial := sprint.Estimate
+	if unit == "todos" {
+		initial = float64(sprint.TodoCount)
+	}
+	if len(chart.Scope) > 0 && chart.Scope[0] != nil {
+		initial = *chart.Scope[0]
+	}
+	days := len(chart.Dates)
+	for i := 0; i < days; i++ {
+		ideal := initial
+		if days > 1 {
+			ideal = initial * float64(days-1-i) / float64(days-1)
+		}
+		chart.Ideal = append(chart.Ideal, round2(ideal))
+	}
+	return chart, nil
+}
+
+// authorize returns the sprint when the user holds at least the required
+// role on its list
+func (s *SprintService) authorize(id, userID int, required string) (*models.Sprint, error) {
+	sprints, err := querySprints(sprintSelect+`
+		WHERE s.id = ? AND l.org_id = ?
+		GROUP BY s.id`, id, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sprints) == 0 {
+		return nil, fmt.Errorf("sprint not found")
+	}
+
+	if _, err := s.lists.getWithRole(sprints[0].ListID, userID, required); err != nil {
+		if err.Error() == "list not found" {
+			return nil, fmt.Errorf("sprint not found")
+		}
+		return nil, err
+	}
+	return &sprints[0], nil
+}
+
+func querySprints(query string, args ...interface{}) ([]models.Sprint, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sprints := []models.Sprint{}
+	for rows.Next() {
+		var sprint models.Sprint
+		var start, end time.Time
+		var closedAt sql.NullTime
+		err := rows.Scan(&sprint.ID, &sprint.ListID, &sprint.Name, &sprint.Goal, &start, &end, &sprint.Unit,
+			&sprint.Status, &closedAt, &sprint.CreatedBy, &sprint.CreatedAt, &sprint.UpdatedAt,
+			&sprint.TodoCount, &sprint.CompletedCount, &sprint.Estimate, &sprint.Remaining)
+		if err != nil {
+			return nil, err
+		}
+		sprint.StartDate = start.Format("2006-01-02")
+		sprint.EndDate = end.Format("2006-01-02")
+		if closedAt.Valid {
+			sprint.ClosedAt = &closedAt.Time
+		}
+		sprints = append(sprints, sprint)
+	}
+	return sprints, rows.Err()
+}
+
+// validateSprint trims and checks a sprint request, defaulting the unit to
+// points
+func validateSprint(req *models.SprintRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(req.Name) > 255 {
+		return fmt.Errorf("name must be at most 255 characters")
+	}
+	if req.Unit == "" {
+		req.Unit = models.EstimatePoints
+	}
+	if !models.IsValidEstimateUnit(req.Unit) {
+		return fmt.Errorf("invalid unit: must be points or hours")
+	}
+
+	start, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		return fmt.Errorf("invalid start_date: must be a date like 2006-01-02")
+	}
+	end, err := time.Parse("2006-01-02", req.EndDate)
+	if err != nil {
+		return fmt.Errorf("invalid end_date: must be a date like 2006-01-02")
+	}
+	if end.Before(start) {
+		return fmt.Errorf("end_date must not be before start_date")
+	}
+	if end.Sub(start) >= maxSprintDays*24*time.Hour {
+		return fmt.Errorf("a sprint can be at most %d days long", maxSprintDays)
+	}
+	return nil
+}
+
+// moveToSprint ends the todo's current sprint membership and, unless sprintID
+// is nil, starts a new one
+func moveToSprint(db sqlExecutor, todoID int, sprintID *int, at time.Time) error {
+	_, err := db.Exec("UPDATE sprint_todos SET removed_at = ? WHERE todo_id = ? AND removed_at IS NULL", at, todoID)
+	if err != nil {
+		return fmt.Errorf("error updating sprint history: %v", err)
+	}
+	if sprintID != nil {
+		_, err := db.Exec("INSERT INTO sprint_todos (sprint_id, todo_id, added_at) VALUES (?, ?, ?)", *sprintID, todoID, at)
+		if err != nil {
+			return fmt.Errorf("error updating sprint history: %v", err)
+		}
+	}
+	if _, err := db.Exec("UPDATE todos SET sprint_id = ? WHERE id = ?", sprintID, todoID); err != nil {
+		return fmt.Errorf("error updating todo sprint: %v", err)
+	}
+	return nil
+}
+
+// recordCompletion sets the todo's completed_at and adds to the completion
+// history that sprint charts are computed from. TodoService calls it whenever
+// a todo's completed flag changes.
+func recordCompletion(db sqlExecutor, todoID int, completed bool) error {
+	now := time.Now().UTC()
+	var completedAt *time.Time
+	if completed {
+		completedAt = &now
+	}
+	if _, err := db.Exec("UPDATE todos SET completed_at = ? WHERE id = ?", completedAt, todoID); err != nil {
+		return fmt.Errorf("error recording completion: %v", err)
+	}
+	_, err := db.Exec("INSERT INTO todo_completion_events (todo_id, completed, created_at) VALUES (?, ?, ?)",
+		todoID, completed, now)
+	if err != nil {
+		return fmt.Errorf("error recording completion: %v", err)
+	}
+	return nil
+}
+
+func unfinishedTodoIDs(db sqlExecutor, sprintID int) ([]int, error) {
+	rows, err := db.Query("SELECT id FROM todos WHERE sprint_id = ? AND completed = FALSE ORDER BY id", sprintID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// sprintMember is one period during which a todo was in a sprint, with the
+// todo's completion history
+type sprintMember struct {
+	todoID    int
+	estimate  float64
+	hasEst    bool
+	completed bool // current value, used for todos without any history
+	addedAt   time.Time
+	removedAt *time.Time
+	events    []completionEvent
+}
+
+type completionEvent struct {
+	completed bool
+	at        time.Time
+}
+
+func (m *sprintMember) inSprintAt(at time.Time) bool {
+	return !m.addedAt.After(at) && (m.removedAt == nil || m.removedAt.After(at))
+}
+
+// completedAt replays the completion history up to the given time. Before the
+// first recorded change the todo was in the opposite state.
+func (m *sprintMember) completedAt(at time.Time) bool {
+	if len(m.events) == 0 {
+		return m.completed
+	}
+	state := !m.events[0].completed
+	for _, e := range m.events {
+		if e.at.After(at) {
+			break
+		}
+		state = e.completed
+	}
+	return state
+}
+
+func loadSprintMembers(sprintID int) ([]sprintMember, error) {
+	rows, err := database.DB.Query(`
+		SELECT st.todo_id, t.estimate, t.completed, st.added_at, st.removed_at
+		FROM sprint_todos st
+		JOIN todos t ON t.id = st.todo_id
+		WHERE st.sprint_id = ?`, sprintID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []sprintMember{}
+	for rows.Next() {
+		var m sprintMember
+		var estimate sql.NullFloat64
+		var removedAt sql.NullTime
+		if err := rows.Scan(&m.todoID, &estimate, &m.completed, &m.addedAt, &removedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		m.estimate, m.hasEst = estimate.Float64, estimate.Valid
+		if removedAt.Valid {
+			m.removedAt = &removedAt.Time
+		}
+		members = append(members, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return members, nil
+	}
+
+	ids := make([]interface{}, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, m.todoID)
+	}
+	rows, err = database.DB.Query(`
+		SELECT todo_id, completed, created_at
+		FROM todo_completion_events
+		WHERE todo_id IN (`+inPlaceholders(len(ids))+`)
+		ORDER BY created_at ASC, id ASC`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := map[int][]completionEvent{}
+	for rows.Next() {
+		var todoID int
+		var e completionEvent
+		if err := rows.Scan(&todoID, &e.completed, &e.at); err != nil {
+			return nil, err
+		}
+		events[todoID] = append(events[todoID], e)
+	}
+	for i := range members {
+		members[i].events = events[members[i].todoID]
+	}
+	return members, rows.Err()
+}
+
+func anyEstimate(members []sprintMember) bool {
+	for _, m := range members {
+		if m.hasEst {
+			return true
+		}
+	}
+	return false
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
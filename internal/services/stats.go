@@ -0,0 +1,396 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// defaultStatsDays is the range of the statistics when from is not given
+const defaultStatsDays = 30
+
+// StatsService computes productivity statistics over the todos a user can
+// see. All aggregation happens in the database; dates are grouped in the
+// user's timezone with CONVERT_TZ and numeric offsets, which assumes
+// timestamps are stored in UTC.
+type StatsService struct {
+	todos *TodoService
+}
+
+func NewStatsService() *StatsService {
+	return &StatsService{
+		todos: NewTodoService(),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *StatsService) ForOrg(orgID int) *StatsService {
+	return &StatsService{
+		todos: s.todos.ForOrg(orgID),
+	}
+}
+
+var weekdayNames = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// GetStats returns the statistics between the inclusive dates from and to
+// (YYYY-MM-DD), which default to the last 30 days, grouped by day or week and
+// broken down by list (the default) or by tag
+func (s *StatsService) GetStats(userID int, from, to, groupBy, breakdown string) (*models.Stats, error) {
+	if groupBy == "" {
+		groupBy = models.ReportByDay
+	}
+	if groupBy != models.ReportByDay && groupBy != models.ReportByWeek {
+		return nil, fmt.Errorf("invalid group_by: must be one of day, week")
+	}
+	if breakdown == "" {
+		breakdown = models.StatsByList
+	}
+	if breakdown != models.StatsByList && breakdown != models.StatsByTag {
+		return nil, fmt.Errorf("invalid breakdown: must be one of list, tag")
+	}
+
+	loc, err := userLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+	if from == "" {
+		end := time.Now().In(loc)
+		if to != "" {
+			parsed, err := time.ParseInLocation("2006-01-02", to, loc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid to: must be a date like 2006-01-02")
+			}
+			end = parsed
+		}
+		from = end.AddDate(0, 0, 1-defaultStatsDays).Format("2006-01-02")
+	}
+	start, end, err := reportRange(from, to, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Archived todos still count towards the history
+	where, args, err := s.todos.accessibleTo(userID)
+	if err != nil {
+		return nil, err
+	}
+	q := statsQuery{where: where, args: args, loc: loc, start: start.UTC(), end: end.UTC()}
+
+	stats := &models.Stats{
+		From:      start.Format("2006-01-02"),
+		To:        end.AddDate(0, 0, -1).Format("2006-01-02"),
+		GroupBy:   groupBy,
+		Timezone:  loc.String(),
+		Buckets:   []models.StatsBucket{},
+		Breakdown: breakdown,
+	}
+
+	created, err := q.countByBucket("created_at", groupBy)
+	if err != nil {
+		return nil, fmt.Errorf("error counting created todos: %v", err)
+	}
+	completed, err := q.countByBucket("completed_at", groupBy)
+	if err != nil {
+		return nil, fmt.Errorf("error counting completed todos: %v", err)
+	}
+	seen := make(map[string]bool)
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		key := bucketStart(day, groupBy).Format("2006-01-02")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		bucket := models.StatsBucket{Start: key, Created: created[key], Completed: completed[key]}
+		stats.Created += bucket.Created
+		stats.Completed += bucket.Completed
+		stats.Buckets = append(stats.Buckets, bucket)
+	}
+
+	if stats.CompletionTime, err = q.completionTime(); err != nil {
+		return nil, fmt.Errorf("error computing completion time: %v", err)
+	}
+	if stats.Streaks, err = q.streaks(); err != nil {
+		return nil, fmt.Errorf("error computing streaks: %v", err)
+	}
+	if stats.Weekdays, err = q.weekdays(); err != nil {
+		return nil, fmt.Errorf("error counting weekdays: %v", err)
+	}
+	if breakdown == models.StatsByTag {
+		if stats.Tags, err = q.tags(); err != nil {
+			return nil, fmt.Errorf("error computing tag breakdown: %v", err)
+		}
+	} else if stats.Lists, err = q.lists(); err != nil {
+		return nil, fmt.Errorf("error computing list breakdown: %v", err)
+	}
+	return stats, nil
+}
+
+// statsQuery holds the todos visible to the user (where and args), the user's
+// timezone and the range [start, end) in UTC
+type statsQuery struct {
+	where      string
+	args       []interface{}
+	loc        *time.Location
+	start, end time.Time
+}
+
+// localTime converts a UTC column to the user's timezone for values in
+// [since, until). Named zones need the time zone tables loaded into the
+// database, so it passes numeric offsets instead, switching between them with
+// a CASE at each daylight saving transition of the range.
+func (q statsQuery) localTime(column string, since, until time.Time) (string, []interface{}) {
+	offset := func(t time.Time) int {
+		_, seconds := t.In(q.loc).Zone()
+		return seconds
+	}
+
+	expr := "CASE"
+	var args []interface{}
+	current := offset(since)
+	for day := since; day.Before(until); {
+		next := day.Add(24 * time.Hour)
+		if offset(next) == current {
+			day = next
+			continue
+		}
+		// The transition is the first second with the new offset
+		lo, hi := day, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if offset(mid) == current {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		hi = hi.Truncate(time.Second)
+		expr += " WHEN " + column + " < ? THEN ?"
+		args = append(args, hi.UTC(), formatOffset(current))
+		current = offset(hi)
+		day = hi
+	}
+	if args == nil {
+		return "CONVERT_TZ(" + column + ", '+00:00', ?)", []interface{}{formatOffset(current)}
+	}
+	args = append(args, formatOffset(current))
+	return "CONVERT_TZ(" + column + ", '+00:00', " + expr + " ELSE ? END)", args
+}
+
+// formatOffset formats an offset east of UTC in seconds as CONVERT_TZ
+// expects, like +05:30
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// countByBucket counts the todos whose column falls in the range, by day or
+// by the Monday starting its week
+func (q statsQuery) countByBucket(column, groupBy string) (map[string]int, error) {
+	local, localArgs := q.localTime(column, q.start, q.end)
+	bucket := "DATE(" + local + ")"
+	bucketArgs := localArgs
+	if groupBy == models.ReportByWeek {
+		bucket = "DATE_SUB(DATE(" + local + "), INTERVAL WEEKDAY(" + local + ") DAY)"
+		bucketArgs = append(append([]interface{}{}, localArgs...), localArgs...)
+	}
+
+	args := append(bucketArgs, q.args...)
+	args = append(args, q.start, q.end)
+	rows, err := database.DB.Query(`
+		SELECT `+bucket+` AS bucket, COUNT(*)
+		FROM todos
+		WHERE `+q.where+` AND `+column+` >= ? AND `+column+` < ?
+		GROUP BY bucket`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var day time.Time
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts[day.Format("2006-01-02")] = count
+	}
+	return counts, rows.Err()
+}
+
+func (q statsQuery) completionTime() (models.CompletionTime, error) {
+	var result models.CompletionTime
+	args := append(append([]interface{}{}, q.args...), q.start, q.end)
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*), COALESCE(AVG(TIMESTAMPDIFF(SECOND, created_at, completed_at)), 0)
+		FROM todos
+		WHERE `+q.where+` AND completed_at >= ? AND completed_at < ?`, args...).
+		Scan(&result.Count, &result.AverageSeconds)
+	return result, err
+}
+
+// streaks finds the runs of consecutive completion days in the last year.
+// Days minus their row number are constant within a run, which groups them.
+func (q statsQuery) streaks() (models.Streaks, error) {
+	var streaks models.Streaks
+
+	now := time.Now().In(q.loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, q.loc)
+	since := today.AddDate(-1, 0, 0).UTC()
+
+	local, args := q.localTime("completed_at", since, today.AddDate(0, 0, 1).UTC())
+	args = append(append(args, q.args...), since)
+	rows, err := database.DB.Query(`
+		SELECT MIN(day), MAX(day), COUNT(*)
+		FROM (
+			SELECT day, DATE_SUB(day, INTERVAL ROW_NUMBER() OVER (ORDER BY day) DAY) AS run
+			FROM (
+				SELECT DISTINCT DATE(`+local+`) AS day
+				FROM todos
+				WHERE `+q.where+` AND completed_at >= ?
+			) days
+		) numbered
+		GROUP BY run
+		ORDER BY MAX(day) DESC`, args...)
+	if err != nil {
+		return streaks, err
+	}
+	defer rows.Close()
+
+	yesterday := today.AddDate(0, 0, -1).Format("2006-01-02")
+	first := true
+	for rows.Next() {
+		var start, end time.Time
+		var streak models.Streak
+		if err := rows.Scan(&start, &end, &streak.Days); err != nil {
+			return streaks, err
+		}
+		streak.Start = start.Format("2006-01-02")
+		streak.End = end.Format("2006-01-02")
+
+		if first && streak.End >= yesterday {
+			streaks.Current = streak
+		}
+		first = false
+		if streak.Days > streaks.Longest.Days {
+			streaks.Longest = streak
+		}
+	}
+	return streaks, rows.Err()
+}
+
+// weekdays counts completions per weekday, busiest first
+func (q statsQuery) weekdays() ([]models.WeekdayStats, error) {
+	local, args := q.localTime("completed_at", q.start, q.end)
+	args = append(append(args, q.args...), q.start, q.end)
+	rows, err := database.DB.Query(`
+		SELECT WEEKDAY(`+local+`) AS weekday, COUNT(*)
+		FROM todos
+		WHERE `+q.where+` AND completed_at >= ? AND completed_at < ?
+		GROUP BY weekday`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	weekdays := make([]models.WeekdayStats, len(weekdayNames))
+	for i, name := range weekdayNames {
+		weekdays[i].Weekday = name
+	}
+	for rows.Next() {
+		var weekday, count int
+		if err := rows.Scan(&weekday, &count); err != nil {
+			return nil, err
+		}
+		if weekday >= 0 && weekday < len(weekdays) {
+			weekdays[weekday].Completed = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(weekdays, func(i, j int) bool {
+		return weekdays[i].Completed > weekdays[j].Completed
+	})
+	return weekdays, nil
+}
+
+// lists breaks the range down by list, with the todos still open in each
+func (q statsQuery) lists() ([]models.ListStats, error) {
+	args := []interface{}{q.start, q.end, q.start, q.end}
+	args = append(args, q.args...)
+	rows, err := database.DB.Query(`
+		SELECT x.list_id, COALESCE(l.name, ''), x.created, x.completed, x.open
+		FROM (
+			SELECT list_id,
+				SUM(CASE WHEN created_at >= ? AND created_at < ? THEN 1 ELSE 0 END) AS created,
+				SUM(CASE WHEN completed_at >= ? AND completed_at < ? THEN 1 ELSE 0 END) AS completed,
+				SUM(CASE WHEN completed THEN 0 ELSE 1 END) AS open
+			FROM todos
+			WHERE `+q.where+`
+			GROUP BY list_id
+		) x
+		LEFT JOIN lists l ON l.id = x.list_id
+		ORDER BY x.completed DESC, x.created DESC, l.name ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []models.ListStats{}
+	for rows.Next() {
+		var stats models.ListStats
+		var listID sql.NullInt64
+		if err := rows.Scan(&listID, &stats.Name, &stats.Created, &stats.Completed, &stats.Open); err != nil {
+			return nil, err
+		}
+		if listID.Valid {
+			id := int(listID.Int64)
+			stats.ListID = &id
+		}
+		lists = append(lists, stats)
+	}
+	return lists, rows.Err()
+}
+
+// tags breaks the range down by tag, with the todos still open under each
+func (q statsQuery) tags() ([]models.TagStats, error) {
+	args := []interface{}{q.start, q.end, q.start, q.end}
+	args = append(args, q.args...)
+	rows, err := database.DB.Query(`
+		SELECT tt.tag,
+			SUM(CASE WHEN t.created_at >= ? AND t.created_at < ? THEN 1 ELSE 0 END) AS created,
+			SUM(CASE WHEN t.completed_at >= ? AND t.completed_at < ? THEN 1 ELSE 0 END) AS completed,
+			SUM(CASE WHEN t.completed THEN 0 ELSE 1 END) AS open
+		FROM todo_tags tt
+		JOIN (
+			SELECT id, created_at, completed_at, completed
+			FROM todos
+			WHERE `+q.where+`
+		) t ON t.id = tt.todo_id
+		GROUP BY tt.tag
+		ORDER BY completed DESC, created DESC, tt.tag ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.TagStats{}
+	for rows.Next() {
+		var stats models.TagStats
+		if err := rows.Scan(&stats.Tag, &stats.Created, &stats.Completed, &stats.Open); err != nil {
+			return nil, err
+		}
+		tags = append(tags, stats)
+	}
+	return tags, rows.Err()
+}
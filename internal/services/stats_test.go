@@ -0,0 +1,70 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLocalTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no timezone database: %v", err)
+	}
+	tests := []struct {
+		name     string
+		loc      *time.Location
+		since    time.Time
+		until    time.Time
+		wantExpr string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "fixed offset",
+			loc:      time.FixedZone("IST", 5*60*60+30*60),
+			since:    time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC),
+			until:    time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC),
+			wantExpr: "CONVERT_TZ(created_at, '+00:00', ?)",
+			wantArgs: []interface{}{"+05:30"},
+		},
+		{
+			name:     "behind UTC",
+			loc:      time.FixedZone("UTC-9:30", -(9*60*60 + 30*60)),
+			since:    time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC),
+			until:    time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC),
+			wantExpr: "CONVERT_TZ(created_at, '+00:00', ?)",
+			wantArgs: []interface{}{"-09:30"},
+		},
+		{
+			name:     "no transition in range",
+			loc:      berlin,
+			since:    time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC),
+			until:    time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC),
+			wantExpr: "CONVERT_TZ(created_at, '+00:00', ?)",
+			wantArgs: []interface{}{"+02:00"},
+		},
+		{
+			name:     "daylight saving time",
+			loc:      berlin,
+			since:    time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC),
+			until:    time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC),
+			wantExpr: "CONVERT_TZ(created_at, '+00:00', CASE WHEN created_at < ? THEN ? WHEN created_at < ? THEN ? ELSE ? END)",
+			wantArgs: []interface{}{
+				time.Date(2026, time.March, 29, 1, 0, 0, 0, time.UTC), "+01:00",
+				time.Date(2026, time.October, 25, 1, 0, 0, 0, time.UTC), "+02:00",
+				"+01:00",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, args := statsQuery{loc: test.loc}.localTime("created_at", test.since, test.until)
+			if expr != test.wantExpr {
+				t.Errorf("expr = %s, want %s", expr, test.wantExpr)
+			}
+			if !reflect.DeepEqual(args, test.wantArgs) {
+				t.Errorf("args = %v, want %v", args, test.wantArgs)
+			}
+		})
+	}
+}
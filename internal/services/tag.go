@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// GetTags returns the tags of the todos the user can see, most used first
+func (s *TodoService) GetTags(userID int) ([]models.TagCount, error) {
+	where, args, err := s.visibleTo(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT tag, COUNT(*)
+		FROM todo_tags
+		WHERE todo_id IN (SELECT id FROM todos WHERE `+where+`)
+		GROUP BY tag
+		ORDER BY COUNT(*) DESC, tag ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.TagCount{}
+	for rows.Next() {
+		var tag models.TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// normalizeTags lowercases tags, strips a leading # and removes duplicates.
+// Tags may contain letters, digits, - and _.
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > models.MaxTagLength {
+			return nil, fmt.Errorf("invalid tag %q: must be at most %d characters", tag, models.MaxTagLength)
+		}
+		for _, r := range tag {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+				return nil, fmt.Errorf("invalid tag %q: only letters, digits, - and _ are allowed", tag)
+			}
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > models.MaxTagsPerTodo {
+		return nil, fmt.Errorf("a todo can have at most %d tags", models.MaxTagsPerTodo)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// setTags replaces the tags of a todo
+func setTags(db sqlExecutor, todoID int, tags []string) error {
+	if _, err := db.Exec("DELETE FROM todo_tags WHERE todo_id = ?", todoID); err != nil {
+		return fmt.Errorf("error saving tags: %v", err)
+	}
+	for _, tag := range tags {
+		if _, err := db.Exec("INSERT INTO todo_tags (todo_id, tag) VALUES (?, ?)", todoID, tag); err != nil {
+			return fmt.Errorf("error saving tags: %v", err)
+		}
+	}
+	return nil
+}
+
+// attachTags loads the tags of the given todos in one query
+func attachTags(db sqlExecutor, todos []models.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int, len(todos))
+	args := make([]interface{}, len(todos))
+	for i := range todos {
+		todos[i].Tags = []string{}
+		index[todos[i].ID] = i
+		args[i] = todos[i].ID
+	}
+
+	rows, err := db.Query(`
+		SELECT todo_id, tag
+		FROM todo_tags
+		WHERE todo_id IN (`+inPlaceholders(len(todos))+`)
+		ORDER BY tag ASC`, args...)
+	if err != nil {
+		return fmt.Errorf("error loading tags: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todoID int
+		var tag string
+		if err := rows.Scan(&todoID, &tag); err != nil {
+			return err
+		}
+		i := index[todoID]
+		todos[i].Tags = append(todos[i].Tags, tag)
+	}
+	return rows.Err()
+}
+
+// attachDetails loads the assignees and tags of the given todos
+func attachDetails(db sqlExecutor, todos []models.Todo) error {
+	if err := attachAssignees(db, todos); err != nil {
+		return err
+	}
+	return attachTags(db, todos)
+}
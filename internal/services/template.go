@@ -0,0 +1,479 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// maxDueOffsetDays caps how far from the start date a template item can be due
+const maxDueOffsetDays = 3650
+
+// placeholderPattern matches template variables such as {{name}}
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+var dueTimePattern = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+
+// TemplateService manages a user's todo templates. Templates are personal and
+// belong to the tenant they were created in.
+type TemplateService struct {
+	todos *TodoService
+	lists *ListService
+	orgID int
+}
+
+func NewTemplateService() *TemplateService {
+	return &TemplateService{
+		todos: NewTodoService(),
+		lists: NewListService(),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *TemplateService) ForOrg(orgID int) *TemplateService {
+	return &TemplateService{
+		todos: s.todos.ForOrg(orgID),
+		lists: s.lists.ForOrg(orgID),
+		orgID: orgID,
+	}
+}
+
+// GetTemplates returns the user's templates by name
+func (s *TemplateService) GetTemplates(userID int) ([]models.Template, error) {
+	return s.queryTemplates("user_id = ? AND org_id = ? ORDER BY name ASC, id ASC", userID, s.orgID)
+}
+
+func (s *TemplateService) GetTemplate(id, userID int) (*models.Template, error) {
+	templates, err := s.queryTemplates("id = ? AND user_id = ? AND org_id = ?", id, userID, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("template not found")
+	}
+	return &templates[0], nil
+}
+
+func (s *TemplateService) CreateTemplate(req *models.TemplateRequest, userID int) (*models.Template, error) {
+	if err := validateTemplate(req); err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO todo_templates (user_id, org_id, name, description) VALUES (?, ?, ?, ?)",
+		userID, s.orgID, req.Name, req.Description)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+
+	if err := saveTemplateItems(tx, int(id), req.Items); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetTemplate(int(id), userID)
+}
+
+// UpdateTemplate replaces the name, description and items of a template
+func (s *TemplateService) UpdateTemplate(id int, req *models.TemplateRequest, userID int) (*models.Template, error) {
+	if _, err := s.GetTemplate(id, userID); err != nil {
+		return nil, err
+	}
+	if err := validateTemplate(req); err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE todo_templates SET name = ?, description = ? WHERE id = ?", req.Name, req.Description, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM template_items WHERE template_id = ?", id); err != nil {
+		return nil, err
+	}
+	if err := saveTemplateItems(tx, id, req.Items); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetTemplate(id, userID)
+}
+
+func (s *TemplateService) DeleteTemplate(id, userID int) error {
+	result, err := database.DB.Exec("DELETE FROM todo_templates WHERE id = ? AND user_id = ? AND org_id = ?", id, userID, s.orgID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("template not found")
+	}
+	return nil
+}
+
+// CreateFromList snapshots the todos of a list, in manual order, into a new
+// template. Due dates become offsets from the earliest due date in the list.
+func (s *TemplateService) CreateFromList(listID int, req *models.SnapshotRequest, userID int) (*models.Template, error) {
+	list, err := s.lists.GetByID(listID, userID)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := userLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT `+todoColumns+`
+		FROM todos
+		WHERE list_id = ? AND org_id = ? AND archived_at IS NULL
+		ORDER BY order_no ASC`, listID, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	var todos []models.Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		todos = append(todos, *todo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(todos) > models.MaxTemplateItems {
+		return nil, fmt.Errorf("list has more than %d todos", models.MaxTemplateItems)
+	}
+	if err := attachTags(database.DB, todos); err != nil {
+		return nil, err
+	}
+
+	var start *time.Time
+	for _, todo := range todos {
+		if todo.DueDate == nil {
+			continue
+		}
+		day := localMidnight(todo.DueDate.In(loc))
+		if start == nil || day.Before(*start) {
+			start = &day
+		}
+	}
+
+	template := &models.TemplateRequest{Name: req.Name, Description: req.Description}
+	if template.Name == "" {
+		template.Name = list.Name
+	}
+	for _, todo := range todos {
+		item := models.TemplateItem{
+			Title:       todo.Title,
+			Description: todo.Description,
+			Priority:    todo.Priority,
+			Estimate:    todo.Estimate,
+			Tags:        todo.Tags,
+		}
+		if todo.DueDate != nil {
+			due := todo.DueDate.In(loc)
+			offset := int(localMidnight(due).Sub(*start).Hours()/24 + 0.5)
+			item.DueOffsetDays = &offset
+			if due.Hour() != 0 || due.Minute() != 0 {
+				item.DueTime = due.Format("15:04")
+			}
+		}
+		template.Items = append(template.Items, item)
+	}
+	return s.CreateTemplate(template, userID)
+}
+
+// Instantiate creates the todos of a template in one transaction, at the end
+// of the owner's manual order. Every variable of the template must be given.
+func (s *TemplateService) Instantiate(id int, req *models.InstantiateRequest, userID int) ([]models.Todo, error) {
+	template, err := s.GetTemplate(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, name := range template.Variables {
+		if strings.TrimSpace(req.Variables[name]) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing variables: %s", strings.Join(missing, ", "))
+	}
+
+	ownerID := userID
+	if req.ListID != nil {
+		list, err := s.lists.getWithRole(*req.ListID, userID, models.RoleEditor)
+		if err != nil {
+			return nil, err
+		}
+		ownerID = list.UserID
+	}
+
+	loc, err := userLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+	start := localMidnight(time.Now().In(loc))
+	if req.StartDate != "" {
+		if start, err = time.ParseInLocation("2006-01-02", req.StartDate, loc); err != nil {
+			return nil, fmt.Errorf("invalid start_date: must be a date like 2006-01-02")
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	todos := make([]models.Todo, 0, len(template.Items))
+	var events []TodoEvent
+	for _, item := range template.Items {
+		todo := &models.Todo{
+			ListID:      req.ListID,
+			Title:       strings.TrimSpace(fillPlaceholders(item.Title, req.Variables)),
+			Description: fillPlaceholders(item.Description, req.Variables),
+			Priority:    item.Priority,
+			Estimate:    item.Estimate,
+			Tags:        item.Tags,
+		}
+		if todo.Title == "" || len(todo.Title) > 255 {
+			return nil, fmt.Errorf("item %d: title must be between 1 and 255 characters", item.Position)
+		}
+		if item.DueOffsetDays != nil {
+			due := start.AddDate(0, 0, *item.DueOffsetDays)
+			if item.DueTime != "" {
+				clock, _ := time.Parse("15:04", item.DueTime)
+				due = time.Date(due.Year(), due.Month(), due.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+			}
+			due = due.UTC()
+			todo.DueDate = &due
+		}
+
+		todoID, err := s.todos.insertTodo(tx, todo, ownerID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %v", item.Position, err)
+		}
+		created, err := loadTodo(tx, todoID)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, *created)
+		events = append(events, createdEvents(created, userID)...)
+	}
+
+	if err := s.todos.stage(tx, events...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.todos.emit(events...)
+	for i := range todos {
+		s.todos.journal(userID, models.OperationCreate, nil, &todos[i])
+	}
+	return todos, nil
+}
+
+// queryTemplates loads templates matching the condition, with their items
+func (s *TemplateService) queryTemplates(where string, args ...interface{}) ([]models.Template, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, org_id, name, COALESCE(description, ''), created_at, updated_at
+		FROM todo_templates
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []models.Template{}
+	for rows.Next() {
+		var t models.Template
+		if err := rows.Scan(&t.ID, &t.UserID, &t.OrgID, &t.Name, &t.Description, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		t.Items = []models.TemplateItem{}
+		templates = append(templates, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return templates, nil
+	}
+
+	index := make(map[int]int, len(templates))
+	ids := make([]interface{}, len(templates))
+	for i := range templates {
+		index[templates[i].ID] = i
+		ids[i] = templates[i].ID
+	}
+
+	rows, err = database.DB.Query(`
+		SELECT template_id, position, title, COALESCE(description, ''), priority, estimate, due_offset_days, due_time, tags
+		FROM template_items
+		WHERE template_id IN (`+inPlaceholders(len(ids))+`)
+		ORDER BY template_id, position ASC`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var templateID int
+		var item models.TemplateItem
+		var estimate sql.NullFloat64
+		var offset sql.NullInt64
+		var dueTime sql.NullString
+		var tags string
+		err := rows.Scan(&templateID, &item.Position, &item.Title, &item.Description, &item.Priority,
+			&estimate, &offset, &dueTime, &tags)
+		if err != nil {
+			return nil, err
+		}
+		if estimate.Valid {
+			item.Estimate = &estimate.Float64
+		}
+		if offset.Valid {
+			days := int(offset.Int64)
+			item.DueOffsetDays = &days
+		}
+		item.DueTime = dueTime.String
+		item.Tags = []string{}
+		if tags != "" {
+			item.Tags = strings.Split(tags, ",")
+		}
+
+		i := index[templateID]
+		templates[i].Items = append(templates[i].Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range templates {
+		templates[i].Variables = templateVariables(templates[i].Items)
+	}
+	return templates, nil
+}
+
+// validateTemplate trims and checks a template, normalizing its items the
+// same way as todos
+func validateTemplate(req *models.TemplateRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(req.Name) > 255 {
+		return fmt.Errorf("name must be at most 255 characters")
+	}
+	if len(req.Items) == 0 {
+		return fmt.Errorf("a template needs at least one item")
+	}
+	if len(req.Items) > models.MaxTemplateItems {
+		return fmt.Errorf("a template can have at most %d items", models.MaxTemplateItems)
+	}
+
+	for i := range req.Items {
+		item := &req.Items[i]
+		item.Position = i + 1
+		item.Title = strings.TrimSpace(item.Title)
+		if item.Title == "" {
+			return fmt.Errorf("item %d: title is required", item.Position)
+		}
+		if len(item.Title) > 255 {
+			return fmt.Errorf("item %d: title must be at most 255 characters", item.Position)
+		}
+
+		todo := models.Todo{Priority: item.Priority, Estimate: item.Estimate, Tags: item.Tags}
+		if err := normalizeTodo(&todo); err != nil {
+			return fmt.Errorf("item %d: %v", item.Position, err)
+		}
+		item.Priority, item.Tags = todo.Priority, todo.Tags
+		if item.Tags == nil {
+			item.Tags = []string{}
+		}
+
+		if item.DueOffsetDays != nil && (*item.DueOffsetDays < -maxDueOffsetDays || *item.DueOffsetDays > maxDueOffsetDays) {
+			return fmt.Errorf("item %d: due_offset_days must be between %d and %d", item.Position, -maxDueOffsetDays, maxDueOffsetDays)
+		}
+		if item.DueTime != "" {
+			if item.DueOffsetDays == nil {
+				return fmt.Errorf("item %d: due_time requires due_offset_days", item.Position)
+			}
+			if !dueTimePattern.MatchString(item.DueTime) {
+				return fmt.Errorf("item %d: due_time must be like 09:30", item.Position)
+			}
+		}
+	}
+	return nil
+}
+
+func saveTemplateItems(db sqlExecutor, templateID int, items []models.TemplateItem) error {
+	for _, item := range items {
+		_, err := db.Exec(`
+			INSERT INTO template_items (template_id, position, title, description, priority, estimate, due_offset_days, due_time, tags)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			templateID, item.Position, item.Title, item.Description, item.Priority, item.Estimate,
+			item.DueOffsetDays, nullableString(item.DueTime), strings.Join(item.Tags, ","))
+		if err != nil {
+			return fmt.Errorf("error saving template items: %v", err)
+		}
+	}
+	return nil
+}
+
+// templateVariables returns the placeholder names used by the items, sorted
+func templateVariables(items []models.TemplateItem) []string {
+	seen := make(map[string]bool)
+	variables := []string{}
+	for _, item := range items {
+		for _, text := range []string{item.Title, item.Description} {
+			for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+				if !seen[match[1]] {
+					seen[match[1]] = true
+					variables = append(variables, match[1])
+				}
+			}
+		}
+	}
+	sort.Strings(variables)
+	return variables
+}
+
+// fillPlaceholders replaces {{name}} with the value of the variable
+func fillPlaceholders(text string, variables map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		return variables[name]
+	})
+}
+
+// localMidnight returns the start of t's day in t's location
+func localMidnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,559 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// MaxTimeEntryDuration caps a single manual entry
+const MaxTimeEntryDuration = 24 * time.Hour
+
+// maxReportDays caps the range of a report or export
+const maxReportDays = 366
+
+// TimeService tracks time spent on todos. Each user has at most one running
+// timer across all todos and organizations.
+type TimeService struct {
+	todos *TodoService
+	lists *ListService
+	orgID int
+}
+
+func NewTimeService() *TimeService {
+	return &TimeService{
+		todos: NewTodoService(),
+		lists: NewListService(),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *TimeService) ForOrg(orgID int) *TimeService {
+	return &TimeService{
+		todos: s.todos.ForOrg(orgID),
+		lists: s.lists.ForOrg(orgID),
+		orgID: orgID,
+	}
+}
+
+const timeEntryColumns = `e.id, e.todo_id, COALESCE(t.title, ''), e.user_id, e.source, e.note, e.started_at, e.ended_at, e.created_at`
+
+// StartTimer starts a timer on a todo. It fails when the user already has a
+// running timer.
+func (s *TimeService) StartTimer(todoID, userID int) (*models.TimeEntry, error) {
+	todo, err := s.todos.authorize(todoID, userID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if todo.Completed {
+		return nil, fmt.Errorf("todo is already completed")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the user row so concurrent starts cannot both succeed
+	var locked int
+	if err := tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Scan(&locked); err != nil {
+		return nil, fmt.Errorf("error locking user: %v", err)
+	}
+
+	var runningTodoID int
+	err = tx.QueryRow("SELECT todo_id FROM time_entries WHERE user_id = ? AND ended_at IS NULL LIMIT 1", userID).Scan(&runningTodoID)
+	if err == nil {
+		return nil, fmt.Errorf("a timer is already running on todo %d", runningTodoID)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO time_entries (todo_id, org_id, user_id, source, started_at)
+		VALUES (?, ?, ?, ?, ?)`, todoID, s.orgID, userID, models.TimeSourceTimer, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error starting timer: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	id, _ := result.LastInsertId()
+	return s.getEntry(int(id))
+}
+
+// StopTimer stops the user's running timer on a todo
+func (s *TimeService) StopTimer(todoID, userID int) (*models.TimeEntry, error) {
+	var id int
+	err := database.DB.QueryRow(`
+		SELECT id
+		FROM time_entries
+		WHERE todo_id = ? AND user_id = ? AND org_id = ? AND ended_at IS NULL`, todoID, userID, s.orgID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("running timer not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := database.DB.Exec("UPDATE time_entries SET ended_at = ? WHERE id = ? AND ended_at IS NULL", time.Now().UTC(), id); err != nil {
+		return nil, fmt.Errorf("error stopping timer: %v", err)
+	}
+	return s.getEntry(id)
+}
+
+// GetRunningTimer returns the user's running timer, or nil
+func (s *TimeService) GetRunningTimer(userID int) (*models.TimeEntry, error) {
+	entries, err := queryTimeEntries("e.user_id = ? AND e.ended_at IS NULL", userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
+
+// GetEntries returns every user's time entries on a todo, newest first
+func (s *TimeService) GetEntries(todoID, userID int) ([]models.TimeEntry, error) {
+	if _, err := s.todos.authorize(todoID, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	return queryTimeEntries("e.todo_id = ? AND e.org_id = ?", todoID, s.orgID)
+}
+
+// CreateEntry records time spent without a timer
+func (s *TimeService) CreateEntry(todoID int, req *models.TimeEntryRequest, userID int) (*models.TimeEntry, error) {
+	if _, err := s.todos.authorize(todoID, userID, models.RoleEditor); err != nil {
+		return nil, err
+	}
+	startedAt, endedAt, err := validateTimeEntry(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO time_entries (todo_id, org_id, user_id, source, note, started_at, ended_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		todoID, s.orgID, userID, models.TimeSourceManual, strings.TrimSpace(req.Note), startedAt, endedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating time entry: %v", err)
+	}
+
+	id, _ := result.LastInsertId()
+	return s.getEntry(int(id))
+}
+
+// UpdateEntry changes the times or note of one of the user's stopped entries
+func (s *TimeService) UpdateEntry(todoID, entryID int, req *models.TimeEntryRequest, userID int) (*models.TimeEntry, error) {
+	entry, err := s.ownEntry(todoID, entryID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Running {
+		return nil, fmt.Errorf("timer is still running")
+	}
+	startedAt, endedAt, err := validateTimeEntry(req)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE time_entries
+		SET note = ?, started_at = ?, ended_at = ?
+		WHERE id = ?`, strings.TrimSpace(req.Note), startedAt, endedAt, entryID)
+	if err != nil {
+		return nil, fmt.Errorf("error updating time entry: %v", err)
+	}
+	return s.getEntry(entryID)
+}
+
+// DeleteEntry removes one of the user's entries, including a running timer
+func (s *TimeService) DeleteEntry(todoID, entryID, userID int) error {
+	if _, err := s.ownEntry(todoID, entryID, userID); err != nil {
+		return err
+	}
+	_, err := database.DB.Exec("DELETE FROM time_entries WHERE id = ?", entryID)
+	return err
+}
+
+// GetTodoTime returns the total time spent on a todo, per user
+func (s *TimeService) GetTodoTime(todoID, userID int) (*models.TodoTime, error) {
+	todo, err := s.todos.authorize(todoID, userID, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	byUser, total, err := timeByUser("e.todo_id = ? AND e.org_id = ?", todoID, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TodoTime{TodoID: todo.ID, Title: todo.Title, Seconds: total, ByUser: byUser}, nil
+}
+
+// GetListTime returns the total time spent on the todos of a list, per user
+// and per todo
+func (s *TimeService) GetListTime(listID, userID int) (*models.ListTime, error) {
+	if _, err := s.lists.GetByID(listID, userID); err != nil {
+		return nil, err
+	}
+
+	where := "t.list_id = ? AND e.org_id = ?"
+	byUser, total, err := timeByUser(where, listID, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT t.id, t.title, SUM(TIMESTAMPDIFF(SECOND, e.started_at, COALESCE(e.ended_at, ?))) AS seconds
+		FROM time_entries e
+		JOIN todos t ON t.id = e.todo_id
+		WHERE `+where+`
+		GROUP BY t.id, t.title
+		ORDER BY seconds DESC`, time.Now().UTC(), listID, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	listTime := &models.ListTime{ListID: listID, Seconds: total, ByUser: byUser, ByTodo: []models.TodoTime{}}
+	for rows.Next() {
+		var todoTime models.TodoTime
+		if err := rows.Scan(&todoTime.TodoID, &todoTime.Title, &todoTime.Seconds); err != nil {
+			return nil, err
+		}
+		listTime.ByTodo = append(listTime.ByTodo, todoTime)
+	}
+	return listTime, rows.Err()
+}
+
+// GetReport aggregates the user's tracked time by day or week in their
+// timezone. from and to are inclusive dates (YYYY-MM-DD); they default to the
+// last seven days. Weeks start on Monday, and entries crossing midnight are
+// split between days.
+func (s *TimeService) GetReport(userID int, from, to, groupBy string) (*models.TimeReport, error) {
+	if groupBy == "" {
+		groupBy = models.ReportByDay
+	}
+	if groupBy != models.ReportByDay && groupBy != models.ReportByWeek {
+		return nil, fmt.Errorf("invalid group_by: must be one of day, week")
+	}
+
+	loc, err := userLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := reportRange(from, to, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.entriesBetween(userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.TimeReport{
+		From:     start.Format("2006-01-02"),
+		To:       end.AddDate(0, 0, -1).Format("2006-01-02"),
+		GroupBy:  groupBy,
+		Timezone: loc.String(),
+		Buckets:  []models.TimeReportBucket{},
+	}
+
+	// Buckets for every day or week in the range, including empty ones
+	index := make(map[string]int)
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		key := bucketStart(day, groupBy).Format("2006-01-02")
+		if _, ok := index[key]; !ok {
+			index[key] = len(report.Buckets)
+			report.Buckets = append(report.Buckets, models.TimeReportBucket{Start: key})
+		}
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		entryStart := entry.StartedAt.In(loc)
+		entryEnd := now.In(loc)
+		if entry.EndedAt != nil {
+			entryEnd = entry.EndedAt.In(loc)
+		}
+		if entryStart.Before(start) {
+			entryStart = start
+		}
+		if entryEnd.After(end) {
+			entryEnd = end
+		}
+
+		// Split the entry at each midnight it crosses
+		for entryStart.Before(entryEnd) {
+			day := time.Date(entryStart.Year(), entryStart.Month(), entryStart.Day(), 0, 0, 0, 0, loc)
+			next := day.AddDate(0, 0, 1)
+			segmentEnd := entryEnd
+			if next.Before(segmentEnd) {
+				segmentEnd = next
+			}
+
+			seconds := int64(segmentEnd.Sub(entryStart) / time.Second)
+			i := index[bucketStart(day, groupBy).Format("2006-01-02")]
+			report.Buckets[i].Seconds += seconds
+			report.Seconds += seconds
+			entryStart = segmentEnd
+		}
+	}
+	return report, nil
+}
+
+// ExportCSV writes the user's time entries between from and to (see GetReport)
+// as CSV, with times in the user's timezone
+func (s *TimeService) ExportCSV(userID int, from, to string, w io.Writer) error {
+	loc, err := userLocation(userID)
+	if err != nil {
+		return err
+	}
+	start, end, err := reportRange(from, to, loc)
+	if err != nil {
+		return err
+	}
+
+	entries, err := s.entriesBetween(userID, start, end)
+	if err != nil {
+		return err
+	}
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"id", "todo_id", "todo_title", "started_at", "ended_at", "duration_seconds", "hours", "source", "note"})
+	for _, entry := range entries {
+		endedAt := ""
+		if entry.EndedAt != nil {
+			endedAt = entry.EndedAt.In(loc).Format(time.RFC3339)
+		}
+		out.Write([]string{
+			strconv.Itoa(entry.ID),
+			strconv.Itoa(entry.TodoID),
+			csvSafe(entry.TodoTitle),
+			entry.StartedAt.In(loc).Format(time.RFC3339),
+			endedAt,
+			strconv.FormatInt(entry.Duration, 10),
+			strconv.FormatFloat(float64(entry.Duration)/3600, 'f', 2, 64),
+			entry.Source,
+			csvSafe(entry.Note),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// entriesBetween returns the user's entries overlapping [start, end), oldest first
+func (s *TimeService) entriesBetween(userID int, start, end time.Time) ([]models.TimeEntry, error) {
+	entries, err := queryTimeEntries(`e.user_id = ? AND e.org_id = ? AND e.started_at < ? AND (e.ended_at IS NULL OR e.ended_at > ?)`,
+		userID, s.orgID, end.UTC(), start.UTC())
+	if err != nil {
+		return nil, err
+	}
+	// queryTimeEntries returns newest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+func (s *TimeService) ownEntry(todoID, entryID, userID int) (*models.TimeEntry, error) {
+	entries, err := queryTimeEntries("e.id = ? AND e.todo_id = ? AND e.org_id = ?", entryID, todoID, s.orgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 || entries[0].UserID != userID {
+		return nil, fmt.Errorf("time entry not found")
+	}
+	return &entries[0], nil
+}
+
+func (s *TimeService) getEntry(id int) (*models.TimeEntry, error) {
+	entries, err := queryTimeEntries("e.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("time entry not found")
+	}
+	return &entries[0], nil
+}
+
+func queryTimeEntries(where string, args ...interface{}) ([]models.TimeEntry, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+timeEntryColumns+`
+		FROM time_entries e
+		LEFT JOIN todos t ON t.id = e.todo_id
+		WHERE `+where+`
+		ORDER BY e.started_at DESC, e.id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	entries := []models.TimeEntry{}
+	for rows.Next() {
+		var entry models.TimeEntry
+		var endedAt sql.NullTime
+		err := rows.Scan(&entry.ID, &entry.TodoID, &entry.TodoTitle, &entry.UserID, &entry.Source, &entry.Note,
+			&entry.StartedAt, &endedAt, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		end := now
+		if endedAt.Valid {
+			entry.EndedAt = &endedAt.Time
+			end = endedAt.Time
+		} else {
+			entry.Running = true
+		}
+		entry.Duration = int64(end.Sub(entry.StartedAt) / time.Second)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// timeByUser sums the time of the matching entries per user. where filters on
+// time_entries e and todos t.
+func timeByUser(where string, args ...interface{}) ([]models.UserTime, int64, error) {
+	rows, err := database.DB.Query(`
+		SELECT e.user_id, u.username, SUM(TIMESTAMPDIFF(SECOND, e.started_at, COALESCE(e.ended_at, ?))) AS seconds
+		FROM time_entries e
+		JOIN todos t ON t.id = e.todo_id
+		JOIN users u ON u.id = e.user_id
+		WHERE `+where+`
+		GROUP BY e.user_id, u.username
+		ORDER BY seconds DESC`, append([]interface{}{time.Now().UTC()}, args...)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var total int64
+	byUser := []models.UserTime{}
+	for rows.Next() {
+		var userTime models.UserTime
+		if err := rows.Scan(&userTime.UserID, &userTime.Username, &userTime.Seconds); err != nil {
+			return nil, 0, err
+		}
+		total += userTime.Seconds
+		byUser = append(byUser, userTime)
+	}
+	return byUser, total, rows.Err()
+}
+
+// stopTimers stops every timer running on a todo. TodoService calls it when a
+// todo is completed or deleted.
+func stopTimers(db sqlExecutor, todoID int) error {
+	_, err := db.Exec("UPDATE time_entries SET ended_at = ? WHERE todo_id = ? AND ended_at IS NULL", time.Now().UTC(), todoID)
+	if err != nil {
+		return fmt.Errorf("error stopping timers: %v", err)
+	}
+	return nil
+}
+
+func validateTimeEntry(req *models.TimeEntryRequest) (time.Time, time.Time, error) {
+	if req.StartedAt.IsZero() {
+		return time.Time{}, time.Time{}, fmt.Errorf("started_at is required")
+	}
+	startedAt := req.StartedAt.UTC()
+
+	var endedAt time.Time
+	switch {
+	case req.EndedAt != nil:
+		endedAt = req.EndedAt.UTC()
+	case req.Duration > 0:
+		endedAt = startedAt.Add(time.Duration(req.Duration) * time.Second)
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("ended_at or duration_seconds is required")
+	}
+
+	if !endedAt.After(startedAt) {
+		return time.Time{}, time.Time{}, fmt.Errorf("ended_at must be after started_at")
+	}
+	if endedAt.Sub(startedAt) > MaxTimeEntryDuration {
+		return time.Time{}, time.Time{}, fmt.Errorf("a time entry cannot be longer than %s", MaxTimeEntryDuration)
+	}
+	if endedAt.After(time.Now().Add(time.Minute)) {
+		return time.Time{}, time.Time{}, fmt.Errorf("ended_at cannot be in the future")
+	}
+	if len(req.Note) > 500 {
+		return time.Time{}, time.Time{}, fmt.Errorf("note must be at most 500 characters")
+	}
+	return startedAt, endedAt, nil
+}
+
+// userLocation returns the user's timezone, falling back to UTC
+func userLocation(userID int) (*time.Location, error) {
+	var name string
+	err := database.DB.QueryRow("SELECT timezone FROM users WHERE id = ?", userID).Scan(&name)
+	if err != nil {
+		return nil, fmt.Errorf("error loading user timezone: %v", err)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
+// reportRange parses inclusive from/to dates in loc and returns the
+// half-open range [start, end) between their midnights
+func reportRange(from, to string, loc *time.Location) (time.Time, time.Time, error) {
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	end := today
+	if to != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", to, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: must be a date like 2006-01-02")
+		}
+		end = parsed
+	}
+	start := end.AddDate(0, 0, -6)
+	if from != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", from, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: must be a date like 2006-01-02")
+		}
+		start = parsed
+	}
+
+	end = end.AddDate(0, 0, 1)
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid range: from must not be after to")
+	}
+	if end.Sub(start) > maxReportDays*24*time.Hour+time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid range: at most %d days", maxReportDays)
+	}
+	return start, end, nil
+}
+
+// bucketStart returns the day itself, or the Monday of its week
+func bucketStart(day time.Time, groupBy string) time.Time {
+	if groupBy == models.ReportByWeek {
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	}
+	return day
+}
+
+// csvSafe prevents spreadsheet applications from evaluating a cell as a formula
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -3,23 +3,182 @@ package services
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"todo/internal/database"
 	"todo/internal/models"
 )
 
-type TodoService struct{}
+// TodoService manages the todos of one tenant: the personal workspace (org 0)
+// or an organization. Every query is filtered on the service's org, so todos
+// of another tenant can never be read or changed through it.
+type TodoService struct {
+	weights SmartSortWeights
+	lists   *ListService
+	orgID   int
+	chain   *ruleChain // set on the copies rules act through
+
+	// replaying is set on the copies undo and redo act through, whose changes
+	// join its transaction and are not journaled
+	replaying *replayTx
+}
 
 func NewTodoService() *TodoService {
-	return &TodoService{}
+	return &TodoService{
+		weights: LoadSmartSortWeights(),
+		lists:   NewListService(),
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *TodoService) ForOrg(orgID int) *TodoService {
+	scoped := *s
+	scoped.orgID = orgID
+	scoped.lists = s.lists.ForOrg(orgID)
+	return &scoped
+}
+
+// todoColumns lists the columns read by scanTodo, in scan order
+const todoColumns = `id, user_id, org_id, list_id, title, description, completed, completed_at, priority, estimate, due_date, order_no, state, state_position, sprint_id, recurrence, snoozed_until, snooze_to_top, archived_at, created_by, updated_by, created_at, updated_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTodo(row rowScanner) (*models.Todo, error) {
+	var todo models.Todo
+	var description sql.NullString
+	var dueDate sql.NullTime
+	var listID, sprintID, orderNo sql.NullInt64
+	var estimate sql.NullFloat64
+	var state, recurrence sql.NullString
+	var createdBy, updatedBy sql.NullInt64
+	var completedAt, snoozedUntil, archivedAt sql.NullTime
+	err := row.Scan(&todo.ID, &todo.UserID, &todo.OrgID, &listID, &todo.Title, &description, &todo.Completed, &completedAt,
+		&todo.Priority, &estimate, &dueDate, &orderNo, &state, &todo.StatePosition, &sprintID, &recurrence,
+		&snoozedUntil, &todo.SnoozeToTop, &archivedAt, &createdBy, &updatedBy, &todo.CreatedAt, &todo.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Todos created before creators were tracked belong to their owner
+	todo.CreatedBy, todo.UpdatedBy = todo.UserID, todo.UserID
+	if createdBy.Valid {
+		todo.CreatedBy = int(createdBy.Int64)
+	}
+	if updatedBy.Valid {
+		todo.UpdatedBy = int(updatedBy.Int64)
+	}
+	todo.Description = description.String
+	todo.OrderNo = int(orderNo.Int64)
+	todo.State = state.String
+	todo.Recurrence = recurrence.String
+	if listID.Valid {
+		id := int(listID.Int64)
+		todo.ListID = &id
+	}
+	if sprintID.Valid {
+		id := int(sprintID.Int64)
+		todo.SprintID = &id
+	}
+	if estimate.Valid {
+		todo.Estimate = &estimate.Float64
+	}
+	if completedAt.Valid {
+		todo.CompletedAt = &completedAt.Time
+	}
+	if dueDate.Valid {
+		todo.DueDate = &dueDate.Time
+	}
+	if snoozedUntil.Valid {
+		todo.SnoozedUntil = &snoozedUntil.Time
+	}
+	if archivedAt.Valid {
+		todo.ArchivedAt = &archivedAt.Time
+	}
+	return &todo, nil
+}
+
+// normalizeTodo defaults an empty priority to none and validates the
+// priority, estimate, recurrence and tags
+func normalizeTodo(todo *models.Todo) error {
+	if todo.Priority == "" {
+		todo.Priority = models.PriorityNone
+	}
+	if !models.IsValidPriority(todo.Priority) {
+		return fmt.Errorf("invalid priority: must be one of none, low, medium, high, urgent")
+	}
+	if todo.Estimate != nil && (*todo.Estimate < 0 || *todo.Estimate >= 1000000) {
+		return fmt.Errorf("invalid estimate: must be between 0 and 999999.99")
+	}
+	if err := normalizeRecurrence(todo); err != nil {
+		return err
+	}
+	tags, err := normalizeTags(todo.Tags)
+	if err != nil {
+		return err
+	}
+	todo.Tags = tags
+	return nil
+}
+
+// TodoFilter narrows the todos returned by GetAllSorted. Zero values match
+// every todo.
+type TodoFilter struct {
+	AssignedTo int    // only todos assigned to this user
+	SprintID   int    // only todos in this sprint
+	Tag        string // only todos with this tag
+	View       string // "snoozed" for only snoozed todos; they are hidden otherwise
 }
 
+// Todo views selectable with TodoFilter.View
+const (
+	ViewDefault = ""
+	ViewSnoozed = "snoozed"
+)
+
+// GetAll returns the user's own todos followed by the todos of lists shared
+// with them, each group in manual order. Snoozed todos are left out.
 func (s *TodoService) GetAll(userID int) ([]models.Todo, error) {
+	return s.getAll(userID, TodoFilter{})
+}
+
+func (s *TodoService) getAll(userID int, filter TodoFilter) ([]models.Todo, error) {
+	where, args, err := s.visibleTo(userID)
+	if err != nil {
+		return nil, err
+	}
+	if filter.AssignedTo != 0 {
+		where += " AND id IN (SELECT todo_id FROM todo_assignees WHERE user_id = ?)"
+		args = append(args, filter.AssignedTo)
+	}
+	if filter.SprintID != 0 {
+		where += " AND sprint_id = ?"
+		args = append(args, filter.SprintID)
+	}
+	if filter.Tag != "" {
+		where += " AND id IN (SELECT todo_id FROM todo_tags WHERE tag = ?)"
+		args = append(args, strings.ToLower(strings.TrimPrefix(filter.Tag, "#")))
+	}
+	if filter.View == ViewSnoozed {
+		where += " AND snoozed_until IS NOT NULL"
+	} else {
+		where += " AND snoozed_until IS NULL"
+	}
+	return s.queryTodos(where, args, userID)
+}
+
+// queryTodos returns the todos matching the condition with their details:
+// the user's own todos first, then those of shared lists, each in manual order
+func (s *TodoService) queryTodos(where string, args []interface{}, userID int) ([]models.Todo, error) {
+	args = append(args, userID)
 	rows, err := database.DB.Query(`
-		SELECT id, user_id, title, description, completed, order_no, created_at, updated_at 
+		SELECT `+todoColumns+`
 		FROM todos 
-		WHERE user_id = ? 
-		ORDER BY order_no ASC`, userID)
+		WHERE `+where+` 
+		ORDER BY CASE WHEN user_id = ? THEN 0 ELSE 1 END, user_id, order_no ASC`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -27,68 +186,305 @@ func (s *TodoService) GetAll(userID int) ([]models.Todo, error) {
 
 	var todos []models.Todo
 	for rows.Next() {
-		var todo models.Todo
-		if err := rows.Scan(&todo.ID, &todo.UserID, &todo.Title, &todo.Description, &todo.Completed, &todo.OrderNo, &todo.CreatedAt, &todo.UpdatedAt); err != nil {
+		todo, err := scanTodo(rows)
+		if err != nil {
 			return nil, err
 		}
-		todos = append(todos, todo)
+		todos = append(todos, *todo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return todos, attachDetails(database.DB, todos)
+}
+
+// visibleTo returns a condition on the todos table matching the active todos
+// the user can see in the service's tenant; see accessibleTo
+func (s *TodoService) visibleTo(userID int) (string, []interface{}, error) {
+	where, args, err := s.accessibleTo(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	return where + " AND archived_at IS NULL", args, nil
+}
+
+// accessibleTo returns a condition on the todos table matching the todos the
+// user can see in the service's tenant, archived or not: their own todos
+// outside lists and the todos of every list they can access
+func (s *TodoService) accessibleTo(userID int) (string, []interface{}, error) {
+	listIDs, err := s.lists.accessibleListIDs(userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	where := "org_id = ? AND ((user_id = ? AND list_id IS NULL)"
+	args := []interface{}{s.orgID, userID}
+	if len(listIDs) > 0 {
+		where += " OR list_id IN (" + inPlaceholders(len(listIDs)) + ")"
+		for _, id := range listIDs {
+			args = append(args, id)
+		}
+	}
+	return where + ")", args, nil
+}
+
+// GetAllSorted returns the user's todos in the requested order: "manual"
+// (order_no, the default), "priority" or "smart" (see SmartSortWeights).
+func (s *TodoService) GetAllSorted(userID int, sortBy string, filter TodoFilter) ([]models.Todo, error) {
+	if sortBy != "" && sortBy != SortManual && sortBy != SortPriority && sortBy != SortSmart {
+		return nil, fmt.Errorf("invalid sort: must be one of %s, %s, %s", SortManual, SortPriority, SortSmart)
+	}
+	if filter.View != ViewDefault && filter.View != ViewSnoozed {
+		return nil, fmt.Errorf("invalid view: must be %s", ViewSnoozed)
+	}
+
+	todos, err := s.getAll(userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	switch sortBy {
+	case SortPriority:
+		sortByPriority(todos)
+	case SortSmart:
+		sortBySmartScore(todos, s.weights, time.Now())
 	}
 	return todos, nil
 }
 
 func (s *TodoService) GetByID(id, userID int) (*models.Todo, error) {
-	var todo models.Todo
-	err := database.DB.QueryRow(`
-		SELECT id, user_id, title, description, completed, order_no, created_at, updated_at 
+	todo, err := s.authorize(id, userID, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	return withDetails(s.db(), todo)
+}
+
+// authorize loads a todo and checks that the user holds at least the required
+// role on it. Users without any access get "todo not found".
+func (s *TodoService) authorize(id, userID int, required string) (*models.Todo, error) {
+	todo, err := scanTodo(s.db().QueryRow(`
+		SELECT `+todoColumns+`
 		FROM todos 
-		WHERE id = ? AND user_id = ?`, id, userID).
-		Scan(&todo.ID, &todo.UserID, &todo.Title, &todo.Description, &todo.Completed, &todo.OrderNo, &todo.CreatedAt, &todo.UpdatedAt)
-	
+		WHERE id = ? AND org_id = ?`, id, s.orgID))
+
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("todo not found")
 	}
-	return &todo, err
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := todoRole(s.db(), todo, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, fmt.Errorf("todo not found")
+	}
+	if !models.HasRole(role, required) {
+		return nil, fmt.Errorf("access denied")
+	}
+	return todo, nil
+}
+
+// authorizeActive is authorize for changes archived todos do not allow; they
+// have to be restored first
+func (s *TodoService) authorizeActive(id, userID int, required string) (*models.Todo, error) {
+	todo, err := s.authorize(id, userID, required)
+	if err != nil {
+		return nil, err
+	}
+	if todo.ArchivedAt != nil {
+		return nil, fmt.Errorf("todo is archived")
+	}
+	return todo, nil
 }
 
 func (s *TodoService) Create(todo *models.Todo, userID int) (*models.Todo, error) {
 	if todo.Title == "" {
 		return nil, fmt.Errorf("title is required")
 	}
+	if err := normalizeTodo(todo); err != nil {
+		return nil, err
+	}
 
-	// Get the next order number for this user
-	nextOrderNo, err := s.getNextOrderNo(userID)
+	// Todos in a list belong to the list owner, whose manual order they join
+	ownerID := userID
+	if todo.ListID != nil {
+		list, err := s.lists.getWithRole(*todo.ListID, userID, models.RoleEditor)
+		if err != nil {
+			return nil, err
+		}
+		ownerID = list.UserID
+	}
+
+	tx, err := database.DB.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("error getting next order number: %v", err)
+		return nil, fmt.Errorf("error starting transaction: %v", err)
 	}
+	defer tx.Rollback()
 
-	result, err := database.DB.Exec(`
-		INSERT INTO todos (user_id, title, description, completed, order_no) 
-		VALUES (?, ?, ?, ?, ?)`, 
-		userID, todo.Title, todo.Description, todo.Completed, nextOrderNo)
+	id, err := s.insertTodo(tx, todo, ownerID, userID)
+	if err != nil {
+		return nil, err
+	}
+	created, err := loadTodo(tx, id)
 	if err != nil {
 		return nil, err
 	}
+	events := createdEvents(created, userID)
+	if err := s.stage(tx, events...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.emit(events...)
+	s.journal(userID, models.OperationCreate, nil, created)
+	return created, nil
+}
+
+// insertTodo adds a validated todo at the end of the owner's manual order.
+// Todos in a list start in a workflow state and at the end of its column.
+// The caller checks access to the list.
+func (s *TodoService) insertTodo(db sqlExecutor, todo *models.Todo, ownerID, userID int) (int, error) {
+	statePosition := 0
+	if todo.ListID != nil {
+		workflow, err := loadWorkflow(db, *todo.ListID)
+		if err != nil {
+			return 0, fmt.Errorf("error loading workflow: %v", err)
+		}
+		state, err := stateForNewTodo(workflow, todo)
+		if err != nil {
+			return 0, err
+		}
+		if err := checkWIPLimit(db, *todo.ListID, state, 0); err != nil {
+			return 0, err
+		}
+		count, err := countInState(db, *todo.ListID, state.Name, 0)
+		if err != nil {
+			return 0, err
+		}
+		todo.State = state.Name
+		todo.Completed = state.IsTerminal
+		statePosition = count + 1
+	} else {
+		todo.State = ""
+	}
+
+	// Get the next order number for the owner
+	nextOrderNo, err := s.getNextOrderNo(db, ownerID)
+	if err != nil {
+		return 0, fmt.Errorf("error getting next order number: %v", err)
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO todos (user_id, org_id, list_id, title, description, completed, priority, estimate, due_date, order_no, state, state_position, recurrence, created_by, updated_by) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, 
+		ownerID, s.orgID, todo.ListID, todo.Title, todo.Description, todo.Completed, todo.Priority, todo.Estimate, todo.DueDate, nextOrderNo,
+		nullableString(todo.State), statePosition, nullableString(todo.Recurrence), userID, userID)
+	if err != nil {
+		return 0, err
+	}
 
 	id, _ := result.LastInsertId()
-	return s.GetByID(int(id), userID)
+	if err := setTags(db, int(id), todo.Tags); err != nil {
+		return 0, err
+	}
+	if todo.Completed {
+		if err := recordCompletion(db, int(id), true); err != nil {
+			return 0, err
+		}
+	}
+	return int(id), nil
 }
 
+// Update replaces the editable fields of a todo. A nil list_id keeps the todo
+// in its current list and 0 moves it out of any list. For todos in a list,
+// changing completed moves the todo to a terminal or open workflow state.
 func (s *TodoService) Update(id int, todo *models.Todo, userID int) (*models.Todo, error) {
 	if todo.Title == "" {
 		return nil, fmt.Errorf("title is required")
 	}
+	if err := normalizeTodo(todo); err != nil {
+		return nil, err
+	}
 
-	// Check if todo exists and belongs to user
-	existingTodo, err := s.GetByID(id, userID)
+	// Check if todo exists and the user may edit it
+	existingTodo, err := s.authorizeActive(id, userID, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
+	if existingTodo, err = withDetails(s.db(), existingTodo); err != nil {
+		return nil, err
+	}
 
-	result, err := database.DB.Exec(`
+	listID := existingTodo.ListID
+	if todo.ListID != nil {
+		if *todo.ListID == 0 {
+			listID = nil
+		} else {
+			list, err := s.lists.getWithRole(*todo.ListID, userID, models.RoleEditor)
+			if err != nil {
+				return nil, err
+			}
+			// The manual order belongs to the owner, so todos stay with their owner
+			if list.UserID != existingTodo.UserID {
+				return nil, fmt.Errorf("todo can only be moved to lists with the same owner")
+			}
+			listID = todo.ListID
+		}
+	}
+	listChanged := !sameListID(existingTodo.ListID, listID)
+
+	tx, err := s.begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	completed := todo.Completed
+	state := ""
+	statePosition := 0
+	if listID != nil {
+		workflow, err := loadWorkflow(tx, *listID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading workflow: %v", err)
+		}
+		target, err := stateForUpdate(workflow, existingTodo, todo, listChanged)
+		if err != nil {
+			return nil, err
+		}
+
+		state = target.Name
+		completed = target.IsTerminal
+		statePosition = existingTodo.StatePosition
+		if listChanged || target.Name != existingTodo.State {
+			if err := checkWIPLimit(tx, *listID, target, id); err != nil {
+				return nil, err
+			}
+			count, err := countInState(tx, *listID, target.Name, id)
+			if err != nil {
+				return nil, err
+			}
+			statePosition = count + 1
+		}
+	}
+
+	leavingColumn := existingTodo.ListID != nil && (listChanged || state != existingTodo.State)
+	if leavingColumn {
+		if err := removeFromColumn(tx, *existingTodo.ListID, existingTodo.State, existingTodo.StatePosition, id); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := tx.Exec(`
 		UPDATE todos 
-		SET title = ?, description = ?, completed = ? 
-		WHERE id = ? AND user_id = ?`, 
-		todo.Title, todo.Description, todo.Completed, id, userID)
+		SET list_id = ?, title = ?, description = ?, completed = ?, priority = ?, estimate = ?, due_date = ?, state = ?, state_position = ?, recurrence = ?, updated_by = ? 
+		WHERE id = ? AND org_id = ?`, 
+		listID, todo.Title, todo.Description, completed, todo.Priority, todo.Estimate, todo.DueDate,
+		nullableString(state), statePosition, nullableString(todo.Recurrence), userID, id, s.orgID)
 	if err != nil {
 		return nil, err
 	}
@@ -97,37 +493,95 @@ func (s *TodoService) Update(id int, todo *models.Todo, userID int) (*models.Tod
 		return nil, fmt.Errorf("todo not found")
 	}
 
-	// Return updated todo with preserved order_no
-	updatedTodo := &models.Todo{
-		ID:          existingTodo.ID,
-		UserID:      existingTodo.UserID,
-		Title:       todo.Title,
-		Description: todo.Description,
-		Completed:   todo.Completed,
-		OrderNo:     existingTodo.OrderNo,
-		CreatedAt:   existingTodo.CreatedAt,
-		UpdatedAt:   existingTodo.UpdatedAt,
+	if completed != existingTodo.Completed {
+		if err := recordCompletion(tx, id, completed); err != nil {
+			return nil, err
+		}
+	}
+	if completed && !existingTodo.Completed {
+		if err := stopTimers(tx, id); err != nil {
+			return nil, err
+		}
+	}
+	if todo.Tags != nil {
+		if err := setTags(tx, id, todo.Tags); err != nil {
+			return nil, err
+		}
+	}
+	var next *models.Todo
+	if completed && !existingTodo.Completed && todo.Recurrence != "" {
+		completedTodo := *todo
+		completedTodo.ID, completedTodo.UserID, completedTodo.ListID = id, existingTodo.UserID, listID
+		if next, err = s.spawnNextOccurrence(tx, &completedTodo, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Assignees who cannot see the todo in its new list are unassigned, and
+	// sprints belong to the list the todo leaves
+	var unassigned []TodoEvent
+	if listChanged {
+		if unassigned, err = unassignWithoutAccess(tx, "a.todo_id = ?", id); err != nil {
+			return nil, err
+		}
+		if existingTodo.SprintID != nil {
+			if err := moveToSprint(tx, id, nil, time.Now().UTC()); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	return updatedTodo, nil
+	// Return updated todo with preserved order_no
+	updated, err := loadTodo(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	events := append(changeEvents(existingTodo, updated, userID), unassigned...)
+	if next != nil {
+		events = append(events, createdEvents(next, userID)...)
+	}
+	if err := s.stage(tx, events...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.emit(events...)
+	s.journalOccurrence(userID, models.OperationUpdate, existingTodo, updated, next)
+	return updated, nil
 }
 
 func (s *TodoService) Delete(id, userID int) error {
 	// Get the todo to be deleted to know its order_no
-	todoToDelete, err := s.GetByID(id, userID)
+	todoToDelete, err := s.authorize(id, userID, models.RoleEditor)
 	if err != nil {
 		return err
 	}
+	if todoToDelete, err = withDetails(s.db(), todoToDelete); err != nil {
+		return err
+	}
 
 	// Start transaction
-	tx, err := database.DB.Begin()
+	tx, err := s.begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %v", err)
 	}
 	defer tx.Rollback()
 
+	if err := stopTimers(tx, id); err != nil {
+		return err
+	}
+
+	// Remove the todo's comments, replies first
+	if _, err := tx.Exec("DELETE FROM todo_comments WHERE todo_id = ? AND parent_id IS NOT NULL", id); err != nil {
+		return fmt.Errorf("error deleting comments: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM todo_comments WHERE todo_id = ?", id); err != nil {
+		return fmt.Errorf("error deleting comments: %v", err)
+	}
+
 	// Delete the todo
-	result, err := tx.Exec("DELETE FROM todos WHERE id = ? AND user_id = ?", id, userID)
+	result, err := tx.Exec("DELETE FROM todos WHERE id = ? AND org_id = ?", id, s.orgID)
 	if err != nil {
 		return err
 	}
@@ -136,28 +590,55 @@ func (s *TodoService) Delete(id, userID int) error {
 		return fmt.Errorf("todo not found")
 	}
 
+	// Archived todos have already left the manual order and their column
+	archived := todoToDelete.ArchivedAt != nil
+
 	// Update order numbers for remaining todos
-	_, err = tx.Exec(`
-		UPDATE todos 
-		SET order_no = order_no - 1 
-		WHERE user_id = ? AND order_no > ?`, 
-		userID, todoToDelete.OrderNo)
-	if err != nil {
-		return fmt.Errorf("error updating order numbers: %v", err)
+	if !archived {
+		_, err = tx.Exec(`
+			UPDATE todos 
+			SET order_no = order_no - 1 
+			WHERE user_id = ? AND org_id = ? AND order_no > ?`, 
+			todoToDelete.UserID, s.orgID, todoToDelete.OrderNo)
+		if err != nil {
+			return fmt.Errorf("error updating order numbers: %v", err)
+		}
+	}
+
+	// Close the gap in the todo's board column
+	if !archived && todoToDelete.ListID != nil && todoToDelete.State != "" {
+		if err := removeFromColumn(tx, *todoToDelete.ListID, todoToDelete.State, todoToDelete.StatePosition, id); err != nil {
+			return err
+		}
 	}
 
-	return tx.Commit()
+	event := TodoEvent{Type: EventTodoDeleted, Todo: todoToDelete, ActorID: userID}
+	if err := s.stage(tx, event); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.emit(event)
+	s.journal(userID, models.OperationDelete, todoToDelete, nil)
+	return nil
 }
 
 func (s *TodoService) ReorderTodos(userID int, todoID int, newOrderNo int) error {
 	// Get current todo
-	currentTodo, err := s.GetByID(todoID, userID)
+	currentTodo, err := s.authorizeActive(todoID, userID, models.RoleEditor)
 	if err != nil {
 		return err
 	}
+	if currentTodo, err = withDetails(s.db(), currentTodo); err != nil {
+		return err
+	}
 
-	// Get max order number for user
-	maxOrderNo, err := s.getMaxOrderNo(userID)
+	// Shared todos are ordered within their owner's todos
+	ownerID := currentTodo.UserID
+
+	// Get max order number for owner
+	maxOrderNo, err := s.getMaxOrderNo(ownerID)
 	if err != nil {
 		return err
 	}
@@ -172,7 +653,7 @@ func (s *TodoService) ReorderTodos(userID int, todoID int, newOrderNo int) error
 	}
 
 	// Start transaction
-	tx, err := database.DB.Begin()
+	tx, err := s.begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %v", err)
 	}
@@ -183,15 +664,15 @@ func (s *TodoService) ReorderTodos(userID int, todoID int, newOrderNo int) error
 		_, err = tx.Exec(`
 			UPDATE todos 
 			SET order_no = order_no - 1 
-			WHERE user_id = ? AND order_no > ? AND order_no <= ?`,
-			userID, currentTodo.OrderNo, newOrderNo)
+			WHERE user_id = ? AND org_id = ? AND order_no > ? AND order_no <= ?`,
+			ownerID, s.orgID, currentTodo.OrderNo, newOrderNo)
 	} else {
 		// Moving up: shift todos down
 		_, err = tx.Exec(`
 			UPDATE todos 
 			SET order_no = order_no + 1 
-			WHERE user_id = ? AND order_no >= ? AND order_no < ?`,
-			userID, newOrderNo, currentTodo.OrderNo)
+			WHERE user_id = ? AND org_id = ? AND order_no >= ? AND order_no < ?`,
+			ownerID, s.orgID, newOrderNo, currentTodo.OrderNo)
 	}
 
 	if err != nil {
@@ -201,22 +682,35 @@ func (s *TodoService) ReorderTodos(userID int, todoID int, newOrderNo int) error
 	// Update the target todo's order
 	_, err = tx.Exec(`
 		UPDATE todos 
-		SET order_no = ? 
-		WHERE id = ? AND user_id = ?`,
-		newOrderNo, todoID, userID)
+		SET order_no = ?, updated_by = ? 
+		WHERE id = ? AND org_id = ?`,
+		newOrderNo, userID, todoID, s.orgID)
 	if err != nil {
 		return fmt.Errorf("error updating todo order: %v", err)
 	}
 
-	return tx.Commit()
+	moved, err := loadTodo(tx, todoID)
+	if err != nil {
+		return err
+	}
+	event := TodoEvent{Type: EventTodoReordered, Todo: moved, ActorID: userID}
+	if err := s.stage(tx, event); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.emit(event)
+	s.journal(userID, models.OperationReorder, currentTodo, moved)
+	return nil
 }
 
-func (s *TodoService) getNextOrderNo(userID int) (int, error) {
+func (s *TodoService) getNextOrderNo(db sqlExecutor, userID int) (int, error) {
 	var maxOrderNo sql.NullInt64
-	err := database.DB.QueryRow(`
+	err := db.QueryRow(`
 		SELECT MAX(order_no) 
 		FROM todos 
-		WHERE user_id = ?`, userID).Scan(&maxOrderNo)
+		WHERE user_id = ? AND org_id = ?`, userID, s.orgID).Scan(&maxOrderNo)
 	
 	if err != nil {
 		return 0, err
@@ -231,10 +725,10 @@ func (s *TodoService) getNextOrderNo(userID int) (int, error) {
 
 func (s *TodoService) getMaxOrderNo(userID int) (int, error) {
 	var maxOrderNo sql.NullInt64
-	err := database.DB.QueryRow(`
+	err := s.db().QueryRow(`
 		SELECT MAX(order_no) 
 		FROM todos 
-		WHERE user_id = ?`, userID).Scan(&maxOrderNo)
+		WHERE user_id = ? AND org_id = ?`, userID, s.orgID).Scan(&maxOrderNo)
 	
 	if err != nil {
 		return 0, err
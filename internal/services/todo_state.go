@@ -0,0 +1,250 @@
+package services
+
+import (
+	"fmt"
+
+	"todo/internal/models"
+)
+
+// stateForNewTodo picks the state of a todo created in a list: the requested
+// state, or the first terminal/open state depending on completed
+func stateForNewTodo(workflow *models.Workflow, todo *models.Todo) (*models.WorkflowState, error) {
+	if todo.State != "" {
+		state := findState(workflow, todo.State)
+		if state == nil {
+			return nil, fmt.Errorf("unknown state: %s", todo.State)
+		}
+		return state, nil
+	}
+
+	for i := range workflow.States {
+		if workflow.States[i].IsTerminal == todo.Completed {
+			return &workflow.States[i], nil
+		}
+	}
+	return nil, fmt.Errorf("list has no matching workflow state")
+}
+
+// stateForUpdate picks the state of a todo after an update. An explicit state
+// wins; otherwise a change of completed maps onto a reachable terminal or open
+// state so that clients unaware of workflows keep working.
+func stateForUpdate(workflow *models.Workflow, existing, todo *models.Todo, listChanged bool) (*models.WorkflowState, error) {
+	if listChanged {
+		return stateForNewTodo(workflow, todo)
+	}
+
+	if todo.State != "" && todo.State != existing.State {
+		target := findState(workflow, todo.State)
+		if target == nil {
+			return nil, fmt.Errorf("unknown state: %s", todo.State)
+		}
+		if !canTransition(workflow, existing.State, target.Name) {
+			return nil, fmt.Errorf("transition from %s to %s is not allowed", existing.State, target.Name)
+		}
+		return target, nil
+	}
+
+	current := findState(workflow, existing.State)
+	if current == nil {
+		current = initialState(workflow)
+	}
+	if current == nil || todo.State != "" || todo.Completed == current.IsTerminal {
+		return current, nil
+	}
+
+	var target *models.WorkflowState
+	if todo.Completed {
+		target = terminalStateFrom(workflow, current.Name)
+	} else {
+		target = openStateFrom(workflow, current.Name)
+	}
+	if target == nil {
+		return nil, fmt.Errorf("transition from %s is not allowed", current.Name)
+	}
+	return target, nil
+}
+
+// TransitionTodo moves a todo to a workflow state and a position within that
+// state's column. An empty state keeps the current column, which reorders the
+// todo within it; position 0 appends to the end of the column.
+func (s *TodoService) TransitionTodo(id, userID int, stateName string, position int) (*models.Todo, error) {
+	todo, err := s.authorizeActive(id, userID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if todo, err = withDetails(s.db(), todo); err != nil {
+		return nil, err
+	}
+	if todo.ListID == nil {
+		return nil, fmt.Errorf("todo is not in a list")
+	}
+	listID := *todo.ListID
+	if stateName == "" {
+		stateName = todo.State
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	workflow, err := loadWorkflow(tx, listID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading workflow: %v", err)
+	}
+	target := findState(workflow, stateName)
+	if target == nil {
+		return nil, fmt.Errorf("unknown state: %s", stateName)
+	}
+
+	changingState := target.Name != todo.State
+	if changingState {
+		if !canTransition(workflow, todo.State, target.Name) {
+			return nil, fmt.Errorf("transition from %s to %s is not allowed", todo.State, target.Name)
+		}
+		if err := checkWIPLimit(tx, listID, target, id); err != nil {
+			return nil, err
+		}
+	}
+
+	others, err := countInState(tx, listID, target.Name, id)
+	if err != nil {
+		return nil, err
+	}
+	if position == 0 {
+		position = others + 1
+	}
+	if position < 1 || position > others+1 {
+		return nil, fmt.Errorf("invalid position: must be between 1 and %d", others+1)
+	}
+
+	if !changingState && position == todo.StatePosition {
+		return todo, nil // No change needed
+	}
+
+	if todo.State != "" {
+		if err := removeFromColumn(tx, listID, todo.State, todo.StatePosition, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := insertIntoColumn(tx, listID, target.Name, position, id); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE todos
+		SET state = ?, state_position = ?, completed = ?, updated_by = ?
+		WHERE id = ? AND org_id = ?`,
+		target.Name, position, target.IsTerminal, userID, id, s.orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error updating todo state: %v", err)
+	}
+	if target.IsTerminal != todo.Completed {
+		if err := recordCompletion(tx, id, target.IsTerminal); err != nil {
+			return nil, err
+		}
+	}
+	var next *models.Todo
+	if target.IsTerminal && !todo.Completed {
+		if err := stopTimers(tx, id); err != nil {
+			return nil, err
+		}
+		if todo.Recurrence != "" {
+			if next, err = s.spawnNextOccurrence(tx, todo, userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	moved, err := loadTodo(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	var events []TodoEvent
+	if changingState {
+		events = append(events, TodoEvent{Type: EventTodoStateChanged, Todo: moved, ActorID: userID})
+		if target.IsTerminal && !todo.Completed {
+			events = append(events, TodoEvent{Type: EventTodoCompleted, Todo: moved, ActorID: userID})
+		}
+	} else {
+		events = append(events, TodoEvent{Type: EventTodoReordered, Todo: moved, ActorID: userID})
+	}
+	if next != nil {
+		events = append(events, createdEvents(next, userID)...)
+	}
+	if err := s.stage(tx, events...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.emit(events...)
+	s.journalOccurrence(userID, models.OperationTransition, todo, moved, next)
+	return moved, nil
+}
+
+// syncStateCompletion brings the completed flag of the todos in a list state
+// in line with the state, after a workflow change made it terminal or open.
+// Todos are completed as by TransitionTodo: their timers stop and recurring
+// ones get their next occurrence. Archived todos are left as they are. It
+// returns the events of the changes.
+func (s *TodoService) syncStateCompletion(tx sqlExecutor, listID int, state models.WorkflowState, userID int) ([]TodoEvent, error) {
+	rows, err := tx.Query(`
+		SELECT id
+		FROM todos
+		WHERE list_id = ? AND org_id = ? AND state = ? AND completed <> ? AND archived_at IS NULL
+		FOR UPDATE`, listID, s.orgID, state.Name, state.IsTerminal)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var events []TodoEvent
+	for _, id := range ids {
+		todo, err := loadTodo(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec("UPDATE todos SET completed = ?, updated_by = ? WHERE id = ?", state.IsTerminal, userID, id)
+		if err != nil {
+			return nil, fmt.Errorf("error updating completed flags: %v", err)
+		}
+		if err := recordCompletion(tx, id, state.IsTerminal); err != nil {
+			return nil, err
+		}
+		var next *models.Todo
+		if state.IsTerminal {
+			if err := stopTimers(tx, id); err != nil {
+				return nil, err
+			}
+			if todo.Recurrence != "" {
+				if next, err = s.spawnNextOccurrence(tx, todo, userID); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		updated, err := loadTodo(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, changeEvents(todo, updated, userID)...)
+		if next != nil {
+			events = append(events, createdEvents(next, userID)...)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,753 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo/internal/database"
+	"todo/internal/models"
+)
+
+// DefaultWebhookInterval is used when WEBHOOK_SWEEP_INTERVAL is not set: how
+// often due webhook deliveries are sent
+const DefaultWebhookInterval = 10 * time.Second
+
+// Delivery of webhook events
+const (
+	MaxWebhookAttempts       = 8
+	WebhookFailureLimit      = 20               // failed attempts in a row before a webhook is disabled
+	webhookRetryDelay        = 30 * time.Second // doubled after each failed attempt
+	webhookMaxDelay          = time.Hour
+	webhookLease             = 2 * time.Minute // how long a delivery attempt holds a delivery
+	webhookBatchSize         = 100
+	webhookTimeout           = 10 * time.Second
+	webhookResponseLimit     = 4096 // bytes of the response body kept in the log
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+)
+
+// Webhook delivery pages default to DefaultWebhookDeliveryPageSize entries
+const (
+	DefaultWebhookDeliveryPageSize = 50
+	MaxWebhookDeliveryPageSize     = 200
+)
+
+// WebhookEvents are the todo events webhooks can subscribe to
+var WebhookEvents = []string{
+	EventTodoCreated,
+	EventTodoUpdated,
+	EventTodoCompleted,
+	EventTodoDeleted,
+	EventTodoReordered,
+	EventTodoStateChanged,
+	EventTodoAssigned,
+	EventTodoUnassigned,
+	EventTodoTagged,
+}
+
+// WebhookService manages the webhooks of a tenant and delivers todo events
+// to them
+type WebhookService struct {
+	client *http.Client
+	orgID  int
+}
+
+func NewWebhookService() *WebhookService {
+	return &WebhookService{
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			// Webhook URLs are set by users: connections to the local machine
+			// and private networks are refused, however the URL's host
+			// resolves at the time, and no proxy is used
+			Transport: &http.Transport{
+				DialContext:         publicDialer(webhookTimeout).DialContext,
+				TLSHandshakeTimeout: webhookTimeout,
+				MaxIdleConnsPerHost: 2,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// Redirects are not followed: webhooks are set up with their
+			// final URL, and a redirect counts as a failed attempt
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// ForOrg returns a copy of the service scoped to an organization
+func (s *WebhookService) ForOrg(orgID int) *WebhookService {
+	return &WebhookService{
+		client: s.client,
+		orgID:  orgID,
+	}
+}
+
+func (s *WebhookService) GetWebhooks(userID int) ([]models.Webhook, error) {
+	where, args, err := s.managedBy(userID)
+	if err != nil {
+		return nil, err
+	}
+	return queryWebhooks(where+" ORDER BY id ASC", args...)
+}
+
+func (s *WebhookService) GetWebhook(id, userID int) (*models.Webhook, error) {
+	where, args, err := s.managedBy(userID)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := queryWebhooks("id = ? AND "+where, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, fmt.Errorf("webhook not found")
+	}
+	return &webhooks[0], nil
+}
+
+// CreateWebhook adds a webhook to the tenant. The result holds the secret
+// the webhook's requests are signed with.
+func (s *WebhookService) CreateWebhook(req *models.WebhookRequest, userID int) (*models.Webhook, error) {
+	where, args, err := s.managedBy(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWebhook(req); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM webhooks WHERE "+where, args...).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= models.MaxWebhooks {
+		return nil, fmt.Errorf("webhook limit reached: at most %d webhooks", models.MaxWebhooks)
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	events, err := json.Marshal(req.Events)
+	if err != nil {
+		return nil, err
+	}
+	var ownerID interface{}
+	if s.orgID == 0 {
+		ownerID = userID
+	}
+	result, err := database.DB.Exec(`
+		INSERT INTO webhooks (org_id, user_id, created_by, url, events, description, secret, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.orgID, ownerID, userID, req.URL, string(events), req.Description, secret, req.Enabled == nil || *req.Enabled)
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	webhook, err := s.GetWebhook(int(id), userID)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = secret
+	return webhook, nil
+}
+
+// UpdateWebhook replaces a webhook's settings. Enabling a disabled webhook
+// resets its failure count and resumes its pending deliveries.
+func (s *WebhookService) UpdateWebhook(id int, req *models.WebhookRequest, userID int) (*models.Webhook, error) {
+	current, err := s.GetWebhook(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWebhook(req); err != nil {
+		return nil, err
+	}
+	events, err := json.Marshal(req.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := req.Enabled == nil || *req.Enabled
+	failures, disabledAt, reason := current.ConsecutiveFailures, current.DisabledAt, current.DisabledReason
+	if enabled && !current.Enabled {
+		failures, disabledAt, reason = 0, nil, ""
+	} else if !enabled && current.Enabled {
+		now := time.Now().UTC()
+		disabledAt, reason = &now, "disabled by a user"
+	}
+	_, err = database.DB.Exec(`
+		UPDATE webhooks
+		SET url = ?, events = ?, description = ?, enabled = ?, consecutive_failures = ?, disabled_at = ?,
+			disabled_reason = ?
+		WHERE id = ?`,
+		req.URL, string(events), req.Description, enabled, failures, disabledAt, reason, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetWebhook(id, userID)
+}
+
+func (s *WebhookService) DeleteWebhook(id, userID int) error {
+	if _, err := s.GetWebhook(id, userID); err != nil {
+		return err
+	}
+	_, err := database.DB.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	return err
+}
+
+// RotateSecret replaces a webhook's secret. Pending deliveries are signed
+// with the new one.
+func (s *WebhookService) RotateSecret(id, userID int) (*models.Webhook, error) {
+	if _, err := s.GetWebhook(id, userID); err != nil {
+		return nil, err
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := database.DB.Exec("UPDATE webhooks SET secret = ? WHERE id = ?", secret, id); err != nil {
+		return nil, err
+	}
+	webhook, err := s.GetWebhook(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = secret
+	return webhook, nil
+}
+
+// GetDeliveries returns a page of a webhook's delivery log, newest first,
+// optionally only the deliveries in a status
+func (s *WebhookService) GetDeliveries(id, userID int, status string, page, pageSize int) (*models.WebhookDeliveryPage, error) {
+	if _, err := s.GetWebhook(id, userID); err != nil {
+		return nil, err
+	}
+	if status != "" && status != models.DeliveryPending && status != models.DeliverySent && status != models.DeliveryFailed {
+		return nil, fmt.Errorf("invalid status: must be pending, sent or failed")
+	}
+	if page < 1 {
+		return nil, fmt.Errorf("invalid page: must be at least 1")
+	}
+	if pageSize < 1 || pageSize > MaxWebhookDeliveryPageSize {
+		return nil, fmt.Errorf("invalid page_size: must be between 1 and %d", MaxWebhookDeliveryPageSize)
+	}
+
+	where, args := "webhook_id = ?", []interface{}{id}
+	if status != "" {
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+	result := &models.WebhookDeliveryPage{Deliveries: []models.WebhookDelivery{}, Page: page, PageSize: pageSize}
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM webhook_deliveries WHERE "+where, args...).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := queryDeliveries(false, where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		return nil, err
+	}
+	result.Deliveries = deliveries
+	return result, nil
+}
+
+// GetDelivery returns an entry of a webhook's delivery log with its payload
+func (s *WebhookService) GetDelivery(id, deliveryID, userID int) (*models.WebhookDelivery, error) {
+	if _, err := s.GetWebhook(id, userID); err != nil {
+		return nil, err
+	}
+	deliveries, err := queryDeliveries(true, "id = ? AND webhook_id = ?", deliveryID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, fmt.Errorf("delivery not found")
+	}
+	return &deliveries[0], nil
+}
+
+// Redeliver queues the event of a delivery again, with the same event ID
+// and payload, to be sent right away
+func (s *WebhookService) Redeliver(id, deliveryID, userID int) (*models.WebhookDelivery, error) {
+	webhook, err := s.GetWebhook(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !webhook.Enabled {
+		return nil, fmt.Errorf("webhook is disabled: enable it to redeliver events")
+	}
+	original, err := s.GetDelivery(id, deliveryID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, next_attempt_at, redelivery_of)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		id, original.EventID, original.Event, string(original.Payload), time.Now().UTC(), original.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error queueing redelivery: %v", err)
+	}
+	redeliveryID, _ := result.LastInsertId()
+	return s.GetDelivery(id, int(redeliveryID), userID)
+}
+
+// DeliverQueued sends the webhook deliveries that are due. The events of a
+// todo are sent to a webhook in order: while one is pending, the later ones
+// wait. Failed attempts are retried with exponential backoff, up to
+// MaxWebhookAttempts attempts, after which the todo's later events go ahead.
+// A webhook is disabled after WebhookFailureLimit failed attempts in a row,
+// or at once when its URL answers 410 Gone. It returns the number of
+// deliveries sent.
+func (s *WebhookService) DeliverQueued(now time.Time) (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT d.id, d.webhook_id, w.url, w.secret, d.event_id, d.event, d.payload, d.attempts, d.next_attempt_at,
+			d.todo_id, d.sequence
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? AND w.enabled = TRUE
+		ORDER BY d.next_attempt_at ASC, d.id ASC
+		LIMIT ?`, models.DeliveryPending, now, webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	type queuedDelivery struct {
+		id, webhookID, attempts int
+		url, secret             string
+		eventID, event, payload string
+		due                     time.Time
+		todoID, sequence        sql.NullInt64
+	}
+	var deliveries []queuedDelivery
+	for rows.Next() {
+		var d queuedDelivery
+		err := rows.Scan(&d.id, &d.webhookID, &d.url, &d.secret, &d.eventID, &d.event, &d.payload, &d.attempts, &d.due,
+			&d.todoID, &d.sequence)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	disabled := map[int]bool{} // webhooks disabled during this batch
+	for _, d := range deliveries {
+		if disabled[d.webhookID] {
+			continue
+		}
+		// An earlier event of the todo still pending, backing off or held
+		// by another worker, holds back this one
+		if d.todoID.Valid {
+			var earlier int
+			err := database.DB.QueryRow(`
+				SELECT COUNT(*)
+				FROM webhook_deliveries
+				WHERE webhook_id = ? AND todo_id = ? AND status = ? AND sequence < ?`,
+				d.webhookID, d.todoID.Int64, models.DeliveryPending, d.sequence.Int64).Scan(&earlier)
+			if err != nil {
+				return sent, err
+			}
+			if earlier > 0 {
+				continue
+			}
+		}
+		// Claim the delivery so that another worker does not send it too; if
+		// this one dies, the delivery is retried once the lease ends
+		result, err := database.DB.Exec(`
+			UPDATE webhook_deliveries
+			SET next_attempt_at = ?
+			WHERE id = ? AND status = ? AND next_attempt_at = ?`,
+			now.Add(webhookLease), d.id, models.DeliveryPending, d.due)
+		if err != nil {
+			return sent, err
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 0 {
+			continue
+		}
+
+		status, body, sendErr := s.send(d.url, d.secret, d.id, d.eventID, d.event, []byte(d.payload))
+		var responseStatus interface{}
+		if status != 0 {
+			responseStatus = status
+		}
+		attempts := d.attempts + 1
+		if sendErr == nil {
+			_, err = database.DB.Exec(`
+				UPDATE webhook_deliveries
+				SET status = ?, attempts = ?, response_status = ?, response_body = ?, last_error = NULL, delivered_at = ?
+				WHERE id = ?`, models.DeliverySent, attempts, responseStatus, body, time.Now().UTC(), d.id)
+			if err == nil {
+				_, err = database.DB.Exec(`
+					UPDATE webhooks
+					SET consecutive_failures = 0, updated_at = updated_at
+					WHERE id = ? AND consecutive_failures > 0`, d.webhookID)
+			}
+			if err != nil {
+				return sent, err
+			}
+			sent++
+			continue
+		}
+
+		if attempts >= MaxWebhookAttempts {
+			log.Printf("Webhook delivery %d to webhook %d failed for good: %v", d.id, d.webhookID, sendErr)
+			_, err = database.DB.Exec(`
+				UPDATE webhook_deliveries
+				SET status = ?, attempts = ?, response_status = ?, response_body = ?, last_error = ?
+				WHERE id = ?`, models.DeliveryFailed, attempts, responseStatus, body, sendErr.Error(), d.id)
+		} else {
+			_, err = database.DB.Exec(`
+				UPDATE webhook_deliveries
+				SET attempts = ?, response_status = ?, response_body = ?, last_error = ?, next_attempt_at = ?
+				WHERE id = ?`, attempts, responseStatus, body, sendErr.Error(),
+				time.Now().UTC().Add(backoff(attempts, webhookRetryDelay, webhookMaxDelay)), d.id)
+		}
+		if err != nil {
+			return sent, err
+		}
+		off, err := recordWebhookFailure(d.webhookID, status)
+		if err != nil {
+			return sent, err
+		}
+		disabled[d.webhookID] = off
+	}
+	return sent, nil
+}
+
+// RunDeliverer delivers due webhook events every WEBHOOK_SWEEP_INTERVAL and
+// prunes old entries of the delivery logs. It never returns.
+func (s *WebhookService) RunDeliverer() {
+	interval := envDuration("WEBHOOK_SWEEP_INTERVAL", DefaultWebhookInterval)
+	for {
+		now := time.Now().UTC()
+		if sent, err := s.DeliverQueued(now); err != nil {
+			log.Println("Webhook delivery failed:", err)
+		} else if sent > 0 {
+			log.Printf("Webhook delivery sent %d events", sent)
+		}
+		_, err := database.DB.Exec(`
+			DELETE FROM webhook_deliveries
+			WHERE status != ? AND created_at < ?`, models.DeliveryPending, now.Add(-webhookDeliveryRetention))
+		if err != nil {
+			log.Println("Webhook delivery log cleanup failed:", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// send posts a signed payload to a webhook. It returns the response status,
+// 0 when there was no response, and the start of the response body. Any
+// status but 2xx is an error.
+func (s *WebhookService) send(target, secret string, deliveryID int, eventID, event string, payload []byte) (int, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todo-webhooks/1.0")
+	req.Header.Set("X-Webhook-ID", eventID)
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(deliveryID))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(secret, timestamp, payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, truncate(string(body), webhookResponseLimit), fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return resp.StatusCode, truncate(string(body), webhookResponseLimit), nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 of the timestamp, a dot and the
+// body, as sent in X-Webhook-Signature
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordWebhookFailure counts a failed attempt against a webhook and disables
+// it when it answered 410 Gone or reached WebhookFailureLimit failures in a
+// row. It returns whether the webhook was disabled.
+func recordWebhookFailure(webhookID, status int) (bool, error) {
+	_, err := database.DB.Exec(`
+		UPDATE webhooks
+		SET consecutive_failures = consecutive_failures + 1, updated_at = updated_at
+		WHERE id = ?`, webhookID)
+	if err != nil {
+		return false, err
+	}
+
+	conditions, args := "consecutive_failures >= ?", []interface{}{WebhookFailureLimit}
+	reason := fmt.Sprintf("%d failed attempts in a row", WebhookFailureLimit)
+	if status == http.StatusGone {
+		conditions, args, reason = "TRUE", nil, "webhook answered 410 Gone"
+	}
+	result, err := database.DB.Exec(`
+		UPDATE webhooks
+		SET enabled = FALSE, disabled_at = ?, disabled_reason = ?
+		WHERE id = ? AND enabled = TRUE AND `+conditions,
+		append([]interface{}{time.Now().UTC(), reason, webhookID}, args...)...)
+	if err != nil {
+		return false, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return false, nil
+	}
+	log.Printf("Webhook %d disabled: %s", webhookID, reason)
+	return true, nil
+}
+
+// queueWebhookEvent queues a delivery of an event to the enabled webhooks of
+// its tenant subscribed to it and allowed to see its todo. Each webhook gets
+// an event once, however often it is queued.
+func queueWebhookEvent(event *OutboxEvent) error {
+	if event.Todo == nil || !containsString(WebhookEvents, event.Type) {
+		return nil
+	}
+	webhooks, err := queryWebhooks("org_id = ? AND enabled = TRUE", event.OrgID)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !containsString(webhook.Events, event.Type) {
+			continue
+		}
+		receives, err := webhookReceives(&webhook, event.Todo)
+		if err != nil {
+			return err
+		}
+		if !receives {
+			continue
+		}
+		if payload == nil {
+			payload, err = json.Marshal(models.WebhookPayload{
+				ID:        event.ID,
+				Type:      event.Type,
+				OrgID:     event.OrgID,
+				ActorID:   event.ActorID,
+				Sequence:  event.Sequence,
+				CreatedAt: event.CreatedAt,
+				Data:      models.WebhookEventData{Todo: event.Todo, Fields: event.Fields, Tags: event.Tags, UserIDs: event.UserIDs},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		_, err = database.DB.Exec(`
+			INSERT INTO webhook_deliveries (webhook_id, dedupe_key, todo_id, sequence, event_id, event, payload, next_attempt_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE id = id`,
+			webhook.ID, fmt.Sprintf("%s:%d", event.ID, webhook.ID), event.Todo.ID, event.Sequence, event.ID, event.Type,
+			string(payload), time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("error queueing delivery for webhook %d: %v", webhook.ID, err)
+		}
+	}
+	return nil
+}
+
+// webhookReceives reports whether a webhook gets the events of a todo:
+// personal webhooks those of the todos their owner can see, organization
+// webhooks those of the todos in the organization's lists
+func webhookReceives(webhook *models.Webhook, todo *models.Todo) (bool, error) {
+	if webhook.OrgID != 0 {
+		return todo.ListID != nil, nil
+	}
+	role, err := todoRole(database.DB, todo, webhook.UserID)
+	if err != nil {
+		return false, err
+	}
+	return role != "", nil
+}
+
+// managedBy returns the conditions selecting the webhooks the user manages in
+// the service's tenant: their own in the personal workspace, or all of an
+// organization's webhooks for its admins
+func (s *WebhookService) managedBy(userID int) (string, []interface{}, error) {
+	if s.orgID == 0 {
+		return "org_id = 0 AND user_id = ?", []interface{}{userID}, nil
+	}
+	access, err := loadOrgAccess(database.DB, s.orgID, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if access.Role == "" {
+		return "", nil, fmt.Errorf("organization not found")
+	}
+	if !models.HasOrgRole(access.Role, models.OrgRoleAdmin) {
+		return "", nil, fmt.Errorf("access denied")
+	}
+	return "org_id = ?", []interface{}{s.orgID}, nil
+}
+
+// validateWebhook trims and checks a webhook's settings
+func validateWebhook(req *models.WebhookRequest) error {
+	req.URL = strings.TrimSpace(req.URL)
+	if len(req.URL) > models.MaxWebhookURLLength {
+		return fmt.Errorf("invalid url: at most %d characters", models.MaxWebhookURLLength)
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid url: must be an absolute HTTP or HTTPS URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("invalid url: must not contain credentials")
+	}
+	if err := checkPublicHost(u.Hostname()); err != nil {
+		return fmt.Errorf("invalid url: %v", err)
+	}
+
+	if len(req.Events) == 0 {
+		return fmt.Errorf("events are required")
+	}
+	var events []string
+	for _, event := range req.Events {
+		if !containsString(WebhookEvents, event) {
+			return fmt.Errorf("invalid event: %q", event)
+		}
+		if !containsString(events, event) {
+			events = append(events, event)
+		}
+	}
+	req.Events = events
+
+	req.Description = strings.TrimSpace(req.Description)
+	if len(req.Description) > 255 {
+		return fmt.Errorf("invalid description: at most 255 characters")
+	}
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %v", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// newEventID returns a random ID identifying an event to its receivers
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating event ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func queryWebhooks(where string, args ...interface{}) ([]models.Webhook, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, org_id, user_id, url, events, description, enabled, consecutive_failures, disabled_at,
+			disabled_reason, created_at, updated_at
+		FROM webhooks
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var webhook models.Webhook
+		var userID sql.NullInt64
+		var events string
+		var disabledAt sql.NullTime
+		err := rows.Scan(&webhook.ID, &webhook.OrgID, &userID, &webhook.URL, &events, &webhook.Description,
+			&webhook.Enabled, &webhook.ConsecutiveFailures, &disabledAt, &webhook.DisabledReason,
+			&webhook.CreatedAt, &webhook.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		webhook.UserID = int(userID.Int64)
+		if disabledAt.Valid {
+			webhook.DisabledAt = &disabledAt.Time
+		}
+		if err := json.Unmarshal([]byte(events), &webhook.Events); err != nil {
+			return nil, fmt.Errorf("error reading webhook %d: %v", webhook.ID, err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// queryDeliveries reads delivery log entries, with their payload if asked
+func queryDeliveries(withPayload bool, where string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	payload := "''"
+	if withPayload {
+		payload = "payload"
+	}
+	rows, err := database.DB.Query(`
+		SELECT id, webhook_id, event_id, event, status, attempts, response_status, response_body, last_error,
+			redelivery_of, next_attempt_at, delivered_at, created_at, `+payload+`
+		FROM webhook_deliveries
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var responseStatus, redeliveryOf sql.NullInt64
+		var responseBody, lastError sql.NullString
+		var nextAttempt time.Time
+		var deliveredAt sql.NullTime
+		var raw string
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.Status, &d.Attempts, &responseStatus,
+			&responseBody, &lastError, &redeliveryOf, &nextAttempt, &deliveredAt, &d.CreatedAt, &raw)
+		if err != nil {
+			return nil, err
+		}
+		if responseStatus.Valid {
+			status := int(responseStatus.Int64)
+			d.ResponseStatus = &status
+		}
+		if redeliveryOf.Valid {
+			id := int(redeliveryOf.Int64)
+			d.RedeliveryOf = &id
+		}
+		if d.Status == models.DeliveryPending {
+			d.NextAttemptAt = &nextAttempt
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		d.ResponseBody, d.LastError = responseBody.String, lastError.String
+		if raw != "" {
+			d.Payload = json.RawMessage(raw)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
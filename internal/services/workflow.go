@@ -0,0 +1,265 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"todo/internal/models"
+)
+
+// sqlExecutor is implemented by both *sql.DB and *sql.Tx
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+var stateNameRegex = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// loadWorkflow reads the states (in column order) and transitions of a list
+func loadWorkflow(db sqlExecutor, listID int) (*models.Workflow, error) {
+	rows, err := db.Query(`
+		SELECT name, position, wip_limit, is_terminal
+		FROM list_states
+		WHERE list_id = ?
+		ORDER BY position ASC`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workflow := &models.Workflow{
+		States:      []models.WorkflowState{},
+		Transitions: []models.StateTransition{},
+	}
+	for rows.Next() {
+		var state models.WorkflowState
+		var wipLimit sql.NullInt64
+		if err := rows.Scan(&state.Name, &state.Position, &wipLimit, &state.IsTerminal); err != nil {
+			return nil, err
+		}
+		if wipLimit.Valid {
+			limit := int(wipLimit.Int64)
+			state.WIPLimit = &limit
+		}
+		workflow.States = append(workflow.States, state)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	transitionRows, err := db.Query(`
+		SELECT from_state, to_state
+		FROM list_state_transitions
+		WHERE list_id = ?
+		ORDER BY id ASC`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer transitionRows.Close()
+
+	for transitionRows.Next() {
+		var transition models.StateTransition
+		if err := transitionRows.Scan(&transition.From, &transition.To); err != nil {
+			return nil, err
+		}
+		workflow.Transitions = append(workflow.Transitions, transition)
+	}
+	return workflow, transitionRows.Err()
+}
+
+// saveWorkflow replaces the states and transitions of a list
+func saveWorkflow(tx *sql.Tx, listID int, workflow *models.Workflow) error {
+	if _, err := tx.Exec("DELETE FROM list_state_transitions WHERE list_id = ?", listID); err != nil {
+		return fmt.Errorf("error clearing transitions: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM list_states WHERE list_id = ?", listID); err != nil {
+		return fmt.Errorf("error clearing states: %v", err)
+	}
+
+	for i, state := range workflow.States {
+		_, err := tx.Exec(`
+			INSERT INTO list_states (list_id, name, position, wip_limit, is_terminal)
+			VALUES (?, ?, ?, ?, ?)`,
+			listID, state.Name, i+1, state.WIPLimit, state.IsTerminal)
+		if err != nil {
+			return fmt.Errorf("error saving state %s: %v", state.Name, err)
+		}
+	}
+
+	for _, transition := range workflow.Transitions {
+		_, err := tx.Exec(`
+			INSERT INTO list_state_transitions (list_id, from_state, to_state)
+			VALUES (?, ?, ?)`,
+			listID, transition.From, transition.To)
+		if err != nil {
+			return fmt.Errorf("error saving transition %s -> %s: %v", transition.From, transition.To, err)
+		}
+	}
+	return nil
+}
+
+// validateWorkflow checks that a workflow has unique, well-formed state names,
+// at least one open and one terminal state, and transitions between known states
+func validateWorkflow(workflow *models.Workflow) error {
+	if len(workflow.States) == 0 {
+		return fmt.Errorf("workflow must have at least one state")
+	}
+
+	names := make(map[string]bool)
+	hasOpen, hasTerminal := false, false
+	for _, state := range workflow.States {
+		if !stateNameRegex.MatchString(state.Name) {
+			return fmt.Errorf("invalid state name %q: use 1-32 lowercase letters, digits or underscores", state.Name)
+		}
+		if names[state.Name] {
+			return fmt.Errorf("duplicate state name %q", state.Name)
+		}
+		if state.WIPLimit != nil && *state.WIPLimit < 1 {
+			return fmt.Errorf("wip limit for state %q must be at least 1", state.Name)
+		}
+		names[state.Name] = true
+		if state.IsTerminal {
+			hasTerminal = true
+		} else {
+			hasOpen = true
+		}
+	}
+	if !hasOpen || !hasTerminal {
+		return fmt.Errorf("workflow must have at least one open and one terminal state")
+	}
+
+	for _, transition := range workflow.Transitions {
+		if !names[transition.From] || !names[transition.To] {
+			return fmt.Errorf("transition %s -> %s references an unknown state", transition.From, transition.To)
+		}
+		if transition.From == transition.To {
+			return fmt.Errorf("transition %s -> %s must change state", transition.From, transition.To)
+		}
+	}
+	return nil
+}
+
+func findState(workflow *models.Workflow, name string) *models.WorkflowState {
+	for i := range workflow.States {
+		if workflow.States[i].Name == name {
+			return &workflow.States[i]
+		}
+	}
+	return nil
+}
+
+// initialState is the first open state of a workflow
+func initialState(workflow *models.Workflow) *models.WorkflowState {
+	for i := range workflow.States {
+		if !workflow.States[i].IsTerminal {
+			return &workflow.States[i]
+		}
+	}
+	return nil
+}
+
+// terminalStateFrom picks the first terminal state reachable from the
+// current state, so that marking a todo completed respects the transitions
+func terminalStateFrom(workflow *models.Workflow, from string) *models.WorkflowState {
+	for i := range workflow.States {
+		if workflow.States[i].IsTerminal && canTransition(workflow, from, workflow.States[i].Name) {
+			return &workflow.States[i]
+		}
+	}
+	return nil
+}
+
+// openStateFrom picks the first open state reachable from the current state
+func openStateFrom(workflow *models.Workflow, from string) *models.WorkflowState {
+	for i := range workflow.States {
+		if !workflow.States[i].IsTerminal && canTransition(workflow, from, workflow.States[i].Name) {
+			return &workflow.States[i]
+		}
+	}
+	return nil
+}
+
+// canTransition reports whether a todo may move between two states.
+// Workflows without transitions allow every move.
+func canTransition(workflow *models.Workflow, from, to string) bool {
+	if from == to || from == "" || len(workflow.Transitions) == 0 {
+		return true
+	}
+	for _, transition := range workflow.Transitions {
+		if transition.From == from && transition.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+// countInState counts the active todos of a list in a state, excluding one
+// todo. Archived todos have left their column.
+func countInState(db sqlExecutor, listID int, state string, excludeTodoID int) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM todos
+		WHERE list_id = ? AND state = ? AND id <> ? AND archived_at IS NULL`,
+		listID, state, excludeTodoID).Scan(&count)
+	return count, err
+}
+
+// checkWIPLimit returns an error when moving one more todo into state would
+// exceed its work-in-progress limit
+func checkWIPLimit(db sqlExecutor, listID int, state *models.WorkflowState, todoID int) error {
+	if state.WIPLimit == nil {
+		return nil
+	}
+	count, err := countInState(db, listID, state.Name, todoID)
+	if err != nil {
+		return fmt.Errorf("error checking wip limit: %v", err)
+	}
+	if count >= *state.WIPLimit {
+		return fmt.Errorf("wip limit reached for state %s (%d)", state.Name, *state.WIPLimit)
+	}
+	return nil
+}
+
+// removeFromColumn closes the gap todoID leaves behind in its column
+func removeFromColumn(db sqlExecutor, listID int, state string, position, todoID int) error {
+	_, err := db.Exec(`
+		UPDATE todos
+		SET state_position = state_position - 1
+		WHERE list_id = ? AND state = ? AND state_position > ? AND id <> ?`,
+		listID, state, position, todoID)
+	if err != nil {
+		return fmt.Errorf("error updating column positions: %v", err)
+	}
+	return nil
+}
+
+// insertIntoColumn makes room for todoID at position in a column
+func insertIntoColumn(db sqlExecutor, listID int, state string, position, todoID int) error {
+	_, err := db.Exec(`
+		UPDATE todos
+		SET state_position = state_position + 1
+		WHERE list_id = ? AND state = ? AND state_position >= ? AND id <> ?`,
+		listID, state, position, todoID)
+	if err != nil {
+		return fmt.Errorf("error updating column positions: %v", err)
+	}
+	return nil
+}
+
+// nullableString stores empty strings as NULL
+func nullableString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func sameListID(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
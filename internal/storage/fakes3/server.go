@@ -0,0 +1,205 @@
+// Package fakes3 is an in-process stand-in for an S3-compatible service, for
+// local testing. It keeps objects in memory, checks the AWS Signature Version
+// 4 of every request against its credentials and supports the requests made
+// by storage.S3Store: PUT, GET (with Range), HEAD and DELETE on path-style
+// object URLs.
+package fakes3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// maxClockSkew is how far the request time may be from the server's, as on S3
+const maxClockSkew = 15 * time.Minute
+
+type object struct {
+	data        []byte
+	contentType string
+	modified    time.Time
+}
+
+type Server struct {
+	accessKey string
+	secretKey string
+
+	mu      sync.RWMutex
+	objects map[string]object
+}
+
+// New returns a server accepting the requests signed with the given
+// credentials, in any region
+func New(accessKey, secretKey string) *Server {
+	return &Server{accessKey: accessKey, secretKey: secretKey, objects: make(map[string]object)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "IncompleteBody", http.StatusBadRequest)
+		return
+	}
+	if code := s.verify(r, body, time.Now()); code != "" {
+		http.Error(w, code, http.StatusForbidden)
+		return
+	}
+
+	// Path-style URLs: /bucket/key
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.Contains(key, "/") {
+		http.Error(w, "InvalidRequest", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.mu.Lock()
+		s.objects[key] = object{data: body, contentType: r.Header.Get("Content-Type"), modified: time.Now()}
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodGet, http.MethodHead:
+		s.mu.RLock()
+		obj, ok := s.objects[key]
+		s.mu.RUnlock()
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		if obj.contentType != "" {
+			w.Header().Set("Content-Type", obj.contentType)
+		}
+		http.ServeContent(w, r, "", obj.modified, bytes.NewReader(obj.data))
+
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// verify checks the Signature Version 4 of a request as S3 does, and returns
+// the S3 error code when it is not valid
+func (s *Server) verify(r *http.Request, body []byte, now time.Time) string {
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	if !ok {
+		return "AccessDenied"
+	}
+	fields := make(map[string]string)
+	for _, field := range strings.Split(auth, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		fields[name] = value
+	}
+
+	// Credential=<access key>/<date>/<region>/s3/aws4_request
+	credential := strings.Split(fields["Credential"], "/")
+	if len(credential) != 5 || credential[3] != "s3" || credential[4] != "aws4_request" {
+		return "AuthorizationHeaderMalformed"
+	}
+	if credential[0] != s.accessKey {
+		return "InvalidAccessKeyId"
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil || credential[1] != signedAt.Format("20060102") {
+		return "AuthorizationHeaderMalformed"
+	}
+	if now.Sub(signedAt) > maxClockSkew || signedAt.Sub(now) > maxClockSkew {
+		return "RequestTimeTooSkewed"
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		return "InvalidRequest"
+	}
+	if payloadHash != unsignedPayload && payloadHash != sha256Hex(body) {
+		return "XAmzContentSHA256Mismatch"
+	}
+
+	signedHeaders := strings.Split(fields["SignedHeaders"], ";")
+	if !contains(signedHeaders, "host") || !contains(signedHeaders, "x-amz-date") {
+		return "AccessDenied"
+	}
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		canonicalQuery(r.URL.Query()),
+		headers.String(),
+		fields["SignedHeaders"],
+		payloadHash,
+	}, "\n")
+	scope := strings.Join(credential[1:], "/")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), credential[1])
+	key = hmacSHA256(key, credential[2])
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	want := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(fields["Signature"]), []byte(want)) {
+		return "SignatureDoesNotMatch"
+	}
+	return ""
+}
+
+// canonicalQuery sorts the query parameters by name and value and encodes
+// them as Signature Version 4 does
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, fmt.Sprintf("%s=%s", uriEncode(name), uriEncode(value)))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func uriEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
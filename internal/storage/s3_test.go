@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"todo/internal/storage/fakes3"
+)
+
+func newTestS3Store(t *testing.T, endpoint, secretKey string) *S3Store {
+	t.Helper()
+	store, err := NewS3Store(S3Config{Endpoint: endpoint, Bucket: "attachments", AccessKey: "test", SecretKey: secretKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestS3Store(t *testing.T) {
+	server := httptest.NewServer(fakes3.New("test", "secret"))
+	defer server.Close()
+	store := newTestS3Store(t, server.URL, "secret")
+	ctx := context.Background()
+
+	const content = "When I grow up, I want to be a watermelon"
+	const key = "todos/1/report file.txt"
+	if err := store.Put(ctx, key, strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+
+	blob, err := store.Open(ctx, key)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		t.Fatalf("reading blob: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("blob = %q, want %q", data, content)
+	}
+
+	// Seeking reads the rest with a ranged GET
+	if _, err := blob.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatalf("Seek() error: %v", err)
+	}
+	data, err = io.ReadAll(blob)
+	if err != nil {
+		t.Fatalf("reading blob: %v", err)
+	}
+	if want := content[len(content)-10:]; string(data) != want {
+		t.Errorf("blob from offset = %q, want %q", data, want)
+	}
+	blob.Close()
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if _, err := store.Open(ctx, key); err != ErrNotFound {
+		t.Errorf("Open() after Delete() error = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete() of a missing blob error: %v", err)
+	}
+}
+
+func TestS3StoreRejectedSignature(t *testing.T) {
+	server := httptest.NewServer(fakes3.New("test", "secret"))
+	defer server.Close()
+	store := newTestS3Store(t, server.URL, "wrong")
+
+	err := store.Put(context.Background(), "todos/1/a.txt", strings.NewReader("a"), 1, "text/plain")
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put() error = %v, want SignatureDoesNotMatch", err)
+	}
+}
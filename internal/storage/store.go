@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// Blob is an open blob. Seeking lets downloads serve byte ranges without
+// reading the whole blob.
+type Blob interface {
+	io.ReadSeekCloser
+}
+
+// BlobStore stores opaque blobs by key
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any existing blob
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns the blob stored under key, or ErrNotFound
+	Open(ctx context.Context, key string) (Blob, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewFromEnv returns the blob store selected by BLOB_STORE: "local" (the
+// default) stores blobs under BLOB_DIR, "s3" uses an S3-compatible service
+// configured by the S3_* variables.
+func NewFromEnv() (BlobStore, error) {
+	switch os.Getenv("BLOB_STORE") {
+	case "", "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "data/blobs"
+		}
+		return NewLocalStore(dir)
+	case "s3":
+		return NewS3StoreFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q: must be local or s3", os.Getenv("BLOB_STORE"))
+	}
+}
@@ -0,0 +1,177 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Urgency of a push message (RFC 8030, section 5.3)
+const (
+	UrgencyVeryLow = "very-low"
+	UrgencyLow     = "low"
+	UrgencyNormal  = "normal"
+	UrgencyHigh    = "high"
+)
+
+// Subscription is where and how to reach a browser, as given by the
+// PushSubscription of the Push API. Keys are URL-safe base64.
+type Subscription struct {
+	Endpoint string
+	P256dh   string
+	Auth     string
+}
+
+// Options of a push message. TTL is how long the push service keeps the
+// message for an offline browser; Topic replaces an undelivered message with
+// the same topic.
+type Options struct {
+	TTL     time.Duration
+	Urgency string
+	Topic   string
+}
+
+// StatusError is a push service's rejection of a message
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("push service returned %d: %s", e.StatusCode, e.Body)
+}
+
+// IsGone tells whether the subscription no longer exists and should be
+// forgotten
+func IsGone(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && (status.StatusCode == http.StatusNotFound || status.StatusCode == http.StatusGone)
+}
+
+// IsPermanent tells whether sending the message again is pointless: the push
+// service rejected it, rather than being unavailable or rate limiting
+func IsPermanent(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && status.StatusCode >= 400 && status.StatusCode < 500 &&
+		status.StatusCode != http.StatusTooManyRequests && status.StatusCode != http.StatusRequestTimeout
+}
+
+// Client sends push messages (RFC 8030) signed with VAPID
+type Client struct {
+	keys    *VAPIDKeys
+	subject string // a mailto: or https: contact for the push service
+	http    *http.Client
+}
+
+func NewClient(keys *VAPIDKeys, subject string) *Client {
+	return &Client{
+		keys:    keys,
+		subject: subject,
+		http: &http.Client{
+			Timeout: 30 * time.Second,
+			// No proxy is used, so that the addresses dialed are those of
+			// the push services, see SetDialer
+			Transport: &http.Transport{
+				DialContext:         (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+				TLSHandshakeTimeout: 30 * time.Second,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// Push services accept messages at the endpoint itself; a
+			// redirect is answered as a failed push, not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// SetDialer makes the client open its connections with dial. Endpoints come
+// from browsers, so servers use it to refuse connections to the local machine
+// and private networks.
+func (c *Client) SetDialer(dial func(ctx context.Context, network, address string) (net.Conn, error)) {
+	c.http.Transport.(*http.Transport).DialContext = dial
+}
+
+// NewClientFromEnv configures the client from VAPID_PRIVATE_KEY and
+// VAPID_SUBJECT. Without a private key it uses a new key pair, which is fine
+// for development but invalidates every subscription on restart.
+func NewClientFromEnv() (*Client, error) {
+	subject := os.Getenv("VAPID_SUBJECT")
+	if subject == "" {
+		subject = "mailto:admin@localhost"
+	}
+	if private := os.Getenv("VAPID_PRIVATE_KEY"); private != "" {
+		keys, err := ParseVAPIDKeys(private)
+		if err != nil {
+			return nil, err
+		}
+		return NewClient(keys, subject), nil
+	}
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		return nil, err
+	}
+	log.Println("VAPID_PRIVATE_KEY is not set: using a temporary key pair, push subscriptions will not survive a restart")
+	return NewClient(keys, subject), nil
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with
+func (c *Client) PublicKey() string {
+	return c.keys.PublicKey()
+}
+
+// Send encrypts a payload for a subscription and hands it to its push
+// service. A nil error means the push service accepted the message, not that
+// the browser received it.
+func (c *Client) Send(ctx context.Context, sub Subscription, payload []byte, opts Options) error {
+	p256dh, err := decodeBase64(sub.P256dh)
+	if err != nil {
+		return fmt.Errorf("invalid p256dh key: %v", err)
+	}
+	auth, err := decodeBase64(sub.Auth)
+	if err != nil {
+		return fmt.Errorf("invalid auth secret: %v", err)
+	}
+	body, err := Encrypt(payload, p256dh, auth)
+	if err != nil {
+		return err
+	}
+	authorization, err := c.keys.authorization(sub.Endpoint, c.subject, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(opts.TTL/time.Second)))
+	if opts.Urgency != "" {
+		req.Header.Set("Urgency", opts.Urgency)
+	}
+	if opts.Topic != "" {
+		req.Header.Set("Topic", opts.Topic)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("error reaching push service: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &StatusError{StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(message))}
+}
@@ -0,0 +1,135 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// MaxPayloadSize is the largest payload that fits in the 4096 bytes push
+// services accept, once encrypted as a single record
+const MaxPayloadSize = 4096 - headerSize - tagSize - 1
+
+const (
+	recordSize = 4096
+	saltSize   = 16
+	keySize    = 65 // uncompressed P-256 point
+	authSize   = 16
+	tagSize    = 16
+	headerSize = saltSize + 4 + 1 + keySize
+)
+
+// Encrypt encrypts a payload for a subscription as RFC 8291 describes, with
+// the aes128gcm content coding of RFC 8188: a single record, keyed by an
+// ECDH agreement between a new key pair and the subscription's p256dh key
+// and by its auth secret
+func Encrypt(payload, p256dh, auth []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, fmt.Errorf("payload too large: %d bytes, at most %d", len(payload), MaxPayloadSize)
+	}
+	if len(auth) != authSize {
+		return nil, fmt.Errorf("invalid auth secret: must be %d bytes", authSize)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %v", err)
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	secret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	gcm, nonce, err := contentKeys(secret, auth, salt, p256dh, asPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	body.Write(salt)
+	binary.Write(&body, binary.BigEndian, uint32(recordSize))
+	body.WriteByte(keySize)
+	body.Write(asPublic)
+	// 0x02 marks the last record; no further padding
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	body.Write(gcm.Seal(nil, nonce, plaintext, nil))
+	return body.Bytes(), nil
+}
+
+// Decrypt reverses Encrypt with the private key of the subscription, as the
+// browser does
+func Decrypt(body []byte, uaPrivate *ecdh.PrivateKey, auth []byte) ([]byte, error) {
+	if len(body) < headerSize+tagSize+1 {
+		return nil, fmt.Errorf("invalid body: too short")
+	}
+	salt := body[:saltSize]
+	if idLen := body[saltSize+4]; idLen != keySize {
+		return nil, fmt.Errorf("invalid body: key ID must be a %d-byte key", keySize)
+	}
+	asPublicBytes := body[saltSize+5 : headerSize]
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body: %v", err)
+	}
+	secret, err := uaPrivate.ECDH(asPublic)
+	if err != nil {
+		return nil, err
+	}
+	gcm, nonce, err := contentKeys(secret, auth, salt, uaPrivate.PublicKey().Bytes(), asPublicBytes)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, body[headerSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body: %v", err)
+	}
+	// Strip the padding: zeros after the 0x02 delimiter of the last record
+	end := bytes.LastIndexByte(plaintext, 0x02)
+	if end < 0 || len(bytes.Trim(plaintext[end+1:], "\x00")) != 0 {
+		return nil, fmt.Errorf("invalid body: missing record delimiter")
+	}
+	return plaintext[:end], nil
+}
+
+// contentKeys derives the AES-GCM cipher and nonce of the single record
+func contentKeys(secret, auth, salt, uaPublic, asPublic []byte) (cipher.AEAD, []byte, error) {
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublic...), asPublic...)
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, auth, keyInfo), ikm); err != nil {
+		return nil, nil, err
+	}
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gcm, nonce, nil
+}
@@ -0,0 +1,156 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+)
+
+// The example of RFC 8291, section 5 and appendix A
+const (
+	rfc8291Plaintext = "When I grow up, I want to be a watermelon"
+	rfc8291ASPrivate = "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"
+	rfc8291UAPrivate = "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"
+	rfc8291UAPublic  = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+	rfc8291Auth      = "BTBZMqHH6r4Tts7J_aSIgg"
+	rfc8291Salt      = "DGv6ra1nlYgDCS1FRnbzlw"
+	rfc8291Nonce     = "4h_95klXJ5E_qnoN"
+	rfc8291Body      = "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+)
+
+func mustDecodeBase64(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := decodeBase64(s)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", s, err)
+	}
+	return b
+}
+
+func mustPrivateKey(t *testing.T, s string) *ecdh.PrivateKey {
+	t.Helper()
+	key, err := ecdh.P256().NewPrivateKey(mustDecodeBase64(t, s))
+	if err != nil {
+		t.Fatalf("parsing private key: %v", err)
+	}
+	return key
+}
+
+func TestContentKeysRFC8291(t *testing.T) {
+	asPrivate := mustPrivateKey(t, rfc8291ASPrivate)
+	uaPrivate := mustPrivateKey(t, rfc8291UAPrivate)
+	uaPublic := mustDecodeBase64(t, rfc8291UAPublic)
+	if !bytes.Equal(uaPrivate.PublicKey().Bytes(), uaPublic) {
+		t.Fatal("user agent public key does not match its private key")
+	}
+
+	secret, err := asPrivate.ECDH(uaPrivate.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, nonce, err := contentKeys(secret, mustDecodeBase64(t, rfc8291Auth), mustDecodeBase64(t, rfc8291Salt),
+		uaPublic, asPrivate.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustDecodeBase64(t, rfc8291Nonce); !bytes.Equal(nonce, want) {
+		t.Errorf("nonce = %x, want %x", nonce, want)
+	}
+
+	// With the example's key pair and salt, the record is the example's
+	body := mustDecodeBase64(t, rfc8291Body)
+	record := gcm.Seal(nil, nonce, append([]byte(rfc8291Plaintext), 0x02), nil)
+	if !bytes.Equal(record, body[headerSize:]) {
+		t.Errorf("record = %x, want %x", record, body[headerSize:])
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	uaPrivate := mustPrivateKey(t, rfc8291UAPrivate)
+	auth := mustDecodeBase64(t, rfc8291Auth)
+	body := mustDecodeBase64(t, rfc8291Body)
+
+	tampered := append([]byte{}, body...)
+	tampered[len(tampered)-1] ^= 1
+	wrongAuth := append([]byte{}, auth...)
+	wrongAuth[0] ^= 1
+
+	tests := []struct {
+		name    string
+		body    []byte
+		auth    []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "RFC 8291 example", body: body, auth: auth, want: rfc8291Plaintext},
+		{name: "tampered record", body: tampered, auth: auth, wantErr: true},
+		{name: "wrong auth secret", body: body, auth: wrongAuth, wantErr: true},
+		{name: "truncated", body: body[:headerSize+tagSize], auth: auth, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plaintext, err := Decrypt(test.body, uaPrivate, test.auth)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Decrypt() = %q, want an error", plaintext)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decrypt() error: %v", err)
+			}
+			if string(plaintext) != test.want {
+				t.Errorf("Decrypt() = %q, want %q", plaintext, test.want)
+			}
+		})
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	uaPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, authSize)
+	rand.Read(auth)
+
+	tests := []struct {
+		name    string
+		payload []byte
+		p256dh  []byte
+		auth    []byte
+		wantErr bool
+	}{
+		{name: "empty", payload: []byte{}, p256dh: uaPrivate.PublicKey().Bytes(), auth: auth},
+		{name: "text", payload: []byte(rfc8291Plaintext), p256dh: uaPrivate.PublicKey().Bytes(), auth: auth},
+		{name: "largest", payload: bytes.Repeat([]byte("x"), MaxPayloadSize), p256dh: uaPrivate.PublicKey().Bytes(), auth: auth},
+		{name: "too large", payload: bytes.Repeat([]byte("x"), MaxPayloadSize+1), p256dh: uaPrivate.PublicKey().Bytes(), auth: auth, wantErr: true},
+		{name: "short auth", payload: []byte("x"), p256dh: uaPrivate.PublicKey().Bytes(), auth: auth[:8], wantErr: true},
+		{name: "invalid key", payload: []byte("x"), p256dh: make([]byte, keySize), auth: auth, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := Encrypt(test.payload, test.p256dh, test.auth)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("Encrypt() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Encrypt() error: %v", err)
+			}
+			if len(body) > recordSize {
+				t.Errorf("body is %d bytes, more than a %d-byte record", len(body), recordSize)
+			}
+			plaintext, err := Decrypt(body, uaPrivate, test.auth)
+			if err != nil {
+				t.Fatalf("Decrypt() error: %v", err)
+			}
+			if !bytes.Equal(plaintext, test.payload) {
+				t.Errorf("Decrypt() = %q, want %q", plaintext, test.payload)
+			}
+		})
+	}
+}
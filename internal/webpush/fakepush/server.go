@@ -0,0 +1,295 @@
+// Package fakepush is an in-process stand-in for a push service and the
+// browsers subscribed to it, for local testing. It hands out subscriptions
+// with keys of their own, checks the VAPID signature of the messages pushed
+// to them, decrypts the messages and keeps them in memory.
+package fakepush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"todo/internal/webpush"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Subscription is what a browser's PushSubscription.toJSON() returns
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// Message is a decrypted message received for a subscription
+type Message struct {
+	Endpoint string    `json:"endpoint"`
+	Payload  string    `json:"payload"`
+	TTL      int       `json:"ttl"`
+	Urgency  string    `json:"urgency,omitempty"`
+	Topic    string    `json:"topic,omitempty"`
+	Received time.Time `json:"received"`
+}
+
+type subscription struct {
+	private   *ecdh.PrivateKey
+	auth      []byte
+	serverKey string // the applicationServerKey it was created with, if any
+	expired   bool
+}
+
+type Server struct {
+	listener net.Listener
+	url      string
+
+	mu            sync.Mutex
+	subscriptions map[string]*subscription
+	messages      []Message
+	failures      []int // status codes for the next messages, see FailNext
+}
+
+// Start listens on addr, such as "127.0.0.1:0" for a random port, and serves
+// push requests at /push/{id} until Close
+func Start(addr string) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// Endpoints must be reachable, so an unspecified address such as ":8027"
+	// is advertised as localhost
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+	s := &Server{
+		listener:      listener,
+		url:           "http://" + net.JoinHostPort(host, port),
+		subscriptions: make(map[string]*subscription),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /push/{id}", s.push)
+	go http.Serve(listener, mux)
+	return s, nil
+}
+
+// URL returns the base URL of the push service
+func (s *Server) URL() string {
+	return s.url
+}
+
+// Subscribe creates a subscription, as a browser does. With a non-empty
+// applicationServerKey, only messages signed with that VAPID key are accepted.
+func (s *Server) Subscribe(applicationServerKey string) (*Subscription, error) {
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	auth := make([]byte, 16)
+	id := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.subscriptions[hex.EncodeToString(id)] = &subscription{private: private, auth: auth, serverKey: applicationServerKey}
+	s.mu.Unlock()
+
+	sub := &Subscription{Endpoint: s.url + "/push/" + hex.EncodeToString(id)}
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(private.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(auth)
+	return sub, nil
+}
+
+// Expire makes pushes to a subscription fail with 410 Gone, as when the user
+// revokes the permission
+func (s *Server) Expire(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sub, ok := s.subscriptions[strings.TrimPrefix(endpoint, s.url+"/push/")]; ok {
+		sub.expired = true
+	}
+}
+
+// FailNext rejects the next message with an HTTP status, such as 503 for an
+// unavailable push service or 429 for rate limiting
+func (s *Server) FailNext(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, status)
+}
+
+// Messages returns the messages received so far, oldest first
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset forgets the messages received and the failures queued
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+	s.failures = nil
+}
+
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+func (s *Server) push(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	sub, ok := s.subscriptions[r.PathValue("id")]
+	var failure int
+	if ok && !sub.expired && len(s.failures) > 0 {
+		failure, s.failures = s.failures[0], s.failures[1:]
+	}
+	s.mu.Unlock()
+	switch {
+	case !ok:
+		http.Error(w, "no such subscription", http.StatusNotFound)
+		return
+	case sub.expired:
+		http.Error(w, "subscription expired", http.StatusGone)
+		return
+	case failure != 0:
+		http.Error(w, "rejected by fakepush", failure)
+		return
+	}
+
+	if err := s.checkVAPID(r.Header.Get("Authorization"), sub.serverKey); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "aes128gcm" {
+		http.Error(w, "content encoding must be aes128gcm", http.StatusUnsupportedMediaType)
+		return
+	}
+	var ttl int
+	if _, err := fmt.Sscan(r.Header.Get("TTL"), &ttl); err != nil || ttl < 0 {
+		http.Error(w, "missing or invalid TTL", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4097))
+	if err != nil || len(body) > 4096 {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	payload, err := webpush.Decrypt(body, sub.private, sub.auth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, Message{
+		Endpoint: s.url + r.URL.Path,
+		Payload:  string(payload),
+		TTL:      ttl,
+		Urgency:  r.Header.Get("Urgency"),
+		Topic:    r.Header.Get("Topic"),
+		Received: time.Now(),
+	})
+	s.mu.Unlock()
+	w.Header().Set("Location", s.url+r.URL.Path)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// checkVAPID verifies an Authorization header of the form
+// "vapid t=<JWT>, k=<public key>" (RFC 8292)
+func (s *Server) checkVAPID(header, serverKey string) error {
+	params, ok := strings.CutPrefix(header, "vapid ")
+	if !ok {
+		return fmt.Errorf("missing VAPID authorization")
+	}
+	var token, key string
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			key = value
+		}
+	}
+	if serverKey != "" && key != serverKey {
+		return fmt.Errorf("VAPID key does not match the subscription")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+	if err != nil || len(raw) != 65 || raw[0] != 4 {
+		return fmt.Errorf("invalid VAPID key")
+	}
+	public := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(raw[1:33]),
+		Y:     new(big.Int).SetBytes(raw[33:]),
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return public, nil
+	}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience(s.url), jwt.WithExpirationRequired())
+	if err != nil {
+		return fmt.Errorf("invalid VAPID token: %v", err)
+	}
+	exp, _ := claims.GetExpirationTime()
+	if time.Until(exp.Time) > 24*time.Hour {
+		return fmt.Errorf("invalid VAPID token: expires more than 24 hours ahead")
+	}
+	return nil
+}
+
+// ServeControl serves the HTTP API of cmd/fakepush: POST /subscriptions
+// creates a subscription, DELETE /subscriptions expires the one whose
+// endpoint is given in ?endpoint=, GET and DELETE /messages read and clear the
+// messages received
+func (s *Server) ServeControl(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/subscriptions" && r.Method == http.MethodPost:
+		var req struct {
+			ApplicationServerKey string `json:"application_server_key"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+		sub, err := s.Subscribe(req.ApplicationServerKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sub)
+	case r.URL.Path == "/subscriptions" && r.Method == http.MethodDelete:
+		s.Expire(r.URL.Query().Get("endpoint"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/messages" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Messages())
+	case r.URL.Path == "/messages" && r.Method == http.MethodDelete:
+		s.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
@@ -0,0 +1,95 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// vapidExpiry is the lifetime of VAPID tokens; RFC 8292 allows at most 24 hours
+const vapidExpiry = 12 * time.Hour
+
+// VAPIDKeys is the P-256 key pair that identifies the application server to
+// push services (RFC 8292). Browsers are given the public key when they
+// subscribe and push services only accept messages signed with its private key.
+type VAPIDKeys struct {
+	private *ecdsa.PrivateKey
+}
+
+func GenerateVAPIDKeys() (*VAPIDKeys, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &VAPIDKeys{private: private}, nil
+}
+
+// ParseVAPIDKeys reads a private key encoded as by PrivateKey
+func ParseVAPIDKeys(privateKey string) (*VAPIDKeys, error) {
+	d, err := decodeBase64(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %v", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %v", err)
+	}
+	public := key.PublicKey().Bytes() // 0x04 || X || Y
+	private := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}
+	return &VAPIDKeys{private: private}, nil
+}
+
+// PublicKey returns the uncompressed public key in URL-safe base64, the
+// applicationServerKey of the browser Push API
+func (k *VAPIDKeys) PublicKey() string {
+	key, _ := k.private.ECDH()
+	return base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes())
+}
+
+// PrivateKey returns the private scalar in URL-safe base64
+func (k *VAPIDKeys) PrivateKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.private.D.FillBytes(make([]byte, 32)))
+}
+
+// authorization returns the Authorization header of a push to endpoint: a
+// JWT for the push service's origin signed with ES256, and the public key
+func (k *VAPIDKeys) authorization(endpoint, subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid endpoint %q", endpoint)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(vapidExpiry).Unix(),
+		"sub": subject,
+	})
+	signed, err := token.SignedString(k.private)
+	if err != nil {
+		return "", fmt.Errorf("error signing VAPID token: %v", err)
+	}
+	return "vapid t=" + signed + ", k=" + k.PublicKey(), nil
+}
+
+// decodeBase64 reads URL-safe base64, as used by the Push API, with or
+// without padding
+func decodeBase64(s string) ([]byte, error) {
+	for len(s)%4 != 0 {
+		s += "="
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
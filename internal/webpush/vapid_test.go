@@ -0,0 +1,112 @@
+package webpush
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseVAPIDKeys(t *testing.T) {
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseVAPIDKeys(keys.PrivateKey())
+	if err != nil {
+		t.Fatalf("ParseVAPIDKeys() error: %v", err)
+	}
+	if parsed.PublicKey() != keys.PublicKey() {
+		t.Errorf("public key = %s, want %s", parsed.PublicKey(), keys.PublicKey())
+	}
+
+	for _, invalid := range []string{"", "not base64!", "AAAA", strings.Repeat("A", 43)} {
+		if _, err := ParseVAPIDKeys(invalid); err == nil {
+			t.Errorf("ParseVAPIDKeys(%q) succeeded, want an error", invalid)
+		}
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	// The application server key of the RFC 8291 example
+	keys, err := ParseVAPIDKeys(rfc8291ASPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, time.March, 4, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		endpoint string
+		audience string
+		wantErr  bool
+	}{
+		{endpoint: "https://push.example.net/push/JzLQ3raZJfFBR0aqvOMsLrt54w4rJUsV", audience: "https://push.example.net"},
+		{endpoint: "https://push.example.net:8443/wpush/v2/abc?x=1", audience: "https://push.example.net:8443"},
+		{endpoint: "http://localhost:8026/push/1", audience: "http://localhost:8026"},
+		{endpoint: "/push/1", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.endpoint, func(t *testing.T) {
+			header, err := keys.authorization(test.endpoint, "mailto:admin@example.com", now)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("authorization() = %q, want an error", header)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("authorization() error: %v", err)
+			}
+
+			// vapid t=<JWT>, k=<public key>
+			rest, ok := strings.CutPrefix(header, "vapid t=")
+			token, public, found := strings.Cut(rest, ", k=")
+			if !ok || !found {
+				t.Fatalf("header = %q, want vapid t=..., k=...", header)
+			}
+			if public != keys.PublicKey() {
+				t.Errorf("k = %s, want %s", public, keys.PublicKey())
+			}
+
+			// The token verifies with the key sent along, as push services
+			// check it
+			point := mustDecodeBase64(t, public)
+			verifyKey := &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(point[1:33]),
+				Y:     new(big.Int).SetBytes(point[33:]),
+			}
+			claims := jwt.MapClaims{}
+			_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) { return verifyKey, nil },
+				jwt.WithValidMethods([]string{"ES256"}), jwt.WithTimeFunc(func() time.Time { return now }))
+			if err != nil {
+				t.Fatalf("verifying token: %v", err)
+			}
+			if claims["aud"] != test.audience {
+				t.Errorf("aud = %v, want %s", claims["aud"], test.audience)
+			}
+			if claims["sub"] != "mailto:admin@example.com" {
+				t.Errorf("sub = %v, want mailto:admin@example.com", claims["sub"])
+			}
+			exp, err := claims.GetExpirationTime()
+			if err != nil || !exp.Time.Equal(now.Add(vapidExpiry)) {
+				t.Errorf("exp = %v, want %v", exp, now.Add(vapidExpiry))
+			}
+
+			// Another key does not verify it
+			other, err := GenerateVAPIDKeys()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return &other.private.PublicKey, nil },
+				jwt.WithTimeFunc(func() time.Time { return now }))
+			if err == nil {
+				t.Error("token verifies with another key")
+			}
+		})
+	}
+}